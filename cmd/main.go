@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"log/slog"
 	"os"
@@ -12,6 +13,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/config"
 	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/ddns"
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/iputil"
 	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/metrics"
 	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/monitor"
 )
@@ -24,7 +26,13 @@ func main() {
 }
 
 func run() (err error) {
-	cfg := config.ParseFlags(os.Args[1:])
+	cfg, err := config.ParseFlags(os.Args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return fmt.Errorf("failed to parse configuration: %w", err)
+	}
 
 	if err := cfg.Validate(); err != nil {
 		return fmt.Errorf("invalid configuration: %w", err)
@@ -41,13 +49,20 @@ func run() (err error) {
 		return fmt.Errorf("failed to create metrics: %w", err)
 	}
 
-	ddnsUpdater, err := runDDNSUpdater(ctx, cfg, promMetrics)
+	// React to network changes immediately. Without events, the monitor and DDNS updater only poll for them.
+	events := iputil.NewEventSource()
+	if err := events.Start(ctx); err != nil {
+		slog.Warn("Failed to subscribe to netlink events, only polling for network changes", "error", err)
+		events = nil
+	}
+
+	ddnsUpdater, err := runDDNSUpdater(ctx, cfg, promMetrics, events)
 	if err != nil {
 		return fmt.Errorf("failed to start DDNS updater: %w", err)
 	}
 
 	// Start the gateway
-	gatewayMonitor, err := monitor.New(cfg, promMetrics, ddnsUpdater)
+	gatewayMonitor, err := monitor.New(cfg, promMetrics, ddnsUpdater, events)
 	if err != nil {
 		return fmt.Errorf("failed to create gateway monitor: %w", err)
 	}
@@ -62,8 +77,13 @@ func run() (err error) {
 
 	slog.Info("Starting gateway monitor", "check_period", cfg.CheckPeriod, "timeout", cfg.Timeout)
 
-	// Start metrics server
-	if err := metrics.StartMetricsServer(ctx, cancel, cfg.MetricsPort); err != nil && !errors.Is(err, context.Canceled) {
+	// Start metrics server. In dry run mode, it also reports the planned changes.
+	var endpoints []metrics.Endpoint
+	if plannedChanges := gatewayMonitor.PlannedChanges(); plannedChanges != nil {
+		endpoints = append(endpoints, metrics.Endpoint{Path: "/dry-run", Handler: plannedChanges})
+	}
+
+	if err := metrics.StartMetricsServer(ctx, cancel, cfg.MetricsPort, endpoints...); err != nil && !errors.Is(err, context.Canceled) {
 		return fmt.Errorf("failed to start metrics server: %w", err)
 	}
 
@@ -76,8 +96,8 @@ func run() (err error) {
 }
 
 // Runs the DDNS updater in a goroutine and handles cleanup
-func runDDNSUpdater(ctx context.Context, cfg config.Config, metrics *metrics.Metrics) (*ddns.Updater, error) {
-	ddnsUpdater, err := ddns.NewUpdater(cfg, metrics)
+func runDDNSUpdater(ctx context.Context, cfg config.Config, metrics *metrics.Metrics, events *iputil.EventSource) (*ddns.Updater, error) {
+	ddnsUpdater, err := ddns.NewUpdater(cfg, metrics, events)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create DDNS updater: %w", err)
 	}
@@ -1,11 +1,18 @@
 package config
 
 import (
+	"cmp"
+	"encoding/base64"
 	"flag"
 	"fmt"
 	"log/slog"
+	"math"
 	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -32,7 +39,77 @@ var reservedCIDRs = []string{
 	"224.0.0.0/3",     // Multicast + MCAST-TEST-NET + Reserved for future use + Broadcast
 }
 
-var ddnsProviders = []string{"dynudns"}
+// See https://en.wikipedia.org/wiki/Reserved_IP_addresses#IPv6 for a full list
+var reservedIPv6CIDRs = []string{
+	"::/128",         // Unspecified address
+	"::1/128",        // Loopback
+	"64:ff9b:1::/48", // Local-use IPv4/IPv6 translation
+	"100::/64",       // Discard prefix
+	"2001::/23",      // IETF Protocol Assignments
+	"2001:db8::/32",  // Documentation
+	"2002::/16",      // 6to4
+	"3fff::/20",      // Documentation
+	"5f00::/16",      // Segment Routing (SRv6) SIDs
+	"fc00::/7",       // Unique local addresses
+	"fe80::/10",      // Link-local
+	"ff00::/8",       // Multicast
+}
+
+const (
+	IPFamilyIPv4 = "ipv4"
+	IPFamilyIPv6 = "ipv6"
+	IPFamilyDual = "dual"
+)
+
+var ipFamilies = []string{IPFamilyIPv4, IPFamilyIPv6, IPFamilyDual}
+
+var ddnsProviders = []string{"dynudns", "cloudflare", "rfc2136", "route53", "webhook", "dyndns2"}
+
+// ddnsTokenProviders authenticate with an API token in ddns-password, and do not need a username
+var ddnsTokenProviders = []string{"dynudns", "cloudflare"}
+
+// ddnsOptionalCredentialProviders pass ddns-username and ddns-password on where configured, and need neither
+var ddnsOptionalCredentialProviders = []string{"webhook"}
+
+var tsigAlgorithms = []string{"hmac-sha256", "hmac-sha512"}
+
+var route53RoutingPolicies = []string{"simple", "multivalue", "weighted"}
+
+const (
+	CheckTypeHTTP = "http"
+	CheckTypeTCP  = "tcp"
+	CheckTypeICMP = "icmp"
+	CheckTypeDNS  = "dns"
+	CheckTypeGRPC = "grpc"
+)
+
+var checkTypes = []string{CheckTypeHTTP, CheckTypeTCP, CheckTypeICMP, CheckTypeDNS, CheckTypeGRPC}
+
+// DefaultDNSPort is the port that DNS health checks query by default
+const DefaultDNSPort = 53
+
+// Initial state policies, which control the state of gateways before their health has been established
+const (
+	InitialStateFirstCheck = "first-check" // The first health check result is applied immediately, ignoring rise/fall
+	InitialStateDown       = "down"        // Gateways start inactive and need rise successful checks to become active
+	InitialStateUp         = "up"          // Gateways start active and need fall failed checks to become inactive
+)
+
+var initialStates = []string{InitialStateFirstCheck, InitialStateDown, InitialStateUp}
+
+// Weight modes, which control how the ECMP weight of each gateway is determined
+const (
+	WeightModeStatic  = "static"  // Gateways use their configured weight
+	WeightModeLatency = "latency" // Configured weights are scaled by health check latency, relative to the fastest gateway
+)
+
+var weightModes = []string{WeightModeStatic, WeightModeLatency}
+
+// Maximum ECMP weight of a gateway, limited by the kernel
+const MaxGatewayWeight = 256
+
+// Longest interface name supported by the kernel (IFNAMSIZ without the terminating null)
+const maxInterfaceNameLength = 15
 
 // PublicIPServiceConfig holds configuration for the public IP service
 type PublicIPServiceConfig struct {
@@ -44,93 +121,197 @@ type PublicIPServiceConfig struct {
 	Password string
 }
 
+// GatewayConfig configures an explicit set of gateways to monitor. Health check settings that are unset (zero)
+// inherit the top-level values.
+type GatewayConfig struct {
+	Address         string // Single IP, CIDR, or inclusive range (`start-end`)
+	CheckType       string
+	Port            int
+	Path            string
+	Scheme          string
+	Weight          int      // Relative ECMP weight of each gateway, between 1 and MaxGatewayWeight. Zero is treated as 1.
+	Priority        int      // Priority tier of the gateways. Lower values are preferred, and the default tier is 0.
+	Pools           []string // Named pools that the gateways belong to, in addition to DefaultPool
+	Interface       string   // Interface that the gateways are reached through. Empty lets the kernel resolve it.
+	OnLink          bool     // Use the gateways even though no route on the interface covers them. Requires Interface.
+	PreferredSource net.IP   // Source address hint for locally generated traffic routed via the gateways
+}
+
+// ParseGatewayConfig parses a gateway entry of the form
+// `address[,type=http|tcp|icmp|dns|grpc][,port=N][,path=/p][,scheme=http|https][,weight=N][,priority=N][,pool=name]...
+// [,dev=name][,onlink=true|false][,src=ip]`
+func ParseGatewayConfig(s string) (GatewayConfig, error) {
+	parts := strings.Split(s, ",")
+
+	gateway := GatewayConfig{
+		Address: strings.TrimSpace(parts[0]),
+	}
+	if gateway.Address == "" {
+		return GatewayConfig{}, fmt.Errorf("gateway address is required")
+	}
+
+	for _, part := range parts[1:] {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return GatewayConfig{}, fmt.Errorf("invalid gateway option %q (expected key=value)", part)
+		}
+
+		switch key {
+		case "type":
+			gateway.CheckType = value
+		case "port":
+			port, err := strconv.Atoi(value)
+			if err != nil {
+				return GatewayConfig{}, fmt.Errorf("invalid gateway port %q: %w", value, err)
+			}
+			gateway.Port = port
+		case "path":
+			gateway.Path = value
+		case "scheme":
+			gateway.Scheme = value
+		case "weight":
+			weight, err := strconv.Atoi(value)
+			if err != nil {
+				return GatewayConfig{}, fmt.Errorf("invalid gateway weight %q: %w", value, err)
+			}
+			gateway.Weight = weight
+		case "priority":
+			priority, err := strconv.Atoi(value)
+			if err != nil {
+				return GatewayConfig{}, fmt.Errorf("invalid gateway priority %q: %w", value, err)
+			}
+			gateway.Priority = priority
+		case "pool":
+			gateway.Pools = append(gateway.Pools, value)
+		case "dev":
+			gateway.Interface = value
+		case "onlink":
+			onLink, err := strconv.ParseBool(value)
+			if err != nil {
+				return GatewayConfig{}, fmt.Errorf("invalid gateway onlink flag %q: %w", value, err)
+			}
+			gateway.OnLink = onLink
+		case "src":
+			source := net.ParseIP(value)
+			if source == nil {
+				return GatewayConfig{}, fmt.Errorf("invalid gateway preferred source %q", value)
+			}
+			gateway.PreferredSource = source
+		default:
+			return GatewayConfig{}, fmt.Errorf("unknown gateway option %q (must be one of: type, port, path, scheme, weight, priority, pool, dev, onlink, src)", key)
+		}
+	}
+
+	return gateway, nil
+}
+
 // Config holds all configuration options for the gateway route manager
 type Config struct {
+	ConfigFile          string
 	StartIP             string
 	EndIP               string
+	Gateways            []GatewayConfig
 	Timeout             time.Duration
 	CheckPeriod         time.Duration
+	CheckType           string
 	Port                int
 	URLPath             string
 	Scheme              string
+	HTTPCheck           HTTPCheckConfig
+	DNSQueryName        string
+	DNSPort             int // Port that DNS health checks query, unless the gateway entry sets a port. Zero is treated as DefaultDNSPort.
+	GRPCService         string
+	Rise                int    // Consecutive successful checks required to mark an inactive gateway as active. Zero is treated as 1.
+	Fall                int    // Consecutive failed checks required to mark an active gateway as inactive. Zero is treated as 1.
+	InitialState        string // One of the InitialState* values. Empty is treated as InitialStateFirstCheck.
+	FlapDamping         FlapDampingConfig
+	WeightMode          string // One of the WeightMode* values. Empty is treated as WeightModeStatic.
+	MinTierGateways     int    // Active gateways required to use a priority tier before failing over to the next. Zero is treated as 1.
 	LogLevel            string
 	MetricsPort         int
+	IPFamily            string
 	CIDRsToExclude      []*net.IPNet
 	FirstRoutingTableID int
 	FirstRulePreference int
-	Routes              []*net.IPNet
+	Routes              []RouteConfig
+	Pools               []PoolConfig
+	SourceCIDRs         []*net.IPNet // Only traffic from these sources, or with these marks, uses the gateways. All traffic does when both are empty.
+	FWMarks             []FWMark
+	BypassFWMarks       []FWMark // Traffic with these marks skips the gateways
+	NFTables            NFTablesConfig
+	ConntrackFlush      bool // Delete the conntrack entries of connections via gateways that are removed from the routes
+	NoGateway           NoGatewayConfig
+	ReconcilePeriod     time.Duration // How often the kernel rules and routes are compared with the desired state. Zero disables periodic reconciliation.
+	NexthopGroups       bool          // Route via kernel nexthop groups instead of multipath routes
+	NexthopGroupBuckets int           // Number of buckets of resilient nexthop groups. Zero uses plain nexthop groups.
+	DryRun              bool          // Record and report rule, route and DDNS changes instead of applying them
 	// DDNS configuration
-	DDNSProvider         string
-	DDNSUsername         string
-	DDNSPassword         string
-	DDNSHostname         string
-	DDNSRequireIPAddress string
-	DDNSTimeout          time.Duration
-	DDNSTTL              time.Duration
+	DDNSProvider             string
+	DDNSUsername             string
+	DDNSPassword             string
+	DDNSHostname             string
+	DDNSRequireIPAddress     string
+	DDNSTimeout              time.Duration
+	DDNSTTL                  time.Duration
+	DDNSRecordComment        string            // Comment that created and updated records are tagged with, where the provider supports it
+	DDNSCloudflareProxied    bool              // Send traffic to the Cloudflare records through the Cloudflare proxy
+	DDNSServer               string            // Server that updates are sent to, for providers without a fixed server
+	DDNSZone                 string            // Zone of the hostname. Looked up by the provider when empty.
+	DDNSTSIGAlgorithm        string            // Algorithm of the TSIG key that RFC 2136 updates are signed with
+	DDNSRoute53RoutingPolicy string            // Routing policy of the Route 53 record sets
+	DDNSRoute53HealthChecks  map[string]string // Route 53 health check ID of each public IP address
+	DDNSWebhook              DDNSWebhookConfig // Request templates and success criterion of the webhook provider
+	DDNSDynDNS2MultipleIPs   bool              // Send all IP addresses in dyndns2 updates, instead of one per IP family
 	// Public IP service configuration
 	PublicIPService PublicIPServiceConfig
+
+	// Command line arguments that the config was parsed from, used for reloading
+	args []string
 }
 
-// ParseFlags parses command line flags and returns a Config struct
-func ParseFlags(args []string) Config {
-	var config Config
+// parseState holds values that are parsed from flags or the configuration file, but require post-processing
+// before they are stored in the Config
+type parseState struct {
+	cidrsToExclude       []*net.IPNet
+	defaultRoute         bool
+	defaultRoutePool     string
+	excludeReservedCIDRs bool
+}
 
-	var cidrsToExclude []*net.IPNet
-
-	flag.StringVar(&config.StartIP, "start-ip", "", "Starting IP address for the range")
-	flag.StringVar(&config.EndIP, "end-ip", "", "Ending IP address for the range")
-	flag.DurationVar(&config.Timeout, "timeout", 1*time.Second, "Timeout for health checks")
-	flag.DurationVar(&config.CheckPeriod, "check-period", 3*time.Second, "How often to check gateways")
-	flag.IntVar(&config.Port, "port", 9999, "Port to target for health checks")
-	flag.StringVar(&config.URLPath, "path", "/", "URL path for health checks")
-	flag.StringVar(&config.Scheme, "scheme", "http", "Scheme to use (http or https)")
-	flag.StringVar(&config.LogLevel, "log-level", "info", "Log level (debug, info, warn, error)")
-	flag.IntVar(&config.MetricsPort, "metrics-port", 9090, "Port for Prometheus metrics endpoint")
-	flag.IntVar(&config.FirstRoutingTableID, "first-routing-table-id", 180, "First routing table ID to use for gateway route logic")
-	flag.IntVar(&config.FirstRulePreference, "first-rule-preference", 10888, "First rule preference to use for gateway route logic")
-	flag.Func("route", "Routes to manage in CIDR notation or 'default'", func(s string) error {
-		if s == "default" {
-			s = "0.0.0.0/0"
-		}
-
-		_, destination, err := net.ParseCIDR(s)
-		if err != nil {
-			return fmt.Errorf("invalid route: %w", err)
-		}
+// ParseFlags parses command line flags and returns a Config struct. If a configuration file is specified, it is
+// loaded first, and any explicitly set flags take precedence over the values in the file.
+func ParseFlags(args []string) (Config, error) {
+	return parseFlags(args, "")
+}
 
-		config.Routes = append(config.Routes, destination)
-		return nil
-	})
+// parseFlags parses command line flags and the configuration file. If ipFamily is set, the reserved networks and
+// default routes are derived for it instead of the parsed IP family.
+func parseFlags(args []string, ipFamily string) (Config, error) {
+	var config Config
+	var state parseState
 
-	// DDNS configuration flags
-	flag.StringVar(&config.DDNSProvider, "ddns-provider", "", fmt.Sprintf("DDNS provider (currently supports: %s)", strings.Join(ddnsProviders, ", ")))
-	flag.StringVar(&config.DDNSUsername, "ddns-username", "", "DDNS username (required for some providers)")
-	flag.StringVar(&config.DDNSPassword, "ddns-password", "", "DDNS password or API key (required if DDNS provider is specified, defaults to DDNS_PASSWORD)")
-	flag.StringVar(&config.DDNSHostname, "ddns-hostname", "", "DDNS hostname to update (required if DDNS provider is specified)")
-	flag.StringVar(&config.DDNSRequireIPAddress, "ddns-require-ip-address", "", "IPv4 address that must be assigned to an interface for DDNS updates to be performed")
-	flag.DurationVar(&config.DDNSTimeout, "ddns-timeout", time.Minute, "Timeout for DDNS updates")
-	flag.DurationVar(&config.DDNSTTL, "ddns-record-ttl", time.Minute, "TTL for managed DDNS records")
+	fs := newFlagSet(&config, &state)
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
 
-	// Public IP service configuration flags
-	flag.StringVar(&config.PublicIPService.Hostname, "public-ip-service-hostname", "", "Hostname for public IP service (if unset, queries each gateway)")
-	flag.IntVar(&config.PublicIPService.Port, "public-ip-service-port", 443, "Port for gateway's public IP service to fetch its public IP addresses")
-	flag.StringVar(&config.PublicIPService.Scheme, "public-ip-service-scheme", "https", "Scheme for public IP service (http or https)")
-	flag.StringVar(&config.PublicIPService.Path, "public-ip-service-path", "/", "URL path for public IP service")
-	flag.StringVar(&config.PublicIPService.Username, "public-ip-service-username", "", "Username for public IP service HTTP basic auth")
-	flag.StringVar(&config.PublicIPService.Password, "public-ip-service-password", "", "Password for public IP service HTTP basic auth (defaults to PUBLIC_IP_SERVICE_PASSWORD)")
-
-	flag.Func("exclude-cidr", "CIDR to exclude from gateway routing (can be specified multiple times)", func(s string) error {
-		_, cidr, err := net.ParseCIDR(s)
-		if err != nil {
-			return fmt.Errorf("invalid CIDR: %w", err)
+	if config.ConfigFile != "" {
+		// Start over from the defaults, apply the file, then apply the flags again so that they take precedence
+		configFile := config.ConfigFile
+		config, state = Config{}, parseState{}
+
+		fs = newFlagSet(&config, &state)
+		if err := loadConfigFile(configFile, &config, &state); err != nil {
+			return Config{}, fmt.Errorf("failed to load configuration file %s: %w", configFile, err)
 		}
 
-		cidrsToExclude = append(cidrsToExclude, cidr)
-		return nil
-	})
-	excludeReservedDestinations := flag.Bool("exclude-reserved-cidrs", true, "Exclude reserved IPv4 destinations (private networks, lookback, multicast, etc.) from gateway routing")
+		if err := fs.Parse(args); err != nil {
+			return Config{}, err
+		}
+		config.ConfigFile = configFile
+	}
 
-	flag.CommandLine.Parse(args)
+	config.args = args
 
 	// Handle DDNS password fallback to environment variable
 	if config.DDNSPassword == "" && config.DDNSProvider != "" {
@@ -142,8 +323,22 @@ func ParseFlags(args []string) Config {
 		config.PublicIPService.Password = os.Getenv("PUBLIC_IP_SERVICE_PASSWORD")
 	}
 
-	if excludeReservedDestinations != nil && *excludeReservedDestinations {
-		for _, cidrStr := range reservedCIDRs {
+	families := config
+	if ipFamily != "" {
+		families.IPFamily = ipFamily
+	}
+
+	cidrsToExclude := state.cidrsToExclude
+	if state.excludeReservedCIDRs {
+		var reserved []string
+		if families.UsesIPv4() {
+			reserved = append(reserved, reservedCIDRs...)
+		}
+		if families.UsesIPv6() {
+			reserved = append(reserved, reservedIPv6CIDRs...)
+		}
+
+		for _, cidrStr := range reserved {
 			_, cidr, err := net.ParseCIDR(cidrStr)
 			if err != nil {
 				slog.Error("failed to parse reserved CIDR (this is a bug)", "cidr", cidrStr, "error", err)
@@ -155,40 +350,444 @@ func ParseFlags(args []string) Config {
 
 	config.CIDRsToExclude = cidrsToExclude
 
-	if len(config.Routes) == 0 {
-		config.Routes = []*net.IPNet{
-			{
-				IP:   net.IPv4(0, 0, 0, 0),
-				Mask: net.CIDRMask(0, 32),
-			},
+	if state.defaultRoute || len(config.Routes) == 0 {
+		for _, destination := range families.defaultRoutes() {
+			config.Routes = append(config.Routes, RouteConfig{Destination: destination, Pool: state.defaultRoutePool})
 		}
 	}
 
-	return config
+	return config, nil
+}
+
+// Reload parses the configuration again from the original command line arguments and the configuration file.
+// This picks up any changes that have been made to the configuration file. The IP family cannot be changed without a
+// restart, so the reserved networks and default routes are derived for the current IP family. The IP family of the
+// returned config is the parsed one, so that callers can detect a change.
+func (c Config) Reload() (Config, error) {
+	return parseFlags(c.args, c.IPFamily)
+}
+
+// newFlagSet creates a flag set that parses all flags into the provided config and state. Registering the flags
+// sets the default values.
+func newFlagSet(config *Config, state *parseState) *flag.FlagSet {
+	name := "gateway-route-manager"
+	if len(os.Args) > 0 {
+		name = os.Args[0]
+	}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+
+	fs.StringVar(&config.ConfigFile, "config", "", "Path to a YAML or JSON configuration file. Explicitly set flags take precedence over values in the file.")
+	fs.StringVar(&config.StartIP, "start-ip", "", "Starting IP address for the range")
+	fs.StringVar(&config.EndIP, "end-ip", "", "Ending IP address for the range")
+	fs.DurationVar(&config.Timeout, "timeout", 1*time.Second, "Timeout for health checks")
+	fs.DurationVar(&config.CheckPeriod, "check-period", 3*time.Second, "How often to check gateways")
+	fs.StringVar(&config.CheckType, "check-type", CheckTypeHTTP, fmt.Sprintf("Health check type (one of: %s)", strings.Join(checkTypes, ", ")))
+	fs.IntVar(&config.Port, "port", 9999, "Port to target for health checks")
+	fs.StringVar(&config.URLPath, "path", "/", "URL path for health checks")
+	fs.StringVar(&config.Scheme, "scheme", "http", "Scheme to use (http or https)")
+	// HTTP health check matching flags
+	fs.StringVar(&config.HTTPCheck.Method, "http-method", http.MethodGet, "HTTP method to use for HTTP health checks")
+	headersSet := false
+	fs.Func("http-header", "Header to send with HTTP health checks, as 'Name: value' (can be specified multiple times)", func(s string) error {
+		if !headersSet {
+			headersSet = true
+			config.HTTPCheck.Headers = nil
+		}
+
+		if config.HTTPCheck.Headers == nil {
+			config.HTTPCheck.Headers = http.Header{}
+		}
+		return parseHeader(s, config.HTTPCheck.Headers)
+	})
+	fs.Func("http-expected-status", "Comma-separated HTTP status codes and ranges that are considered healthy (default 200-299)", func(s string) error {
+		statuses, err := ParseStatusRanges(s)
+		if err != nil {
+			return err
+		}
+
+		config.HTTPCheck.ExpectedStatuses = statuses
+		return nil
+	})
+	fs.StringVar(&config.HTTPCheck.BodyContains, "http-body-contains", "", "Substring that the HTTP health check response body must contain")
+	fs.Func("http-body-regex", "Regular expression that the HTTP health check response body must match", func(s string) error {
+		bodyRegex, err := regexp.Compile(s)
+		if err != nil {
+			return fmt.Errorf("invalid regular expression: %w", err)
+		}
+
+		config.HTTPCheck.BodyRegex = bodyRegex
+		return nil
+	})
+	fs.StringVar(&config.HTTPCheck.JSONPath, "http-json-path", "", "Dot-separated path into the JSON response body that must be present (e.g. status or checks.0.state)")
+	fs.StringVar(&config.HTTPCheck.JSONValue, "http-json-value", "", "Expected value at http-json-path (if unset, the value only needs to be present and not null)")
+	fs.Int64Var(&config.HTTPCheck.MaxBodySize, "http-max-body-size", DefaultHTTPMaxBodySize, "Maximum number of response body bytes to read for HTTP health checks")
+
+	fs.StringVar(&config.DNSQueryName, "dns-query-name", "example.com", "Name to resolve via the gateway for DNS health checks")
+	fs.IntVar(&config.DNSPort, "dns-port", DefaultDNSPort, "Port of the gateways to query for DNS health checks (overridden by the port of gateway entries)")
+	fs.StringVar(&config.GRPCService, "grpc-service", "", "Service name to query for gRPC health checks (empty checks the overall server health)")
+	fs.IntVar(&config.Rise, "rise", 1, "Number of consecutive successful health checks before an inactive gateway is marked as active")
+	fs.IntVar(&config.Fall, "fall", 1, "Number of consecutive failed health checks before an active gateway is marked as inactive")
+	fs.StringVar(&config.InitialState, "initial-state", InitialStateFirstCheck, fmt.Sprintf("State of gateways before their health is established (one of: %s)", strings.Join(initialStates, ", ")))
+	fs.StringVar(&config.WeightMode, "weight-mode", WeightModeStatic, fmt.Sprintf("How gateway ECMP weights are determined (one of: %s)", strings.Join(weightModes, ", ")))
+	fs.IntVar(&config.MinTierGateways, "min-tier-gateways", 1, "Minimum number of active gateways in a priority tier before failing over to the next tier")
+	// Flap damping flags
+	fs.BoolVar(&config.FlapDamping.Enabled, "flap-damping", false, "Keep gateways whose state changes frequently out of the routes until they stabilize")
+	fs.IntVar(&config.FlapDamping.Penalty, "flap-penalty", 500, "Penalty added to a gateway each time its state changes")
+	fs.IntVar(&config.FlapDamping.SuppressThreshold, "flap-suppress-threshold", 2000, "Penalty at which a gateway is suppressed")
+	fs.IntVar(&config.FlapDamping.ReuseThreshold, "flap-reuse-threshold", 750, "Penalty below which a suppressed gateway can be used again")
+	fs.DurationVar(&config.FlapDamping.HalfLife, "flap-half-life", 15*time.Minute, "Time for a gateway's penalty to decay by half")
+	fs.DurationVar(&config.FlapDamping.MaxSuppressTime, "flap-max-suppress-time", time.Hour, "Maximum time a gateway can stay suppressed after its last state change (0 for no limit)")
+	fs.BoolVar(&config.DryRun, "dry-run", false, "Log and report the rule, route and DDNS changes that would be made, without applying them")
+	fs.StringVar(&config.LogLevel, "log-level", "info", "Log level (debug, info, warn, error)")
+	fs.IntVar(&config.MetricsPort, "metrics-port", 9090, "Port for Prometheus metrics endpoint")
+	fs.IntVar(&config.FirstRoutingTableID, "first-routing-table-id", 180, "First routing table ID to use for gateway route logic")
+	fs.IntVar(&config.FirstRulePreference, "first-rule-preference", 10888, "First rule preference to use for gateway route logic")
+	fs.StringVar(&config.IPFamily, "ip-family", IPFamilyIPv4, fmt.Sprintf("IP address families to manage (one of: %s)", strings.Join(ipFamilies, ", ")))
+
+	// List flags replace any values from the configuration file the first time they are set
+	gatewaysSet := false
+	fs.Func("gateway", "Gateway to monitor, as a single IP, CIDR, or start-end range, optionally followed by ,type=T ,port=N ,path=/p ,scheme=http|https ,weight=N ,priority=N ,pool=NAME ,dev=IFACE ,onlink=true and ,src=IP options (can be specified multiple times)", func(s string) error {
+		if !gatewaysSet {
+			gatewaysSet = true
+			config.Gateways = nil
+		}
+
+		gateway, err := ParseGatewayConfig(s)
+		if err != nil {
+			return err
+		}
+
+		config.Gateways = append(config.Gateways, gateway)
+		return nil
+	})
+
+	routesSet := false
+	fs.Func("route", "Routes to manage in CIDR notation or 'default' (the default route of each managed IP family), optionally followed by ,pool=NAME (can be specified multiple times)", func(s string) error {
+		if !routesSet {
+			routesSet = true
+			config.Routes = nil
+			state.defaultRoute = false
+			state.defaultRoutePool = ""
+		}
+
+		return parseRoute(s, config, state)
+	})
+
+	poolsSet := false
+	fs.Func("pool", "Gateway pool settings, as NAME optionally followed by ,min-tier-gateways=N and ,fallback=POOL (can be specified multiple times)", func(s string) error {
+		if !poolsSet {
+			poolsSet = true
+			config.Pools = nil
+		}
+
+		pool, err := ParsePoolConfig(s)
+		if err != nil {
+			return err
+		}
+
+		config.Pools = append(config.Pools, pool)
+		return nil
+	})
+
+	sourceCIDRsSet := false
+	fs.Func("source-cidr", "Only route traffic from this source CIDR via the gateways (can be specified multiple times)", func(s string) error {
+		if !sourceCIDRsSet {
+			sourceCIDRsSet = true
+			config.SourceCIDRs = nil
+		}
+
+		return parseSourceCIDR(s, config)
+	})
+
+	fwmarksSet := false
+	fs.Func("fwmark", "Only route traffic with this firewall mark, as MARK or MARK/MASK, via the gateways (can be specified multiple times)", func(s string) error {
+		if !fwmarksSet {
+			fwmarksSet = true
+			config.FWMarks = nil
+		}
+
+		fwmark, err := ParseFWMark(s)
+		if err != nil {
+			return err
+		}
+
+		config.FWMarks = append(config.FWMarks, fwmark)
+		return nil
+	})
+
+	bypassFWMarksSet := false
+	fs.Func("bypass-fwmark", "Do not route traffic with this firewall mark, as MARK or MARK/MASK, via the gateways (can be specified multiple times)", func(s string) error {
+		if !bypassFWMarksSet {
+			bypassFWMarksSet = true
+			config.BypassFWMarks = nil
+		}
+
+		fwmark, err := ParseFWMark(s)
+		if err != nil {
+			return err
+		}
+
+		config.BypassFWMarks = append(config.BypassFWMarks, fwmark)
+		return nil
+	})
+
+	fs.BoolVar(&config.NFTables.Enabled, "nftables", false, "Manage an nftables table that marks packets to excluded destinations and other configured networks so that they bypass or use the gateways (requires the nft command)")
+	fs.StringVar(&config.NFTables.Table, "nftables-table", DefaultNFTablesTable, "Name of the managed nftables table in the inet family")
+	fs.Func("nftables-mark", fmt.Sprintf("Firewall mark that the nftables table sets on packets to excluded destinations, as MARK or MARK/MASK (default %s)", DefaultNFTablesMark.String()), func(s string) error {
+		fwmark, err := ParseFWMark(s)
+		if err != nil {
+			return err
+		}
+
+		config.NFTables.Mark = fwmark
+		return nil
+	})
+	fs.Func("nftables-gateway-mark", fmt.Sprintf("Firewall mark that the nftables table sets on packets to or from the gateway networks, as MARK or MARK/MASK (default %s)", DefaultNFTablesGatewayMark.String()), func(s string) error {
+		fwmark, err := ParseFWMark(s)
+		if err != nil {
+			return err
+		}
+
+		config.NFTables.GatewayMark = fwmark
+		return nil
+	})
+	nftablesBypassSourcesSet := false
+	fs.Func("nftables-bypass-source", "Do not route traffic from this source CIDR via the gateways, by marking it in the nftables table (can be specified multiple times)", func(s string) error {
+		if !nftablesBypassSourcesSet {
+			nftablesBypassSourcesSet = true
+			config.NFTables.BypassSources = nil
+		}
+
+		return parseCIDRInto(s, &config.NFTables.BypassSources)
+	})
+	nftablesGatewayDestinationsSet := false
+	fs.Func("nftables-gateway-dest", "Route traffic to this destination CIDR via the gateways, by marking it in the nftables table (can be specified multiple times)", func(s string) error {
+		if !nftablesGatewayDestinationsSet {
+			nftablesGatewayDestinationsSet = true
+			config.NFTables.GatewayDestinations = nil
+		}
+
+		return parseCIDRInto(s, &config.NFTables.GatewayDestinations)
+	})
+	nftablesGatewaySourcesSet := false
+	fs.Func("nftables-gateway-source", "Route traffic from this source CIDR via the gateways, by marking it in the nftables table (can be specified multiple times)", func(s string) error {
+		if !nftablesGatewaySourcesSet {
+			nftablesGatewaySourcesSet = true
+			config.NFTables.GatewaySources = nil
+		}
+
+		return parseCIDRInto(s, &config.NFTables.GatewaySources)
+	})
+
+	fs.StringVar(&config.NoGateway.Policy, "no-gateway-policy", NoGatewayPolicyFallthrough, fmt.Sprintf("What happens to traffic to a route without any active gateways (one of: %s)", strings.Join(noGatewayPolicies, ", ")))
+	noGatewayFallbacksSet := false
+	fs.Func("no-gateway-fallback", "Static gateway that routes without any active gateways are sent via when no-gateway-policy is gateway, at most one per IP family (can be specified multiple times)", func(s string) error {
+		if !noGatewayFallbacksSet {
+			noGatewayFallbacksSet = true
+			config.NoGateway.FallbackGateways = nil
+		}
+
+		return parseNoGatewayFallback(s, config)
+	})
+
+	fs.DurationVar(&config.ReconcilePeriod, "reconcile-period", 30*time.Second, "How often to repair rules and routes that were changed by something else (0 to only repair them when the gateway table changes)")
+	fs.BoolVar(&config.NexthopGroups, "nexthop-groups", false, "Route via kernel nexthop groups instead of multipath routes, so that gateway changes update all routes at once (requires Linux 5.3 or later)")
+	fs.IntVar(&config.NexthopGroupBuckets, "nexthop-group-buckets", 0, "Number of buckets of resilient nexthop groups, which keep flows via healthy gateways in place when a gateway is removed (0 for plain groups, requires Linux 5.13 or later)")
+	fs.BoolVar(&config.ConntrackFlush, "conntrack-flush", false, "Delete the conntrack entries of connections to routes that a gateway was removed from, so that they fail quickly")
+
+	// DDNS configuration flags
+	fs.StringVar(&config.DDNSProvider, "ddns-provider", "", fmt.Sprintf("DDNS provider (currently supports: %s)", strings.Join(ddnsProviders, ", ")))
+	fs.StringVar(&config.DDNSUsername, "ddns-username", "", "DDNS username (required for some providers, dyndns2: basic auth username)")
+	fs.StringVar(&config.DDNSPassword, "ddns-password", "", "DDNS password or API key (required by all providers except webhook, defaults to DDNS_PASSWORD)")
+	fs.StringVar(&config.DDNSHostname, "ddns-hostname", "", "DDNS hostname to update (required if DDNS provider is specified)")
+	fs.StringVar(&config.DDNSRequireIPAddress, "ddns-require-ip-address", "", "IP address that must be assigned to an interface for DDNS updates to be performed")
+	fs.DurationVar(&config.DDNSTimeout, "ddns-timeout", time.Minute, "Timeout for DDNS updates")
+	fs.DurationVar(&config.DDNSTTL, "ddns-record-ttl", time.Minute, "TTL for managed DDNS records")
+	fs.StringVar(&config.DDNSRecordComment, "ddns-record-comment", "Managed by gateway-route-manager", "Comment that managed DDNS records are tagged with (cloudflare, route53: comment of the change batch)")
+	fs.BoolVar(&config.DDNSCloudflareProxied, "ddns-cloudflare-proxied", false, "Proxy traffic to the DDNS records through Cloudflare")
+	fs.StringVar(&config.DDNSServer, "ddns-server", "", "DDNS server to send updates to (rfc2136: HOST[:PORT] of the primary name server, route53: API endpoint URL, dyndns2: server URL)")
+	fs.StringVar(&config.DDNSZone, "ddns-zone", "", "DNS zone of the DDNS hostname (rfc2136: zone name, route53: hosted zone ID, looked up when unset)")
+	fs.StringVar(&config.DDNSTSIGAlgorithm, "ddns-tsig-algorithm", "hmac-sha256", fmt.Sprintf("Algorithm of the TSIG key named by ddns-username, with the base64 secret in ddns-password (rfc2136, one of: %s)", strings.Join(tsigAlgorithms, ", ")))
+	fs.StringVar(&config.DDNSRoute53RoutingPolicy, "ddns-route53-routing", "simple", fmt.Sprintf("Routing policy of the Route 53 record sets, with one record set per IP address for multivalue and weighted (one of: %s)", strings.Join(route53RoutingPolicies, ", ")))
+	route53HealthChecksSet := false
+	fs.Func("ddns-route53-health-check", "Route 53 health check of a public IP address, as IP=HEALTH_CHECK_ID, for the multivalue and weighted routing policies (can be specified multiple times)", func(s string) error {
+		if !route53HealthChecksSet {
+			route53HealthChecksSet = true
+			config.DDNSRoute53HealthChecks = nil
+		}
+
+		ip, healthCheckID, ok := strings.Cut(s, "=")
+		if !ok || ip == "" || healthCheckID == "" {
+			return fmt.Errorf("invalid Route 53 health check %q (expected 'IP=HEALTH_CHECK_ID')", s)
+		}
+
+		if config.DDNSRoute53HealthChecks == nil {
+			config.DDNSRoute53HealthChecks = make(map[string]string)
+		}
+		config.DDNSRoute53HealthChecks[ip] = healthCheckID
+		return nil
+	})
+
+	fs.StringVar(&config.DDNSWebhook.URL, "ddns-webhook-url", "", "URL template of webhook DDNS requests (required for webhook)")
+	fs.StringVar(&config.DDNSWebhook.Method, "ddns-webhook-method", http.MethodPost, "Method template of webhook DDNS requests")
+	webhookHeadersSet := false
+	fs.Func("ddns-webhook-header", "Header to send with webhook DDNS requests, as 'Name: value template' (can be specified multiple times)", func(s string) error {
+		if !webhookHeadersSet {
+			webhookHeadersSet = true
+			config.DDNSWebhook.Headers = nil
+		}
+
+		if config.DDNSWebhook.Headers == nil {
+			config.DDNSWebhook.Headers = http.Header{}
+		}
+		return parseHeader(s, config.DDNSWebhook.Headers)
+	})
+	fs.StringVar(&config.DDNSWebhook.Body, "ddns-webhook-body", "", "Body template of webhook DDNS requests (no body when unset)")
+	fs.Func("ddns-webhook-success-codes", "Comma-separated HTTP status codes and ranges of successful webhook DDNS requests (default 200-299)", func(s string) error {
+		statuses, err := ParseStatusRanges(s)
+		if err != nil {
+			return err
+		}
+
+		config.DDNSWebhook.SuccessStatuses = statuses
+		return nil
+	})
+	fs.Func("ddns-webhook-success-regex", "Regular expression that the response body of successful webhook DDNS requests must match", func(s string) error {
+		successRegex, err := regexp.Compile(s)
+		if err != nil {
+			return fmt.Errorf("invalid regular expression: %w", err)
+		}
+
+		config.DDNSWebhook.SuccessRegex = successRegex
+		return nil
+	})
+	fs.StringVar(&config.DDNSWebhook.Mode, "ddns-webhook-mode", WebhookModeSet, fmt.Sprintf("Whether webhook DDNS requests are sent for the whole set of IP addresses, or for each IP address (one of: %s)", strings.Join(webhookModes, ", ")))
+	fs.BoolVar(&config.DDNSDynDNS2MultipleIPs, "ddns-dyndns2-multiple-ips", false, "Send all IP addresses in dyndns2 updates, for servers that accept multiple comma-separated IP addresses (otherwise only the first IPv4 and IPv6 address are sent)")
+
+	// Public IP service configuration flags
+	fs.StringVar(&config.PublicIPService.Hostname, "public-ip-service-hostname", "", "Hostname for public IP service (if unset, queries each gateway)")
+	fs.IntVar(&config.PublicIPService.Port, "public-ip-service-port", 443, "Port for gateway's public IP service to fetch its public IP addresses")
+	fs.StringVar(&config.PublicIPService.Scheme, "public-ip-service-scheme", "https", "Scheme for public IP service (http or https)")
+	fs.StringVar(&config.PublicIPService.Path, "public-ip-service-path", "/", "URL path for public IP service")
+	fs.StringVar(&config.PublicIPService.Username, "public-ip-service-username", "", "Username for public IP service HTTP basic auth")
+	fs.StringVar(&config.PublicIPService.Password, "public-ip-service-password", "", "Password for public IP service HTTP basic auth (defaults to PUBLIC_IP_SERVICE_PASSWORD)")
+
+	excludeCIDRsSet := false
+	fs.Func("exclude-cidr", "CIDR to exclude from gateway routing (can be specified multiple times)", func(s string) error {
+		if !excludeCIDRsSet {
+			excludeCIDRsSet = true
+			state.cidrsToExclude = nil
+		}
+
+		return parseExcludeCIDR(s, state)
+	})
+	fs.BoolVar(&state.excludeReservedCIDRs, "exclude-reserved-cidrs", true, "Exclude reserved destinations of each managed IP family (private networks, lookback, multicast, etc.) from gateway routing")
+
+	return fs
+}
+
+// parseRoute parses a route of the form `cidr|default[,pool=name]`
+func parseRoute(s string, config *Config, state *parseState) error {
+	parts := strings.Split(s, ",")
+
+	var pool string
+	for _, part := range parts[1:] {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || key != "pool" {
+			return fmt.Errorf("invalid route option %q (expected pool=NAME)", part)
+		}
+		pool = value
+	}
+
+	destinationStr := strings.TrimSpace(parts[0])
+	if destinationStr == "default" {
+		state.defaultRoute = true
+		state.defaultRoutePool = pool
+		return nil
+	}
+
+	_, destination, err := net.ParseCIDR(destinationStr)
+	if err != nil {
+		return fmt.Errorf("invalid route: %w", err)
+	}
+
+	config.Routes = append(config.Routes, RouteConfig{Destination: destination, Pool: pool})
+	return nil
+}
+
+func parseSourceCIDR(s string, config *Config) error {
+	return parseCIDRInto(s, &config.SourceCIDRs)
+}
+
+// parseCIDRInto parses a CIDR and appends it to the list
+func parseCIDRInto(s string, cidrs *[]*net.IPNet) error {
+	_, cidr, err := net.ParseCIDR(s)
+	if err != nil {
+		return fmt.Errorf("invalid CIDR: %w", err)
+	}
+
+	*cidrs = append(*cidrs, cidr)
+	return nil
+}
+
+func parseExcludeCIDR(s string, state *parseState) error {
+	_, cidr, err := net.ParseCIDR(s)
+	if err != nil {
+		return fmt.Errorf("invalid CIDR: %w", err)
+	}
+
+	state.cidrsToExclude = append(state.cidrsToExclude, cidr)
+	return nil
 }
 
 // Validate validates the configuration and returns an error if invalid
 func (c Config) Validate() error {
-	if c.StartIP == "" || c.EndIP == "" {
-		return fmt.Errorf("start-ip and end-ip are required")
+	if c.IPFamily != "" && !slices.Contains(ipFamilies, strings.ToLower(c.IPFamily)) {
+		return fmt.Errorf("ip-family must be one of: %s", strings.Join(ipFamilies, ", "))
 	}
 
-	// Validate that start and end IPs are valid
-	startIP := net.ParseIP(c.StartIP)
-	if startIP == nil {
-		return fmt.Errorf("invalid start-ip: %s", c.StartIP)
+	if (c.StartIP == "") != (c.EndIP == "") {
+		return fmt.Errorf("start-ip and end-ip must be set together")
 	}
 
-	endIP := net.ParseIP(c.EndIP)
-	if endIP == nil {
-		return fmt.Errorf("invalid end-ip: %s", c.EndIP)
+	if c.StartIP == "" && len(c.Gateways) == 0 {
+		return fmt.Errorf("start-ip and end-ip, or at least one gateway, are required")
 	}
 
-	// Validate that end IP is after start IP
-	if startIP.Equal(endIP) {
-		// Allow equal IPs (single IP range)
-	} else if iputil.IsIPGreater(startIP, endIP) {
-		return fmt.Errorf("start-ip (%s) must be less than or equal to end-ip (%s)", c.StartIP, c.EndIP)
+	if c.StartIP != "" {
+		if err := c.validateRange(); err != nil {
+			return err
+		}
+	}
+
+	for _, gateway := range c.Gateways {
+		if err := c.validateGateway(gateway); err != nil {
+			return fmt.Errorf("invalid gateway %q: %w", gateway.Address, err)
+		}
+	}
+
+	for _, route := range c.Routes {
+		if !c.usesFamilyOf(route.Destination.IP) {
+			return fmt.Errorf("route %s is not in the managed IP family (%s)", route.Destination.String(), c.IPFamily)
+		}
+	}
+
+	if err := c.validatePools(); err != nil {
+		return err
+	}
+
+	if err := c.validatePolicy(); err != nil {
+		return err
+	}
+
+	if err := c.validateNoGateway(); err != nil {
+		return err
+	}
+
+	for _, cidr := range c.CIDRsToExclude {
+		if !c.usesFamilyOf(cidr.IP) {
+			return fmt.Errorf("excluded CIDR %s is not in the managed IP family (%s)", cidr.String(), c.IPFamily)
+		}
 	}
 
 	if c.CheckPeriod < c.Timeout {
@@ -200,6 +799,58 @@ func (c Config) Validate() error {
 		return fmt.Errorf("scheme must be 'http' or 'https'")
 	}
 
+	if c.CheckType != "" && !slices.Contains(checkTypes, c.CheckType) {
+		return fmt.Errorf("check-type must be one of: %s", strings.Join(checkTypes, ", "))
+	}
+
+	if err := c.HTTPCheck.validate(); err != nil {
+		return err
+	}
+
+	if c.usesCheckType(CheckTypeDNS) && c.DNSQueryName == "" {
+		return fmt.Errorf("dns-query-name is required for DNS health checks")
+	}
+
+	if c.DNSPort < 0 || c.DNSPort > 65535 {
+		return fmt.Errorf("dns-port must be between 0 and 65535 (0 uses the default port 53)")
+	}
+
+	if c.Rise < 0 {
+		return fmt.Errorf("rise must not be negative")
+	}
+
+	if c.Fall < 0 {
+		return fmt.Errorf("fall must not be negative")
+	}
+
+	if c.InitialState != "" && !slices.Contains(initialStates, c.InitialState) {
+		return fmt.Errorf("initial-state must be one of: %s", strings.Join(initialStates, ", "))
+	}
+
+	if c.WeightMode != "" && !slices.Contains(weightModes, c.WeightMode) {
+		return fmt.Errorf("weight-mode must be one of: %s", strings.Join(weightModes, ", "))
+	}
+
+	if c.MinTierGateways < 0 {
+		return fmt.Errorf("min-tier-gateways must not be negative")
+	}
+
+	if c.ReconcilePeriod < 0 {
+		return fmt.Errorf("reconcile-period must not be negative")
+	}
+
+	if c.NexthopGroupBuckets < 0 || c.NexthopGroupBuckets > math.MaxUint16 {
+		return fmt.Errorf("nexthop-group-buckets must be between 0 and %d", math.MaxUint16)
+	}
+
+	if c.NexthopGroupBuckets != 0 && !c.NexthopGroups {
+		return fmt.Errorf("nexthop-group-buckets requires nexthop-groups")
+	}
+
+	if err := c.FlapDamping.validate(); err != nil {
+		return err
+	}
+
 	if c.MetricsPort < 1 || c.MetricsPort > 65535 {
 		return fmt.Errorf("metrics port must be between 1 and 65535")
 	}
@@ -218,15 +869,17 @@ func (c Config) Validate() error {
 			return fmt.Errorf("ddns-provider must be one of: %s", strings.Join(ddnsProviders, ", "))
 		}
 
-		// DynuDNS uses API key authentication via password only
-		if strings.ToLower(c.DDNSProvider) != "dynudns" {
+		credentialsOptional := slices.Contains(ddnsOptionalCredentialProviders, strings.ToLower(c.DDNSProvider))
+
+		// DynuDNS and Cloudflare use API key authentication via password only
+		if !slices.Contains(ddnsTokenProviders, strings.ToLower(c.DDNSProvider)) && !credentialsOptional {
 			// Other providers require both username and password
 			if c.DDNSUsername == "" {
 				return fmt.Errorf("ddns-username is required")
 			}
 		}
 
-		if c.DDNSPassword == "" {
+		if c.DDNSPassword == "" && !credentialsOptional {
 			return fmt.Errorf("ddns-password is required when ddns-provider is specified (can be provided via DDNS_PASSWORD)")
 		}
 
@@ -241,6 +894,50 @@ func (c Config) Validate() error {
 		if c.DDNSTTL <= 0 {
 			return fmt.Errorf("ddns-record-ttl must be greater than zero")
 		}
+
+		if strings.ToLower(c.DDNSProvider) == "rfc2136" {
+			if c.DDNSServer == "" {
+				return fmt.Errorf("ddns-server is required when ddns-provider is rfc2136")
+			}
+
+			if !slices.Contains(tsigAlgorithms, strings.ToLower(c.DDNSTSIGAlgorithm)) {
+				return fmt.Errorf("ddns-tsig-algorithm must be one of: %s", strings.Join(tsigAlgorithms, ", "))
+			}
+
+			if _, err := base64.StdEncoding.DecodeString(c.DDNSPassword); err != nil {
+				return fmt.Errorf("ddns-password must be the base64 encoded TSIG secret when ddns-provider is rfc2136: %w", err)
+			}
+		}
+
+		if strings.ToLower(c.DDNSProvider) == "webhook" {
+			if err := c.DDNSWebhook.validate(); err != nil {
+				return err
+			}
+		}
+
+		if strings.ToLower(c.DDNSProvider) == "route53" {
+			if !slices.Contains(route53RoutingPolicies, c.DDNSRoute53RoutingPolicy) {
+				return fmt.Errorf("ddns-route53-routing must be one of: %s", strings.Join(route53RoutingPolicies, ", "))
+			}
+
+			if len(c.DDNSRoute53HealthChecks) > 0 && c.DDNSRoute53RoutingPolicy == "simple" {
+				return fmt.Errorf("ddns-route53-health-check requires ddns-route53-routing to be multivalue or weighted")
+			}
+
+			for ip := range c.DDNSRoute53HealthChecks {
+				if net.ParseIP(ip) == nil {
+					return fmt.Errorf("invalid IP address in ddns-route53-health-check: %s", ip)
+				}
+			}
+
+			if c.DDNSServer != "" && !isHTTPURL(c.DDNSServer) {
+				return fmt.Errorf("ddns-server must be an endpoint URL when ddns-provider is route53")
+			}
+		}
+
+		if strings.ToLower(c.DDNSProvider) == "dyndns2" && !isHTTPURL(c.DDNSServer) {
+			return fmt.Errorf("ddns-server must be the server URL when ddns-provider is dyndns2")
+		}
 	}
 
 	// Validate DDNS require IP address if provided
@@ -249,11 +946,6 @@ func (c Config) Validate() error {
 		if ip == nil {
 			return fmt.Errorf("invalid ddns-require-ip-address: %s", c.DDNSRequireIPAddress)
 		}
-
-		// Ensure it's an IPv4 address
-		if ip.To4() == nil {
-			return fmt.Errorf("ddns-require-ip-address must be an IPv4 address: %s", c.DDNSRequireIPAddress)
-		}
 	}
 
 	if c.PublicIPService.Port < 1 || c.PublicIPService.Port > 65535 {
@@ -292,7 +984,142 @@ func (c Config) GetSlogLevel() slog.Level {
 	}
 }
 
+// isHTTPURL returns true if the string is an absolute URL with a scheme and host
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+
 // IsDDNSEnabled returns true if DDNS is configured
 func (c Config) IsDDNSEnabled() bool {
 	return c.DDNSProvider != ""
 }
+
+// validateRange validates the start-ip and end-ip range
+func (c Config) validateRange() error {
+	startIP := net.ParseIP(c.StartIP)
+	if startIP == nil {
+		return fmt.Errorf("invalid start-ip: %s", c.StartIP)
+	}
+
+	endIP := net.ParseIP(c.EndIP)
+	if endIP == nil {
+		return fmt.Errorf("invalid end-ip: %s", c.EndIP)
+	}
+
+	if iputil.Family(startIP) != iputil.Family(endIP) {
+		return fmt.Errorf("start-ip (%s) and end-ip (%s) must be of the same IP family", c.StartIP, c.EndIP)
+	}
+
+	if !c.usesFamilyOf(startIP) {
+		return fmt.Errorf("start-ip (%s) is not in the managed IP family (%s)", c.StartIP, c.IPFamily)
+	}
+
+	// Validate that end IP is after start IP
+	if startIP.Equal(endIP) {
+		// Allow equal IPs (single IP range)
+	} else if iputil.IsIPGreater(startIP, endIP) {
+		return fmt.Errorf("start-ip (%s) must be less than or equal to end-ip (%s)", c.StartIP, c.EndIP)
+	}
+
+	return nil
+}
+
+// validateGateway validates an explicit gateway entry
+func (c Config) validateGateway(gateway GatewayConfig) error {
+	first, _, err := iputil.ParseAddressRange(gateway.Address)
+	if err != nil {
+		return err
+	}
+
+	if !c.usesFamilyOf(first) {
+		return fmt.Errorf("address is not in the managed IP family (%s)", c.IPFamily)
+	}
+
+	if gateway.Port != 0 && (gateway.Port < 1 || gateway.Port > 65535) {
+		return fmt.Errorf("port must be between 1 and 65535")
+	}
+
+	if gateway.Scheme != "" && gateway.Scheme != "http" && gateway.Scheme != "https" {
+		return fmt.Errorf("scheme must be 'http' or 'https'")
+	}
+
+	if gateway.CheckType != "" && !slices.Contains(checkTypes, gateway.CheckType) {
+		return fmt.Errorf("type must be one of: %s", strings.Join(checkTypes, ", "))
+	}
+
+	if gateway.Priority < 0 {
+		return fmt.Errorf("priority must not be negative")
+	}
+
+	if gateway.Weight < 0 || gateway.Weight > MaxGatewayWeight {
+		return fmt.Errorf("weight must be between 0 and %d (0 means 1)", MaxGatewayWeight)
+	}
+
+	// The kernel requires the interface of onlink nexthops, as it cannot be resolved from the gateway address
+	if gateway.OnLink && gateway.Interface == "" {
+		return fmt.Errorf("onlink requires dev")
+	}
+
+	if len(gateway.Interface) > maxInterfaceNameLength {
+		return fmt.Errorf("dev must be at most %d characters", maxInterfaceNameLength)
+	}
+
+	if gateway.PreferredSource != nil && iputil.Family(gateway.PreferredSource) != iputil.Family(first) {
+		return fmt.Errorf("src %s is not in the IP family of the address", gateway.PreferredSource)
+	}
+
+	return nil
+}
+
+// usesCheckType returns true if any gateway is checked with the given health check type
+func (c Config) usesCheckType(checkType string) bool {
+	if c.StartIP != "" && cmp.Or(c.CheckType, CheckTypeHTTP) == checkType {
+		return true
+	}
+
+	return slices.ContainsFunc(c.Gateways, func(gateway GatewayConfig) bool {
+		return cmp.Or(gateway.CheckType, c.CheckType, CheckTypeHTTP) == checkType
+	})
+}
+
+// UsesIPv4 returns true if IPv4 gateways and routes are managed. An unset IP family defaults to IPv4.
+func (c Config) UsesIPv4() bool {
+	family := strings.ToLower(c.IPFamily)
+	return family == "" || family == IPFamilyIPv4 || family == IPFamilyDual
+}
+
+// UsesIPv6 returns true if IPv6 gateways and routes are managed
+func (c Config) UsesIPv6() bool {
+	family := strings.ToLower(c.IPFamily)
+	return family == IPFamilyIPv6 || family == IPFamilyDual
+}
+
+// usesFamilyOf returns true if the IP family of the provided address is managed
+func (c Config) usesFamilyOf(ip net.IP) bool {
+	if ip.To4() != nil {
+		return c.UsesIPv4()
+	}
+
+	return c.UsesIPv6()
+}
+
+// defaultRoutes returns the default route for each managed IP family
+func (c Config) defaultRoutes() []*net.IPNet {
+	var routes []*net.IPNet
+	if c.UsesIPv4() {
+		routes = append(routes, &net.IPNet{
+			IP:   net.IPv4zero.To4(),
+			Mask: net.CIDRMask(0, 32),
+		})
+	}
+
+	if c.UsesIPv6() {
+		routes = append(routes, &net.IPNet{
+			IP:   net.IPv6zero,
+			Mask: net.CIDRMask(0, 128),
+		})
+	}
+
+	return routes
+}
@@ -3,7 +3,11 @@ package config
 import (
 	"fmt"
 	"log/slog"
+	"math"
 	"net"
+	"net/http"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -70,100 +74,129 @@ func TestConfig_Validate(t *testing.T) {
 			},
 		},
 		{
-			name: "missing start IP",
+			name: "valid IPv6 config",
 			config: Config{
-				StartIP:     "",
-				EndIP:       "192.168.1.10",
+				StartIP:     "2001:db8::10",
+				EndIP:       "2001:db8::20",
+				IPFamily:    IPFamilyIPv6,
+				Routes:      []RouteConfig{{Destination: parseCIDR(t, "::/0")}},
 				Timeout:     1 * time.Second,
 				CheckPeriod: 3 * time.Second,
 				Port:        80,
 				URLPath:     "/",
 				Scheme:      "http",
+				LogLevel:    "info",
 				MetricsPort: 9090,
 				PublicIPService: PublicIPServiceConfig{
 					Port: 443,
 				},
 			},
-			errFunc: require.Error,
-			errMsg:  "start-ip and end-ip are required",
 		},
 		{
-			name: "missing end IP",
+			name: "valid dual-stack config",
+			config: Config{
+				StartIP:        "192.168.1.1",
+				EndIP:          "192.168.1.10",
+				IPFamily:       IPFamilyDual,
+				Routes:         []RouteConfig{{Destination: parseCIDR(t, "0.0.0.0/0")}, {Destination: parseCIDR(t, "::/0")}},
+				CIDRsToExclude: []*net.IPNet{parseCIDR(t, "10.0.0.0/8"), parseCIDR(t, "fc00::/7")},
+				Timeout:        1 * time.Second,
+				CheckPeriod:    3 * time.Second,
+				Port:           80,
+				URLPath:        "/",
+				Scheme:         "http",
+				LogLevel:       "info",
+				MetricsPort:    9090,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+			},
+		},
+		{
+			name: "invalid IP family",
 			config: Config{
 				StartIP:     "192.168.1.1",
-				EndIP:       "",
+				EndIP:       "192.168.1.10",
+				IPFamily:    "ipx",
 				Timeout:     1 * time.Second,
 				CheckPeriod: 3 * time.Second,
 				Port:        80,
 				URLPath:     "/",
 				Scheme:      "http",
+				LogLevel:    "info",
 				MetricsPort: 9090,
 				PublicIPService: PublicIPServiceConfig{
 					Port: 443,
 				},
 			},
 			errFunc: require.Error,
-			errMsg:  "start-ip and end-ip are required",
+			errMsg:  "ip-family must be one of: ipv4, ipv6, dual",
 		},
 		{
-			name: "missing both IPs",
+			name: "mixed IP families in range",
 			config: Config{
-				StartIP:     "",
-				EndIP:       "",
+				StartIP:     "192.168.1.1",
+				EndIP:       "2001:db8::1",
+				IPFamily:    IPFamilyDual,
 				Timeout:     1 * time.Second,
 				CheckPeriod: 3 * time.Second,
 				Port:        80,
 				URLPath:     "/",
 				Scheme:      "http",
+				LogLevel:    "info",
 				MetricsPort: 9090,
 				PublicIPService: PublicIPServiceConfig{
 					Port: 443,
 				},
 			},
 			errFunc: require.Error,
-			errMsg:  "start-ip and end-ip are required",
+			errMsg:  "start-ip (192.168.1.1) and end-ip (2001:db8::1) must be of the same IP family",
 		},
 		{
-			name: "invalid start IP",
+			name: "IPv6 range with IPv4 family",
 			config: Config{
-				StartIP:     "invalid-ip",
-				EndIP:       "192.168.1.10",
+				StartIP:     "2001:db8::10",
+				EndIP:       "2001:db8::20",
 				Timeout:     1 * time.Second,
 				CheckPeriod: 3 * time.Second,
 				Port:        80,
 				URLPath:     "/",
 				Scheme:      "http",
+				LogLevel:    "info",
 				MetricsPort: 9090,
 				PublicIPService: PublicIPServiceConfig{
 					Port: 443,
 				},
 			},
 			errFunc: require.Error,
-			errMsg:  "invalid start-ip: invalid-ip",
+			errMsg:  "start-ip (2001:db8::10) is not in the managed IP family ()",
 		},
 		{
-			name: "invalid end IP",
+			name: "IPv6 route with IPv4 family",
 			config: Config{
 				StartIP:     "192.168.1.1",
-				EndIP:       "not-an-ip",
+				EndIP:       "192.168.1.10",
+				IPFamily:    IPFamilyIPv4,
+				Routes:      []RouteConfig{{Destination: parseCIDR(t, "::/0")}},
 				Timeout:     1 * time.Second,
 				CheckPeriod: 3 * time.Second,
 				Port:        80,
 				URLPath:     "/",
 				Scheme:      "http",
+				LogLevel:    "info",
 				MetricsPort: 9090,
 				PublicIPService: PublicIPServiceConfig{
 					Port: 443,
 				},
 			},
 			errFunc: require.Error,
-			errMsg:  "invalid end-ip: not-an-ip",
+			errMsg:  "route ::/0 is not in the managed IP family (ipv4)",
 		},
 		{
-			name: "start IP greater than end IP",
+			name: "missing start IP",
 			config: Config{
-				StartIP:     "192.168.1.10",
-				EndIP:       "192.168.1.1",
+				StartIP:     "",
+				EndIP:       "192.168.1.10",
 				Timeout:     1 * time.Second,
 				CheckPeriod: 3 * time.Second,
 				Port:        80,
@@ -175,14 +208,14 @@ func TestConfig_Validate(t *testing.T) {
 				},
 			},
 			errFunc: require.Error,
-			errMsg:  "start-ip (192.168.1.10) must be less than or equal to end-ip (192.168.1.1)",
+			errMsg:  "start-ip and end-ip must be set together",
 		},
 		{
-			name: "check period less than timeout",
+			name: "missing end IP",
 			config: Config{
 				StartIP:     "192.168.1.1",
-				EndIP:       "192.168.1.10",
-				Timeout:     5 * time.Second,
+				EndIP:       "",
+				Timeout:     1 * time.Second,
 				CheckPeriod: 3 * time.Second,
 				Port:        80,
 				URLPath:     "/",
@@ -193,260 +226,1118 @@ func TestConfig_Validate(t *testing.T) {
 				},
 			},
 			errFunc: require.Error,
-			errMsg:  "check-period (3s) must be at least as long as timeout (5s)",
+			errMsg:  "start-ip and end-ip must be set together",
 		},
 		{
-			name: "invalid scheme - empty",
+			name: "missing both IPs",
 			config: Config{
-				StartIP:     "192.168.1.1",
-				EndIP:       "192.168.1.10",
+				StartIP:     "",
+				EndIP:       "",
 				Timeout:     1 * time.Second,
 				CheckPeriod: 3 * time.Second,
 				Port:        80,
 				URLPath:     "/",
-				Scheme:      "",
+				Scheme:      "http",
 				MetricsPort: 9090,
 				PublicIPService: PublicIPServiceConfig{
 					Port: 443,
 				},
 			},
 			errFunc: require.Error,
-			errMsg:  "scheme must be 'http' or 'https'",
+			errMsg:  "start-ip and end-ip, or at least one gateway, are required",
 		},
 		{
-			name: "invalid scheme - wrong value",
+			name: "valid config with explicit gateways only",
 			config: Config{
-				StartIP:     "192.168.1.1",
-				EndIP:       "192.168.1.10",
+				Gateways: []GatewayConfig{
+					{Address: "192.168.1.1"},
+					{Address: "10.0.0.0/29", Port: 8080, Path: "/healthz", Scheme: "https"},
+					{Address: "172.16.0.10-172.16.0.20"},
+				},
 				Timeout:     1 * time.Second,
 				CheckPeriod: 3 * time.Second,
 				Port:        80,
 				URLPath:     "/",
-				Scheme:      "ftp",
+				Scheme:      "http",
+				LogLevel:    "info",
 				MetricsPort: 9090,
 				PublicIPService: PublicIPServiceConfig{
 					Port: 443,
 				},
 			},
-			errFunc: require.Error,
-			errMsg:  "scheme must be 'http' or 'https'",
 		},
 		{
-			name: "metrics port too low",
+			name: "valid config with range and explicit gateways",
 			config: Config{
 				StartIP:     "192.168.1.1",
-				EndIP:       "192.168.1.10",
+				EndIP:       "192.168.1.5",
+				Gateways:    []GatewayConfig{{Address: "10.0.0.1"}},
 				Timeout:     1 * time.Second,
 				CheckPeriod: 3 * time.Second,
 				Port:        80,
 				URLPath:     "/",
 				Scheme:      "http",
-				MetricsPort: 0,
+				LogLevel:    "info",
+				MetricsPort: 9090,
 				PublicIPService: PublicIPServiceConfig{
 					Port: 443,
 				},
 			},
-			errFunc: require.Error,
-			errMsg:  "metrics port must be between 1 and 65535",
 		},
 		{
-			name: "metrics port too high",
+			name: "invalid gateway address",
 			config: Config{
-				StartIP:     "192.168.1.1",
-				EndIP:       "192.168.1.10",
+				Gateways:    []GatewayConfig{{Address: "not-an-ip"}},
 				Timeout:     1 * time.Second,
 				CheckPeriod: 3 * time.Second,
 				Port:        80,
 				URLPath:     "/",
 				Scheme:      "http",
-				MetricsPort: 65536,
-				PublicIPService: PublicIPServiceConfig{
-					Port: 443,
-				},
+				LogLevel:    "info",
+				MetricsPort: 9090,
 			},
 			errFunc: require.Error,
-			errMsg:  "metrics port must be between 1 and 65535",
 		},
 		{
-			name: "edge case - port 1 (minimum valid port)",
+			name: "IPv6 gateway with IPv4 family",
 			config: Config{
-				StartIP:     "127.0.0.1",
-				EndIP:       "127.0.0.1",
+				Gateways:    []GatewayConfig{{Address: "2001:db8::1"}},
 				Timeout:     1 * time.Second,
 				CheckPeriod: 3 * time.Second,
 				Port:        80,
 				URLPath:     "/",
 				Scheme:      "http",
 				LogLevel:    "info",
-				MetricsPort: 1,
-				PublicIPService: PublicIPServiceConfig{
-					Port: 443,
-				},
+				MetricsPort: 9090,
 			},
+			errFunc: require.Error,
 		},
 		{
-			name: "edge case - port 65535 (maximum valid port)",
+			name: "invalid gateway port",
 			config: Config{
-				StartIP:     "127.0.0.1",
-				EndIP:       "127.0.0.1",
+				Gateways:    []GatewayConfig{{Address: "192.168.1.1", Port: 70000}},
 				Timeout:     1 * time.Second,
 				CheckPeriod: 3 * time.Second,
 				Port:        80,
 				URLPath:     "/",
 				Scheme:      "http",
-				LogLevel:    "error",
-				MetricsPort: 65535,
-				PublicIPService: PublicIPServiceConfig{
-					Port: 443,
-				},
+				LogLevel:    "info",
+				MetricsPort: 9090,
 			},
+			errFunc: require.Error,
 		},
 		{
-			name: "valid DDNS config with require IP address",
+			name: "valid config with mixed check types",
 			config: Config{
-				StartIP:              "192.168.1.1",
-				EndIP:                "192.168.1.1",
-				Timeout:              1 * time.Second,
-				CheckPeriod:          3 * time.Second,
-				Port:                 80,
-				URLPath:              "/",
-				Scheme:               "http",
-				LogLevel:             "info",
-				MetricsPort:          9090,
-				DDNSProvider:         "dynudns",
-				DDNSUsername:         "user",
-				DDNSPassword:         "pass",
-				DDNSHostname:         "example.com",
-				DDNSRequireIPAddress: "192.168.1.100",
-				DDNSTimeout:          time.Minute,
-				DDNSTTL:              time.Minute,
+				StartIP:   "192.168.1.1",
+				EndIP:     "192.168.1.5",
+				CheckType: CheckTypeTCP,
+				Gateways: []GatewayConfig{
+					{Address: "10.0.0.1", CheckType: CheckTypeICMP},
+					{Address: "10.0.0.2", CheckType: CheckTypeDNS, Port: 53},
+					{Address: "10.0.0.3", CheckType: CheckTypeGRPC},
+				},
+				DNSQueryName: "example.com",
+				Timeout:      1 * time.Second,
+				CheckPeriod:  3 * time.Second,
+				Port:         80,
+				URLPath:      "/",
+				Scheme:       "http",
+				LogLevel:     "info",
+				MetricsPort:  9090,
 				PublicIPService: PublicIPServiceConfig{
 					Port: 443,
 				},
 			},
 		},
 		{
-			name: "invalid DDNS require IP address - not a valid IP",
+			name: "valid config with rise, fall and initial state",
 			config: Config{
-				StartIP:              "192.168.1.1",
-				EndIP:                "192.168.1.1",
-				Timeout:              1 * time.Second,
-				CheckPeriod:          3 * time.Second,
-				Port:                 80,
-				URLPath:              "/",
-				Scheme:               "http",
-				LogLevel:             "info",
-				MetricsPort:          9090,
-				DDNSProvider:         "dynudns",
-				DDNSUsername:         "user",
-				DDNSPassword:         "pass",
-				DDNSHostname:         "example.com",
-				DDNSRequireIPAddress: "not.an.ip",
-				DDNSTimeout:          time.Minute,
-				DDNSTTL:              time.Minute,
+				StartIP:      "192.168.1.1",
+				EndIP:        "192.168.1.5",
+				Rise:         3,
+				Fall:         2,
+				InitialState: InitialStateUp,
+				Timeout:      1 * time.Second,
+				CheckPeriod:  3 * time.Second,
+				Port:         80,
+				URLPath:      "/",
+				Scheme:       "http",
+				LogLevel:     "info",
+				MetricsPort:  9090,
 				PublicIPService: PublicIPServiceConfig{
 					Port: 443,
 				},
 			},
+		},
+		{
+			name: "negative rise",
+			config: Config{
+				StartIP:     "192.168.1.1",
+				EndIP:       "192.168.1.5",
+				Rise:        -1,
+				Timeout:     1 * time.Second,
+				CheckPeriod: 3 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				LogLevel:    "info",
+				MetricsPort: 9090,
+			},
 			errFunc: require.Error,
-			errMsg:  "invalid ddns-require-ip-address: not.an.ip",
 		},
 		{
-			name: "invalid DDNS require IP address - IPv6 address",
+			name: "negative reconcile period",
 			config: Config{
-				StartIP:              "192.168.1.1",
-				EndIP:                "192.168.1.1",
-				Timeout:              1 * time.Second,
-				CheckPeriod:          3 * time.Second,
-				Port:                 80,
-				URLPath:              "/",
-				Scheme:               "http",
-				LogLevel:             "info",
-				MetricsPort:          9090,
-				DDNSProvider:         "dynudns",
-				DDNSUsername:         "user",
-				DDNSPassword:         "pass",
-				DDNSHostname:         "example.com",
-				DDNSRequireIPAddress: "2001:db8::1",
-				DDNSTimeout:          time.Minute,
-				DDNSTTL:              time.Minute,
-				PublicIPService: PublicIPServiceConfig{
-					Port: 443,
-				},
+				StartIP:         "192.168.1.1",
+				EndIP:           "192.168.1.5",
+				ReconcilePeriod: -time.Second,
+				Timeout:         1 * time.Second,
+				CheckPeriod:     3 * time.Second,
+				Port:            80,
+				URLPath:         "/",
+				Scheme:          "http",
+				LogLevel:        "info",
+				MetricsPort:     9090,
 			},
 			errFunc: require.Error,
-			errMsg:  "ddns-require-ip-address must be an IPv4 address: 2001:db8::1",
 		},
 		{
-			name: "valid DynuDNS config - API key only",
+			name: "nexthop group buckets without nexthop groups",
+			config: Config{
+				StartIP:             "192.168.1.1",
+				EndIP:               "192.168.1.5",
+				NexthopGroupBuckets: 128,
+				Timeout:             1 * time.Second,
+				CheckPeriod:         3 * time.Second,
+				Port:                80,
+				URLPath:             "/",
+				Scheme:              "http",
+				LogLevel:            "info",
+				MetricsPort:         9090,
+			},
+			errFunc: require.Error,
+		},
+		{
+			name: "too many nexthop group buckets",
+			config: Config{
+				StartIP:             "192.168.1.1",
+				EndIP:               "192.168.1.5",
+				NexthopGroups:       true,
+				NexthopGroupBuckets: math.MaxUint16 + 1,
+				Timeout:             1 * time.Second,
+				CheckPeriod:         3 * time.Second,
+				Port:                80,
+				URLPath:             "/",
+				Scheme:              "http",
+				LogLevel:            "info",
+				MetricsPort:         9090,
+			},
+			errFunc: require.Error,
+		},
+		{
+			name: "invalid initial state",
+			config: Config{
+				StartIP:      "192.168.1.1",
+				EndIP:        "192.168.1.5",
+				InitialState: "unknown",
+				Timeout:      1 * time.Second,
+				CheckPeriod:  3 * time.Second,
+				Port:         80,
+				URLPath:      "/",
+				Scheme:       "http",
+				LogLevel:     "info",
+				MetricsPort:  9090,
+			},
+			errFunc: require.Error,
+		},
+		{
+			name: "invalid check type",
 			config: Config{
 				StartIP:     "192.168.1.1",
-				EndIP:       "192.168.1.100",
-				CheckPeriod: time.Minute,
-				Timeout:     30 * time.Second,
+				EndIP:       "192.168.1.5",
+				CheckType:   "udp",
+				Timeout:     1 * time.Second,
+				CheckPeriod: 3 * time.Second,
 				Port:        80,
 				URLPath:     "/",
 				Scheme:      "http",
 				LogLevel:    "info",
-				MetricsPort: 8080,
-				PublicIPService: PublicIPServiceConfig{
-					Port: 443,
-				},
-				DDNSProvider: "dynudns",
-				DDNSPassword: "api-key-12345",
-				DDNSHostname: "test.example.com",
-				DDNSTimeout:  time.Minute,
-				DDNSTTL:      time.Minute,
+				MetricsPort: 9090,
 			},
-			errFunc: require.NoError,
+			errFunc: require.Error,
 		},
 		{
-			name: "invalid DynuDNS config - missing API key",
+			name: "invalid gateway check type",
 			config: Config{
-				StartIP:     "192.168.1.1",
-				EndIP:       "192.168.1.100",
-				CheckPeriod: time.Minute,
-				Timeout:     30 * time.Second,
+				Gateways:    []GatewayConfig{{Address: "192.168.1.1", CheckType: "udp"}},
+				Timeout:     1 * time.Second,
+				CheckPeriod: 3 * time.Second,
 				Port:        80,
 				URLPath:     "/",
 				Scheme:      "http",
 				LogLevel:    "info",
-				MetricsPort: 8080,
-				PublicIPService: PublicIPServiceConfig{
-					Port: 443,
-				},
-				DDNSProvider: "dynudns",
-				DDNSHostname: "test.example.com",
-				DDNSTimeout:  time.Minute,
-				DDNSTTL:      time.Minute,
+				MetricsPort: 9090,
 			},
 			errFunc: require.Error,
-			errMsg:  "ddns-password is required when ddns-provider is dynudns",
 		},
 		{
-			name: "invalid provider",
+			name: "gateway weight too high",
 			config: Config{
-				StartIP:     "192.168.1.1",
-				EndIP:       "192.168.1.100",
-				CheckPeriod: time.Minute,
-				Timeout:     30 * time.Second,
+				Gateways:    []GatewayConfig{{Address: "192.168.1.1", Weight: MaxGatewayWeight + 1}},
+				Timeout:     1 * time.Second,
+				CheckPeriod: 3 * time.Second,
 				Port:        80,
 				URLPath:     "/",
 				Scheme:      "http",
 				LogLevel:    "info",
-				MetricsPort: 8080,
+				MetricsPort: 9090,
+			},
+			errFunc: require.Error,
+		},
+		{
+			name: "valid gateway interface settings",
+			config: Config{
+				Gateways:    []GatewayConfig{{Address: "10.200.0.1", Interface: "wg0", OnLink: true, PreferredSource: net.ParseIP("10.200.0.2")}},
+				Timeout:     1 * time.Second,
+				CheckPeriod: 3 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				LogLevel:    "info",
+				MetricsPort: 9090,
 				PublicIPService: PublicIPServiceConfig{
 					Port: 443,
 				},
-				DDNSProvider: "invalid-provider",
-				DDNSUsername: "user",
-				DDNSPassword: "pass",
-				DDNSHostname: "test.example.com",
-				DDNSTimeout:  time.Minute,
-				DDNSTTL:      time.Minute,
+			},
+			errFunc: require.NoError,
+		},
+		{
+			name: "gateway onlink without interface",
+			config: Config{
+				Gateways:    []GatewayConfig{{Address: "10.200.0.1", OnLink: true}},
+				Timeout:     1 * time.Second,
+				CheckPeriod: 3 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				LogLevel:    "info",
+				MetricsPort: 9090,
 			},
 			errFunc: require.Error,
-			errMsg:  "ddns-provider must be one of: dynudns",
+		},
+		{
+			name: "gateway interface name too long",
+			config: Config{
+				Gateways:    []GatewayConfig{{Address: "10.200.0.1", Interface: "wireguard-tunnel0"}},
+				Timeout:     1 * time.Second,
+				CheckPeriod: 3 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				LogLevel:    "info",
+				MetricsPort: 9090,
+			},
+			errFunc: require.Error,
+		},
+		{
+			name: "gateway preferred source in other family",
+			config: Config{
+				Gateways:    []GatewayConfig{{Address: "10.200.0.1", PreferredSource: net.ParseIP("2001:db8::2")}},
+				Timeout:     1 * time.Second,
+				CheckPeriod: 3 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				LogLevel:    "info",
+				MetricsPort: 9090,
+			},
+			errFunc: require.Error,
+		},
+		{
+			name: "negative gateway priority",
+			config: Config{
+				Gateways:    []GatewayConfig{{Address: "192.168.1.1", Priority: -1}},
+				Timeout:     1 * time.Second,
+				CheckPeriod: 3 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				LogLevel:    "info",
+				MetricsPort: 9090,
+			},
+			errFunc: require.Error,
+		},
+		{
+			name: "invalid weight mode",
+			config: Config{
+				StartIP:     "192.168.1.1",
+				EndIP:       "192.168.1.5",
+				WeightMode:  "bandwidth",
+				Timeout:     1 * time.Second,
+				CheckPeriod: 3 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				LogLevel:    "info",
+				MetricsPort: 9090,
+			},
+			errFunc: require.Error,
+		},
+		{
+			name: "DNS check without query name",
+			config: Config{
+				Gateways:    []GatewayConfig{{Address: "192.168.1.1", CheckType: CheckTypeDNS}},
+				Timeout:     1 * time.Second,
+				CheckPeriod: 3 * time.Second,
+				Port:        53,
+				URLPath:     "/",
+				Scheme:      "http",
+				LogLevel:    "info",
+				MetricsPort: 9090,
+			},
+			errFunc: require.Error,
+		},
+		{
+			name: "invalid gateway scheme",
+			config: Config{
+				Gateways:    []GatewayConfig{{Address: "192.168.1.1", Scheme: "ftp"}},
+				Timeout:     1 * time.Second,
+				CheckPeriod: 3 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				LogLevel:    "info",
+				MetricsPort: 9090,
+			},
+			errFunc: require.Error,
+		},
+		{
+			name: "invalid start IP",
+			config: Config{
+				StartIP:     "invalid-ip",
+				EndIP:       "192.168.1.10",
+				Timeout:     1 * time.Second,
+				CheckPeriod: 3 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				MetricsPort: 9090,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+			},
+			errFunc: require.Error,
+			errMsg:  "invalid start-ip: invalid-ip",
+		},
+		{
+			name: "invalid end IP",
+			config: Config{
+				StartIP:     "192.168.1.1",
+				EndIP:       "not-an-ip",
+				Timeout:     1 * time.Second,
+				CheckPeriod: 3 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				MetricsPort: 9090,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+			},
+			errFunc: require.Error,
+			errMsg:  "invalid end-ip: not-an-ip",
+		},
+		{
+			name: "start IP greater than end IP",
+			config: Config{
+				StartIP:     "192.168.1.10",
+				EndIP:       "192.168.1.1",
+				Timeout:     1 * time.Second,
+				CheckPeriod: 3 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				MetricsPort: 9090,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+			},
+			errFunc: require.Error,
+			errMsg:  "start-ip (192.168.1.10) must be less than or equal to end-ip (192.168.1.1)",
+		},
+		{
+			name: "check period less than timeout",
+			config: Config{
+				StartIP:     "192.168.1.1",
+				EndIP:       "192.168.1.10",
+				Timeout:     5 * time.Second,
+				CheckPeriod: 3 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				MetricsPort: 9090,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+			},
+			errFunc: require.Error,
+			errMsg:  "check-period (3s) must be at least as long as timeout (5s)",
+		},
+		{
+			name: "invalid scheme - empty",
+			config: Config{
+				StartIP:     "192.168.1.1",
+				EndIP:       "192.168.1.10",
+				Timeout:     1 * time.Second,
+				CheckPeriod: 3 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "",
+				MetricsPort: 9090,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+			},
+			errFunc: require.Error,
+			errMsg:  "scheme must be 'http' or 'https'",
+		},
+		{
+			name: "invalid scheme - wrong value",
+			config: Config{
+				StartIP:     "192.168.1.1",
+				EndIP:       "192.168.1.10",
+				Timeout:     1 * time.Second,
+				CheckPeriod: 3 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "ftp",
+				MetricsPort: 9090,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+			},
+			errFunc: require.Error,
+			errMsg:  "scheme must be 'http' or 'https'",
+		},
+		{
+			name: "metrics port too low",
+			config: Config{
+				StartIP:     "192.168.1.1",
+				EndIP:       "192.168.1.10",
+				Timeout:     1 * time.Second,
+				CheckPeriod: 3 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				MetricsPort: 0,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+			},
+			errFunc: require.Error,
+			errMsg:  "metrics port must be between 1 and 65535",
+		},
+		{
+			name: "metrics port too high",
+			config: Config{
+				StartIP:     "192.168.1.1",
+				EndIP:       "192.168.1.10",
+				Timeout:     1 * time.Second,
+				CheckPeriod: 3 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				MetricsPort: 65536,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+			},
+			errFunc: require.Error,
+			errMsg:  "metrics port must be between 1 and 65535",
+		},
+		{
+			name: "dns port too high",
+			config: Config{
+				StartIP:     "192.168.1.1",
+				EndIP:       "192.168.1.10",
+				Timeout:     1 * time.Second,
+				CheckPeriod: 3 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				DNSPort:     65536,
+				MetricsPort: 9090,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+			},
+			errFunc: require.Error,
+			errMsg:  "dns-port must be between 0 and 65535 (0 uses the default port 53)",
+		},
+		{
+			name: "edge case - port 1 (minimum valid port)",
+			config: Config{
+				StartIP:     "127.0.0.1",
+				EndIP:       "127.0.0.1",
+				Timeout:     1 * time.Second,
+				CheckPeriod: 3 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				LogLevel:    "info",
+				MetricsPort: 1,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+			},
+		},
+		{
+			name: "edge case - port 65535 (maximum valid port)",
+			config: Config{
+				StartIP:     "127.0.0.1",
+				EndIP:       "127.0.0.1",
+				Timeout:     1 * time.Second,
+				CheckPeriod: 3 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				LogLevel:    "error",
+				MetricsPort: 65535,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+			},
+		},
+		{
+			name: "valid DDNS config with require IP address",
+			config: Config{
+				StartIP:              "192.168.1.1",
+				EndIP:                "192.168.1.1",
+				Timeout:              1 * time.Second,
+				CheckPeriod:          3 * time.Second,
+				Port:                 80,
+				URLPath:              "/",
+				Scheme:               "http",
+				LogLevel:             "info",
+				MetricsPort:          9090,
+				DDNSProvider:         "dynudns",
+				DDNSUsername:         "user",
+				DDNSPassword:         "pass",
+				DDNSHostname:         "example.com",
+				DDNSRequireIPAddress: "192.168.1.100",
+				DDNSTimeout:          time.Minute,
+				DDNSTTL:              time.Minute,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+			},
+		},
+		{
+			name: "invalid DDNS require IP address - not a valid IP",
+			config: Config{
+				StartIP:              "192.168.1.1",
+				EndIP:                "192.168.1.1",
+				Timeout:              1 * time.Second,
+				CheckPeriod:          3 * time.Second,
+				Port:                 80,
+				URLPath:              "/",
+				Scheme:               "http",
+				LogLevel:             "info",
+				MetricsPort:          9090,
+				DDNSProvider:         "dynudns",
+				DDNSUsername:         "user",
+				DDNSPassword:         "pass",
+				DDNSHostname:         "example.com",
+				DDNSRequireIPAddress: "not.an.ip",
+				DDNSTimeout:          time.Minute,
+				DDNSTTL:              time.Minute,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+			},
+			errFunc: require.Error,
+			errMsg:  "invalid ddns-require-ip-address: not.an.ip",
+		},
+		{
+			name: "valid DDNS require IP address - IPv6 address",
+			config: Config{
+				StartIP:              "192.168.1.1",
+				EndIP:                "192.168.1.1",
+				Timeout:              1 * time.Second,
+				CheckPeriod:          3 * time.Second,
+				Port:                 80,
+				URLPath:              "/",
+				Scheme:               "http",
+				LogLevel:             "info",
+				MetricsPort:          9090,
+				DDNSProvider:         "dynudns",
+				DDNSUsername:         "user",
+				DDNSPassword:         "pass",
+				DDNSHostname:         "example.com",
+				DDNSRequireIPAddress: "2001:db8::1",
+				DDNSTimeout:          time.Minute,
+				DDNSTTL:              time.Minute,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+			},
+		},
+		{
+			name: "valid DynuDNS config - API key only",
+			config: Config{
+				StartIP:     "192.168.1.1",
+				EndIP:       "192.168.1.100",
+				CheckPeriod: time.Minute,
+				Timeout:     30 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				LogLevel:    "info",
+				MetricsPort: 8080,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+				DDNSProvider: "dynudns",
+				DDNSPassword: "api-key-12345",
+				DDNSHostname: "test.example.com",
+				DDNSTimeout:  time.Minute,
+				DDNSTTL:      time.Minute,
+			},
+			errFunc: require.NoError,
+		},
+		{
+			name: "valid Cloudflare config - API token only",
+			config: Config{
+				StartIP:     "192.168.1.1",
+				EndIP:       "192.168.1.100",
+				CheckPeriod: time.Minute,
+				Timeout:     30 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				LogLevel:    "info",
+				MetricsPort: 8080,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+				DDNSProvider:          "cloudflare",
+				DDNSPassword:          "api-token-12345",
+				DDNSHostname:          "test.example.com",
+				DDNSTimeout:           time.Minute,
+				DDNSTTL:               time.Minute,
+				DDNSCloudflareProxied: true,
+			},
+			errFunc: require.NoError,
+		},
+		{
+			name: "valid RFC 2136 config",
+			config: Config{
+				StartIP:     "192.168.1.1",
+				EndIP:       "192.168.1.100",
+				CheckPeriod: time.Minute,
+				Timeout:     30 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				LogLevel:    "info",
+				MetricsPort: 8080,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+				DDNSProvider:      "rfc2136",
+				DDNSUsername:      "ddns-key",
+				DDNSPassword:      "c2VjcmV0",
+				DDNSHostname:      "test.example.com",
+				DDNSServer:        "ns1.example.com:5353",
+				DDNSTSIGAlgorithm: "hmac-sha512",
+				DDNSTimeout:       time.Minute,
+				DDNSTTL:           time.Minute,
+			},
+			errFunc: require.NoError,
+		},
+		{
+			name: "invalid RFC 2136 config - missing server",
+			config: Config{
+				StartIP:     "192.168.1.1",
+				EndIP:       "192.168.1.100",
+				CheckPeriod: time.Minute,
+				Timeout:     30 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				LogLevel:    "info",
+				MetricsPort: 8080,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+				DDNSProvider:      "rfc2136",
+				DDNSUsername:      "ddns-key",
+				DDNSPassword:      "c2VjcmV0",
+				DDNSHostname:      "test.example.com",
+				DDNSServer:        "",
+				DDNSTSIGAlgorithm: "hmac-sha512",
+				DDNSTimeout:       time.Minute,
+				DDNSTTL:           time.Minute,
+			},
+			errFunc: require.Error,
+			errMsg:  "ddns-server is required when ddns-provider is rfc2136",
+		},
+		{
+			name: "invalid RFC 2136 config - secret not base64",
+			config: Config{
+				StartIP:     "192.168.1.1",
+				EndIP:       "192.168.1.100",
+				CheckPeriod: time.Minute,
+				Timeout:     30 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				LogLevel:    "info",
+				MetricsPort: 8080,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+				DDNSProvider:      "rfc2136",
+				DDNSUsername:      "ddns-key",
+				DDNSPassword:      "secret!",
+				DDNSHostname:      "test.example.com",
+				DDNSServer:        "ns1.example.com",
+				DDNSTSIGAlgorithm: "hmac-sha512",
+				DDNSTimeout:       time.Minute,
+				DDNSTTL:           time.Minute,
+			},
+			errFunc: require.Error,
+			errMsg:  "ddns-password must be the base64 encoded TSIG secret when ddns-provider is rfc2136",
+		},
+		{
+			name: "valid Route 53 config",
+			config: Config{
+				StartIP:     "192.168.1.1",
+				EndIP:       "192.168.1.100",
+				CheckPeriod: time.Minute,
+				Timeout:     30 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				LogLevel:    "info",
+				MetricsPort: 8080,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+				DDNSProvider:             "route53",
+				DDNSUsername:             "AKIDEXAMPLE",
+				DDNSPassword:             "secret",
+				DDNSHostname:             "test.example.com",
+				DDNSServer:               "http://localhost:4566",
+				DDNSTimeout:              time.Minute,
+				DDNSTTL:                  time.Minute,
+				DDNSRoute53RoutingPolicy: "weighted",
+				DDNSRoute53HealthChecks:  map[string]string{"1.2.3.4": "hc-1"},
+			},
+			errFunc: require.NoError,
+		},
+		{
+			name: "invalid Route 53 config - unknown routing policy",
+			config: Config{
+				StartIP:     "192.168.1.1",
+				EndIP:       "192.168.1.100",
+				CheckPeriod: time.Minute,
+				Timeout:     30 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				LogLevel:    "info",
+				MetricsPort: 8080,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+				DDNSProvider:             "route53",
+				DDNSUsername:             "AKIDEXAMPLE",
+				DDNSPassword:             "secret",
+				DDNSHostname:             "test.example.com",
+				DDNSTimeout:              time.Minute,
+				DDNSTTL:                  time.Minute,
+				DDNSRoute53RoutingPolicy: "latency",
+			},
+			errFunc: require.Error,
+			errMsg:  "ddns-route53-routing must be one of: simple, multivalue, weighted",
+		},
+		{
+			name: "invalid Route 53 config - health checks with simple routing policy",
+			config: Config{
+				StartIP:     "192.168.1.1",
+				EndIP:       "192.168.1.100",
+				CheckPeriod: time.Minute,
+				Timeout:     30 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				LogLevel:    "info",
+				MetricsPort: 8080,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+				DDNSProvider:             "route53",
+				DDNSUsername:             "AKIDEXAMPLE",
+				DDNSPassword:             "secret",
+				DDNSHostname:             "test.example.com",
+				DDNSTimeout:              time.Minute,
+				DDNSTTL:                  time.Minute,
+				DDNSRoute53RoutingPolicy: "simple",
+				DDNSRoute53HealthChecks:  map[string]string{"1.2.3.4": "hc-1"},
+			},
+			errFunc: require.Error,
+			errMsg:  "ddns-route53-health-check requires ddns-route53-routing to be multivalue or weighted",
+		},
+		{
+			name: "invalid Route 53 config - health check IP",
+			config: Config{
+				StartIP:     "192.168.1.1",
+				EndIP:       "192.168.1.100",
+				CheckPeriod: time.Minute,
+				Timeout:     30 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				LogLevel:    "info",
+				MetricsPort: 8080,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+				DDNSProvider:             "route53",
+				DDNSUsername:             "AKIDEXAMPLE",
+				DDNSPassword:             "secret",
+				DDNSHostname:             "test.example.com",
+				DDNSTimeout:              time.Minute,
+				DDNSTTL:                  time.Minute,
+				DDNSRoute53RoutingPolicy: "multivalue",
+				DDNSRoute53HealthChecks:  map[string]string{"gateway-1": "hc-1"},
+			},
+			errFunc: require.Error,
+			errMsg:  "invalid IP address in ddns-route53-health-check: gateway-1",
+		},
+		{
+			name: "invalid Route 53 config - endpoint",
+			config: Config{
+				StartIP:     "192.168.1.1",
+				EndIP:       "192.168.1.100",
+				CheckPeriod: time.Minute,
+				Timeout:     30 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				LogLevel:    "info",
+				MetricsPort: 8080,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+				DDNSProvider:             "route53",
+				DDNSUsername:             "AKIDEXAMPLE",
+				DDNSPassword:             "secret",
+				DDNSHostname:             "test.example.com",
+				DDNSServer:               "localhost:4566",
+				DDNSTimeout:              time.Minute,
+				DDNSTTL:                  time.Minute,
+				DDNSRoute53RoutingPolicy: "simple",
+			},
+			errFunc: require.Error,
+			errMsg:  "ddns-server must be an endpoint URL when ddns-provider is route53",
+		},
+		{
+			name: "valid dyndns2 config",
+			config: Config{
+				StartIP:     "192.168.1.1",
+				EndIP:       "192.168.1.100",
+				CheckPeriod: time.Minute,
+				Timeout:     30 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				LogLevel:    "info",
+				MetricsPort: 8080,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+				DDNSProvider: "dyndns2",
+				DDNSUsername: "test-user",
+				DDNSPassword: "test-password",
+				DDNSHostname: "test.example.com",
+				DDNSServer:   "https://dynupdate.example.com",
+				DDNSTimeout:  time.Minute,
+				DDNSTTL:      time.Minute,
+			},
+			errFunc: require.NoError,
+		},
+		{
+			name: "invalid dyndns2 config - missing server",
+			config: Config{
+				StartIP:     "192.168.1.1",
+				EndIP:       "192.168.1.100",
+				CheckPeriod: time.Minute,
+				Timeout:     30 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				LogLevel:    "info",
+				MetricsPort: 8080,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+				DDNSProvider: "dyndns2",
+				DDNSUsername: "test-user",
+				DDNSPassword: "test-password",
+				DDNSHostname: "test.example.com",
+				DDNSTimeout:  time.Minute,
+				DDNSTTL:      time.Minute,
+			},
+			errFunc: require.Error,
+			errMsg:  "ddns-server must be the server URL when ddns-provider is dyndns2",
+		},
+		{
+			name: "invalid dyndns2 config - server without scheme",
+			config: Config{
+				StartIP:     "192.168.1.1",
+				EndIP:       "192.168.1.100",
+				CheckPeriod: time.Minute,
+				Timeout:     30 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				LogLevel:    "info",
+				MetricsPort: 8080,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+				DDNSProvider: "dyndns2",
+				DDNSUsername: "test-user",
+				DDNSPassword: "test-password",
+				DDNSHostname: "test.example.com",
+				DDNSServer:   "dynupdate.example.com",
+				DDNSTimeout:  time.Minute,
+				DDNSTTL:      time.Minute,
+			},
+			errFunc: require.Error,
+			errMsg:  "ddns-server must be the server URL when ddns-provider is dyndns2",
+		},
+		{
+			name: "valid webhook config without credentials",
+			config: Config{
+				StartIP:     "192.168.1.1",
+				EndIP:       "192.168.1.100",
+				CheckPeriod: time.Minute,
+				Timeout:     30 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				LogLevel:    "info",
+				MetricsPort: 8080,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+				DDNSProvider: "webhook",
+				DDNSHostname: "test.example.com",
+				DDNSTimeout:  time.Minute,
+				DDNSTTL:      time.Minute,
+				DDNSWebhook:  DDNSWebhookConfig{URL: "https://example.com/update", Mode: WebhookModePerIP},
+			},
+			errFunc: require.NoError,
+		},
+		{
+			name: "invalid webhook config - missing URL",
+			config: Config{
+				StartIP:     "192.168.1.1",
+				EndIP:       "192.168.1.100",
+				CheckPeriod: time.Minute,
+				Timeout:     30 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				LogLevel:    "info",
+				MetricsPort: 8080,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+				DDNSProvider: "webhook",
+				DDNSHostname: "test.example.com",
+				DDNSTimeout:  time.Minute,
+				DDNSTTL:      time.Minute,
+				DDNSWebhook:  DDNSWebhookConfig{Mode: WebhookModeSet},
+			},
+			errFunc: require.Error,
+			errMsg:  "ddns-webhook-url is required when ddns-provider is webhook",
+		},
+		{
+			name: "invalid webhook config - unknown mode",
+			config: Config{
+				StartIP:     "192.168.1.1",
+				EndIP:       "192.168.1.100",
+				CheckPeriod: time.Minute,
+				Timeout:     30 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				LogLevel:    "info",
+				MetricsPort: 8080,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+				DDNSProvider: "webhook",
+				DDNSHostname: "test.example.com",
+				DDNSTimeout:  time.Minute,
+				DDNSTTL:      time.Minute,
+				DDNSWebhook:  DDNSWebhookConfig{URL: "https://example.com/update", Mode: "batch"},
+			},
+			errFunc: require.Error,
+			errMsg:  "ddns-webhook-mode must be one of: set, per-ip",
+		},
+		{
+			name: "invalid DynuDNS config - missing API key",
+			config: Config{
+				StartIP:     "192.168.1.1",
+				EndIP:       "192.168.1.100",
+				CheckPeriod: time.Minute,
+				Timeout:     30 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				LogLevel:    "info",
+				MetricsPort: 8080,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+				DDNSProvider: "dynudns",
+				DDNSHostname: "test.example.com",
+				DDNSTimeout:  time.Minute,
+				DDNSTTL:      time.Minute,
+			},
+			errFunc: require.Error,
+			errMsg:  "ddns-password is required when ddns-provider is dynudns",
+		},
+		{
+			name: "invalid provider",
+			config: Config{
+				StartIP:     "192.168.1.1",
+				EndIP:       "192.168.1.100",
+				CheckPeriod: time.Minute,
+				Timeout:     30 * time.Second,
+				Port:        80,
+				URLPath:     "/",
+				Scheme:      "http",
+				LogLevel:    "info",
+				MetricsPort: 8080,
+				PublicIPService: PublicIPServiceConfig{
+					Port: 443,
+				},
+				DDNSProvider: "invalid-provider",
+				DDNSUsername: "user",
+				DDNSPassword: "pass",
+				DDNSHostname: "test.example.com",
+				DDNSTimeout:  time.Minute,
+				DDNSTTL:      time.Minute,
+			},
+			errFunc: require.Error,
+			errMsg:  "ddns-provider must be one of: dynudns, cloudflare, rfc2136, route53, webhook, dyndns2",
 		},
 	}
 
@@ -546,3 +1437,427 @@ func TestReservedCIDRsContent(t *testing.T) {
 
 	assert.Equal(t, expectedCIDRs, reservedCIDRs, "Reserved CIDRs list should match expected values")
 }
+
+func TestReservedIPv6CIDRs(t *testing.T) {
+	for _, cidrStr := range reservedIPv6CIDRs {
+		t.Run(fmt.Sprintf("parse_%s", cidrStr), func(t *testing.T) {
+			ip, cidr, err := net.ParseCIDR(cidrStr)
+			require.NoError(t, err, "Reserved CIDR %s should be valid", cidrStr)
+			require.NotNil(t, cidr, "Parsed CIDR should not be nil")
+			require.Nil(t, ip.To4(), "Reserved IPv6 CIDR %s should not be an IPv4 network", cidrStr)
+		})
+	}
+}
+
+func TestConfig_DefaultRoutes(t *testing.T) {
+	tests := []struct {
+		ipFamily string
+		expected []string
+	}{
+		{
+			ipFamily: "",
+			expected: []string{"0.0.0.0/0"},
+		},
+		{
+			ipFamily: IPFamilyIPv4,
+			expected: []string{"0.0.0.0/0"},
+		},
+		{
+			ipFamily: IPFamilyIPv6,
+			expected: []string{"::/0"},
+		},
+		{
+			ipFamily: IPFamilyDual,
+			expected: []string{"0.0.0.0/0", "::/0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ipFamily, func(t *testing.T) {
+			config := Config{IPFamily: tt.ipFamily}
+
+			routes := config.defaultRoutes()
+			actual := make([]string, 0, len(routes))
+			for _, route := range routes {
+				actual = append(actual, route.String())
+			}
+
+			require.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+// Helper function to parse CIDR and fail test if invalid
+func parseCIDR(t *testing.T, cidr string) *net.IPNet {
+	t.Helper()
+
+	_, network, err := net.ParseCIDR(cidr)
+	require.NoError(t, err, "Failed to parse CIDR: %s", cidr)
+
+	return network
+}
+
+func TestParseFlags(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(`
+start-ip: 10.0.0.1
+end-ip: 10.0.0.10
+check-period: 10s
+routes:
+  - 10.0.0.0/8
+exclude-cidrs:
+  - 192.168.0.0/16
+exclude-reserved-cidrs: false
+`), 0o600))
+
+	gatewaysConfigFile := filepath.Join(t.TempDir(), "gateways.yaml")
+	require.NoError(t, os.WriteFile(gatewaysConfigFile, []byte("gateways: [10.0.0.1, 10.0.0.2]\n"), 0o600))
+
+	tests := []struct {
+		name     string
+		args     []string
+		validate func(t *testing.T, config Config)
+		errFunc  require.ErrorAssertionFunc
+	}{
+		{
+			name: "flags only",
+			args: []string{"-start-ip", "192.168.1.1", "-end-ip", "192.168.1.5", "-exclude-reserved-cidrs=false"},
+			validate: func(t *testing.T, config Config) {
+				assert.Equal(t, "192.168.1.1", config.StartIP)
+				assert.Equal(t, "192.168.1.5", config.EndIP)
+				assert.Equal(t, 3*time.Second, config.CheckPeriod)
+				assert.Equal(t, []RouteConfig{{Destination: parseCIDR(t, "0.0.0.0/0")}}, config.Routes)
+				assert.Empty(t, config.CIDRsToExclude)
+			},
+		},
+		{
+			name: "config file",
+			args: []string{"-config", configFile},
+			validate: func(t *testing.T, config Config) {
+				assert.Equal(t, configFile, config.ConfigFile)
+				assert.Equal(t, "10.0.0.1", config.StartIP)
+				assert.Equal(t, "10.0.0.10", config.EndIP)
+				assert.Equal(t, 10*time.Second, config.CheckPeriod)
+				assert.Equal(t, 9999, config.Port) // Default is kept when not set in the file
+				assert.Equal(t, 1, config.Rise)
+				assert.Equal(t, InitialStateFirstCheck, config.InitialState)
+				assert.Equal(t, []RouteConfig{{Destination: parseCIDR(t, "10.0.0.0/8")}}, config.Routes)
+				assert.Equal(t, []*net.IPNet{parseCIDR(t, "192.168.0.0/16")}, config.CIDRsToExclude)
+			},
+		},
+		{
+			name: "flags take precedence over config file",
+			args: []string{"-end-ip", "10.0.0.20", "-config", configFile, "-route", "default", "-exclude-cidr", "172.16.0.0/12"},
+			validate: func(t *testing.T, config Config) {
+				assert.Equal(t, "10.0.0.1", config.StartIP)
+				assert.Equal(t, "10.0.0.20", config.EndIP)
+				assert.Equal(t, 10*time.Second, config.CheckPeriod)
+				assert.Equal(t, []RouteConfig{{Destination: parseCIDR(t, "0.0.0.0/0")}}, config.Routes)
+				assert.Equal(t, []*net.IPNet{parseCIDR(t, "172.16.0.0/12")}, config.CIDRsToExclude)
+			},
+		},
+		{
+			name: "gateway flags replace config file gateways",
+			args: []string{"-config", gatewaysConfigFile, "-gateway", "10.1.0.1,port=8080"},
+			validate: func(t *testing.T, config Config) {
+				assert.Equal(t, []GatewayConfig{{Address: "10.1.0.1", Port: 8080}}, config.Gateways)
+			},
+		},
+		{
+			name: "HTTP check flags",
+			args: []string{"-http-header", "Authorization: Bearer token", "-http-header", "X-Check: 1", "-http-expected-status", "200,204", "-http-body-regex", "ok"},
+			validate: func(t *testing.T, config Config) {
+				assert.Equal(t, "GET", config.HTTPCheck.Method)
+				assert.Equal(t, "Bearer token", config.HTTPCheck.Headers.Get("Authorization"))
+				assert.Equal(t, "1", config.HTTPCheck.Headers.Get("X-Check"))
+				assert.Equal(t, []StatusRange{{Min: 200, Max: 200}, {Min: 204, Max: 204}}, config.HTTPCheck.ExpectedStatuses)
+				require.NotNil(t, config.HTTPCheck.BodyRegex)
+				assert.Equal(t, int64(DefaultHTTPMaxBodySize), config.HTTPCheck.MaxBodySize)
+			},
+		},
+		{
+			name: "Route 53 flags",
+			args: []string{"-ddns-route53-routing", "multivalue", "-ddns-route53-health-check", "1.2.3.4=hc-1", "-ddns-route53-health-check", "2001:db8::1=hc-2"},
+			validate: func(t *testing.T, config Config) {
+				assert.Equal(t, "multivalue", config.DDNSRoute53RoutingPolicy)
+				assert.Equal(t, map[string]string{"1.2.3.4": "hc-1", "2001:db8::1": "hc-2"}, config.DDNSRoute53HealthChecks)
+			},
+		},
+		{
+			name:    "invalid Route 53 health check flag",
+			args:    []string{"-ddns-route53-health-check", "1.2.3.4"},
+			errFunc: require.Error,
+		},
+		{
+			name: "webhook flags",
+			args: []string{"-ddns-webhook-url", "https://example.com/{{.Hostname}}", "-ddns-webhook-header", "Authorization: Bearer {{.Password}}", "-ddns-webhook-body", "{{json .IPs}}", "-ddns-webhook-success-codes", "200,204", "-ddns-webhook-success-regex", "^ok", "-ddns-webhook-mode", "per-ip"},
+			validate: func(t *testing.T, config Config) {
+				assert.Equal(t, "POST", config.DDNSWebhook.Method)
+				assert.Equal(t, "https://example.com/{{.Hostname}}", config.DDNSWebhook.URL)
+				assert.Equal(t, http.Header{"Authorization": {"Bearer {{.Password}}"}}, config.DDNSWebhook.Headers)
+				assert.Equal(t, "{{json .IPs}}", config.DDNSWebhook.Body)
+				assert.Equal(t, []StatusRange{{Min: 200, Max: 200}, {Min: 204, Max: 204}}, config.DDNSWebhook.SuccessStatuses)
+				require.NotNil(t, config.DDNSWebhook.SuccessRegex)
+				assert.Equal(t, "^ok", config.DDNSWebhook.SuccessRegex.String())
+				assert.Equal(t, WebhookModePerIP, config.DDNSWebhook.Mode)
+			},
+		},
+		{
+			name: "dyndns2 flags",
+			args: []string{"-ddns-provider", "dyndns2", "-ddns-server", "https://dynupdate.example.com", "-ddns-dyndns2-multiple-ips"},
+			validate: func(t *testing.T, config Config) {
+				assert.Equal(t, "dyndns2", config.DDNSProvider)
+				assert.Equal(t, "https://dynupdate.example.com", config.DDNSServer)
+				assert.True(t, config.DDNSDynDNS2MultipleIPs)
+			},
+		},
+		{
+			name: "dns port flag",
+			args: []string{"-check-type", "dns", "-dns-port", "5353"},
+			validate: func(t *testing.T, config Config) {
+				assert.Equal(t, 5353, config.DNSPort)
+			},
+		},
+		{
+			name: "default dns port",
+			args: []string{},
+			validate: func(t *testing.T, config Config) {
+				assert.Equal(t, DefaultDNSPort, config.DNSPort)
+			},
+		},
+		{
+			name: "health state flags",
+			args: []string{"-rise", "3", "-fall", "2", "-initial-state", InitialStateDown},
+			validate: func(t *testing.T, config Config) {
+				assert.Equal(t, 3, config.Rise)
+				assert.Equal(t, 2, config.Fall)
+				assert.Equal(t, InitialStateDown, config.InitialState)
+			},
+		},
+		{
+			name: "flap damping flags",
+			args: []string{"-flap-damping", "-flap-half-life", "5m"},
+			validate: func(t *testing.T, config Config) {
+				assert.True(t, config.FlapDamping.Enabled)
+				assert.Equal(t, 5*time.Minute, config.FlapDamping.HalfLife)
+				assert.Equal(t, 2000, config.FlapDamping.SuppressThreshold)
+			},
+		},
+		{
+			name: "pool flags",
+			args: []string{"-gateway", "10.1.0.1,pool=fast", "-route", "10.0.0.0/8,pool=fast", "-route", "default", "-pool", "fast,fallback=default"},
+			validate: func(t *testing.T, config Config) {
+				assert.Equal(t, []RouteConfig{
+					{Destination: parseCIDR(t, "10.0.0.0/8"), Pool: "fast"},
+					{Destination: parseCIDR(t, "0.0.0.0/0")},
+				}, config.Routes)
+				assert.Equal(t, []PoolConfig{{Name: "fast", Fallback: DefaultPool}}, config.Pools)
+			},
+		},
+		{
+			name: "dry run flag",
+			args: []string{"-dry-run"},
+			validate: func(t *testing.T, config Config) {
+				assert.True(t, config.DryRun)
+			},
+		},
+		{
+			name: "no gateway flags",
+			args: []string{"-no-gateway-policy", NoGatewayPolicyGateway, "-no-gateway-fallback", "192.168.1.254"},
+			validate: func(t *testing.T, config Config) {
+				assert.Equal(t, NoGatewayConfig{Policy: NoGatewayPolicyGateway, FallbackGateways: []net.IP{net.ParseIP("192.168.1.254")}}, config.NoGateway)
+			},
+		},
+		{
+			name: "source policy flags",
+			args: []string{"-source-cidr", "192.168.10.0/24", "-fwmark", "0x10/0xff"},
+			validate: func(t *testing.T, config Config) {
+				assert.Equal(t, []*net.IPNet{parseCIDR(t, "192.168.10.0/24")}, config.SourceCIDRs)
+				assert.Equal(t, []FWMark{{Mark: 0x10, Mask: 0xff}}, config.FWMarks)
+			},
+		},
+		{
+			name: "nftables flags",
+			args: []string{"-bypass-fwmark", "0x2/0x2", "-nftables", "-nftables-mark", "0x100"},
+			validate: func(t *testing.T, config Config) {
+				assert.Equal(t, []FWMark{{Mark: 0x2, Mask: 0x2}}, config.BypassFWMarks)
+				assert.True(t, config.NFTables.Enabled)
+				assert.Equal(t, DefaultNFTablesTable, config.NFTables.Table)
+				assert.Equal(t, FWMark{Mark: 0x100, Mask: math.MaxUint32}, config.NFTables.BypassMark())
+				assert.Equal(t, DefaultNFTablesGatewayMark, config.NFTables.UseGatewayMark())
+				assert.False(t, config.NFTables.SelectsGateways())
+			},
+		},
+		{
+			name: "nftables network flags",
+			args: []string{"-nftables", "-nftables-gateway-mark", "0x4/0x4", "-nftables-bypass-source", "192.168.50.0/24", "-nftables-gateway-dest", "203.0.113.0/24", "-nftables-gateway-source", "192.168.10.0/24"},
+			validate: func(t *testing.T, config Config) {
+				assert.Equal(t, FWMark{Mark: 0x4, Mask: 0x4}, config.NFTables.UseGatewayMark())
+				assert.Equal(t, []*net.IPNet{parseCIDR(t, "192.168.50.0/24")}, config.NFTables.BypassSources)
+				assert.Equal(t, []*net.IPNet{parseCIDR(t, "203.0.113.0/24")}, config.NFTables.GatewayDestinations)
+				assert.Equal(t, []*net.IPNet{parseCIDR(t, "192.168.10.0/24")}, config.NFTables.GatewaySources)
+				assert.True(t, config.NFTables.SelectsGateways())
+			},
+		},
+		{
+			name:    "invalid fwmark flag",
+			args:    []string{"-fwmark", "vpn"},
+			errFunc: require.Error,
+		},
+		{
+			name:    "invalid route pool option",
+			args:    []string{"-route", "10.0.0.0/8,priority=1"},
+			errFunc: require.Error,
+		},
+		{
+			name:    "invalid HTTP body regex flag",
+			args:    []string{"-http-body-regex", "("},
+			errFunc: require.Error,
+		},
+		{
+			name:    "missing config file",
+			args:    []string{"-config", filepath.Join(t.TempDir(), "missing.yaml")},
+			errFunc: require.Error,
+		},
+		{
+			name:    "unknown flag",
+			args:    []string{"-not-a-flag"},
+			errFunc: require.Error,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := ParseFlags(tt.args)
+
+			errFunc := tt.errFunc
+			if errFunc == nil {
+				errFunc = require.NoError
+			}
+			errFunc(t, err)
+
+			if tt.validate != nil {
+				tt.validate(t, config)
+			}
+		})
+	}
+}
+
+func TestConfig_Reload(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(configFile, []byte(`{"start-ip": "10.0.0.1", "end-ip": "10.0.0.5"}`), 0o600))
+
+	config, err := ParseFlags([]string{"-config", configFile, "-port", "8080"})
+	require.NoError(t, err)
+	require.Equal(t, "10.0.0.5", config.EndIP)
+
+	require.NoError(t, os.WriteFile(configFile, []byte(`{"start-ip": "10.0.0.1", "end-ip": "10.0.0.9", "port": 1234}`), 0o600))
+
+	reloaded, err := config.Reload()
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.9", reloaded.EndIP)
+	assert.Equal(t, 8080, reloaded.Port) // Flags still take precedence after a reload
+	assert.Equal(t, configFile, reloaded.ConfigFile)
+}
+
+func TestConfig_Reload_IPFamily(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(configFile, []byte(`{"start-ip": "10.0.0.1", "end-ip": "10.0.0.5"}`), 0o600))
+
+	config, err := ParseFlags([]string{"-config", configFile, "-exclude-reserved-cidrs"})
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(configFile, []byte(`{"start-ip": "10.0.0.1", "end-ip": "10.0.0.5", "ip-family": "dual"}`), 0o600))
+
+	reloaded, err := config.Reload()
+	require.NoError(t, err)
+	assert.Equal(t, IPFamilyDual, reloaded.IPFamily) // Reported so that the change can be detected
+	assert.Equal(t, config.CIDRsToExclude, reloaded.CIDRsToExclude)
+	assert.Equal(t, config.Routes, reloaded.Routes)
+}
+
+func TestParseGatewayConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected GatewayConfig
+		errFunc  require.ErrorAssertionFunc
+	}{
+		{
+			name:     "address only",
+			input:    "192.168.1.1",
+			expected: GatewayConfig{Address: "192.168.1.1"},
+		},
+		{
+			name:     "range with all overrides",
+			input:    "10.0.0.1-10.0.0.5,type=grpc,port=8080,path=/healthz,scheme=https,weight=4,priority=1,pool=fast,pool=backup",
+			expected: GatewayConfig{Address: "10.0.0.1-10.0.0.5", CheckType: "grpc", Port: 8080, Path: "/healthz", Scheme: "https", Weight: 4, Priority: 1, Pools: []string{"fast", "backup"}},
+		},
+		{
+			name:     "CIDR with port override",
+			input:    "2001:db8::/126, port=9000",
+			expected: GatewayConfig{Address: "2001:db8::/126", Port: 9000},
+		},
+		{
+			name:    "empty address",
+			input:   ",port=80",
+			errFunc: require.Error,
+		},
+		{
+			name:    "option without value",
+			input:   "192.168.1.1,port",
+			errFunc: require.Error,
+		},
+		{
+			name:    "invalid port",
+			input:   "192.168.1.1,port=http",
+			errFunc: require.Error,
+		},
+		{
+			name:    "invalid weight",
+			input:   "192.168.1.1,weight=heavy",
+			errFunc: require.Error,
+		},
+		{
+			name:    "invalid priority",
+			input:   "192.168.1.1,priority=primary",
+			errFunc: require.Error,
+		},
+		{
+			name:     "interface settings",
+			input:    "10.200.0.1,dev=wg0,onlink=true,src=10.200.0.2",
+			expected: GatewayConfig{Address: "10.200.0.1", Interface: "wg0", OnLink: true, PreferredSource: net.ParseIP("10.200.0.2")},
+		},
+		{
+			name:    "invalid onlink flag",
+			input:   "10.200.0.1,dev=wg0,onlink=maybe",
+			errFunc: require.Error,
+		},
+		{
+			name:    "invalid preferred source",
+			input:   "10.200.0.1,src=local",
+			errFunc: require.Error,
+		},
+		{
+			name:    "unknown option",
+			input:   "192.168.1.1,tier=2",
+			errFunc: require.Error,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gateway, err := ParseGatewayConfig(tt.input)
+
+			errFunc := tt.errFunc
+			if errFunc == nil {
+				errFunc = require.NoError
+			}
+			errFunc(t, err)
+
+			if tt.errFunc == nil {
+				assert.Equal(t, tt.expected, gateway)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// FlapDampingConfig holds the route flap damping options. Each gateway state change adds Penalty to the gateway's
+// penalty, which halves every HalfLife. A gateway whose penalty reaches SuppressThreshold is kept out of the routes
+// until its penalty decays below ReuseThreshold.
+type FlapDampingConfig struct {
+	Enabled           bool
+	Penalty           int
+	SuppressThreshold int
+	ReuseThreshold    int
+	HalfLife          time.Duration
+	MaxSuppressTime   time.Duration // Upper limit for how long a gateway can be suppressed after its last state change. Zero disables the limit.
+}
+
+// MaxPenalty returns the highest penalty that a gateway can accumulate, so that it is suppressed for at most
+// MaxSuppressTime. Returns zero if there is no limit.
+func (c FlapDampingConfig) MaxPenalty() float64 {
+	if c.MaxSuppressTime <= 0 || c.HalfLife <= 0 {
+		return 0
+	}
+
+	halfLives := c.MaxSuppressTime.Seconds() / c.HalfLife.Seconds()
+	return float64(c.ReuseThreshold) * math.Exp2(halfLives)
+}
+
+// validate validates the flap damping options. The options are only checked when damping is enabled.
+func (c FlapDampingConfig) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	if c.Penalty <= 0 {
+		return fmt.Errorf("flap-penalty must be greater than zero")
+	}
+
+	if c.ReuseThreshold <= 0 {
+		return fmt.Errorf("flap-reuse-threshold must be greater than zero")
+	}
+
+	if c.SuppressThreshold <= c.ReuseThreshold {
+		return fmt.Errorf("flap-suppress-threshold (%d) must be greater than flap-reuse-threshold (%d)",
+			c.SuppressThreshold, c.ReuseThreshold)
+	}
+
+	if c.HalfLife <= 0 {
+		return fmt.Errorf("flap-half-life must be greater than zero")
+	}
+
+	if c.MaxSuppressTime < 0 {
+		return fmt.Errorf("flap-max-suppress-time must not be negative")
+	}
+
+	if maxPenalty := c.MaxPenalty(); maxPenalty != 0 && maxPenalty < float64(c.SuppressThreshold) {
+		return fmt.Errorf("flap-max-suppress-time (%v) is too short for gateways to ever be suppressed", c.MaxSuppressTime)
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlapDampingConfig_Validate(t *testing.T) {
+	valid := FlapDampingConfig{
+		Enabled:           true,
+		Penalty:           500,
+		SuppressThreshold: 2000,
+		ReuseThreshold:    750,
+		HalfLife:          15 * time.Minute,
+		MaxSuppressTime:   time.Hour,
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(c *FlapDampingConfig)
+		errFunc require.ErrorAssertionFunc
+	}{
+		{
+			name:   "valid",
+			modify: func(c *FlapDampingConfig) {},
+		},
+		{
+			name:   "disabled options are not checked",
+			modify: func(c *FlapDampingConfig) { *c = FlapDampingConfig{Penalty: -1} },
+		},
+		{
+			name:   "no max suppress time",
+			modify: func(c *FlapDampingConfig) { c.MaxSuppressTime = 0 },
+		},
+		{
+			name:    "zero penalty",
+			modify:  func(c *FlapDampingConfig) { c.Penalty = 0 },
+			errFunc: require.Error,
+		},
+		{
+			name:    "zero reuse threshold",
+			modify:  func(c *FlapDampingConfig) { c.ReuseThreshold = 0 },
+			errFunc: require.Error,
+		},
+		{
+			name:    "suppress threshold not above reuse threshold",
+			modify:  func(c *FlapDampingConfig) { c.SuppressThreshold = c.ReuseThreshold },
+			errFunc: require.Error,
+		},
+		{
+			name:    "zero half-life",
+			modify:  func(c *FlapDampingConfig) { c.HalfLife = 0 },
+			errFunc: require.Error,
+		},
+		{
+			name:    "negative max suppress time",
+			modify:  func(c *FlapDampingConfig) { c.MaxSuppressTime = -time.Second },
+			errFunc: require.Error,
+		},
+		{
+			name:    "max suppress time too short to suppress",
+			modify:  func(c *FlapDampingConfig) { c.MaxSuppressTime = time.Minute },
+			errFunc: require.Error,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.errFunc == nil {
+				tt.errFunc = require.NoError
+			}
+
+			c := valid
+			tt.modify(&c)
+			tt.errFunc(t, c.validate())
+		})
+	}
+}
+
+func TestFlapDampingConfig_MaxPenalty(t *testing.T) {
+	c := FlapDampingConfig{ReuseThreshold: 750, HalfLife: 15 * time.Minute, MaxSuppressTime: time.Hour}
+	assert.InDelta(t, 750*16, c.MaxPenalty(), 0.001)
+
+	c.MaxSuppressTime = 0
+	assert.Zero(t, c.MaxPenalty())
+}
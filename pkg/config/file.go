@@ -0,0 +1,435 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// fileConfig is the structure of the configuration file. Keys match the command line flag names, with list
+// values using the plural form. All fields are optional, and unset fields keep their default values.
+// JSON is a subset of YAML, so both formats are supported by the same decoder.
+type fileConfig struct {
+	StartIP               *string           `yaml:"start-ip"`
+	EndIP                 *string           `yaml:"end-ip"`
+	Gateways              []fileGateway     `yaml:"gateways"`
+	Timeout               *time.Duration    `yaml:"timeout"`
+	CheckPeriod           *time.Duration    `yaml:"check-period"`
+	CheckType             *string           `yaml:"check-type"`
+	Port                  *int              `yaml:"port"`
+	URLPath               *string           `yaml:"path"`
+	Scheme                *string           `yaml:"scheme"`
+	HTTPMethod            *string           `yaml:"http-method"`
+	HTTPHeaders           map[string]string `yaml:"http-headers"`
+	HTTPExpectedStatus    *string           `yaml:"http-expected-status"`
+	HTTPBodyContains      *string           `yaml:"http-body-contains"`
+	HTTPBodyRegex         *string           `yaml:"http-body-regex"`
+	HTTPJSONPath          *string           `yaml:"http-json-path"`
+	HTTPJSONValue         *string           `yaml:"http-json-value"`
+	HTTPMaxBodySize       *int64            `yaml:"http-max-body-size"`
+	DNSQueryName          *string           `yaml:"dns-query-name"`
+	DNSPort               *int              `yaml:"dns-port"`
+	GRPCService           *string           `yaml:"grpc-service"`
+	Rise                  *int              `yaml:"rise"`
+	Fall                  *int              `yaml:"fall"`
+	InitialState          *string           `yaml:"initial-state"`
+	WeightMode            *string           `yaml:"weight-mode"`
+	MinTierGateways       *int              `yaml:"min-tier-gateways"`
+	FlapDamping           *bool             `yaml:"flap-damping"`
+	FlapPenalty           *int              `yaml:"flap-penalty"`
+	FlapSuppressThreshold *int              `yaml:"flap-suppress-threshold"`
+	FlapReuseThreshold    *int              `yaml:"flap-reuse-threshold"`
+	FlapHalfLife          *time.Duration    `yaml:"flap-half-life"`
+	FlapMaxSuppressTime   *time.Duration    `yaml:"flap-max-suppress-time"`
+	DryRun                *bool             `yaml:"dry-run"`
+	LogLevel              *string           `yaml:"log-level"`
+	MetricsPort           *int              `yaml:"metrics-port"`
+	FirstRoutingTableID   *int              `yaml:"first-routing-table-id"`
+	FirstRulePreference   *int              `yaml:"first-rule-preference"`
+	IPFamily              *string           `yaml:"ip-family"`
+	Routes                []string          `yaml:"routes"`
+	Pools                 []filePool        `yaml:"pools"`
+	SourceCIDRs           []string          `yaml:"source-cidrs"`
+	FWMarks               []string          `yaml:"fwmarks"`
+	BypassFWMarks         []string          `yaml:"bypass-fwmarks"`
+	NFTables              *bool             `yaml:"nftables"`
+	NFTablesTable         *string           `yaml:"nftables-table"`
+	NFTablesMark          *string           `yaml:"nftables-mark"`
+	NFTablesGatewayMark   *string           `yaml:"nftables-gateway-mark"`
+	NFTablesBypassSources []string          `yaml:"nftables-bypass-sources"`
+	NFTablesGatewayDests  []string          `yaml:"nftables-gateway-dests"`
+	NFTablesGatewaySrcs   []string          `yaml:"nftables-gateway-sources"`
+	ConntrackFlush        *bool             `yaml:"conntrack-flush"`
+	ReconcilePeriod       *time.Duration    `yaml:"reconcile-period"`
+	NexthopGroups         *bool             `yaml:"nexthop-groups"`
+	NexthopGroupBuckets   *int              `yaml:"nexthop-group-buckets"`
+	NoGatewayPolicy       *string           `yaml:"no-gateway-policy"`
+	NoGatewayFallbacks    []string          `yaml:"no-gateway-fallbacks"`
+	ExcludeCIDRs          []string          `yaml:"exclude-cidrs"`
+	ExcludeReservedCIDRs  *bool             `yaml:"exclude-reserved-cidrs"`
+
+	// DDNS configuration
+	DDNSProvider             *string           `yaml:"ddns-provider"`
+	DDNSUsername             *string           `yaml:"ddns-username"`
+	DDNSPassword             *string           `yaml:"ddns-password"`
+	DDNSHostname             *string           `yaml:"ddns-hostname"`
+	DDNSRequireIPAddress     *string           `yaml:"ddns-require-ip-address"`
+	DDNSTimeout              *time.Duration    `yaml:"ddns-timeout"`
+	DDNSTTL                  *time.Duration    `yaml:"ddns-record-ttl"`
+	DDNSRecordComment        *string           `yaml:"ddns-record-comment"`
+	DDNSCloudflareProxied    *bool             `yaml:"ddns-cloudflare-proxied"`
+	DDNSServer               *string           `yaml:"ddns-server"`
+	DDNSZone                 *string           `yaml:"ddns-zone"`
+	DDNSTSIGAlgorithm        *string           `yaml:"ddns-tsig-algorithm"`
+	DDNSRoute53RoutingPolicy *string           `yaml:"ddns-route53-routing"`
+	DDNSRoute53HealthChecks  map[string]string `yaml:"ddns-route53-health-checks"`
+	DDNSWebhookURL           *string           `yaml:"ddns-webhook-url"`
+	DDNSWebhookMethod        *string           `yaml:"ddns-webhook-method"`
+	DDNSWebhookHeaders       map[string]string `yaml:"ddns-webhook-headers"`
+	DDNSWebhookBody          *string           `yaml:"ddns-webhook-body"`
+	DDNSWebhookSuccessCodes  *string           `yaml:"ddns-webhook-success-codes"`
+	DDNSWebhookSuccessRegex  *string           `yaml:"ddns-webhook-success-regex"`
+	DDNSWebhookMode          *string           `yaml:"ddns-webhook-mode"`
+	DDNSDynDNS2MultipleIPs   *bool             `yaml:"ddns-dyndns2-multiple-ips"`
+
+	// Public IP service configuration
+	PublicIPServiceHostname *string `yaml:"public-ip-service-hostname"`
+	PublicIPServicePort     *int    `yaml:"public-ip-service-port"`
+	PublicIPServiceScheme   *string `yaml:"public-ip-service-scheme"`
+	PublicIPServicePath     *string `yaml:"public-ip-service-path"`
+	PublicIPServiceUsername *string `yaml:"public-ip-service-username"`
+	PublicIPServicePassword *string `yaml:"public-ip-service-password"`
+}
+
+// fileGateway is a gateway entry in the configuration file. It can either be a string using the same syntax as the
+// -gateway flag, or a mapping with address, type, port, path, scheme, weight, priority, pools, dev, onlink and src
+// keys.
+type fileGateway GatewayConfig
+
+func (g *fileGateway) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		gateway, err := ParseGatewayConfig(value.Value)
+		if err != nil {
+			return err
+		}
+
+		*g = fileGateway(gateway)
+		return nil
+	}
+
+	var gateway struct {
+		Address   string   `yaml:"address"`
+		CheckType string   `yaml:"type"`
+		Port      int      `yaml:"port"`
+		Path      string   `yaml:"path"`
+		Scheme    string   `yaml:"scheme"`
+		Weight    int      `yaml:"weight"`
+		Priority  int      `yaml:"priority"`
+		Pools     []string `yaml:"pools"`
+		Interface string   `yaml:"dev"`
+		OnLink    bool     `yaml:"onlink"`
+		Source    string   `yaml:"src"`
+	}
+	if err := value.Decode(&gateway); err != nil {
+		return err
+	}
+
+	if gateway.Address == "" {
+		return fmt.Errorf("gateway address is required")
+	}
+
+	var source net.IP
+	if gateway.Source != "" {
+		source = net.ParseIP(gateway.Source)
+		if source == nil {
+			return fmt.Errorf("invalid gateway preferred source %q", gateway.Source)
+		}
+	}
+
+	*g = fileGateway{
+		Address:         gateway.Address,
+		CheckType:       gateway.CheckType,
+		Port:            gateway.Port,
+		Path:            gateway.Path,
+		Scheme:          gateway.Scheme,
+		Weight:          gateway.Weight,
+		Priority:        gateway.Priority,
+		Pools:           gateway.Pools,
+		Interface:       gateway.Interface,
+		OnLink:          gateway.OnLink,
+		PreferredSource: source,
+	}
+	return nil
+}
+
+// filePool is a pool entry in the configuration file. It can either be a string using the same syntax as the -pool
+// flag, or a mapping with name, min-tier-gateways and fallback keys.
+type filePool PoolConfig
+
+func (p *filePool) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		pool, err := ParsePoolConfig(value.Value)
+		if err != nil {
+			return err
+		}
+
+		*p = filePool(pool)
+		return nil
+	}
+
+	var pool struct {
+		Name            string `yaml:"name"`
+		MinTierGateways int    `yaml:"min-tier-gateways"`
+		Fallback        string `yaml:"fallback"`
+	}
+	if err := value.Decode(&pool); err != nil {
+		return err
+	}
+
+	if pool.Name == "" {
+		return fmt.Errorf("pool name is required")
+	}
+
+	*p = filePool(pool)
+	return nil
+}
+
+// loadConfigFile reads the configuration file at the given path and applies it to the config and parse state
+func loadConfigFile(path string, config *Config, state *parseState) error {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	var file fileConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to decode file: %w", err)
+	}
+
+	return file.apply(config, state)
+}
+
+// apply sets all values that are present in the file on the config and parse state
+func (f *fileConfig) apply(config *Config, state *parseState) error {
+	setIfPresent(&config.StartIP, f.StartIP)
+	setIfPresent(&config.EndIP, f.EndIP)
+	setIfPresent(&config.Timeout, f.Timeout)
+	setIfPresent(&config.CheckPeriod, f.CheckPeriod)
+	setIfPresent(&config.CheckType, f.CheckType)
+	setIfPresent(&config.Port, f.Port)
+	setIfPresent(&config.URLPath, f.URLPath)
+	setIfPresent(&config.Scheme, f.Scheme)
+	setIfPresent(&config.HTTPCheck.Method, f.HTTPMethod)
+	setIfPresent(&config.HTTPCheck.BodyContains, f.HTTPBodyContains)
+	setIfPresent(&config.HTTPCheck.JSONPath, f.HTTPJSONPath)
+	setIfPresent(&config.HTTPCheck.JSONValue, f.HTTPJSONValue)
+	setIfPresent(&config.HTTPCheck.MaxBodySize, f.HTTPMaxBodySize)
+	setIfPresent(&config.DNSQueryName, f.DNSQueryName)
+	setIfPresent(&config.DNSPort, f.DNSPort)
+	setIfPresent(&config.GRPCService, f.GRPCService)
+	setIfPresent(&config.Rise, f.Rise)
+	setIfPresent(&config.Fall, f.Fall)
+	setIfPresent(&config.InitialState, f.InitialState)
+	setIfPresent(&config.WeightMode, f.WeightMode)
+	setIfPresent(&config.MinTierGateways, f.MinTierGateways)
+	setIfPresent(&config.FlapDamping.Enabled, f.FlapDamping)
+	setIfPresent(&config.FlapDamping.Penalty, f.FlapPenalty)
+	setIfPresent(&config.FlapDamping.SuppressThreshold, f.FlapSuppressThreshold)
+	setIfPresent(&config.FlapDamping.ReuseThreshold, f.FlapReuseThreshold)
+	setIfPresent(&config.FlapDamping.HalfLife, f.FlapHalfLife)
+	setIfPresent(&config.FlapDamping.MaxSuppressTime, f.FlapMaxSuppressTime)
+	setIfPresent(&config.DryRun, f.DryRun)
+	setIfPresent(&config.LogLevel, f.LogLevel)
+	setIfPresent(&config.MetricsPort, f.MetricsPort)
+	setIfPresent(&config.FirstRoutingTableID, f.FirstRoutingTableID)
+	setIfPresent(&config.FirstRulePreference, f.FirstRulePreference)
+	setIfPresent(&config.IPFamily, f.IPFamily)
+	setIfPresent(&state.excludeReservedCIDRs, f.ExcludeReservedCIDRs)
+	setIfPresent(&config.NFTables.Enabled, f.NFTables)
+	setIfPresent(&config.NFTables.Table, f.NFTablesTable)
+	setIfPresent(&config.ConntrackFlush, f.ConntrackFlush)
+	setIfPresent(&config.ReconcilePeriod, f.ReconcilePeriod)
+	setIfPresent(&config.NexthopGroups, f.NexthopGroups)
+	setIfPresent(&config.NexthopGroupBuckets, f.NexthopGroupBuckets)
+	setIfPresent(&config.NoGateway.Policy, f.NoGatewayPolicy)
+
+	setIfPresent(&config.DDNSProvider, f.DDNSProvider)
+	setIfPresent(&config.DDNSUsername, f.DDNSUsername)
+	setIfPresent(&config.DDNSPassword, f.DDNSPassword)
+	setIfPresent(&config.DDNSHostname, f.DDNSHostname)
+	setIfPresent(&config.DDNSRequireIPAddress, f.DDNSRequireIPAddress)
+	setIfPresent(&config.DDNSTimeout, f.DDNSTimeout)
+	setIfPresent(&config.DDNSTTL, f.DDNSTTL)
+	setIfPresent(&config.DDNSRecordComment, f.DDNSRecordComment)
+	setIfPresent(&config.DDNSCloudflareProxied, f.DDNSCloudflareProxied)
+	setIfPresent(&config.DDNSServer, f.DDNSServer)
+	setIfPresent(&config.DDNSZone, f.DDNSZone)
+	setIfPresent(&config.DDNSTSIGAlgorithm, f.DDNSTSIGAlgorithm)
+	setIfPresent(&config.DDNSRoute53RoutingPolicy, f.DDNSRoute53RoutingPolicy)
+	if f.DDNSRoute53HealthChecks != nil {
+		config.DDNSRoute53HealthChecks = f.DDNSRoute53HealthChecks
+	}
+	setIfPresent(&config.DDNSWebhook.URL, f.DDNSWebhookURL)
+	setIfPresent(&config.DDNSWebhook.Method, f.DDNSWebhookMethod)
+	setIfPresent(&config.DDNSWebhook.Body, f.DDNSWebhookBody)
+	setIfPresent(&config.DDNSWebhook.Mode, f.DDNSWebhookMode)
+	setIfPresent(&config.DDNSDynDNS2MultipleIPs, f.DDNSDynDNS2MultipleIPs)
+
+	setIfPresent(&config.PublicIPService.Hostname, f.PublicIPServiceHostname)
+	setIfPresent(&config.PublicIPService.Port, f.PublicIPServicePort)
+	setIfPresent(&config.PublicIPService.Scheme, f.PublicIPServiceScheme)
+	setIfPresent(&config.PublicIPService.Path, f.PublicIPServicePath)
+	setIfPresent(&config.PublicIPService.Username, f.PublicIPServiceUsername)
+	setIfPresent(&config.PublicIPService.Password, f.PublicIPServicePassword)
+
+	if f.HTTPHeaders != nil {
+		config.HTTPCheck.Headers = make(http.Header, len(f.HTTPHeaders))
+		for name, value := range f.HTTPHeaders {
+			config.HTTPCheck.Headers.Set(name, value)
+		}
+	}
+
+	if f.HTTPExpectedStatus != nil {
+		statuses, err := ParseStatusRanges(*f.HTTPExpectedStatus)
+		if err != nil {
+			return fmt.Errorf("invalid http-expected-status: %w", err)
+		}
+		config.HTTPCheck.ExpectedStatuses = statuses
+	}
+
+	if f.HTTPBodyRegex != nil {
+		bodyRegex, err := regexp.Compile(*f.HTTPBodyRegex)
+		if err != nil {
+			return fmt.Errorf("invalid http-body-regex: %w", err)
+		}
+		config.HTTPCheck.BodyRegex = bodyRegex
+	}
+
+	if f.DDNSWebhookHeaders != nil {
+		config.DDNSWebhook.Headers = make(http.Header, len(f.DDNSWebhookHeaders))
+		for name, value := range f.DDNSWebhookHeaders {
+			config.DDNSWebhook.Headers.Set(name, value)
+		}
+	}
+
+	if f.DDNSWebhookSuccessCodes != nil {
+		statuses, err := ParseStatusRanges(*f.DDNSWebhookSuccessCodes)
+		if err != nil {
+			return fmt.Errorf("invalid ddns-webhook-success-codes: %w", err)
+		}
+		config.DDNSWebhook.SuccessStatuses = statuses
+	}
+
+	if f.DDNSWebhookSuccessRegex != nil {
+		successRegex, err := regexp.Compile(*f.DDNSWebhookSuccessRegex)
+		if err != nil {
+			return fmt.Errorf("invalid ddns-webhook-success-regex: %w", err)
+		}
+		config.DDNSWebhook.SuccessRegex = successRegex
+	}
+
+	if f.Gateways != nil {
+		config.Gateways = make([]GatewayConfig, 0, len(f.Gateways))
+		for _, gateway := range f.Gateways {
+			config.Gateways = append(config.Gateways, GatewayConfig(gateway))
+		}
+	}
+
+	if f.Pools != nil {
+		config.Pools = make([]PoolConfig, 0, len(f.Pools))
+		for _, pool := range f.Pools {
+			config.Pools = append(config.Pools, PoolConfig(pool))
+		}
+	}
+
+	for _, route := range f.Routes {
+		if err := parseRoute(route, config, state); err != nil {
+			return fmt.Errorf("invalid routes entry %q: %w", route, err)
+		}
+	}
+
+	for _, cidr := range f.SourceCIDRs {
+		if err := parseSourceCIDR(cidr, config); err != nil {
+			return fmt.Errorf("invalid source-cidrs entry %q: %w", cidr, err)
+		}
+	}
+
+	for _, fwmarkStr := range f.FWMarks {
+		fwmark, err := ParseFWMark(fwmarkStr)
+		if err != nil {
+			return fmt.Errorf("invalid fwmarks entry %q: %w", fwmarkStr, err)
+		}
+		config.FWMarks = append(config.FWMarks, fwmark)
+	}
+
+	for _, fwmarkStr := range f.BypassFWMarks {
+		fwmark, err := ParseFWMark(fwmarkStr)
+		if err != nil {
+			return fmt.Errorf("invalid bypass-fwmarks entry %q: %w", fwmarkStr, err)
+		}
+		config.BypassFWMarks = append(config.BypassFWMarks, fwmark)
+	}
+
+	for _, fallback := range f.NoGatewayFallbacks {
+		if err := parseNoGatewayFallback(fallback, config); err != nil {
+			return fmt.Errorf("invalid no-gateway-fallbacks entry %q: %w", fallback, err)
+		}
+	}
+
+	if f.NFTablesMark != nil {
+		fwmark, err := ParseFWMark(*f.NFTablesMark)
+		if err != nil {
+			return fmt.Errorf("invalid nftables-mark: %w", err)
+		}
+		config.NFTables.Mark = fwmark
+	}
+
+	if f.NFTablesGatewayMark != nil {
+		fwmark, err := ParseFWMark(*f.NFTablesGatewayMark)
+		if err != nil {
+			return fmt.Errorf("invalid nftables-gateway-mark: %w", err)
+		}
+		config.NFTables.GatewayMark = fwmark
+	}
+
+	nftablesNetworks := []struct {
+		key   string
+		cidrs []string
+		dest  *[]*net.IPNet
+	}{
+		{key: "nftables-bypass-sources", cidrs: f.NFTablesBypassSources, dest: &config.NFTables.BypassSources},
+		{key: "nftables-gateway-dests", cidrs: f.NFTablesGatewayDests, dest: &config.NFTables.GatewayDestinations},
+		{key: "nftables-gateway-sources", cidrs: f.NFTablesGatewaySrcs, dest: &config.NFTables.GatewaySources},
+	}
+	for _, networks := range nftablesNetworks {
+		for _, cidr := range networks.cidrs {
+			if err := parseCIDRInto(cidr, networks.dest); err != nil {
+				return fmt.Errorf("invalid %s entry %q: %w", networks.key, cidr, err)
+			}
+		}
+	}
+
+	for _, cidr := range f.ExcludeCIDRs {
+		if err := parseExcludeCIDR(cidr, state); err != nil {
+			return fmt.Errorf("invalid exclude-cidrs entry %q: %w", cidr, err)
+		}
+	}
+
+	return nil
+}
+
+func setIfPresent[T any](dst *T, value *T) {
+	if value != nil {
+		*dst = *value
+	}
+}
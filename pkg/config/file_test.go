@@ -0,0 +1,362 @@
+package config
+
+import (
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		contents string
+		validate func(t *testing.T, config Config, state parseState)
+		errFunc  require.ErrorAssertionFunc
+	}{
+		{
+			name:     "yaml",
+			fileName: "config.yaml",
+			contents: `
+start-ip: 10.0.0.1
+end-ip: 10.0.0.10
+timeout: 2s
+ip-family: dual
+routes:
+  - default
+  - 10.0.0.0/8
+exclude-cidrs:
+  - 192.168.0.0/16
+exclude-reserved-cidrs: false
+rise: 3
+fall: 2
+initial-state: up
+flap-damping: true
+flap-penalty: 1000
+ddns-provider: dynudns
+public-ip-service-port: 8443
+`,
+			validate: func(t *testing.T, config Config, state parseState) {
+				assert.Equal(t, "10.0.0.1", config.StartIP)
+				assert.Equal(t, "10.0.0.10", config.EndIP)
+				assert.Equal(t, 2*time.Second, config.Timeout)
+				assert.Equal(t, IPFamilyDual, config.IPFamily)
+				assert.Equal(t, 3, config.Rise)
+				assert.Equal(t, 2, config.Fall)
+				assert.Equal(t, InitialStateUp, config.InitialState)
+				assert.True(t, config.FlapDamping.Enabled)
+				assert.Equal(t, 1000, config.FlapDamping.Penalty)
+				assert.Equal(t, "dynudns", config.DDNSProvider)
+				assert.Equal(t, 8443, config.PublicIPService.Port)
+				assert.True(t, state.defaultRoute)
+				assert.False(t, state.excludeReservedCIDRs)
+				require.Len(t, config.Routes, 1)
+				assert.Equal(t, "10.0.0.0/8", config.Routes[0].Destination.String())
+				require.Len(t, state.cidrsToExclude, 1)
+				assert.Equal(t, "192.168.0.0/16", state.cidrsToExclude[0].String())
+			},
+		},
+		{
+			name:     "json",
+			fileName: "config.json",
+			contents: `{"start-ip": "2001:db8::1", "end-ip": "2001:db8::5", "port": 8080, "routes": ["::/0"]}`,
+			validate: func(t *testing.T, config Config, state parseState) {
+				assert.Equal(t, "2001:db8::1", config.StartIP)
+				assert.Equal(t, "2001:db8::5", config.EndIP)
+				assert.Equal(t, 8080, config.Port)
+				require.Len(t, config.Routes, 1)
+				assert.Equal(t, "::/0", config.Routes[0].Destination.String())
+			},
+		},
+		{
+			name:     "gateways",
+			fileName: "config.yaml",
+			contents: `
+gateways:
+  - 10.0.0.1
+  - 10.0.1.0/29,port=8080
+  - address: 10.0.2.1-10.0.2.5
+    type: grpc
+    port: 9000
+    path: /healthz
+    scheme: https
+    weight: 3
+    priority: 1
+    pools: [fast]
+  - address: 10.200.0.1
+    dev: wg0
+    onlink: true
+    src: 10.200.0.2
+`,
+			validate: func(t *testing.T, config Config, state parseState) {
+				assert.Equal(t, []GatewayConfig{
+					{Address: "10.0.0.1"},
+					{Address: "10.0.1.0/29", Port: 8080},
+					{Address: "10.0.2.1-10.0.2.5", CheckType: "grpc", Port: 9000, Path: "/healthz", Scheme: "https", Weight: 3, Priority: 1, Pools: []string{"fast"}},
+					{Address: "10.200.0.1", Interface: "wg0", OnLink: true, PreferredSource: net.ParseIP("10.200.0.2")},
+				}, config.Gateways)
+			},
+		},
+		{
+			name:     "pools",
+			fileName: "config.yaml",
+			contents: `
+routes:
+  - 10.0.0.0/8,pool=fast
+pools:
+  - cheap
+  - name: fast
+    min-tier-gateways: 2
+    fallback: cheap
+`,
+			validate: func(t *testing.T, config Config, state parseState) {
+				require.Len(t, config.Routes, 1)
+				assert.Equal(t, "fast", config.Routes[0].Pool)
+				assert.Equal(t, []PoolConfig{
+					{Name: "cheap"},
+					{Name: "fast", MinTierGateways: 2, Fallback: "cheap"},
+				}, config.Pools)
+			},
+		},
+		{
+			name:     "source policy",
+			fileName: "config.yaml",
+			contents: `
+source-cidrs:
+  - 192.168.10.0/24
+fwmarks:
+  - 0x10/0xff
+  - "32"
+bypass-fwmarks:
+  - 0x2/0x2
+nftables: true
+nftables-table: routes
+nftables-mark: 0x100/0x100
+nftables-gateway-mark: 0x200/0x200
+nftables-bypass-sources:
+  - 192.168.50.0/24
+nftables-gateway-dests:
+  - 203.0.113.0/24
+nftables-gateway-sources:
+  - 192.168.20.0/24
+conntrack-flush: true
+reconcile-period: 1m
+nexthop-groups: true
+nexthop-group-buckets: 128
+no-gateway-policy: gateway
+no-gateway-fallbacks:
+  - 192.168.1.254
+`,
+			validate: func(t *testing.T, config Config, state parseState) {
+				assert.Equal(t, []*net.IPNet{parseCIDR(t, "192.168.10.0/24")}, config.SourceCIDRs)
+				assert.Equal(t, []FWMark{{Mark: 0x10, Mask: 0xff}, {Mark: 32, Mask: math.MaxUint32}}, config.FWMarks)
+				assert.Equal(t, []FWMark{{Mark: 0x2, Mask: 0x2}}, config.BypassFWMarks)
+				assert.Equal(t, NFTablesConfig{
+					Enabled:             true,
+					Table:               "routes",
+					Mark:                FWMark{Mark: 0x100, Mask: 0x100},
+					GatewayMark:         FWMark{Mark: 0x200, Mask: 0x200},
+					BypassSources:       []*net.IPNet{parseCIDR(t, "192.168.50.0/24")},
+					GatewayDestinations: []*net.IPNet{parseCIDR(t, "203.0.113.0/24")},
+					GatewaySources:      []*net.IPNet{parseCIDR(t, "192.168.20.0/24")},
+				}, config.NFTables)
+				assert.True(t, config.ConntrackFlush)
+				assert.Equal(t, time.Minute, config.ReconcilePeriod)
+				assert.True(t, config.NexthopGroups)
+				assert.Equal(t, 128, config.NexthopGroupBuckets)
+				assert.Equal(t, NoGatewayConfig{Policy: NoGatewayPolicyGateway, FallbackGateways: []net.IP{net.ParseIP("192.168.1.254")}}, config.NoGateway)
+			},
+		},
+		{
+			name:     "cloudflare ddns",
+			fileName: "config.yaml",
+			contents: `
+ddns-provider: cloudflare
+ddns-hostname: gateways.example.com
+ddns-record-comment: gateways
+ddns-cloudflare-proxied: true
+`,
+			validate: func(t *testing.T, config Config, state parseState) {
+				assert.Equal(t, "cloudflare", config.DDNSProvider)
+				assert.Equal(t, "gateways.example.com", config.DDNSHostname)
+				assert.Equal(t, "gateways", config.DDNSRecordComment)
+				assert.True(t, config.DDNSCloudflareProxied)
+			},
+		},
+		{
+			name:     "rfc2136 ddns",
+			fileName: "config.yaml",
+			contents: `
+ddns-provider: rfc2136
+ddns-server: ns1.example.com:53
+ddns-zone: example.com
+ddns-tsig-algorithm: hmac-sha512
+`,
+			validate: func(t *testing.T, config Config, state parseState) {
+				assert.Equal(t, "rfc2136", config.DDNSProvider)
+				assert.Equal(t, "ns1.example.com:53", config.DDNSServer)
+				assert.Equal(t, "example.com", config.DDNSZone)
+				assert.Equal(t, "hmac-sha512", config.DDNSTSIGAlgorithm)
+			},
+		},
+		{
+			name:     "route53 ddns",
+			fileName: "config.yaml",
+			contents: `
+ddns-provider: route53
+ddns-zone: Z123
+ddns-route53-routing: weighted
+ddns-route53-health-checks:
+  1.2.3.4: hc-1
+`,
+			validate: func(t *testing.T, config Config, state parseState) {
+				assert.Equal(t, "route53", config.DDNSProvider)
+				assert.Equal(t, "Z123", config.DDNSZone)
+				assert.Equal(t, "weighted", config.DDNSRoute53RoutingPolicy)
+				assert.Equal(t, map[string]string{"1.2.3.4": "hc-1"}, config.DDNSRoute53HealthChecks)
+			},
+		},
+		{
+			name:     "webhook ddns",
+			fileName: "config.yaml",
+			contents: `
+ddns-provider: webhook
+ddns-webhook-url: https://example.com/update?hostname={{.Hostname}}
+ddns-webhook-method: PUT
+ddns-webhook-headers:
+  X-Api-Key: "{{.Password}}"
+ddns-webhook-body: '{"ips": {{json .IPs}}}'
+ddns-webhook-success-codes: "200-299"
+ddns-webhook-success-regex: ok
+ddns-webhook-mode: per-ip
+`,
+			validate: func(t *testing.T, config Config, state parseState) {
+				assert.Equal(t, "webhook", config.DDNSProvider)
+				assert.Equal(t, "https://example.com/update?hostname={{.Hostname}}", config.DDNSWebhook.URL)
+				assert.Equal(t, "PUT", config.DDNSWebhook.Method)
+				assert.Equal(t, "{{.Password}}", config.DDNSWebhook.Headers.Get("X-Api-Key"))
+				assert.Equal(t, `{"ips": {{json .IPs}}}`, config.DDNSWebhook.Body)
+				assert.Equal(t, []StatusRange{{Min: 200, Max: 299}}, config.DDNSWebhook.SuccessStatuses)
+				require.NotNil(t, config.DDNSWebhook.SuccessRegex)
+				assert.Equal(t, WebhookModePerIP, config.DDNSWebhook.Mode)
+			},
+		},
+		{
+			name:     "dyndns2 ddns",
+			fileName: "config.yaml",
+			contents: `
+ddns-provider: dyndns2
+ddns-server: https://dynupdate.example.com
+ddns-dyndns2-multiple-ips: true
+`,
+			validate: func(t *testing.T, config Config, state parseState) {
+				assert.Equal(t, "dyndns2", config.DDNSProvider)
+				assert.Equal(t, "https://dynupdate.example.com", config.DDNSServer)
+				assert.True(t, config.DDNSDynDNS2MultipleIPs)
+			},
+		},
+		{
+			name:     "invalid webhook success regex",
+			fileName: "config.yaml",
+			contents: "ddns-webhook-success-regex: '('\n",
+			errFunc:  require.Error,
+		},
+		{
+			name:     "gateway without address",
+			fileName: "config.yaml",
+			contents: "gateways:\n  - port: 8080\n",
+			errFunc:  require.Error,
+		},
+		{
+			name:     "empty file",
+			fileName: "config.yaml",
+			contents: "",
+			validate: func(t *testing.T, config Config, state parseState) {
+				assert.Equal(t, Config{}, config)
+			},
+		},
+		{
+			name:     "HTTP check options",
+			fileName: "config.yaml",
+			contents: `
+http-method: HEAD
+http-headers:
+  authorization: Bearer token
+http-expected-status: 200,300-399
+http-body-contains: ok
+http-body-regex: ^ok$
+http-json-path: status
+http-json-value: running
+http-max-body-size: 4096
+`,
+			validate: func(t *testing.T, config Config, state parseState) {
+				assert.Equal(t, "HEAD", config.HTTPCheck.Method)
+				assert.Equal(t, "Bearer token", config.HTTPCheck.Headers.Get("Authorization"))
+				assert.Equal(t, []StatusRange{{Min: 200, Max: 200}, {Min: 300, Max: 399}}, config.HTTPCheck.ExpectedStatuses)
+				assert.Equal(t, "ok", config.HTTPCheck.BodyContains)
+				require.NotNil(t, config.HTTPCheck.BodyRegex)
+				assert.Equal(t, "^ok$", config.HTTPCheck.BodyRegex.String())
+				assert.Equal(t, "status", config.HTTPCheck.JSONPath)
+				assert.Equal(t, "running", config.HTTPCheck.JSONValue)
+				assert.Equal(t, int64(4096), config.HTTPCheck.MaxBodySize)
+			},
+		},
+		{
+			name:     "invalid HTTP body regex",
+			fileName: "config.yaml",
+			contents: "http-body-regex: '('\n",
+			errFunc:  require.Error,
+		},
+		{
+			name:     "unknown key",
+			fileName: "config.yaml",
+			contents: "not-a-key: true\n",
+			errFunc:  require.Error,
+		},
+		{
+			name:     "invalid route",
+			fileName: "config.yaml",
+			contents: "routes: [not-a-cidr]\n",
+			errFunc:  require.Error,
+		},
+		{
+			name:     "invalid exclude CIDR",
+			fileName: "config.yaml",
+			contents: "exclude-cidrs: [10.0.0.0]\n",
+			errFunc:  require.Error,
+		},
+		{
+			name:     "invalid duration",
+			fileName: "config.yaml",
+			contents: "timeout: soon\n",
+			errFunc:  require.Error,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.fileName)
+			require.NoError(t, os.WriteFile(path, []byte(tt.contents), 0o600))
+
+			var config Config
+			var state parseState
+			err := loadConfigFile(path, &config, &state)
+
+			errFunc := tt.errFunc
+			if errFunc == nil {
+				errFunc = require.NoError
+			}
+			errFunc(t, err)
+
+			if tt.validate != nil {
+				tt.validate(t, config, state)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Default maximum number of response body bytes that are read by HTTP health checks
+const DefaultHTTPMaxBodySize = 1 << 20
+
+// HTTPCheckConfig holds the request and response matching options for HTTP health checks. Zero values use the
+// defaults (GET requests, any 2xx status, and a body size limit of DefaultHTTPMaxBodySize).
+type HTTPCheckConfig struct {
+	Method           string
+	Headers          http.Header
+	ExpectedStatuses []StatusRange
+	BodyContains     string
+	BodyRegex        *regexp.Regexp
+	JSONPath         string // Dot-separated path into the JSON response body, e.g. `status` or `checks.0.state`
+	JSONValue        string // Expected value at JSONPath. If empty, the value only needs to be present and not null.
+	MaxBodySize      int64
+}
+
+// ReadsBody returns true if any of the configured assertions require the response body
+func (c HTTPCheckConfig) ReadsBody() bool {
+	return c.BodyContains != "" || c.BodyRegex != nil || c.JSONPath != ""
+}
+
+// StatusRange is an inclusive range of HTTP status codes
+type StatusRange struct {
+	Min int
+	Max int
+}
+
+// Contains returns true if the status code is in the range
+func (r StatusRange) Contains(statusCode int) bool {
+	return statusCode >= r.Min && statusCode <= r.Max
+}
+
+func (r StatusRange) String() string {
+	if r.Min == r.Max {
+		return strconv.Itoa(r.Min)
+	}
+
+	return fmt.Sprintf("%d-%d", r.Min, r.Max)
+}
+
+// DefaultExpectedStatuses accepts any 2xx status code
+var DefaultExpectedStatuses = []StatusRange{{Min: 200, Max: 299}}
+
+// ParseStatusRanges parses a comma-separated list of status codes and inclusive ranges, e.g. `200,204,300-399`
+func ParseStatusRanges(s string) ([]StatusRange, error) {
+	var ranges []StatusRange
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		minStr, maxStr, isRange := strings.Cut(part, "-")
+		if !isRange {
+			maxStr = minStr
+		}
+
+		minCode, err := strconv.Atoi(strings.TrimSpace(minStr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid status code %q: %w", minStr, err)
+		}
+
+		maxCode, err := strconv.Atoi(strings.TrimSpace(maxStr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid status code %q: %w", maxStr, err)
+		}
+
+		if minCode < 100 || maxCode > 599 || minCode > maxCode {
+			return nil, fmt.Errorf("invalid status code range %q (codes must be between 100 and 599)", part)
+		}
+
+		ranges = append(ranges, StatusRange{Min: minCode, Max: maxCode})
+	}
+
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("at least one status code is required")
+	}
+
+	return ranges, nil
+}
+
+// parseHeader parses a header of the form `Name: value` and adds it to the headers
+func parseHeader(s string, headers http.Header) error {
+	name, value, ok := strings.Cut(s, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return fmt.Errorf("invalid header %q (expected 'Name: value')", s)
+	}
+
+	headers.Add(name, strings.TrimSpace(value))
+	return nil
+}
+
+// validate validates the HTTP health check options
+func (c HTTPCheckConfig) validate() error {
+	if strings.ContainsAny(c.Method, " \t\r\n") {
+		return fmt.Errorf("http-method must be a valid HTTP method")
+	}
+
+	if c.MaxBodySize < 0 {
+		return fmt.Errorf("http-max-body-size must not be negative")
+	}
+
+	if c.JSONValue != "" && c.JSONPath == "" {
+		return fmt.Errorf("http-json-path is required when http-json-value is set")
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStatusRanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []StatusRange
+		errFunc  require.ErrorAssertionFunc
+	}{
+		{
+			name:     "single code",
+			input:    "200",
+			expected: []StatusRange{{Min: 200, Max: 200}},
+		},
+		{
+			name:     "codes and ranges",
+			input:    "200, 204,300-399",
+			expected: []StatusRange{{Min: 200, Max: 200}, {Min: 204, Max: 204}, {Min: 300, Max: 399}},
+		},
+		{
+			name:    "empty",
+			input:   " , ",
+			errFunc: require.Error,
+		},
+		{
+			name:    "not a number",
+			input:   "ok",
+			errFunc: require.Error,
+		},
+		{
+			name:    "out of range",
+			input:   "600",
+			errFunc: require.Error,
+		},
+		{
+			name:    "reversed range",
+			input:   "299-200",
+			errFunc: require.Error,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranges, err := ParseStatusRanges(tt.input)
+
+			errFunc := tt.errFunc
+			if errFunc == nil {
+				errFunc = require.NoError
+			}
+			errFunc(t, err)
+
+			assert.Equal(t, tt.expected, ranges)
+		})
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	headers := http.Header{}
+
+	require.NoError(t, parseHeader("Authorization: Bearer token", headers))
+	require.NoError(t, parseHeader("x-custom:value:with:colons", headers))
+	require.Error(t, parseHeader("no-colon", headers))
+	require.Error(t, parseHeader(": value", headers))
+
+	assert.Equal(t, "Bearer token", headers.Get("Authorization"))
+	assert.Equal(t, "value:with:colons", headers.Get("X-Custom"))
+}
+
+func TestHTTPCheckConfig_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  HTTPCheckConfig
+		errFunc require.ErrorAssertionFunc
+	}{
+		{
+			name:   "defaults",
+			config: HTTPCheckConfig{},
+		},
+		{
+			name:   "all options",
+			config: HTTPCheckConfig{Method: http.MethodHead, MaxBodySize: 1024, JSONPath: "status", JSONValue: "ok"},
+		},
+		{
+			name:    "invalid method",
+			config:  HTTPCheckConfig{Method: "GET POST"},
+			errFunc: require.Error,
+		},
+		{
+			name:    "negative max body size",
+			config:  HTTPCheckConfig{MaxBodySize: -1},
+			errFunc: require.Error,
+		},
+		{
+			name:    "JSON value without path",
+			config:  HTTPCheckConfig{JSONValue: "ok"},
+			errFunc: require.Error,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errFunc := tt.errFunc
+			if errFunc == nil {
+				errFunc = require.NoError
+			}
+			errFunc(t, tt.config.validate())
+		})
+	}
+}
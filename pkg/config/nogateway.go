@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/iputil"
+)
+
+// No gateway policies, which control what happens to traffic to a route without any active gateways
+const (
+	NoGatewayPolicyFallthrough = "fallthrough" // The route is removed, and traffic uses the rest of the system routing tables
+	NoGatewayPolicyBlackhole   = "blackhole"   // Traffic is silently dropped
+	NoGatewayPolicyUnreachable = "unreachable" // Traffic is rejected with an ICMP unreachable error
+	NoGatewayPolicyProhibit    = "prohibit"    // Traffic is rejected with an ICMP administratively prohibited error
+	NoGatewayPolicyGateway     = "gateway"     // Traffic is routed via a static fallback gateway
+)
+
+var noGatewayPolicies = []string{NoGatewayPolicyFallthrough, NoGatewayPolicyBlackhole, NoGatewayPolicyUnreachable, NoGatewayPolicyProhibit, NoGatewayPolicyGateway}
+
+// NoGatewayConfig configures the route that is installed for destinations without any active gateways
+type NoGatewayConfig struct {
+	Policy string // One of the NoGatewayPolicy* values. Empty is treated as NoGatewayPolicyFallthrough.
+	// Static gateways used by NoGatewayPolicyGateway, at most one per IP family. Routes in a family without a
+	// fallback gateway fall through.
+	FallbackGateways []net.IP
+}
+
+func parseNoGatewayFallback(s string, config *Config) error {
+	ip := net.ParseIP(strings.TrimSpace(s))
+	if ip == nil {
+		return fmt.Errorf("invalid IP address %q", s)
+	}
+
+	config.NoGateway.FallbackGateways = append(config.NoGateway.FallbackGateways, ip)
+	return nil
+}
+
+// validateNoGateway validates the no gateway policy and its fallback gateways
+func (c Config) validateNoGateway() error {
+	if c.NoGateway.Policy != "" && !slices.Contains(noGatewayPolicies, c.NoGateway.Policy) {
+		return fmt.Errorf("no-gateway-policy must be one of: %s", strings.Join(noGatewayPolicies, ", "))
+	}
+
+	if c.NoGateway.Policy != NoGatewayPolicyGateway {
+		if len(c.NoGateway.FallbackGateways) > 0 {
+			return fmt.Errorf("no-gateway-fallback requires no-gateway-policy to be %q", NoGatewayPolicyGateway)
+		}
+
+		return nil
+	}
+
+	if len(c.NoGateway.FallbackGateways) == 0 {
+		return fmt.Errorf("no-gateway-policy %q requires at least one no-gateway-fallback", NoGatewayPolicyGateway)
+	}
+
+	for i, fallback := range c.NoGateway.FallbackGateways {
+		if !c.usesFamilyOf(fallback) {
+			return fmt.Errorf("no gateway fallback %s is not in the managed IP family (%s)", fallback.String(), c.IPFamily)
+		}
+
+		for _, other := range c.NoGateway.FallbackGateways[:i] {
+			if iputil.Family(other) == iputil.Family(fallback) {
+				return fmt.Errorf("only one no gateway fallback can be configured per IP family (got %s and %s)", other.String(), fallback.String())
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_ValidateNoGateway(t *testing.T) {
+	fallback4 := net.ParseIP("192.168.1.254")
+	fallback6 := net.ParseIP("fd00::1")
+
+	tests := []struct {
+		name    string
+		config  Config
+		errFunc require.ErrorAssertionFunc
+	}{
+		{
+			name:   "unset",
+			config: Config{},
+		},
+		{
+			name:   "blackhole",
+			config: Config{NoGateway: NoGatewayConfig{Policy: NoGatewayPolicyBlackhole}},
+		},
+		{
+			name:    "unknown policy",
+			config:  Config{NoGateway: NoGatewayConfig{Policy: "drop"}},
+			errFunc: require.Error,
+		},
+		{
+			name: "fallback gateway per family",
+			config: Config{
+				IPFamily:  IPFamilyDual,
+				NoGateway: NoGatewayConfig{Policy: NoGatewayPolicyGateway, FallbackGateways: []net.IP{fallback4, fallback6}},
+			},
+		},
+		{
+			name:    "fallback gateway policy without fallbacks",
+			config:  Config{NoGateway: NoGatewayConfig{Policy: NoGatewayPolicyGateway}},
+			errFunc: require.Error,
+		},
+		{
+			name:    "fallbacks without fallback gateway policy",
+			config:  Config{NoGateway: NoGatewayConfig{Policy: NoGatewayPolicyBlackhole, FallbackGateways: []net.IP{fallback4}}},
+			errFunc: require.Error,
+		},
+		{
+			name:    "fallback not in managed family",
+			config:  Config{IPFamily: IPFamilyIPv4, NoGateway: NoGatewayConfig{Policy: NoGatewayPolicyGateway, FallbackGateways: []net.IP{fallback6}}},
+			errFunc: require.Error,
+		},
+		{
+			name: "multiple fallbacks in one family",
+			config: Config{NoGateway: NoGatewayConfig{
+				Policy:           NoGatewayPolicyGateway,
+				FallbackGateways: []net.IP{fallback4, net.ParseIP("192.168.1.253")},
+			}},
+			errFunc: require.Error,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.errFunc == nil {
+				tt.errFunc = require.NoError
+			}
+
+			tt.errFunc(t, tt.config.validateNoGateway())
+		})
+	}
+}
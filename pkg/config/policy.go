@@ -0,0 +1,196 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DefaultNFTablesTable is the name of the nftables table that is managed when nftables integration is enabled
+const DefaultNFTablesTable = "gateway-route-manager"
+
+// DefaultNFTablesMark is the firewall mark that the nftables table sets on packets to excluded destinations
+var DefaultNFTablesMark = FWMark{Mark: 0x1000000, Mask: 0x1000000}
+
+// DefaultNFTablesGatewayMark is the firewall mark that the nftables table sets on packets that are routed via the
+// gateways
+var DefaultNFTablesGatewayMark = FWMark{Mark: 0x2000000, Mask: 0x2000000}
+
+// FWMark matches traffic by firewall mark. Traffic matches when its mark, after applying Mask, equals Mark.
+type FWMark struct {
+	Mark uint32
+	Mask uint32
+}
+
+func (f FWMark) String() string {
+	return fmt.Sprintf("%#x/%#x", f.Mark, f.Mask)
+}
+
+// ParseFWMark parses a firewall mark of the form `mark[/mask]`. Values may be decimal or hexadecimal (with a 0x
+// prefix). When no mask is given, all bits of the mark are compared.
+func ParseFWMark(s string) (FWMark, error) {
+	markStr, maskStr, hasMask := strings.Cut(strings.TrimSpace(s), "/")
+
+	mark, err := strconv.ParseUint(markStr, 0, 32)
+	if err != nil {
+		return FWMark{}, fmt.Errorf("invalid fwmark %q: %w", markStr, err)
+	}
+
+	fwmark := FWMark{Mark: uint32(mark), Mask: math.MaxUint32}
+	if hasMask {
+		mask, err := strconv.ParseUint(maskStr, 0, 32)
+		if err != nil {
+			return FWMark{}, fmt.Errorf("invalid fwmark mask %q: %w", maskStr, err)
+		}
+		fwmark.Mask = uint32(mask)
+	}
+
+	return fwmark, nil
+}
+
+// NFTablesConfig configures the nftables table that marks packets to excluded destinations and from bypassed sources,
+// so that they bypass the gateways, and packets to or from the gateway networks, so that they use the gateways
+type NFTablesConfig struct {
+	Enabled             bool
+	Table               string
+	Mark                FWMark // Zero is treated as DefaultNFTablesMark
+	GatewayMark         FWMark // Zero is treated as DefaultNFTablesGatewayMark
+	BypassSources       []*net.IPNet
+	GatewayDestinations []*net.IPNet
+	GatewaySources      []*net.IPNet
+}
+
+// BypassMark returns the firewall mark that is set on packets to excluded destinations and from bypassed sources
+func (c NFTablesConfig) BypassMark() FWMark {
+	if c.Mark == (FWMark{}) {
+		return DefaultNFTablesMark
+	}
+
+	return c.Mark
+}
+
+// UseGatewayMark returns the firewall mark that is set on packets to or from the gateway networks
+func (c NFTablesConfig) UseGatewayMark() FWMark {
+	if c.GatewayMark == (FWMark{}) {
+		return DefaultNFTablesGatewayMark
+	}
+
+	return c.GatewayMark
+}
+
+// SelectsGateways returns true if the table marks packets to be routed via the gateways. Like the other selectors,
+// this limits the traffic that is routed via the gateways to the selected traffic.
+func (c NFTablesConfig) SelectsGateways() bool {
+	return c.Enabled && (len(c.GatewayDestinations) > 0 || len(c.GatewaySources) > 0)
+}
+
+// Equal returns true if both configs have the same options
+func (c NFTablesConfig) Equal(other NFTablesConfig) bool {
+	equalNetworks := func(a, b []*net.IPNet) bool {
+		return slices.EqualFunc(a, b, func(a, b *net.IPNet) bool {
+			return a.String() == b.String()
+		})
+	}
+
+	return c.Enabled == other.Enabled &&
+		c.Table == other.Table &&
+		c.Mark == other.Mark &&
+		c.GatewayMark == other.GatewayMark &&
+		equalNetworks(c.BypassSources, other.BypassSources) &&
+		equalNetworks(c.GatewayDestinations, other.GatewayDestinations) &&
+		equalNetworks(c.GatewaySources, other.GatewaySources)
+}
+
+// validatePolicy validates the selectors that limit which traffic is routed via the gateways
+func (c Config) validatePolicy() error {
+	for i, cidr := range c.SourceCIDRs {
+		if !c.usesFamilyOf(cidr.IP) {
+			return fmt.Errorf("source CIDR %s is not in the managed IP family (%s)", cidr.String(), c.IPFamily)
+		}
+
+		for _, other := range c.SourceCIDRs[:i] {
+			if other.String() == cidr.String() {
+				return fmt.Errorf("source CIDR %s is configured more than once", cidr.String())
+			}
+		}
+	}
+
+	if err := validateFWMarks("fwmark", c.FWMarks); err != nil {
+		return err
+	}
+
+	if err := validateFWMarks("bypass-fwmark", c.BypassFWMarks); err != nil {
+		return err
+	}
+
+	if c.NFTables.Enabled {
+		if c.NFTables.Table == "" || strings.ContainsFunc(c.NFTables.Table, func(r rune) bool {
+			return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_')
+		}) {
+			return fmt.Errorf("nftables-table %q must only contain letters, digits, '-' and '_'", c.NFTables.Table)
+		}
+
+		mark := c.NFTables.BypassMark()
+		if err := validateFWMarks("nftables-mark", []FWMark{mark}); err != nil {
+			return err
+		}
+
+		// Clearing the masked bits would match all unmarked packets
+		if mark.Mark == 0 {
+			return fmt.Errorf("nftables-mark %s must set at least one bit", mark.String())
+		}
+
+		gatewayMark := c.NFTables.UseGatewayMark()
+		if err := validateFWMarks("nftables-gateway-mark", []FWMark{gatewayMark}); err != nil {
+			return err
+		}
+
+		if gatewayMark.Mark == 0 {
+			return fmt.Errorf("nftables-gateway-mark %s must set at least one bit", gatewayMark.String())
+		}
+
+		// Packets can have both marks, which must not change each other
+		if gatewayMark.Mask&mark.Mask != 0 {
+			return fmt.Errorf("nftables-gateway-mark %s and nftables-mark %s must not have overlapping masks", gatewayMark.String(), mark.String())
+		}
+
+		networks := []struct {
+			name  string
+			cidrs []*net.IPNet
+		}{
+			{name: "nftables-bypass-source", cidrs: c.NFTables.BypassSources},
+			{name: "nftables-gateway-dest", cidrs: c.NFTables.GatewayDestinations},
+			{name: "nftables-gateway-source", cidrs: c.NFTables.GatewaySources},
+		}
+		for _, network := range networks {
+			for _, cidr := range network.cidrs {
+				if !c.usesFamilyOf(cidr.IP) {
+					return fmt.Errorf("%s %s is not in the managed IP family (%s)", network.name, cidr.String(), c.IPFamily)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateFWMarks(name string, fwmarks []FWMark) error {
+	for i, fwmark := range fwmarks {
+		if fwmark.Mask == 0 {
+			return fmt.Errorf("%s %s must have a non-zero mask", name, fwmark.String())
+		}
+
+		if fwmark.Mark&^fwmark.Mask != 0 {
+			return fmt.Errorf("%s %s has bits set outside of its mask", name, fwmark.String())
+		}
+
+		if slices.Contains(fwmarks[:i], fwmark) {
+			return fmt.Errorf("%s %s is configured more than once", name, fwmark.String())
+		}
+	}
+
+	return nil
+}
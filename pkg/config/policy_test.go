@@ -0,0 +1,163 @@
+package config
+
+import (
+	"math"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFWMark(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected FWMark
+		errFunc  require.ErrorAssertionFunc
+	}{
+		{
+			name:     "decimal mark",
+			input:    "16",
+			expected: FWMark{Mark: 16, Mask: math.MaxUint32},
+		},
+		{
+			name:     "hexadecimal mark and mask",
+			input:    "0x10/0xff",
+			expected: FWMark{Mark: 0x10, Mask: 0xff},
+		},
+		{
+			name:    "invalid mark",
+			input:   "vpn",
+			errFunc: require.Error,
+		},
+		{
+			name:    "invalid mask",
+			input:   "0x10/all",
+			errFunc: require.Error,
+		},
+		{
+			name:    "mark too large",
+			input:   "0x100000000",
+			errFunc: require.Error,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fwmark, err := ParseFWMark(tt.input)
+
+			errFunc := tt.errFunc
+			if errFunc == nil {
+				errFunc = require.NoError
+			}
+			errFunc(t, err)
+
+			if tt.errFunc == nil {
+				assert.Equal(t, tt.expected, fwmark)
+			}
+		})
+	}
+}
+
+func TestConfig_ValidatePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		errFunc require.ErrorAssertionFunc
+	}{
+		{
+			name: "valid",
+			config: Config{
+				SourceCIDRs: []*net.IPNet{parseCIDR(t, "192.168.10.0/24"), parseCIDR(t, "192.168.20.0/24")},
+				FWMarks:     []FWMark{{Mark: 0x10, Mask: 0xff}, {Mark: 0x20, Mask: 0xff}},
+			},
+		},
+		{
+			name:    "source CIDR not in managed family",
+			config:  Config{IPFamily: IPFamilyIPv4, SourceCIDRs: []*net.IPNet{parseCIDR(t, "fd00::/64")}},
+			errFunc: require.Error,
+		},
+		{
+			name:    "duplicate source CIDR",
+			config:  Config{SourceCIDRs: []*net.IPNet{parseCIDR(t, "192.168.10.0/24"), parseCIDR(t, "192.168.10.0/24")}},
+			errFunc: require.Error,
+		},
+		{
+			name:    "zero mask",
+			config:  Config{FWMarks: []FWMark{{Mark: 0x10}}},
+			errFunc: require.Error,
+		},
+		{
+			name:    "mark outside of mask",
+			config:  Config{FWMarks: []FWMark{{Mark: 0x100, Mask: 0xff}}},
+			errFunc: require.Error,
+		},
+		{
+			name: "valid bypass and nftables marks",
+			config: Config{
+				BypassFWMarks: []FWMark{{Mark: 0x2, Mask: 0x2}},
+				NFTables:      NFTablesConfig{Enabled: true, Table: DefaultNFTablesTable},
+			},
+		},
+		{
+			name:    "bypass mark outside of mask",
+			config:  Config{BypassFWMarks: []FWMark{{Mark: 0x3, Mask: 0x2}}},
+			errFunc: require.Error,
+		},
+		{
+			name:    "invalid nftables table name",
+			config:  Config{NFTables: NFTablesConfig{Enabled: true, Table: "gateway routes"}},
+			errFunc: require.Error,
+		},
+		{
+			name:    "nftables mark without bits set",
+			config:  Config{NFTables: NFTablesConfig{Enabled: true, Table: DefaultNFTablesTable, Mark: FWMark{Mask: 0xff}}},
+			errFunc: require.Error,
+		},
+		{
+			name: "valid nftables networks",
+			config: Config{NFTables: NFTablesConfig{
+				Enabled:             true,
+				Table:               DefaultNFTablesTable,
+				BypassSources:       []*net.IPNet{parseCIDR(t, "192.168.50.0/24")},
+				GatewayDestinations: []*net.IPNet{parseCIDR(t, "203.0.113.0/24")},
+				GatewaySources:      []*net.IPNet{parseCIDR(t, "192.168.10.0/24")},
+			}},
+		},
+		{
+			name:    "nftables network not in managed family",
+			config:  Config{IPFamily: IPFamilyIPv4, NFTables: NFTablesConfig{Enabled: true, Table: DefaultNFTablesTable, GatewaySources: []*net.IPNet{parseCIDR(t, "fd00::/64")}}},
+			errFunc: require.Error,
+		},
+		{
+			name:    "nftables gateway mark without bits set",
+			config:  Config{NFTables: NFTablesConfig{Enabled: true, Table: DefaultNFTablesTable, GatewayMark: FWMark{Mask: 0xff}}},
+			errFunc: require.Error,
+		},
+		{
+			name:    "overlapping nftables marks",
+			config:  Config{NFTables: NFTablesConfig{Enabled: true, Table: DefaultNFTablesTable, Mark: FWMark{Mark: 0x1, Mask: 0x3}, GatewayMark: FWMark{Mark: 0x2, Mask: 0x2}}},
+			errFunc: require.Error,
+		},
+		{
+			name:   "nftables settings are not checked when disabled",
+			config: Config{NFTables: NFTablesConfig{Table: "gateway routes"}},
+		},
+		{
+			name:    "duplicate fwmark",
+			config:  Config{FWMarks: []FWMark{{Mark: 0x10, Mask: 0xff}, {Mark: 0x10, Mask: 0xff}}},
+			errFunc: require.Error,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.errFunc == nil {
+				tt.errFunc = require.NoError
+			}
+
+			tt.errFunc(t, tt.config.validatePolicy())
+		})
+	}
+}
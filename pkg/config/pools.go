@@ -0,0 +1,144 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DefaultPool is the name of the pool that contains every gateway. Routes without a pool use it.
+const DefaultPool = "default"
+
+// RouteConfig is a destination that is routed via the gateways of a pool
+type RouteConfig struct {
+	Destination *net.IPNet
+	Pool        string // Empty is treated as DefaultPool
+}
+
+// PoolName returns the name of the pool that the route uses
+func (r RouteConfig) PoolName() string {
+	if r.Pool == "" {
+		return DefaultPool
+	}
+
+	return r.Pool
+}
+
+func (r RouteConfig) String() string {
+	return fmt.Sprintf("%s via %s", r.Destination.String(), r.PoolName())
+}
+
+// PoolConfig configures the failover behavior of a named pool of gateways. Pools are created by referencing them
+// from gateways, so a PoolConfig is only needed to change the defaults.
+type PoolConfig struct {
+	Name            string
+	MinTierGateways int    // Zero inherits the top-level min-tier-gateways value
+	Fallback        string // Pool that is used when this pool has no active gateways of a route's IP family
+}
+
+// ParsePoolConfig parses a pool entry of the form `name[,min-tier-gateways=N][,fallback=pool]`
+func ParsePoolConfig(s string) (PoolConfig, error) {
+	parts := strings.Split(s, ",")
+
+	pool := PoolConfig{
+		Name: strings.TrimSpace(parts[0]),
+	}
+	if pool.Name == "" {
+		return PoolConfig{}, fmt.Errorf("pool name is required")
+	}
+
+	for _, part := range parts[1:] {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return PoolConfig{}, fmt.Errorf("invalid pool option %q (expected key=value)", part)
+		}
+
+		switch key {
+		case "min-tier-gateways":
+			minTierGateways, err := strconv.Atoi(value)
+			if err != nil {
+				return PoolConfig{}, fmt.Errorf("invalid pool min-tier-gateways %q: %w", value, err)
+			}
+			pool.MinTierGateways = minTierGateways
+		case "fallback":
+			pool.Fallback = value
+		default:
+			return PoolConfig{}, fmt.Errorf("unknown pool option %q (must be one of: min-tier-gateways, fallback)", key)
+		}
+	}
+
+	return pool, nil
+}
+
+// Pool returns the configuration of the named pool, with unset values inherited from the top-level configuration
+func (c Config) Pool(name string) PoolConfig {
+	pool := PoolConfig{Name: name}
+	for _, poolConfig := range c.Pools {
+		if poolConfig.Name == name {
+			pool = poolConfig
+			break
+		}
+	}
+
+	if pool.MinTierGateways == 0 {
+		pool.MinTierGateways = c.MinTierGateways
+	}
+
+	return pool
+}
+
+// validatePools validates the pool configuration, and the pools that routes and gateways refer to
+func (c Config) validatePools() error {
+	// Pools with at least one gateway. Every gateway is in the default pool.
+	poolsWithGateways := []string{DefaultPool}
+	for _, gateway := range c.Gateways {
+		for _, pool := range gateway.Pools {
+			if pool == "" || strings.ContainsAny(pool, ", \t") {
+				return fmt.Errorf("invalid pool name %q for gateway %q", pool, gateway.Address)
+			}
+
+			if !slices.Contains(poolsWithGateways, pool) {
+				poolsWithGateways = append(poolsWithGateways, pool)
+			}
+		}
+	}
+
+	for i, pool := range c.Pools {
+		if slices.ContainsFunc(c.Pools[:i], func(other PoolConfig) bool { return other.Name == pool.Name }) {
+			return fmt.Errorf("pool %q is configured more than once", pool.Name)
+		}
+
+		if pool.MinTierGateways < 0 {
+			return fmt.Errorf("pool %q min-tier-gateways must not be negative", pool.Name)
+		}
+
+		if pool.Fallback != "" && !slices.Contains(poolsWithGateways, pool.Fallback) {
+			return fmt.Errorf("fallback pool %q of pool %q has no gateways", pool.Fallback, pool.Name)
+		}
+
+		// Follow the fallback chain to detect loops
+		visited := []string{pool.Name}
+		for next := pool.Fallback; next != ""; next = c.Pool(next).Fallback {
+			if slices.Contains(visited, next) {
+				return fmt.Errorf("pool %q has a fallback loop", pool.Name)
+			}
+			visited = append(visited, next)
+		}
+	}
+
+	for i, route := range c.Routes {
+		if !slices.Contains(poolsWithGateways, route.PoolName()) {
+			return fmt.Errorf("pool %q of route %s has no gateways", route.PoolName(), route.Destination.String())
+		}
+
+		if slices.ContainsFunc(c.Routes[:i], func(other RouteConfig) bool {
+			return other.Destination.String() == route.Destination.String()
+		}) {
+			return fmt.Errorf("route %s is configured more than once", route.Destination.String())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePoolConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected PoolConfig
+		errFunc  require.ErrorAssertionFunc
+	}{
+		{
+			name:     "name only",
+			input:    "fast",
+			expected: PoolConfig{Name: "fast"},
+		},
+		{
+			name:     "all options",
+			input:    "fast, min-tier-gateways=2,fallback=cheap",
+			expected: PoolConfig{Name: "fast", MinTierGateways: 2, Fallback: "cheap"},
+		},
+		{
+			name:    "empty name",
+			input:   ",fallback=cheap",
+			errFunc: require.Error,
+		},
+		{
+			name:    "invalid min-tier-gateways",
+			input:   "fast,min-tier-gateways=many",
+			errFunc: require.Error,
+		},
+		{
+			name:    "unknown option",
+			input:   "fast,priority=1",
+			errFunc: require.Error,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, err := ParsePoolConfig(tt.input)
+
+			errFunc := tt.errFunc
+			if errFunc == nil {
+				errFunc = require.NoError
+			}
+			errFunc(t, err)
+
+			if tt.errFunc == nil {
+				assert.Equal(t, tt.expected, pool)
+			}
+		})
+	}
+}
+
+func TestConfig_Pool(t *testing.T) {
+	c := Config{
+		MinTierGateways: 2,
+		Pools:           []PoolConfig{{Name: "fast", Fallback: "cheap"}, {Name: "cheap", MinTierGateways: 3}},
+	}
+
+	assert.Equal(t, PoolConfig{Name: "fast", MinTierGateways: 2, Fallback: "cheap"}, c.Pool("fast"))
+	assert.Equal(t, PoolConfig{Name: "cheap", MinTierGateways: 3}, c.Pool("cheap"))
+	assert.Equal(t, PoolConfig{Name: DefaultPool, MinTierGateways: 2}, c.Pool(DefaultPool))
+}
+
+func TestConfig_ValidatePools(t *testing.T) {
+	gateways := []GatewayConfig{
+		{Address: "192.168.1.1", Pools: []string{"fast"}},
+		{Address: "192.168.1.2", Pools: []string{"cheap"}},
+	}
+
+	tests := []struct {
+		name    string
+		config  Config
+		errFunc require.ErrorAssertionFunc
+	}{
+		{
+			name: "valid",
+			config: Config{
+				Gateways: gateways,
+				Pools:    []PoolConfig{{Name: "fast", Fallback: "cheap"}, {Name: "cheap", Fallback: DefaultPool}},
+				Routes: []RouteConfig{
+					{Destination: parseCIDR(t, "10.0.0.0/8"), Pool: "fast"},
+					{Destination: parseCIDR(t, "0.0.0.0/0")},
+				},
+			},
+		},
+		{
+			name: "route to pool without gateways",
+			config: Config{
+				Gateways: gateways,
+				Routes:   []RouteConfig{{Destination: parseCIDR(t, "10.0.0.0/8"), Pool: "slow"}},
+			},
+			errFunc: require.Error,
+		},
+		{
+			name: "duplicate route",
+			config: Config{
+				Gateways: gateways,
+				Routes: []RouteConfig{
+					{Destination: parseCIDR(t, "10.0.0.0/8"), Pool: "fast"},
+					{Destination: parseCIDR(t, "10.0.0.0/8"), Pool: "cheap"},
+				},
+			},
+			errFunc: require.Error,
+		},
+		{
+			name: "duplicate pool",
+			config: Config{
+				Gateways: gateways,
+				Pools:    []PoolConfig{{Name: "fast"}, {Name: "fast"}},
+			},
+			errFunc: require.Error,
+		},
+		{
+			name: "fallback without gateways",
+			config: Config{
+				Gateways: gateways,
+				Pools:    []PoolConfig{{Name: "fast", Fallback: "slow"}},
+			},
+			errFunc: require.Error,
+		},
+		{
+			name: "fallback loop",
+			config: Config{
+				Gateways: gateways,
+				Pools:    []PoolConfig{{Name: "fast", Fallback: "cheap"}, {Name: "cheap", Fallback: "fast"}},
+			},
+			errFunc: require.Error,
+		},
+		{
+			name: "negative min-tier-gateways",
+			config: Config{
+				Gateways: gateways,
+				Pools:    []PoolConfig{{Name: "fast", MinTierGateways: -1}},
+			},
+			errFunc: require.Error,
+		},
+		{
+			name: "invalid gateway pool name",
+			config: Config{
+				Gateways: []GatewayConfig{{Address: "192.168.1.1", Pools: []string{"fast pool"}}},
+			},
+			errFunc: require.Error,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.errFunc == nil {
+				tt.errFunc = require.NoError
+			}
+
+			tt.errFunc(t, tt.config.validatePools())
+		})
+	}
+}
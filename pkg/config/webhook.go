@@ -0,0 +1,62 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	// WebhookModeSet sends one request with all public IP addresses
+	WebhookModeSet = "set"
+	// WebhookModePerIP sends one request for each public IP address, and for each removed IP address
+	WebhookModePerIP = "per-ip"
+)
+
+var webhookModes = []string{WebhookModeSet, WebhookModePerIP}
+
+// DDNSWebhookConfig holds the request templates and success criterion of the webhook DDNS provider. The method, URL,
+// header values and body are Go templates. Zero values use the defaults (POST requests, no body, and any 2xx status).
+type DDNSWebhookConfig struct {
+	Method          string
+	URL             string
+	Headers         http.Header
+	Body            string
+	SuccessStatuses []StatusRange
+	SuccessRegex    *regexp.Regexp // Regular expression that the response body must match, if set
+	Mode            string
+}
+
+// Equal returns true if both configs have the same options
+func (c DDNSWebhookConfig) Equal(other DDNSWebhookConfig) bool {
+	regexString := func(r *regexp.Regexp) string {
+		if r == nil {
+			return ""
+		}
+		return r.String()
+	}
+
+	return c.Method == other.Method &&
+		c.URL == other.URL &&
+		maps.EqualFunc(c.Headers, other.Headers, slices.Equal) &&
+		c.Body == other.Body &&
+		slices.Equal(c.SuccessStatuses, other.SuccessStatuses) &&
+		regexString(c.SuccessRegex) == regexString(other.SuccessRegex) &&
+		c.Mode == other.Mode
+}
+
+// validate validates the webhook options. The templates are parsed by the provider.
+func (c DDNSWebhookConfig) validate() error {
+	if strings.TrimSpace(c.URL) == "" {
+		return fmt.Errorf("ddns-webhook-url is required when ddns-provider is webhook")
+	}
+
+	if c.Mode != "" && !slices.Contains(webhookModes, c.Mode) {
+		return fmt.Errorf("ddns-webhook-mode must be one of: %s", strings.Join(webhookModes, ", "))
+	}
+
+	return nil
+}
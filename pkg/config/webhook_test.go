@@ -0,0 +1,64 @@
+package config
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDDNSWebhookConfig_Equal(t *testing.T) {
+	newConfig := func() DDNSWebhookConfig {
+		return DDNSWebhookConfig{
+			Method:          "PUT",
+			URL:             "https://example.com/{{.Hostname}}",
+			Headers:         http.Header{"Authorization": {"Bearer {{.Password}}"}},
+			Body:            "{{json .IPs}}",
+			SuccessStatuses: []StatusRange{{Min: 200, Max: 299}},
+			SuccessRegex:    regexp.MustCompile("^ok"),
+			Mode:            WebhookModeSet,
+		}
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(c *DDNSWebhookConfig)
+		expected bool
+	}{
+		{
+			name:     "same options",
+			modify:   func(c *DDNSWebhookConfig) {},
+			expected: true,
+		},
+		{
+			name:     "different header",
+			modify:   func(c *DDNSWebhookConfig) { c.Headers.Set("Authorization", "Token {{.Password}}") },
+			expected: false,
+		},
+		{
+			name:     "different success statuses",
+			modify:   func(c *DDNSWebhookConfig) { c.SuccessStatuses = []StatusRange{{Min: 200, Max: 200}} },
+			expected: false,
+		},
+		{
+			name:     "different success regex",
+			modify:   func(c *DDNSWebhookConfig) { c.SuccessRegex = nil },
+			expected: false,
+		},
+		{
+			name:     "different mode",
+			modify:   func(c *DDNSWebhookConfig) { c.Mode = WebhookModePerIP },
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			other := newConfig()
+			tt.modify(&other)
+
+			assert.Equal(t, tt.expected, newConfig().Equal(other))
+		})
+	}
+}
@@ -0,0 +1,398 @@
+package ddns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+var cloudflareBaseURL = "https://api.cloudflare.com/client/v4"
+
+// cloudflareAutoTTL is the TTL value that lets Cloudflare pick the TTL. Proxied records always use it.
+const cloudflareAutoTTL = 1
+
+// cloudflareRecordsPerPage is the number of DNS records that are requested per page
+const cloudflareRecordsPerPage = 100
+
+// CloudflareProvider implements the DDNS Provider interface for Cloudflare
+type CloudflareProvider struct {
+	apiToken  string
+	hostname  string
+	recordTTL time.Duration
+	proxied   bool
+	comment   string
+	client    *http.Client
+
+	// Cached zone information
+	initialized atomic.Bool
+	zoneID      string
+}
+
+// CloudflareAPIError represents an error or message returned by the Cloudflare API
+type CloudflareAPIError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// CloudflareResultInfo represents the pagination information of list responses
+type CloudflareResultInfo struct {
+	Page       int `json:"page"`
+	TotalPages int `json:"total_pages"`
+}
+
+// CloudflareAPIResponse represents the common structure for API responses
+type CloudflareAPIResponse struct {
+	Success    bool                  `json:"success"`
+	Errors     []CloudflareAPIError  `json:"errors"`
+	Result     json.RawMessage       `json:"result"`
+	ResultInfo *CloudflareResultInfo `json:"result_info,omitempty"`
+}
+
+// CloudflareZone represents a zone from the Cloudflare API
+type CloudflareZone struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// CloudflareRecord represents a DNS record from the Cloudflare API
+type CloudflareRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl"`
+	Proxied bool   `json:"proxied"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// makeAPIRequest is a helper function that makes HTTP requests to the Cloudflare API
+// It handles common tasks like authentication, encoding the request body, and checking for API errors
+func (c *CloudflareProvider) makeAPIRequest(ctx context.Context, method, url string, body interface{}, result interface{}) (*CloudflareResultInfo, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		jsonData, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+		bodyReader = bytes.NewReader(jsonData)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bodyReader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.apiToken)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var response CloudflareAPIResponse
+	if err := json.Unmarshal(bodyBytes, &response); err != nil {
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return nil, fmt.Errorf("Cloudflare API returned status %d: %s", resp.StatusCode, string(bodyBytes))
+		}
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if !response.Success || resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		if len(response.Errors) == 0 {
+			return nil, fmt.Errorf("Cloudflare API returned status %d: %s", resp.StatusCode, string(bodyBytes))
+		}
+
+		messages := make([]string, 0, len(response.Errors))
+		for _, apiErr := range response.Errors {
+			messages = append(messages, fmt.Sprintf("%s (code %d)", apiErr.Message, apiErr.Code))
+		}
+		return nil, fmt.Errorf("Cloudflare API error: %s (%d)", strings.Join(messages, "; "), resp.StatusCode)
+	}
+
+	if result == nil {
+		return response.ResultInfo, nil
+	}
+
+	if err := json.Unmarshal(response.Result, result); err != nil {
+		return nil, fmt.Errorf("failed to parse response into provided result type: %w", err)
+	}
+
+	return response.ResultInfo, nil
+}
+
+// NewCloudflareProvider creates a new Cloudflare DDNS provider. The API token needs the Zone:Read and DNS:Edit
+// permissions for the zone of the hostname. Created and updated records are tagged with the comment, if set.
+func NewCloudflareProvider(apiToken, hostname string, timeout, recordTTL time.Duration, proxied bool, comment string) *CloudflareProvider {
+	return &CloudflareProvider{
+		apiToken:  apiToken,
+		hostname:  strings.TrimSuffix(hostname, "."),
+		recordTTL: recordTTL,
+		proxied:   proxied,
+		comment:   comment,
+		client: &http.Client{
+			Timeout: timeout,
+		},
+	}
+}
+
+// Name returns the provider name
+func (c *CloudflareProvider) Name() string {
+	return "Cloudflare"
+}
+
+// initializeZoneInfo looks up the zone that contains the hostname. The hostname and its parent domains are tried in
+// order, so that the most specific zone is used.
+func (c *CloudflareProvider) initializeZoneInfo(ctx context.Context) error {
+	logger := slog.With("provider", c.Name(), "hostname", c.hostname)
+
+	labels := strings.Split(c.hostname, ".")
+	for i := 0; i < len(labels)-1; i++ {
+		zoneName := strings.Join(labels[i:], ".")
+
+		logger.DebugContext(ctx, "Looking up Cloudflare zone", "zone", zoneName)
+
+		var zones []CloudflareZone
+		if _, err := c.makeAPIRequest(ctx, "GET", fmt.Sprintf("%s/zones?name=%s", cloudflareBaseURL, url.QueryEscape(zoneName)), nil, &zones); err != nil {
+			return err
+		}
+
+		if len(zones) == 0 {
+			continue
+		}
+
+		c.zoneID = zones[0].ID
+		logger.InfoContext(ctx, "Initialized Cloudflare zone info", "zoneID", c.zoneID, "zone", zones[0].Name)
+		return nil
+	}
+
+	return fmt.Errorf("no Cloudflare zone found for hostname %s", c.hostname)
+}
+
+// UpdateRecords updates the DNS records with the provided IP addresses
+func (c *CloudflareProvider) UpdateRecords(ctx context.Context, newPublicIPs []string) error {
+	logger := slog.With("provider", c.Name(), "hostname", c.hostname, "ips", newPublicIPs)
+
+	// This cannot be done at provider creation time because it requires network access, which may not be available then
+	if !c.initialized.Load() {
+		logger.Info("Initializing Cloudflare zone info")
+
+		if err := c.initializeZoneInfo(ctx); err != nil {
+			return fmt.Errorf("failed to initialize zone info: %w", err)
+		}
+		c.initialized.Store(true)
+	}
+
+	// Get current records
+	existingRecords, err := c.getExistingRecords(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get existing records: %w", err)
+	}
+
+	// Index the existing A and AAAA records by IP address. Cloudflare may return IPv6 addresses in another form than
+	// the target IP addresses, so both are compared in their canonical form. Records with the same IP address as
+	// another record are deleted, keeping a record that is up to date if there is one.
+	targetIPs := make([]string, 0, len(newPublicIPs))
+	for _, ip := range newPublicIPs {
+		targetIPs = append(targetIPs, canonicalIP(ip))
+	}
+
+	existingIPs := make(map[string]CloudflareRecord)
+	var recordsToDelete []CloudflareRecord
+	for _, record := range existingRecords {
+		ip := canonicalIP(record.Content)
+		keptRecord, ok := existingIPs[ip]
+		if !ok {
+			existingIPs[ip] = record
+			continue
+		}
+
+		if desiredRecord := c.newRecord(ip); !c.recordUpToDate(keptRecord, desiredRecord) && c.recordUpToDate(record, desiredRecord) {
+			existingIPs[ip] = record
+			record = keptRecord
+		}
+		recordsToDelete = append(recordsToDelete, record)
+	}
+
+	// Calculate records to delete (existing IPs not in target list), and records to update (existing IPs in the target
+	// list with other settings)
+	var recordsToUpdate []CloudflareRecord
+	for ip, record := range existingIPs {
+		if !slices.Contains(targetIPs, ip) {
+			recordsToDelete = append(recordsToDelete, record)
+			continue
+		}
+
+		if desiredRecord := c.newRecord(ip); !c.recordUpToDate(record, desiredRecord) {
+			desiredRecord.ID = record.ID
+			if desiredRecord.Comment == "" {
+				desiredRecord.Comment = record.Comment
+			}
+			recordsToUpdate = append(recordsToUpdate, desiredRecord)
+		}
+	}
+
+	// Calculate IPs to add (target IPs not in existing list)
+	var ipsToAdd []string
+	for _, targetIP := range targetIPs {
+		if _, exists := existingIPs[targetIP]; !exists && !slices.Contains(ipsToAdd, targetIP) {
+			ipsToAdd = append(ipsToAdd, targetIP)
+		}
+	}
+
+	logger.InfoContext(ctx, "Calculated DNS record changes", "recordsToDelete", len(recordsToDelete), "recordsToUpdate", len(recordsToUpdate), "ipsToAdd", len(ipsToAdd))
+
+	// Execute deletions, updates and additions in parallel using errgroup
+	eg, gctx := errgroup.WithContext(ctx)
+
+	// Delete unwanted records
+	for _, record := range recordsToDelete {
+		eg.Go(func() error {
+			if err := c.deleteRecord(gctx, record.ID); err != nil {
+				return fmt.Errorf("failed to delete record %s (IP: %s): %w", record.ID, record.Content, err)
+			}
+
+			logger.DebugContext(gctx, "Deleted DNS record", "recordID", record.ID, "ip", record.Content)
+			return nil
+		})
+	}
+
+	// Update records with outdated settings
+	for _, record := range recordsToUpdate {
+		eg.Go(func() error {
+			if err := c.updateRecord(gctx, record); err != nil {
+				return fmt.Errorf("failed to update record %s (IP: %s): %w", record.ID, record.Content, err)
+			}
+
+			logger.DebugContext(gctx, "Updated DNS record", "recordID", record.ID, "ip", record.Content)
+			return nil
+		})
+	}
+
+	// Add new records
+	for _, ip := range ipsToAdd {
+		eg.Go(func() error {
+			if err := c.createRecord(gctx, ip); err != nil {
+				return fmt.Errorf("failed to create record for IP %s: %w", ip, err)
+			}
+
+			logger.DebugContext(gctx, "Created DNS record", "ip", ip)
+			return nil
+		})
+	}
+
+	// Wait for all operations to complete
+	if err := eg.Wait(); err != nil {
+		return fmt.Errorf("DNS record update failed: %w", err)
+	}
+
+	logger.InfoContext(ctx, "Successfully updated DNS records")
+	return nil
+}
+
+// getExistingRecords retrieves the existing A and AAAA records of the hostname, from all result pages
+func (c *CloudflareProvider) getExistingRecords(ctx context.Context) ([]CloudflareRecord, error) {
+	var filteredRecords []CloudflareRecord
+	for page := 1; ; page++ {
+		query := url.Values{
+			"name":     {c.hostname},
+			"page":     {fmt.Sprint(page)},
+			"per_page": {fmt.Sprint(cloudflareRecordsPerPage)},
+		}
+		requestURL := fmt.Sprintf("%s/zones/%s/dns_records?%s", cloudflareBaseURL, c.zoneID, query.Encode())
+
+		var records []CloudflareRecord
+		resultInfo, err := c.makeAPIRequest(ctx, "GET", requestURL, nil, &records)
+		if err != nil {
+			return nil, err
+		}
+
+		// Filter records by type
+		for _, record := range records {
+			if record.Type != "A" && record.Type != "AAAA" {
+				continue
+			}
+
+			filteredRecords = append(filteredRecords, record)
+		}
+
+		if resultInfo == nil || resultInfo.Page >= resultInfo.TotalPages {
+			return filteredRecords, nil
+		}
+	}
+}
+
+// newRecord returns the desired record for the IP address
+func (c *CloudflareProvider) newRecord(ipAddress string) CloudflareRecord {
+	record := CloudflareRecord{
+		Type:    recordType(ipAddress),
+		Name:    c.hostname,
+		Content: ipAddress,
+		TTL:     int(c.recordTTL.Seconds()),
+		Proxied: c.proxied,
+		Comment: c.comment,
+	}
+
+	if c.proxied {
+		record.TTL = cloudflareAutoTTL
+	}
+
+	return record
+}
+
+// recordUpToDate returns whether an existing record has the settings of the desired record. Comments are left alone
+// when no comment is configured.
+func (c *CloudflareProvider) recordUpToDate(existing, desired CloudflareRecord) bool {
+	if desired.Comment != "" && existing.Comment != desired.Comment {
+		return false
+	}
+
+	return existing.Proxied == desired.Proxied && existing.TTL == desired.TTL
+}
+
+// createRecord creates a new DNS A or AAAA record, depending on the IP address family
+func (c *CloudflareProvider) createRecord(ctx context.Context, ipAddress string) error {
+	url := fmt.Sprintf("%s/zones/%s/dns_records", cloudflareBaseURL, c.zoneID)
+
+	record := c.newRecord(ipAddress)
+	slog.DebugContext(ctx, "Creating new DNS record", "provider", c.Name(), "request", fmt.Sprintf("%#v", record))
+
+	_, err := c.makeAPIRequest(ctx, "POST", url, record, nil)
+	return err
+}
+
+// updateRecord replaces the settings of an existing DNS record
+func (c *CloudflareProvider) updateRecord(ctx context.Context, record CloudflareRecord) error {
+	url := fmt.Sprintf("%s/zones/%s/dns_records/%s", cloudflareBaseURL, c.zoneID, record.ID)
+
+	// The ID is part of the URL, and cannot be set in the body
+	record.ID = ""
+	_, err := c.makeAPIRequest(ctx, "PUT", url, record, nil)
+	return err
+}
+
+// deleteRecord deletes a DNS record by ID
+func (c *CloudflareProvider) deleteRecord(ctx context.Context, recordID string) error {
+	url := fmt.Sprintf("%s/zones/%s/dns_records/%s", cloudflareBaseURL, c.zoneID, recordID)
+
+	_, err := c.makeAPIRequest(ctx, "DELETE", url, nil, nil)
+	return err
+}
@@ -0,0 +1,276 @@
+package ddns
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCloudflareResult writes a successful Cloudflare API response with the result
+func writeCloudflareResult(t *testing.T, w http.ResponseWriter, result interface{}, resultInfo *CloudflareResultInfo) {
+	resultJSON, err := json.Marshal(result)
+	require.NoError(t, err)
+
+	json.NewEncoder(w).Encode(CloudflareAPIResponse{Success: true, Result: resultJSON, ResultInfo: resultInfo})
+}
+
+// useCloudflareServer points the Cloudflare provider at the test server for the duration of the test
+func useCloudflareServer(t *testing.T, handler http.HandlerFunc) {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	originalURL := cloudflareBaseURL
+	cloudflareBaseURL = server.URL + "/client/v4"
+	t.Cleanup(func() { cloudflareBaseURL = originalURL })
+}
+
+// TestCloudflareProvider_UpdateRecords tests the core functionality of updating DNS records
+func TestCloudflareProvider_UpdateRecords(t *testing.T) {
+	var mu sync.Mutex
+	var zoneLookups, deletedPaths []string
+	var createdRecords, updatedRecords []CloudflareRecord
+	var updatedPaths []string
+
+	useCloudflareServer(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.Header.Get("Authorization") != "Bearer test-api-token" {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(CloudflareAPIResponse{Errors: []CloudflareAPIError{{Code: 10000, Message: "Authentication error"}}})
+			return
+		}
+
+		switch {
+		case r.URL.Path == "/client/v4/zones":
+			zoneName := r.URL.Query().Get("name")
+			zoneLookups = append(zoneLookups, zoneName)
+
+			var zones []CloudflareZone
+			if zoneName == "example.com" {
+				zones = append(zones, CloudflareZone{ID: "zone-1", Name: "example.com"})
+			}
+			writeCloudflareResult(t, w, zones, nil)
+
+		case r.URL.Path == "/client/v4/zones/zone-1/dns_records":
+			if r.Method == "GET" {
+				assert.Equal(t, "gateways.test.example.com", r.URL.Query().Get("name"))
+				writeCloudflareResult(t, w, []CloudflareRecord{
+					{ID: "record-1", Type: "A", Name: "gateways.test.example.com", Content: "1.2.3.4", TTL: 60},
+					{ID: "record-2", Type: "A", Name: "gateways.test.example.com", Content: "5.6.7.8", TTL: 60, Comment: "manual"},
+					{ID: "record-3", Type: "AAAA", Name: "gateways.test.example.com", Content: "2001:db8::1", TTL: 60},
+					{ID: "record-4", Type: "TXT", Name: "gateways.test.example.com", Content: "9.9.9.9", TTL: 60},
+				}, &CloudflareResultInfo{Page: 1, TotalPages: 1})
+			} else if r.Method == "POST" {
+				var record CloudflareRecord
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&record))
+				createdRecords = append(createdRecords, record)
+				writeCloudflareResult(t, w, record, nil)
+			}
+
+		case strings.HasPrefix(r.URL.Path, "/client/v4/zones/zone-1/dns_records/"):
+			switch r.Method {
+			case "DELETE":
+				deletedPaths = append(deletedPaths, r.URL.Path)
+				writeCloudflareResult(t, w, nil, nil)
+			case "PUT":
+				var record CloudflareRecord
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&record))
+				updatedPaths = append(updatedPaths, r.URL.Path)
+				updatedRecords = append(updatedRecords, record)
+				writeCloudflareResult(t, w, record, nil)
+			}
+
+		default:
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
+	})
+
+	provider := NewCloudflareProvider("test-api-token", "gateways.test.example.com.", 10*time.Second, 2*time.Minute, true, "gateways")
+
+	err := provider.UpdateRecords(t.Context(), []string{"5.6.7.8", "9.9.9.9"})
+	require.NoError(t, err, "UpdateRecords failed")
+
+	// The most specific zone is looked up first
+	assert.Equal(t, []string{"gateways.test.example.com", "test.example.com", "example.com"}, zoneLookups)
+
+	assert.ElementsMatch(t, []string{"/client/v4/zones/zone-1/dns_records/record-1", "/client/v4/zones/zone-1/dns_records/record-3"}, deletedPaths)
+
+	// Proxied records use the automatic TTL
+	require.Len(t, createdRecords, 1)
+	assert.Equal(t, CloudflareRecord{Type: "A", Name: "gateways.test.example.com", Content: "9.9.9.9", TTL: 1, Proxied: true, Comment: "gateways"}, createdRecords[0])
+
+	// The kept record is updated with the new settings
+	assert.Equal(t, []string{"/client/v4/zones/zone-1/dns_records/record-2"}, updatedPaths)
+	assert.Equal(t, []CloudflareRecord{{Type: "A", Name: "gateways.test.example.com", Content: "5.6.7.8", TTL: 1, Proxied: true, Comment: "gateways"}}, updatedRecords)
+
+	// The zone is only looked up once
+	zoneLookups = nil
+	require.NoError(t, provider.UpdateRecords(t.Context(), []string{"5.6.7.8", "9.9.9.9"}))
+	assert.Empty(t, zoneLookups)
+}
+
+// TestCloudflareProvider_UpdateRecords_Unchanged tests that records with the desired settings are left alone
+func TestCloudflareProvider_UpdateRecords_Unchanged(t *testing.T) {
+	var requests []string
+
+	useCloudflareServer(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, fmt.Sprintf("%s %s", r.Method, r.URL.Path))
+
+		switch r.URL.Path {
+		case "/client/v4/zones":
+			writeCloudflareResult(t, w, []CloudflareZone{{ID: "zone-1", Name: "example.com"}}, nil)
+
+		case "/client/v4/zones/zone-1/dns_records":
+			writeCloudflareResult(t, w, []CloudflareRecord{
+				{ID: "record-1", Type: "A", Name: "test.example.com", Content: "1.2.3.4", TTL: 120, Comment: "manual"},
+				{ID: "record-2", Type: "AAAA", Name: "test.example.com", Content: "2001:db8::1", TTL: 120},
+			}, &CloudflareResultInfo{Page: 1, TotalPages: 1})
+
+		default:
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
+	})
+
+	// Comments are not compared when no comment is configured
+	provider := NewCloudflareProvider("test-api-token", "test.example.com", 10*time.Second, 2*time.Minute, false, "")
+
+	err := provider.UpdateRecords(t.Context(), []string{"1.2.3.4", "2001:db8::1"})
+	require.NoError(t, err, "UpdateRecords failed")
+
+	assert.Equal(t, []string{"GET /client/v4/zones", "GET /client/v4/zones/zone-1/dns_records"}, requests)
+}
+
+// TestCloudflareProvider_UpdateRecords_SameIP tests that records are matched to the target IP addresses in their
+// canonical form, and that records with the same IP address as another record are deleted
+func TestCloudflareProvider_UpdateRecords_SameIP(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+
+	useCloudflareServer(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		requests = append(requests, fmt.Sprintf("%s %s", r.Method, r.URL.Path))
+
+		switch {
+		case r.URL.Path == "/client/v4/zones":
+			writeCloudflareResult(t, w, []CloudflareZone{{ID: "zone-1", Name: "example.com"}}, nil)
+
+		case r.URL.Path == "/client/v4/zones/zone-1/dns_records":
+			writeCloudflareResult(t, w, []CloudflareRecord{
+				{ID: "record-1", Type: "A", Name: "test.example.com", Content: "1.2.3.4", TTL: 60},
+				{ID: "record-2", Type: "A", Name: "test.example.com", Content: "1.2.3.4", TTL: 120},
+				{ID: "record-3", Type: "AAAA", Name: "test.example.com", Content: "2001:0db8:0000::0001", TTL: 120},
+				{ID: "record-4", Type: "AAAA", Name: "test.example.com", Content: "2001:db8::1", TTL: 120},
+			}, &CloudflareResultInfo{Page: 1, TotalPages: 1})
+
+		case strings.HasPrefix(r.URL.Path, "/client/v4/zones/zone-1/dns_records/") && r.Method == "DELETE":
+			writeCloudflareResult(t, w, nil, nil)
+
+		default:
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
+	})
+
+	provider := NewCloudflareProvider("test-api-token", "test.example.com", 10*time.Second, 2*time.Minute, false, "")
+
+	err := provider.UpdateRecords(t.Context(), []string{"1.2.3.4", "2001:db8:0::1"})
+	require.NoError(t, err, "UpdateRecords failed")
+
+	// The outdated duplicate is deleted rather than updated, and nothing is created
+	assert.ElementsMatch(t, []string{
+		"GET /client/v4/zones",
+		"GET /client/v4/zones/zone-1/dns_records",
+		"DELETE /client/v4/zones/zone-1/dns_records/record-1",
+		"DELETE /client/v4/zones/zone-1/dns_records/record-4",
+	}, requests)
+}
+
+// TestCloudflareProvider_UpdateRecords_Pagination tests that records on all result pages are managed
+func TestCloudflareProvider_UpdateRecords_Pagination(t *testing.T) {
+	var mu sync.Mutex
+	var deletedPaths []string
+
+	useCloudflareServer(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/client/v4/zones":
+			writeCloudflareResult(t, w, []CloudflareZone{{ID: "zone-1", Name: "example.com"}}, nil)
+
+		case r.URL.Path == "/client/v4/zones/zone-1/dns_records":
+			page := r.URL.Query().Get("page")
+			writeCloudflareResult(t, w, []CloudflareRecord{
+				{ID: "record-" + page, Type: "A", Name: "test.example.com", Content: "1.2.3." + page, TTL: 60},
+			}, &CloudflareResultInfo{Page: int(page[0] - '0'), TotalPages: 2})
+
+		case strings.HasPrefix(r.URL.Path, "/client/v4/zones/zone-1/dns_records/") && r.Method == "DELETE":
+			deletedPaths = append(deletedPaths, r.URL.Path)
+			writeCloudflareResult(t, w, nil, nil)
+
+		default:
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
+	})
+
+	provider := NewCloudflareProvider("test-api-token", "test.example.com", 10*time.Second, time.Minute, false, "")
+
+	err := provider.UpdateRecords(t.Context(), []string{})
+	require.NoError(t, err, "UpdateRecords failed")
+
+	assert.ElementsMatch(t, []string{"/client/v4/zones/zone-1/dns_records/record-1", "/client/v4/zones/zone-1/dns_records/record-2"}, deletedPaths)
+}
+
+// TestCloudflareProvider_UpdateRecords_Errors tests that zone lookup and API errors are reported
+func TestCloudflareProvider_UpdateRecords_Errors(t *testing.T) {
+	tests := []struct {
+		name          string
+		handler       http.HandlerFunc
+		expectedError string
+	}{
+		{
+			name: "zone not found",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				writeCloudflareResult(t, w, []CloudflareZone{}, nil)
+			},
+			expectedError: "no Cloudflare zone found for hostname test.example.com",
+		},
+		{
+			name: "API error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(CloudflareAPIResponse{Errors: []CloudflareAPIError{{Code: 10000, Message: "Authentication error"}}})
+			},
+			expectedError: "Cloudflare API error: Authentication error (code 10000) (403)",
+		},
+		{
+			name: "non-JSON error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "Bad gateway", http.StatusBadGateway)
+			},
+			expectedError: "Cloudflare API returned status 502",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useCloudflareServer(t, tt.handler)
+
+			provider := NewCloudflareProvider("test-api-token", "test.example.com", 10*time.Second, time.Minute, false, "")
+
+			err := provider.UpdateRecords(t.Context(), []string{"1.2.3.4"})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.expectedError)
+		})
+	}
+}
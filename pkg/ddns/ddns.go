@@ -2,8 +2,10 @@ package ddns
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"slices"
 	"sync/atomic"
 	"time"
@@ -17,30 +19,47 @@ import (
 // Provider defines the interface for DDNS providers.
 type Provider interface {
 	// UpdateRecords updates the DNS records with the provided IP addresses.
+	// IPv4 addresses are published as A records, and IPv6 addresses as AAAA records.
 	// If no IP addresses are provided, the provider should remove any existing records.
-	// Extra A records should be removed.
+	// Extra A and AAAA records should be removed.
 	UpdateRecords(ctx context.Context, ips []string) error
 	// Name returns the name of the provider.
 	Name() string
 }
 
+// BackoffError is implemented by provider errors that require the updater to wait before the next update
+type BackoffError interface {
+	error
+	// Backoff returns how long to wait before the next update, or zero if no further updates may be sent until the
+	// process is restarted (for example because the credentials were rejected).
+	Backoff() time.Duration
+}
+
 type Updater struct {
 	provider Provider
 	config   config.Config
 	metrics  *metrics.Metrics
 	handle   iputil.NetlinkHandle
+	events   *iputil.EventSource // Nil when netlink events are unavailable
 
 	nextActiveGateways atomic.Value
 	updateChan         chan struct{}
 	lastActiveIPs      atomic.Value
+
+	// Set by provider errors that require backoff. Only used by the update loop.
+	backoffUntil   time.Time
+	updatesStopped bool
 }
 
-func NewUpdater(cfg config.Config, m *metrics.Metrics) (*Updater, error) {
+// NewUpdater creates a new DDNS updater. The events are optional, and are used to update the records as soon as the
+// required IP address is assigned. Without them, the interfaces are polled for the address.
+func NewUpdater(cfg config.Config, m *metrics.Metrics, events *iputil.EventSource) (*Updater, error) {
 	u := &Updater{
 		// provider: provider,
 		config:     cfg,
 		metrics:    m,
 		handle:     iputil.NewRealNetlinkHandle(),
+		events:     events,
 		updateChan: make(chan struct{}),
 	}
 
@@ -69,12 +88,14 @@ func (u *Updater) Run(ctx context.Context) {
 	// Start the monitoring goroutine
 	go u.monitorAddresses(ctx)
 
-	// Main update loop
+	// Main update loop. Updates that were skipped because of a provider backoff are retried when the backoff ends.
+	var retry <-chan time.Time
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-u.updateChan:
+		case <-retry:
 		}
 
 		updateCtx, cancel := context.WithTimeout(ctx, u.config.DDNSTimeout)
@@ -83,6 +104,11 @@ func (u *Updater) Run(ctx context.Context) {
 		if err := u.update(updateCtx); err != nil {
 			slog.ErrorContext(updateCtx, "DDNS update failed", "error", err)
 		}
+
+		retry = nil
+		if wait := time.Until(u.backoffUntil); wait > 0 && !u.updatesStopped {
+			retry = time.After(wait)
+		}
 	}
 }
 
@@ -111,10 +137,7 @@ func (u *Updater) ScheduleUpdate(activeGateways []gateway.Gateway) {
 	}
 
 	u.nextActiveGateways.Swap(activeGateways)
-	select {
-	case u.updateChan <- struct{}{}:
-	default:
-	}
+	u.triggerUpdate()
 }
 
 func (u *Updater) update(ctx context.Context) error {
@@ -122,6 +145,18 @@ func (u *Updater) update(ctx context.Context) error {
 		return nil
 	}
 
+	if u.updatesStopped {
+		u.metrics.DDNSUpdatesSkippedTotal.WithLabelValues(u.provider.Name(), "stopped").Inc()
+		slog.DebugContext(ctx, "Skipping DDNS update: updates were stopped by a provider error")
+		return nil
+	}
+
+	if time.Now().Before(u.backoffUntil) {
+		u.metrics.DDNSUpdatesSkippedTotal.WithLabelValues(u.provider.Name(), "backoff").Inc()
+		slog.DebugContext(ctx, "Skipping DDNS update: waiting for provider backoff", "until", u.backoffUntil)
+		return nil
+	}
+
 	activeGateways := u.nextActiveGateways.Load().([]gateway.Gateway)
 
 	// Check if DDNS requires a specific IP address to be present on an interface
@@ -173,6 +208,13 @@ func (u *Updater) update(ctx context.Context) error {
 		u.metrics.PublicIPChangesTotal.Inc()
 
 		providerName := u.provider.Name()
+		if u.config.DryRun {
+			u.metrics.DDNSUpdatesSkippedTotal.WithLabelValues(providerName, "dry_run").Inc()
+			slog.InfoContext(ctx, "Dry run, skipping DDNS update", "provider", providerName, "hostname", u.config.DDNSHostname, "ips", publicIPs)
+			u.lastActiveIPs.Store(publicIPs)
+			return nil
+		}
+
 		slog.InfoContext(ctx, "Public IPs changed, updating DDNS", "ips", publicIPs)
 
 		start := time.Now()
@@ -182,6 +224,7 @@ func (u *Updater) update(ctx context.Context) error {
 		if err != nil {
 			// Record failed DDNS update
 			u.metrics.DDNSUpdatesTotal.WithLabelValues(providerName, "failure").Inc()
+			u.backOff(ctx, err)
 			return fmt.Errorf("failed to update DNS records: %w", err)
 		}
 
@@ -197,6 +240,23 @@ func (u *Updater) update(ctx context.Context) error {
 	return nil
 }
 
+// backOff delays or stops further updates if the provider error requires it
+func (u *Updater) backOff(ctx context.Context, err error) {
+	var backoffErr BackoffError
+	if !errors.As(err, &backoffErr) {
+		return
+	}
+
+	if backoff := backoffErr.Backoff(); backoff > 0 {
+		u.backoffUntil = time.Now().Add(backoff)
+		slog.WarnContext(ctx, "Delaying DDNS updates after provider error", "provider", u.provider.Name(), "until", u.backoffUntil, "error", err)
+		return
+	}
+
+	u.updatesStopped = true
+	slog.ErrorContext(ctx, "Stopping DDNS updates until restart after provider error", "provider", u.provider.Name(), "error", err)
+}
+
 // Periodically checks for the presence of the required IP address on any interface and triggers DDNS updates when it appears
 // This is mainly useful for startup cases where there may be no VRRP master yet when an update is first triggered
 func (u *Updater) monitorAddresses(ctx context.Context) {
@@ -204,6 +264,14 @@ func (u *Updater) monitorAddresses(ctx context.Context) {
 		return
 	}
 
+	if u.events != nil {
+		unsubscribe := u.events.Subscribe(u.addressHandler(ctx, net.ParseIP(u.config.DDNSRequireIPAddress)))
+		<-ctx.Done()
+		unsubscribe()
+		slog.InfoContext(ctx, "Address monitor stopped")
+		return
+	}
+
 	ticker := time.NewTicker(3 * time.Second)
 	defer ticker.Stop()
 
@@ -223,13 +291,50 @@ func (u *Updater) monitorAddresses(ctx context.Context) {
 
 			if foundIP && !foundAddressLast {
 				slog.DebugContext(ctx, "Required IP address appeared on interface, triggering DDNS update", "required_ip", u.config.DDNSRequireIPAddress)
-				select {
-				case u.updateChan <- struct{}{}:
-				default:
-				}
+				u.triggerUpdate()
 			}
 
 			foundAddressLast = foundIP
 		}
 	}
 }
+
+// addressHandler returns an event handler that triggers an update when the required IP address is assigned to an
+// interface
+func (u *Updater) addressHandler(ctx context.Context, requiredIP net.IP) func(iputil.Event) {
+	return func(event iputil.Event) {
+		if event.Address == nil || !event.Address.NewAddr || !event.Address.LinkAddress.IP.Equal(requiredIP) {
+			return
+		}
+
+		slog.DebugContext(ctx, "Required IP address appeared on interface, triggering DDNS update", "required_ip", requiredIP)
+		u.triggerUpdate()
+	}
+}
+
+// triggerUpdate schedules an update with the current gateways. If one is already pending, this is a no-op.
+func (u *Updater) triggerUpdate() {
+	select {
+	case u.updateChan <- struct{}{}:
+	default:
+	}
+}
+
+// recordType returns the DNS record type (A or AAAA) used to publish the provided IP address
+func recordType(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+		return "AAAA"
+	}
+
+	return "A"
+}
+
+// canonicalIP returns the IP address in its canonical form, so that addresses written in different forms, such as
+// IPv6 addresses with leading zeros, compare equal. Invalid addresses are returned unchanged.
+func canonicalIP(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil {
+		return parsed.String()
+	}
+
+	return ip
+}
@@ -0,0 +1,223 @@
+package ddns
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/config"
+)
+
+// dyndns2UpdatePath is the path of the update endpoint, used when the server URL has no path
+const dyndns2UpdatePath = "/nic/update"
+
+// dyndns2RetryBackoff is how long to wait after a server or DNS error before the next update
+const dyndns2RetryBackoff = 30 * time.Minute
+
+// Return codes of the dyndns2 protocol
+const (
+	DynDNS2CodeGood        = "good"
+	DynDNS2CodeNoChange    = "nochg"
+	DynDNS2CodeBadAuth     = "badauth"
+	DynDNS2CodeNotDonator  = "!donator"
+	DynDNS2CodeNotFQDN     = "notfqdn"
+	DynDNS2CodeNoHost      = "nohost"
+	DynDNS2CodeNumHost     = "numhost"
+	DynDNS2CodeAbuse       = "abuse"
+	DynDNS2CodeBadAgent    = "badagent"
+	DynDNS2CodeDNSError    = "dnserr"
+	DynDNS2CodeServerError = "911"
+)
+
+// dyndns2CodeDescriptions describes the error return codes
+var dyndns2CodeDescriptions = map[string]string{
+	DynDNS2CodeBadAuth:     "invalid username or password",
+	DynDNS2CodeNotDonator:  "feature not available for the account",
+	DynDNS2CodeNotFQDN:     "hostname is not a fully qualified domain name",
+	DynDNS2CodeNoHost:      "hostname does not exist in the account",
+	DynDNS2CodeNumHost:     "too many hostnames in the update",
+	DynDNS2CodeAbuse:       "hostname is blocked for abuse",
+	DynDNS2CodeBadAgent:    "user agent is blocked",
+	DynDNS2CodeDNSError:    "DNS error on the server",
+	DynDNS2CodeServerError: "server error",
+}
+
+// DynDNS2Error is returned when the server rejects an update with a dyndns2 return code
+type DynDNS2Error struct {
+	Code string
+}
+
+func (e *DynDNS2Error) Error() string {
+	return fmt.Sprintf("dyndns2 server returned %s (%s)", e.Code, dyndns2CodeDescriptions[e.Code])
+}
+
+// Backoff returns how long to wait before the next update. Server and DNS errors are retried after a while. The
+// other codes are not resolved by retrying, and servers may block clients that keep sending the same update, so no
+// further updates are sent.
+func (e *DynDNS2Error) Backoff() time.Duration {
+	switch e.Code {
+	case DynDNS2CodeDNSError, DynDNS2CodeServerError:
+		return dyndns2RetryBackoff
+	default:
+		return 0
+	}
+}
+
+// DynDNS2Provider implements the DDNS Provider interface for servers that speak the dyndns2 protocol, such as No-IP
+// and many router and DDNS host implementations
+type DynDNS2Provider struct {
+	updateURL   *url.URL
+	hostname    string
+	username    string
+	password    string
+	multipleIPs bool
+	client      *http.Client
+}
+
+// NewDynDNS2Provider creates a new dyndns2 DDNS provider. Updates are sent to /nic/update on the server, unless the
+// server URL has another path. When multiple IP addresses are not supported by the server, only the first IPv4 and the
+// first IPv6 address are sent.
+func NewDynDNS2Provider(server, hostname string, timeout time.Duration, username, password string, multipleIPs bool) (*DynDNS2Provider, error) {
+	updateURL, err := url.Parse(server)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dyndns2 server URL: %w", err)
+	}
+
+	if updateURL.Scheme == "" || updateURL.Host == "" {
+		return nil, fmt.Errorf("invalid dyndns2 server URL %q: scheme and host are required", server)
+	}
+
+	if updateURL.Path == "" || updateURL.Path == "/" {
+		updateURL.Path = dyndns2UpdatePath
+	}
+
+	return &DynDNS2Provider{
+		updateURL:   updateURL,
+		hostname:    strings.TrimSuffix(hostname, "."),
+		username:    username,
+		password:    password,
+		multipleIPs: multipleIPs,
+		client: &http.Client{
+			Timeout: timeout,
+		},
+	}, nil
+}
+
+// Name returns the provider name
+func (d *DynDNS2Provider) Name() string {
+	return "DynDNS2"
+}
+
+// UpdateRecords updates the DNS records with the provided IP addresses. The dyndns2 protocol cannot remove records,
+// so the records are left alone when there are no IP addresses.
+func (d *DynDNS2Provider) UpdateRecords(ctx context.Context, newPublicIPs []string) error {
+	logger := slog.With("provider", d.Name(), "hostname", d.hostname, "ips", newPublicIPs)
+
+	if len(newPublicIPs) == 0 {
+		logger.WarnContext(ctx, "Not updating DNS records without IP addresses, because dyndns2 cannot remove records")
+		return nil
+	}
+
+	ips := d.selectIPs(newPublicIPs)
+	if len(ips) < len(newPublicIPs) {
+		logger.WarnContext(ctx, "Sending a single IP address per IP family, because multiple IP addresses are not enabled", "sentIPs", ips)
+	}
+
+	updateURL := *d.updateURL
+	query := updateURL.Query()
+	query.Set("hostname", d.hostname)
+	query.Set("myip", strings.Join(ips, ","))
+	updateURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", updateURL.String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.SetBasicAuth(d.username, d.password)
+	req.Header.Set("User-Agent", "gateway-route-manager")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, config.DefaultHTTPMaxBodySize))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if err := parseDynDNS2Response(resp.StatusCode, string(body)); err != nil {
+		return fmt.Errorf("DNS record update failed: %w", err)
+	}
+
+	logger.InfoContext(ctx, "Successfully updated DNS records", "response", strings.TrimSpace(string(body)))
+	return nil
+}
+
+// selectIPs returns the IP addresses to send. Without multiple IP address support, these are the first IPv4 and the
+// first IPv6 address.
+func (d *DynDNS2Provider) selectIPs(ips []string) []string {
+	if d.multipleIPs {
+		return ips
+	}
+
+	var selected []string
+	var hasIPv4, hasIPv6 bool
+	for _, ip := range ips {
+		if recordType(ip) == "AAAA" {
+			if !hasIPv6 {
+				selected = append(selected, ip)
+				hasIPv6 = true
+			}
+		} else if !hasIPv4 {
+			selected = append(selected, ip)
+			hasIPv4 = true
+		}
+	}
+
+	return selected
+}
+
+// parseDynDNS2Response checks the return codes of an update. Servers return one line for each updated hostname, and
+// some also for each IP address, so every line must report success.
+func parseDynDNS2Response(statusCode int, body string) error {
+	var codes int
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		codes++
+
+		code := fields[0]
+		switch code {
+		case DynDNS2CodeGood, DynDNS2CodeNoChange:
+			continue
+		}
+
+		if _, ok := dyndns2CodeDescriptions[code]; ok {
+			return &DynDNS2Error{Code: code}
+		}
+
+		return fmt.Errorf("unexpected dyndns2 response (status %d): %s", statusCode, strings.TrimSpace(body))
+	}
+
+	if codes == 0 {
+		return fmt.Errorf("empty dyndns2 response (status %d)", statusCode)
+	}
+
+	if statusCode < 200 || statusCode >= 300 {
+		return fmt.Errorf("dyndns2 server returned status %d: %s", statusCode, strings.TrimSpace(body))
+	}
+
+	return nil
+}
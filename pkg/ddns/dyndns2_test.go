@@ -0,0 +1,235 @@
+package ddns
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useDynDNS2Server starts a dyndns2 server that responds with the status and body, and returns its URL and a pointer
+// to the last request
+func useDynDNS2Server(t *testing.T, status int, body string) (string, **http.Request) {
+	var lastRequest *http.Request
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastRequest = r
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+
+	return server.URL, &lastRequest
+}
+
+func TestDynDNS2Provider_UpdateRecords(t *testing.T) {
+	tests := []struct {
+		name         string
+		multipleIPs  bool
+		ips          []string
+		body         string
+		expectedMyIP string
+	}{
+		{
+			name:         "single IP address",
+			ips:          []string{"1.2.3.4"},
+			body:         "good 1.2.3.4\n",
+			expectedMyIP: "1.2.3.4",
+		},
+		{
+			name:         "unchanged IP address",
+			ips:          []string{"1.2.3.4"},
+			body:         "nochg 1.2.3.4",
+			expectedMyIP: "1.2.3.4",
+		},
+		{
+			name:         "one IP address per family",
+			ips:          []string{"1.2.3.4", "5.6.7.8", "2001:db8::1", "2001:db8::2"},
+			body:         "good 1.2.3.4,2001:db8::1",
+			expectedMyIP: "1.2.3.4,2001:db8::1",
+		},
+		{
+			name:         "multiple IP addresses",
+			multipleIPs:  true,
+			ips:          []string{"1.2.3.4", "5.6.7.8", "2001:db8::1"},
+			body:         "good 1.2.3.4\ngood 5.6.7.8\nnochg 2001:db8::1\n",
+			expectedMyIP: "1.2.3.4,5.6.7.8,2001:db8::1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverURL, lastRequest := useDynDNS2Server(t, http.StatusOK, tt.body)
+
+			provider, err := NewDynDNS2Provider(serverURL, "gateways.example.com.", 10*time.Second, "test-user", "test-password", tt.multipleIPs)
+			require.NoError(t, err)
+
+			err = provider.UpdateRecords(t.Context(), tt.ips)
+			require.NoError(t, err, "UpdateRecords failed")
+
+			req := *lastRequest
+			require.NotNil(t, req)
+			assert.Equal(t, http.MethodGet, req.Method)
+			assert.Equal(t, "/nic/update", req.URL.Path)
+			assert.Equal(t, "gateways.example.com", req.URL.Query().Get("hostname"))
+			assert.Equal(t, tt.expectedMyIP, req.URL.Query().Get("myip"))
+			assert.Equal(t, "gateway-route-manager", req.UserAgent())
+
+			username, password, ok := req.BasicAuth()
+			require.True(t, ok)
+			assert.Equal(t, "test-user", username)
+			assert.Equal(t, "test-password", password)
+		})
+	}
+}
+
+// TestDynDNS2Provider_UpdateRecords_NoIPs tests that no request is sent without IP addresses, because dyndns2 cannot
+// remove records
+func TestDynDNS2Provider_UpdateRecords_NoIPs(t *testing.T) {
+	serverURL, lastRequest := useDynDNS2Server(t, http.StatusOK, "good")
+
+	provider, err := NewDynDNS2Provider(serverURL+"/custom/update", "gateways.example.com", 10*time.Second, "", "", false)
+	require.NoError(t, err)
+
+	require.NoError(t, provider.UpdateRecords(t.Context(), nil))
+	assert.Nil(t, *lastRequest)
+}
+
+// TestDynDNS2Provider_UpdateRecords_Errors tests that return codes are parsed into errors with the expected backoff
+func TestDynDNS2Provider_UpdateRecords_Errors(t *testing.T) {
+	tests := []struct {
+		name            string
+		status          int
+		body            string
+		expectedCode    string
+		expectedBackoff time.Duration
+		expectedError   string
+	}{
+		{
+			name:         "badauth",
+			status:       http.StatusUnauthorized,
+			body:         "badauth",
+			expectedCode: DynDNS2CodeBadAuth,
+		},
+		{
+			name:         "abuse",
+			status:       http.StatusOK,
+			body:         "abuse\n",
+			expectedCode: DynDNS2CodeAbuse,
+		},
+		{
+			name:         "nohost after a successful line",
+			status:       http.StatusOK,
+			body:         "good 1.2.3.4\nnohost\n",
+			expectedCode: DynDNS2CodeNoHost,
+		},
+		{
+			name:            "server error",
+			status:          http.StatusOK,
+			body:            "911",
+			expectedCode:    DynDNS2CodeServerError,
+			expectedBackoff: 30 * time.Minute,
+		},
+		{
+			name:            "DNS error",
+			status:          http.StatusOK,
+			body:            "dnserr",
+			expectedCode:    DynDNS2CodeDNSError,
+			expectedBackoff: 30 * time.Minute,
+		},
+		{
+			name:          "unexpected response",
+			status:        http.StatusOK,
+			body:          "<html>Not Found</html>",
+			expectedError: "unexpected dyndns2 response (status 200): <html>Not Found</html>",
+		},
+		{
+			name:          "empty response",
+			status:        http.StatusBadGateway,
+			expectedError: "empty dyndns2 response (status 502)",
+		},
+		{
+			name:          "success code with error status",
+			status:        http.StatusInternalServerError,
+			body:          "good 1.2.3.4",
+			expectedError: "dyndns2 server returned status 500: good 1.2.3.4",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverURL, _ := useDynDNS2Server(t, tt.status, tt.body)
+
+			provider, err := NewDynDNS2Provider(serverURL, "gateways.example.com", 10*time.Second, "test-user", "test-password", false)
+			require.NoError(t, err)
+
+			err = provider.UpdateRecords(t.Context(), []string{"1.2.3.4"})
+			require.Error(t, err)
+
+			var backoffErr BackoffError
+			if tt.expectedCode == "" {
+				assert.Contains(t, err.Error(), tt.expectedError)
+				assert.False(t, errors.As(err, &backoffErr))
+				return
+			}
+
+			var dyndns2Err *DynDNS2Error
+			require.True(t, errors.As(err, &dyndns2Err))
+			assert.Equal(t, tt.expectedCode, dyndns2Err.Code)
+
+			require.True(t, errors.As(err, &backoffErr))
+			assert.Equal(t, tt.expectedBackoff, backoffErr.Backoff())
+		})
+	}
+}
+
+func TestNewDynDNS2Provider(t *testing.T) {
+	tests := []struct {
+		name          string
+		server        string
+		expectedURL   string
+		expectedError string
+	}{
+		{
+			name:        "default path",
+			server:      "https://dynupdate.example.com",
+			expectedURL: "https://dynupdate.example.com/nic/update",
+		},
+		{
+			name:        "root path",
+			server:      "https://dynupdate.example.com/",
+			expectedURL: "https://dynupdate.example.com/nic/update",
+		},
+		{
+			name:        "custom path",
+			server:      "http://router.example.com:8080/dyndns/update",
+			expectedURL: "http://router.example.com:8080/dyndns/update",
+		},
+		{
+			name:          "missing scheme",
+			server:        "dynupdate.example.com",
+			expectedError: "scheme and host are required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, err := NewDynDNS2Provider(tt.server, "gateways.example.com", time.Minute, "", "", false)
+
+			if tt.expectedError != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedError)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, "DynDNS2", provider.Name())
+			assert.Equal(t, tt.expectedURL, provider.updateURL.String())
+		})
+	}
+}
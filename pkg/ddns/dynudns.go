@@ -50,6 +50,16 @@ type DynuDNSRecord struct {
 	NodeName    string `json:"nodeName"`
 	RecordType  string `json:"recordType"`
 	IPv4Address string `json:"ipv4Address,omitempty"`
+	IPv6Address string `json:"ipv6Address,omitempty"`
+}
+
+// Address returns the IP address of an A or AAAA record
+func (r DynuDNSRecord) Address() string {
+	if r.RecordType == "AAAA" {
+		return r.IPv6Address
+	}
+
+	return r.IPv4Address
 }
 
 // DynuDNSRecordsResponse represents the response from /dns/{id}/record
@@ -65,6 +75,7 @@ type DynuDNSRecordRequest struct {
 	TTL         int    `json:"ttl"`
 	State       bool   `json:"state"`
 	IPv4Address string `json:"ipv4Address,omitempty"`
+	IPv6Address string `json:"ipv6Address,omitempty"`
 }
 
 // makeAPIRequest is a helper function that makes HTTP requests to the DynuDNS API
@@ -176,10 +187,10 @@ func (d *DynuDNSProvider) UpdateRecords(ctx context.Context, newPublicIPs []stri
 		return fmt.Errorf("failed to get existing records: %w", err)
 	}
 
-	// Build list of existing IP addresses from A records
+	// Build list of existing IP addresses from A and AAAA records
 	existingIPs := make(map[string]DynuDNSRecord)
 	for _, record := range existingRecords {
-		existingIPs[record.IPv4Address] = record
+		existingIPs[record.Address()] = record
 	}
 
 	// Calculate records to delete (existing IPs not in target list)
@@ -207,10 +218,10 @@ func (d *DynuDNSProvider) UpdateRecords(ctx context.Context, newPublicIPs []stri
 	for _, record := range recordsToDelete {
 		eg.Go(func() error {
 			if err := d.deleteRecord(gctx, d.rootDomainID, record.ID); err != nil {
-				return fmt.Errorf("failed to delete record %d (IP: %s): %w", record.ID, record.IPv4Address, err)
+				return fmt.Errorf("failed to delete record %d (IP: %s): %w", record.ID, record.Address(), err)
 			}
 
-			logger.DebugContext(gctx, "Deleted DNS record", "recordID", record.ID, "ip", record.IPv4Address)
+			logger.DebugContext(gctx, "Deleted DNS record", "recordID", record.ID, "ip", record.Address())
 			return nil
 		})
 	}
@@ -253,7 +264,7 @@ func (d *DynuDNSProvider) getExistingRecords(ctx context.Context) ([]DynuDNSReco
 			continue
 		}
 
-		if record.RecordType != "A" {
+		if record.RecordType != "A" && record.RecordType != "AAAA" {
 			continue
 		}
 
@@ -263,16 +274,21 @@ func (d *DynuDNSProvider) getExistingRecords(ctx context.Context) ([]DynuDNSReco
 	return filteredRecords, nil
 }
 
-// createRecord creates a new DNS A record
+// createRecord creates a new DNS A or AAAA record, depending on the IP address family
 func (d *DynuDNSProvider) createRecord(ctx context.Context, ipAddress string) error {
 	url := fmt.Sprintf("%s/dns/%d/record", dynuDNSBaseURL, d.rootDomainID)
 
 	recordReq := DynuDNSRecordRequest{
-		NodeName:    d.nodeName,
-		RecordType:  "A",
-		TTL:         int(d.recordTTL.Seconds()),
-		State:       true,
-		IPv4Address: ipAddress,
+		NodeName:   d.nodeName,
+		RecordType: recordType(ipAddress),
+		TTL:        int(d.recordTTL.Seconds()),
+		State:      true,
+	}
+
+	if recordReq.RecordType == "AAAA" {
+		recordReq.IPv6Address = ipAddress
+	} else {
+		recordReq.IPv4Address = ipAddress
 	}
 	slog.DebugContext(ctx, "Creating new DNS record", "provider", d.Name(), "request", fmt.Sprintf("%#v", recordReq))
 
@@ -112,3 +112,70 @@ func TestDynuDNSProvider_UpdateRecords_EmptyList(t *testing.T) {
 	err := provider.UpdateRecords(t.Context(), []string{})
 	require.NoError(t, err, "UpdateRecords failed")
 }
+
+// TestDynuDNSProvider_UpdateRecords_IPv6 tests that IPv6 addresses are managed as AAAA records
+func TestDynuDNSProvider_UpdateRecords_IPv6(t *testing.T) {
+	var createdRecords []DynuDNSRecordRequest
+	var deletedPaths []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/dns/getroot/test.example.com":
+			response := DynuDNSHostnameResponse{ID: 12345, Node: "test"}
+			json.NewEncoder(w).Encode(response)
+
+		case r.URL.Path == "/v2/dns/12345/record":
+			if r.Method == "GET" {
+				response := DynuDNSRecordsResponse{
+					StatusCode: 200,
+					DNSRecords: []DynuDNSRecord{
+						{
+							ID:          1,
+							RecordType:  "A",
+							NodeName:    "test",
+							IPv4Address: "1.2.3.4",
+						},
+						{
+							ID:          2,
+							RecordType:  "AAAA",
+							NodeName:    "test",
+							IPv6Address: "2001:db8::1",
+						},
+					},
+				}
+				json.NewEncoder(w).Encode(response)
+			} else if r.Method == "POST" {
+				var record DynuDNSRecordRequest
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&record))
+				createdRecords = append(createdRecords, record)
+				w.WriteHeader(http.StatusOK)
+			}
+
+		case strings.Contains(r.URL.Path, "/v2/dns/12345/record/"):
+			if r.Method == "DELETE" {
+				deletedPaths = append(deletedPaths, r.URL.Path)
+				w.WriteHeader(http.StatusOK)
+			}
+
+		default:
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	originalURL := dynuDNSBaseURL
+	dynuDNSBaseURL = server.URL + "/v2"
+	defer func() { dynuDNSBaseURL = originalURL }()
+
+	provider := NewDynuDNSProvider("test-api-key", "test.example.com", 10*time.Second, 10*time.Minute)
+
+	err := provider.UpdateRecords(t.Context(), []string{"1.2.3.4", "2001:db8::2"})
+	require.NoError(t, err, "UpdateRecords failed")
+
+	require.Len(t, createdRecords, 1)
+	require.Equal(t, "AAAA", createdRecords[0].RecordType)
+	require.Equal(t, "2001:db8::2", createdRecords[0].IPv6Address)
+	require.Empty(t, createdRecords[0].IPv4Address)
+
+	require.Equal(t, []string{"/v2/dns/12345/record/2"}, deletedPaths)
+}
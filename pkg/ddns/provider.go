@@ -21,6 +21,73 @@ func NewProvider(cfg config.Config) (Provider, error) {
 			cfg.DDNSTimeout,
 			cfg.DDNSTTL,
 		), nil
+	case "cloudflare":
+		return NewCloudflareProvider(
+			cfg.DDNSPassword, // API token
+			cfg.DDNSHostname,
+			cfg.DDNSTimeout,
+			cfg.DDNSTTL,
+			cfg.DDNSCloudflareProxied,
+			cfg.DDNSRecordComment,
+		), nil
+	case "rfc2136":
+		provider, err := NewRFC2136Provider(
+			cfg.DDNSServer,
+			cfg.DDNSZone,
+			cfg.DDNSHostname,
+			cfg.DDNSTimeout,
+			cfg.DDNSTTL,
+			cfg.DDNSUsername, // TSIG key name
+			cfg.DDNSTSIGAlgorithm,
+			cfg.DDNSPassword, // TSIG secret
+		)
+		if err != nil {
+			return nil, err
+		}
+		return provider, nil
+	case "route53":
+		provider, err := NewRoute53Provider(
+			cfg.DDNSServer, // API endpoint
+			cfg.DDNSZone,   // Hosted zone ID
+			cfg.DDNSHostname,
+			cfg.DDNSTimeout,
+			cfg.DDNSTTL,
+			cfg.DDNSUsername, // Access key ID
+			cfg.DDNSPassword, // Secret access key
+			cfg.DDNSRoute53RoutingPolicy,
+			cfg.DDNSRoute53HealthChecks,
+			cfg.DDNSRecordComment,
+		)
+		if err != nil {
+			return nil, err
+		}
+		return provider, nil
+	case "webhook":
+		provider, err := NewWebhookProvider(
+			cfg.DDNSWebhook,
+			cfg.DDNSHostname,
+			cfg.DDNSTimeout,
+			cfg.DDNSTTL,
+			cfg.DDNSUsername,
+			cfg.DDNSPassword,
+		)
+		if err != nil {
+			return nil, err
+		}
+		return provider, nil
+	case "dyndns2":
+		provider, err := NewDynDNS2Provider(
+			cfg.DDNSServer,
+			cfg.DDNSHostname,
+			cfg.DDNSTimeout,
+			cfg.DDNSUsername,
+			cfg.DDNSPassword,
+			cfg.DDNSDynDNS2MultipleIPs,
+		)
+		if err != nil {
+			return nil, err
+		}
+		return provider, nil
 	default:
 		return nil, fmt.Errorf("unsupported DDNS provider: %s", cfg.DDNSProvider)
 	}
@@ -34,6 +34,110 @@ func TestNewProvider(t *testing.T) {
 			},
 			expectedError: "unsupported DDNS provider: unsupported",
 		},
+		{
+			name: "cloudflare",
+			config: config.Config{
+				DDNSProvider: "cloudflare",
+				DDNSPassword: "api-token",
+				DDNSHostname: "test.example.com",
+				DDNSTimeout:  time.Minute,
+				DDNSTTL:      time.Minute,
+			},
+			expectedType: "Cloudflare",
+		},
+		{
+			name: "rfc2136",
+			config: config.Config{
+				DDNSProvider:      "rfc2136",
+				DDNSUsername:      "ddns-key",
+				DDNSPassword:      testTSIGSecret,
+				DDNSHostname:      "test.example.com",
+				DDNSServer:        "ns1.example.com",
+				DDNSTSIGAlgorithm: "hmac-sha256",
+				DDNSTimeout:       time.Minute,
+				DDNSTTL:           time.Minute,
+			},
+			expectedType: "RFC2136",
+		},
+		{
+			name: "rfc2136 with invalid TSIG algorithm",
+			config: config.Config{
+				DDNSProvider:      "rfc2136",
+				DDNSUsername:      "ddns-key",
+				DDNSPassword:      testTSIGSecret,
+				DDNSHostname:      "test.example.com",
+				DDNSServer:        "ns1.example.com",
+				DDNSTSIGAlgorithm: "hmac-md5",
+			},
+			expectedError: "unsupported TSIG algorithm: hmac-md5",
+		},
+		{
+			name: "route53",
+			config: config.Config{
+				DDNSProvider:             "route53",
+				DDNSUsername:             "AKIDEXAMPLE",
+				DDNSPassword:             "secret",
+				DDNSHostname:             "test.example.com",
+				DDNSZone:                 "Z123",
+				DDNSTimeout:              time.Minute,
+				DDNSTTL:                  time.Minute,
+				DDNSRoute53RoutingPolicy: "multivalue",
+				DDNSRoute53HealthChecks:  map[string]string{"1.2.3.4": "hc-1"},
+			},
+			expectedType: "Route53",
+		},
+		{
+			name: "route53 with invalid routing policy",
+			config: config.Config{
+				DDNSProvider:             "route53",
+				DDNSUsername:             "AKIDEXAMPLE",
+				DDNSPassword:             "secret",
+				DDNSHostname:             "test.example.com",
+				DDNSRoute53RoutingPolicy: "latency",
+			},
+			expectedError: "unsupported Route 53 routing policy: latency",
+		},
+		{
+			name: "webhook",
+			config: config.Config{
+				DDNSProvider: "webhook",
+				DDNSHostname: "test.example.com",
+				DDNSTimeout:  time.Minute,
+				DDNSTTL:      time.Minute,
+				DDNSWebhook:  config.DDNSWebhookConfig{URL: "https://example.com/update?ips={{join \",\" .IPs}}"},
+			},
+			expectedType: "Webhook",
+		},
+		{
+			name: "webhook with invalid template",
+			config: config.Config{
+				DDNSProvider: "webhook",
+				DDNSHostname: "test.example.com",
+				DDNSWebhook:  config.DDNSWebhookConfig{URL: "https://example.com/{{"},
+			},
+			expectedError: "failed to parse webhook URL template",
+		},
+		{
+			name: "dyndns2",
+			config: config.Config{
+				DDNSProvider: "dyndns2",
+				DDNSUsername: "test-user",
+				DDNSPassword: "test-password",
+				DDNSHostname: "test.example.com",
+				DDNSServer:   "https://dynupdate.example.com",
+				DDNSTimeout:  time.Minute,
+			},
+			expectedType: "DynDNS2",
+		},
+		{
+			name: "dyndns2 with invalid server",
+			config: config.Config{
+				DDNSProvider: "dyndns2",
+				DDNSHostname: "test.example.com",
+				DDNSServer:   "dynupdate.example.com",
+			},
+			expectedError: "invalid dyndns2 server URL",
+		},
 	}
 
 	for _, tt := range tests {
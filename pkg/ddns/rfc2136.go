@@ -0,0 +1,277 @@
+package ddns
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// TSIG algorithms that messages can be signed with
+const (
+	TSIGAlgorithmHMACSHA256 = "hmac-sha256"
+	TSIGAlgorithmHMACSHA512 = "hmac-sha512"
+)
+
+// tsigFudge is the allowed difference between the signing time and the time of verification, in seconds
+const tsigFudge = 300
+
+// maxUDPMessageSize is the largest message that is sent over UDP. Larger messages are sent over TCP.
+const maxUDPMessageSize = dns.MinMsgSize
+
+// RFC2136Provider implements the DDNS Provider interface for name servers that accept dynamic updates (RFC 2136),
+// such as BIND and Knot. Updates are signed with a TSIG key.
+type RFC2136Provider struct {
+	server       string
+	hostname     string
+	recordTTL    time.Duration
+	keyName      string // Fully qualified, lowercase key name
+	keyAlgorithm string // Fully qualified algorithm name
+	keySecret    string // Base64 encoded secret
+	timeout      time.Duration
+
+	// Cached zone information
+	initialized atomic.Bool
+	zone        string
+}
+
+// DNSResponseError is returned when the name server rejects a message
+type DNSResponseError struct {
+	RCode int
+}
+
+func (e *DNSResponseError) Error() string {
+	name, ok := dns.RcodeToString[e.RCode]
+	if !ok {
+		name = fmt.Sprintf("RCODE%d", e.RCode)
+	}
+	return fmt.Sprintf("name server returned %s", name)
+}
+
+// TSIGError is returned when the name server rejects the transaction signature of a message
+type TSIGError struct {
+	Code    uint16
+	Message string
+}
+
+func (e *TSIGError) Error() string {
+	return fmt.Sprintf("TSIG error: %s", e.Message)
+}
+
+// newTSIGError returns the error for a TSIG error code, from RFC 8945 section 3
+func newTSIGError(code uint16) *TSIGError {
+	messages := map[uint16]string{
+		dns.RcodeBadSig:   "bad signature",
+		dns.RcodeBadKey:   "unknown key",
+		dns.RcodeBadTime:  "signature expired",
+		dns.RcodeBadTrunc: "bad truncation",
+	}
+
+	message, ok := messages[code]
+	if !ok {
+		message = fmt.Sprintf("error %d", code)
+	}
+	return &TSIGError{Code: code, Message: message}
+}
+
+// NewRFC2136Provider creates a new RFC 2136 DDNS provider. The server is the address of the primary name server of the
+// zone, with an optional port. If the zone is empty, it is looked up with an SOA query for the hostname. The secret
+// of the TSIG key is base64 encoded.
+func NewRFC2136Provider(server, zone, hostname string, timeout, recordTTL time.Duration, keyName, keyAlgorithm, keySecret string) (*RFC2136Provider, error) {
+	var algorithm string
+	switch strings.ToLower(keyAlgorithm) {
+	case TSIGAlgorithmHMACSHA256:
+		algorithm = dns.HmacSHA256
+	case TSIGAlgorithmHMACSHA512:
+		algorithm = dns.HmacSHA512
+	default:
+		return nil, fmt.Errorf("failed to create TSIG key: unsupported TSIG algorithm: %s", keyAlgorithm)
+	}
+
+	if _, err := base64.StdEncoding.DecodeString(keySecret); err != nil {
+		return nil, fmt.Errorf("failed to create TSIG key: failed to decode TSIG secret: %w", err)
+	}
+
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	p := &RFC2136Provider{
+		server:       server,
+		hostname:     dns.CanonicalName(hostname),
+		recordTTL:    recordTTL,
+		keyName:      dns.CanonicalName(keyName),
+		keyAlgorithm: algorithm,
+		keySecret:    keySecret,
+		timeout:      timeout,
+	}
+
+	if zone != "" {
+		p.zone = dns.CanonicalName(zone)
+		p.initialized.Store(true)
+	}
+
+	return p, nil
+}
+
+// Name returns the provider name
+func (p *RFC2136Provider) Name() string {
+	return "RFC2136"
+}
+
+// initializeZoneInfo looks up the zone that contains the hostname, from the SOA record that the name server returns
+// for the hostname
+func (p *RFC2136Provider) initializeZoneInfo(ctx context.Context) error {
+	logger := slog.With("provider", p.Name(), "hostname", p.hostname)
+
+	query := new(dns.Msg)
+	query.SetQuestion(p.hostname, dns.TypeSOA)
+
+	logger.DebugContext(ctx, "Looking up zone of hostname", "server", p.server)
+
+	response, err := p.exchange(ctx, query)
+	if err != nil {
+		return fmt.Errorf("SOA query failed: %w", err)
+	}
+
+	if response.Rcode != dns.RcodeSuccess && response.Rcode != dns.RcodeNameError {
+		return &DNSResponseError{RCode: response.Rcode}
+	}
+
+	// The SOA record is an answer at the apex of the zone, and an authority record below it
+	for _, record := range append(response.Answer, response.Ns...) {
+		if soa, ok := record.(*dns.SOA); ok {
+			p.zone = dns.CanonicalName(soa.Hdr.Name)
+			logger.InfoContext(ctx, "Initialized RFC 2136 zone info", "zone", p.zone)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("no zone found for hostname %s", p.hostname)
+}
+
+// UpdateRecords replaces the A and AAAA records of the hostname with the provided IP addresses, in a single update
+func (p *RFC2136Provider) UpdateRecords(ctx context.Context, newPublicIPs []string) error {
+	logger := slog.With("provider", p.Name(), "hostname", p.hostname, "ips", newPublicIPs)
+
+	// This cannot be done at provider creation time because it requires network access, which may not be available then
+	if !p.initialized.Load() {
+		logger.Info("Initializing RFC 2136 zone info")
+
+		if err := p.initializeZoneInfo(ctx); err != nil {
+			return fmt.Errorf("failed to initialize zone info: %w", err)
+		}
+		p.initialized.Store(true)
+	}
+
+	update, err := p.buildUpdate(newPublicIPs)
+	if err != nil {
+		return fmt.Errorf("failed to build update: %w", err)
+	}
+	update.SetTsig(p.keyName, p.keyAlgorithm, tsigFudge, time.Now().Unix())
+
+	logger.DebugContext(ctx, "Sending DNS update", "server", p.server, "zone", p.zone)
+
+	response, err := p.exchange(ctx, update)
+	if err := checkUpdateResponse(response, err); err != nil {
+		return fmt.Errorf("DNS record update failed: %w", err)
+	}
+
+	logger.InfoContext(ctx, "Successfully updated DNS records")
+	return nil
+}
+
+// buildUpdate builds an update message that deletes the A and AAAA RRsets of the hostname, and adds a record for each
+// IP address. The server applies all changes of the message atomically.
+func (p *RFC2136Provider) buildUpdate(ips []string) (*dns.Msg, error) {
+	update := new(dns.Msg)
+	update.SetUpdate(p.zone)
+
+	// There are no prerequisites
+	update.RemoveRRset([]dns.RR{
+		&dns.A{Hdr: dns.RR_Header{Name: p.hostname, Rrtype: dns.TypeA}},
+		&dns.AAAA{Hdr: dns.RR_Header{Name: p.hostname, Rrtype: dns.TypeAAAA}},
+	})
+
+	ttl := uint32(p.recordTTL.Seconds())
+	records := make([]dns.RR, 0, len(ips))
+	for _, ip := range ips {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP address %q: %w", ip, err)
+		}
+
+		if addr.Unmap().Is4() {
+			records = append(records, &dns.A{Hdr: dns.RR_Header{Name: p.hostname, Rrtype: dns.TypeA, Ttl: ttl}, A: net.IP(addr.Unmap().AsSlice())})
+		} else {
+			records = append(records, &dns.AAAA{Hdr: dns.RR_Header{Name: p.hostname, Rrtype: dns.TypeAAAA, Ttl: ttl}, AAAA: net.IP(addr.AsSlice())})
+		}
+	}
+	update.Insert(records)
+
+	return update, nil
+}
+
+// checkUpdateResponse checks the result and the signature of the response to an update, along with the error of the
+// exchange. The signature of the response is verified by the exchange.
+func checkUpdateResponse(response *dns.Msg, err error) error {
+	// Rejected signatures are reported through the TSIG record of the response, which is not signed
+	if response != nil && response.Rcode == dns.RcodeNotAuth {
+		if tsig := response.IsTsig(); tsig != nil && tsig.Error != dns.RcodeSuccess {
+			return newTSIGError(tsig.Error)
+		}
+		return &DNSResponseError{RCode: response.Rcode}
+	}
+
+	if err != nil {
+		// Signatures are only verified when the response has a TSIG record
+		if response != nil && response.IsTsig() != nil {
+			return fmt.Errorf("invalid response signature: %w", err)
+		}
+		return err
+	}
+
+	if response.Rcode != dns.RcodeSuccess {
+		return &DNSResponseError{RCode: response.Rcode}
+	}
+
+	if response.IsTsig() == nil {
+		return errors.New("invalid response signature: response is not signed")
+	}
+
+	return nil
+}
+
+// exchange sends a message to the name server and returns the response. Messages that do not fit in a UDP packet, and
+// truncated responses, are sent over TCP. Signed messages are signed when they are sent, and the signature of their
+// response is verified. Responses with an invalid signature are returned along with the error, so that TSIG errors
+// reported by the server can be checked.
+func (p *RFC2136Provider) exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	client := &dns.Client{
+		Net:        "udp",
+		Timeout:    p.timeout,
+		TsigSecret: map[string]string{p.keyName: p.keySecret},
+	}
+
+	if msg.Len() <= maxUDPMessageSize {
+		response, _, err := client.ExchangeContext(ctx, msg, p.server)
+		if err != nil || !response.Truncated {
+			return response, err
+		}
+	}
+
+	client.Net = "tcp"
+	response, _, err := client.ExchangeContext(ctx, msg, p.server)
+	return response, err
+}
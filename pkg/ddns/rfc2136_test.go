@@ -0,0 +1,359 @@
+package ddns
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testTSIGKeyName = "ddns-key."
+	testTSIGSecret  = "c2VjcmV0LXNoYXJlZC13aXRoLXRoZS1uYW1lLXNlcnZlcg=="
+)
+
+// testDNSServer is an authoritative name server for a single zone that accepts dynamic updates signed with a TSIG
+// key, over UDP and TCP on the same port
+type testDNSServer struct {
+	t         *testing.T
+	zone      string
+	algorithm string
+
+	// Replaces the response code of updates, when set
+	rcode int
+	// Signs responses with another secret
+	badResponseSignature bool
+
+	mu         sync.Mutex
+	records    map[string][]string // Record data by "name type"
+	ttls       map[string]uint32   // TTLs by "name type"
+	queries    []string            // Question names of SOA queries
+	updates    int
+	transports []string
+
+	addr string
+}
+
+// newTestDNSServer starts a name server for example.com that accepts updates signed with the test key
+func newTestDNSServer(t *testing.T, algorithm string) *testDNSServer {
+	s := &testDNSServer{
+		t:         t,
+		zone:      "example.com.",
+		algorithm: dns.CanonicalName(algorithm),
+		records:   make(map[string][]string),
+		ttls:      make(map[string]uint32),
+	}
+
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s.addr = packetConn.LocalAddr().String()
+	listener, err := net.Listen("tcp", s.addr)
+	require.NoError(t, err)
+
+	// Updates are rejected by the default accept function
+	acceptAll := func(dns.Header) dns.MsgAcceptAction { return dns.MsgAccept }
+	tsigSecret := map[string]string{testTSIGKeyName: testTSIGSecret}
+	servers := []*dns.Server{
+		{PacketConn: packetConn, TsigSecret: tsigSecret, MsgAcceptFunc: acceptAll, Handler: s.handler("udp")},
+		{Listener: listener, TsigSecret: tsigSecret, MsgAcceptFunc: acceptAll, Handler: s.handler("tcp")},
+	}
+	for _, server := range servers {
+		go server.ActivateAndServe()
+		t.Cleanup(func() { server.Shutdown() })
+	}
+
+	return s
+}
+
+// setRecords sets the records of an RRset
+func (s *testDNSServer) setRecords(name string, recordType uint16, ttl uint32, data ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := fmt.Sprintf("%s %s", name, dns.TypeToString[recordType])
+	s.records[key] = data
+	s.ttls[key] = ttl
+}
+
+// getRecords returns the records and TTL of an RRset
+func (s *testDNSServer) getRecords(name string, recordType uint16) ([]string, uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := fmt.Sprintf("%s %s", name, dns.TypeToString[recordType])
+	records := slices.Clone(s.records[key])
+	slices.Sort(records)
+	return records, s.ttls[key]
+}
+
+// handler returns the handler of the messages received over the transport
+func (s *testDNSServer) handler(transport string) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		response := new(dns.Msg)
+		response.SetReply(r)
+
+		if r.Opcode == dns.OpcodeQuery {
+			s.queries = append(s.queries, r.Question[0].Name)
+			require.NoError(s.t, w.WriteMsg(s.soaResponse(response)))
+			return
+		}
+
+		require.Equal(s.t, dns.OpcodeUpdate, r.Opcode)
+		s.updates++
+		s.transports = append(s.transports, transport)
+
+		tsig := r.IsTsig()
+		require.NotNil(s.t, tsig, "update is not signed")
+		require.Equal(s.t, s.algorithm, tsig.Algorithm)
+		require.Equal(s.t, uint16(300), tsig.Fudge)
+		response.SetTsig(tsig.Hdr.Name, tsig.Algorithm, tsig.Fudge, time.Now().Unix())
+
+		// Rejected signatures are reported with an unsigned TSIG record
+		if err := w.TsigStatus(); err != nil {
+			response.Rcode = dns.RcodeNotAuth
+			response.IsTsig().Error = dns.RcodeBadSig
+			if errors.Is(err, dns.ErrSecret) {
+				response.IsTsig().Error = dns.RcodeBadKey
+			}
+			require.NoError(s.t, w.WriteMsg(response))
+			return
+		}
+
+		if s.rcode != dns.RcodeSuccess {
+			response.Rcode = s.rcode
+		} else {
+			s.applyUpdate(r)
+		}
+
+		if s.badResponseSignature {
+			signed, _, err := dns.TsigGenerate(response, base64.StdEncoding.EncodeToString([]byte("wrong secret")), tsig.MAC, false)
+			require.NoError(s.t, err)
+			_, err = w.Write(signed)
+			require.NoError(s.t, err)
+			return
+		}
+
+		require.NoError(s.t, w.WriteMsg(response))
+	}
+}
+
+// soaResponse returns the SOA record of the zone as an authority record, like for names below the apex
+func (s *testDNSServer) soaResponse(response *dns.Msg) *dns.Msg {
+	response.Authoritative = true
+	response.Rcode = dns.RcodeNameError
+	response.Ns = []dns.RR{&dns.SOA{
+		Hdr:    dns.RR_Header{Name: s.zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 3600},
+		Ns:     "ns1.example.com.",
+		Mbox:   "hostmaster.example.com.",
+		Serial: 1,
+	}}
+	return response
+}
+
+// applyUpdate applies the RRset deletions and record additions of the update section
+func (s *testDNSServer) applyUpdate(r *dns.Msg) {
+	for _, record := range r.Ns {
+		header := record.Header()
+		key := fmt.Sprintf("%s %s", header.Name, dns.TypeToString[header.Rrtype])
+		switch header.Class {
+		case dns.ClassANY:
+			// Delete the RRset
+			require.Equal(s.t, uint32(0), header.Ttl)
+			require.Equal(s.t, uint16(0), header.Rdlength)
+			delete(s.records, key)
+			delete(s.ttls, key)
+
+		case dns.ClassINET:
+			// Add a record to the RRset
+			switch record := record.(type) {
+			case *dns.A:
+				s.records[key] = append(s.records[key], record.A.String())
+			case *dns.AAAA:
+				s.records[key] = append(s.records[key], record.AAAA.String())
+			default:
+				s.t.Errorf("unexpected update record %s", record)
+			}
+			s.ttls[key] = header.Ttl
+
+		default:
+			s.t.Errorf("unexpected update class %s", dns.ClassToString[header.Class])
+		}
+	}
+}
+
+// TestRFC2136Provider_UpdateRecords tests that the records are replaced with a single signed update
+func TestRFC2136Provider_UpdateRecords(t *testing.T) {
+	for _, algorithm := range []string{TSIGAlgorithmHMACSHA256, TSIGAlgorithmHMACSHA512} {
+		t.Run(algorithm, func(t *testing.T) {
+			server := newTestDNSServer(t, algorithm)
+			server.setRecords("gateways.example.com.", dns.TypeA, 60, "1.2.3.4")
+			server.setRecords("gateways.example.com.", dns.TypeAAAA, 60, "2001:db8::1")
+			server.setRecords("gateways.example.com.", dns.TypeTXT, 60, "unrelated")
+
+			// The zone is looked up when it is not configured
+			provider, err := NewRFC2136Provider(server.addr, "", "Gateways.example.com", 10*time.Second, 2*time.Minute, "ddns-key", algorithm, testTSIGSecret)
+			require.NoError(t, err)
+
+			err = provider.UpdateRecords(t.Context(), []string{"5.6.7.8", "1.2.3.4", "2001:db8::2"})
+			require.NoError(t, err, "UpdateRecords failed")
+
+			records, ttl := server.getRecords("gateways.example.com.", dns.TypeA)
+			assert.Equal(t, []string{"1.2.3.4", "5.6.7.8"}, records)
+			assert.Equal(t, uint32(120), ttl)
+
+			records, _ = server.getRecords("gateways.example.com.", dns.TypeAAAA)
+			assert.Equal(t, []string{"2001:db8::2"}, records)
+
+			records, _ = server.getRecords("gateways.example.com.", dns.TypeTXT)
+			assert.Equal(t, []string{"unrelated"}, records)
+
+			assert.Equal(t, []string{"gateways.example.com."}, server.queries)
+			assert.Equal(t, []string{"udp"}, server.transports)
+
+			// The zone is only looked up once, and an empty list removes all records
+			require.NoError(t, provider.UpdateRecords(t.Context(), []string{}))
+			records, _ = server.getRecords("gateways.example.com.", dns.TypeA)
+			assert.Empty(t, records)
+			assert.Len(t, server.queries, 1)
+		})
+	}
+}
+
+// TestRFC2136Provider_UpdateRecords_TCP tests that updates that do not fit in a UDP packet are sent over TCP
+func TestRFC2136Provider_UpdateRecords_TCP(t *testing.T) {
+	server := newTestDNSServer(t, TSIGAlgorithmHMACSHA256)
+
+	provider, err := NewRFC2136Provider(server.addr, "example.com", "gateways.example.com", 10*time.Second, time.Minute, "ddns-key", TSIGAlgorithmHMACSHA256, testTSIGSecret)
+	require.NoError(t, err)
+
+	var ips []string
+	for i := 1; i <= 32; i++ {
+		ips = append(ips, fmt.Sprintf("2001:db8::%x", i))
+	}
+
+	require.NoError(t, provider.UpdateRecords(t.Context(), ips))
+
+	records, _ := server.getRecords("gateways.example.com.", dns.TypeAAAA)
+	assert.Len(t, records, 32)
+	assert.Equal(t, []string{"tcp"}, server.transports)
+	assert.Empty(t, server.queries)
+}
+
+// TestRFC2136Provider_UpdateRecords_Errors tests that rejected updates and invalid responses are reported
+func TestRFC2136Provider_UpdateRecords_Errors(t *testing.T) {
+	tests := []struct {
+		name                 string
+		secret               string
+		keyName              string
+		rcode                int
+		badResponseSignature bool
+		check                func(t *testing.T, err error)
+	}{
+		{
+			name:   "wrong secret",
+			secret: base64.StdEncoding.EncodeToString([]byte("wrong secret")),
+			check: func(t *testing.T, err error) {
+				var tsigErr *TSIGError
+				require.ErrorAs(t, err, &tsigErr)
+				assert.Equal(t, uint16(dns.RcodeBadSig), tsigErr.Code)
+			},
+		},
+		{
+			name:    "unknown key",
+			keyName: "other-key",
+			check: func(t *testing.T, err error) {
+				var tsigErr *TSIGError
+				require.ErrorAs(t, err, &tsigErr)
+				assert.Equal(t, uint16(dns.RcodeBadKey), tsigErr.Code)
+			},
+		},
+		{
+			name:  "refused",
+			rcode: dns.RcodeRefused,
+			check: func(t *testing.T, err error) {
+				var responseErr *DNSResponseError
+				require.ErrorAs(t, err, &responseErr)
+				assert.Equal(t, dns.RcodeRefused, responseErr.RCode)
+			},
+		},
+		{
+			name:  "not in zone",
+			rcode: dns.RcodeNotZone,
+			check: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, "name server returned NOTZONE")
+			},
+		},
+		{
+			name:                 "bad response signature",
+			badResponseSignature: true,
+			check: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, "invalid response signature")
+				assert.ErrorIs(t, err, dns.ErrSig)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestDNSServer(t, TSIGAlgorithmHMACSHA256)
+			server.rcode = tt.rcode
+			server.badResponseSignature = tt.badResponseSignature
+
+			secret := tt.secret
+			if secret == "" {
+				secret = testTSIGSecret
+			}
+			keyName := tt.keyName
+			if keyName == "" {
+				keyName = testTSIGKeyName
+			}
+
+			provider, err := NewRFC2136Provider(server.addr, "example.com", "gateways.example.com", 10*time.Second, time.Minute, keyName, TSIGAlgorithmHMACSHA256, secret)
+			require.NoError(t, err)
+
+			err = provider.UpdateRecords(t.Context(), []string{"1.2.3.4"})
+			require.Error(t, err)
+			tt.check(t, err)
+		})
+	}
+}
+
+// TestRFC2136Provider_UpdateRecords_Timeout tests that updates fail when the server does not respond
+func TestRFC2136Provider_UpdateRecords_Timeout(t *testing.T) {
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer packetConn.Close()
+
+	provider, err := NewRFC2136Provider(packetConn.LocalAddr().String(), "example.com", "gateways.example.com", 100*time.Millisecond, time.Minute, "ddns-key", TSIGAlgorithmHMACSHA256, testTSIGSecret)
+	require.NoError(t, err)
+
+	err = provider.UpdateRecords(t.Context(), []string{"1.2.3.4"})
+	var netErr net.Error
+	require.ErrorAs(t, err, &netErr)
+	assert.True(t, netErr.Timeout())
+}
+
+func TestNewRFC2136Provider(t *testing.T) {
+	provider, err := NewRFC2136Provider("ns1.example.com", "", "gateways.example.com", time.Second, time.Minute, "ddns-key", "HMAC-SHA512", testTSIGSecret)
+	require.NoError(t, err)
+	assert.Equal(t, "ns1.example.com:53", provider.server)
+	assert.False(t, provider.initialized.Load())
+
+	_, err = NewRFC2136Provider("ns1.example.com", "", "gateways.example.com", time.Second, time.Minute, "ddns-key", "hmac-md5", testTSIGSecret)
+	assert.ErrorContains(t, err, "unsupported TSIG algorithm: hmac-md5")
+
+	_, err = NewRFC2136Provider("ns1.example.com", "", "gateways.example.com", time.Second, time.Minute, "ddns-key", TSIGAlgorithmHMACSHA256, "not base64!")
+	assert.ErrorContains(t, err, "failed to decode TSIG secret")
+}
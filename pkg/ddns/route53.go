@@ -0,0 +1,542 @@
+package ddns
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var route53BaseURL = "https://route53.amazonaws.com"
+
+const (
+	// route53APIVersion is the version of the Route 53 API that requests are made against
+	route53APIVersion = "2013-04-01"
+	// route53SigningRegion is the region that Route 53 requests are signed for. Route 53 is a global service.
+	route53SigningRegion = "us-east-1"
+	// route53MaxItems is the number of record sets that are requested per page
+	route53MaxItems = 300
+	// route53ChangePollInterval is how often the status of a change is checked while waiting for it to reach INSYNC
+	route53ChangePollInterval = 5 * time.Second
+	// route53Weight is the weight of each record set with the weighted routing policy, so that the traffic is split
+	// evenly between the healthy IP addresses
+	route53Weight = 1
+)
+
+// Route 53 routing policies for the managed records
+const (
+	// Route53RoutingPolicySimple publishes all IP addresses of a family in a single record set
+	Route53RoutingPolicySimple = "simple"
+	// Route53RoutingPolicyMultivalue publishes each IP address in a multivalue answer record set
+	Route53RoutingPolicyMultivalue = "multivalue"
+	// Route53RoutingPolicyWeighted publishes each IP address in a weighted record set
+	Route53RoutingPolicyWeighted = "weighted"
+)
+
+// Route53Provider implements the DDNS Provider interface for AWS Route 53
+type Route53Provider struct {
+	endpoint      string
+	hostname      string
+	recordTTL     time.Duration
+	routingPolicy string
+	healthChecks  map[string]string // Health check ID of each public IP address
+	comment       string
+	signer        *sigV4Signer
+	client        *http.Client
+	pollInterval  time.Duration
+
+	// Cached zone information
+	initialized  atomic.Bool
+	hostedZoneID string
+}
+
+// Route53APIError is returned when the Route 53 API rejects a request
+type Route53APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *Route53APIError) Error() string {
+	return fmt.Sprintf("Route 53 API error: %s: %s (%d)", e.Code, e.Message, e.StatusCode)
+}
+
+// Route53ResourceRecord represents a single value of a record set
+type Route53ResourceRecord struct {
+	Value string
+}
+
+// Route53AliasTarget represents the target of an alias record set
+type Route53AliasTarget struct {
+	HostedZoneId         string
+	DNSName              string
+	EvaluateTargetHealth bool
+}
+
+// Route53ResourceRecordSet represents a record set from the Route 53 API. The fields are in the order of the API
+// schema.
+type Route53ResourceRecordSet struct {
+	Name             string
+	Type             string
+	SetIdentifier    string                  `xml:",omitempty"`
+	Weight           *int64                  `xml:",omitempty"`
+	Region           string                  `xml:",omitempty"`
+	Failover         string                  `xml:",omitempty"`
+	MultiValueAnswer *bool                   `xml:",omitempty"`
+	TTL              int64                   `xml:",omitempty"`
+	ResourceRecords  []Route53ResourceRecord `xml:"ResourceRecords>ResourceRecord,omitempty"`
+	AliasTarget      *Route53AliasTarget     `xml:",omitempty"`
+	HealthCheckId    string                  `xml:",omitempty"`
+}
+
+// Route53Change represents a single change of a change batch
+type Route53Change struct {
+	Action            string
+	ResourceRecordSet Route53ResourceRecordSet
+}
+
+// Route53ChangeBatch represents the changes that are applied together in one request
+type Route53ChangeBatch struct {
+	Comment string          `xml:",omitempty"`
+	Changes []Route53Change `xml:"Changes>Change"`
+}
+
+// Route53ChangeResourceRecordSetsRequest represents the body of a ChangeResourceRecordSets request
+type Route53ChangeResourceRecordSetsRequest struct {
+	XMLName     xml.Name `xml:"https://route53.amazonaws.com/doc/2013-04-01/ ChangeResourceRecordSetsRequest"`
+	ChangeBatch Route53ChangeBatch
+}
+
+// Route53ChangeInfo represents the status of a change batch
+type Route53ChangeInfo struct {
+	Id     string
+	Status string
+}
+
+// Route53ChangeInfoResponse represents the response of the ChangeResourceRecordSets and GetChange requests
+type Route53ChangeInfoResponse struct {
+	ChangeInfo Route53ChangeInfo
+}
+
+// Route53ListResourceRecordSetsResponse represents a page of record sets
+type Route53ListResourceRecordSetsResponse struct {
+	ResourceRecordSets   []Route53ResourceRecordSet `xml:"ResourceRecordSets>ResourceRecordSet"`
+	IsTruncated          bool
+	NextRecordName       string
+	NextRecordType       string
+	NextRecordIdentifier string
+}
+
+// Route53HostedZone represents a hosted zone from the Route 53 API
+type Route53HostedZone struct {
+	Id     string
+	Name   string
+	Config struct {
+		PrivateZone bool
+	}
+}
+
+// Route53ListHostedZonesByNameResponse represents a page of hosted zones, ordered by name
+type Route53ListHostedZonesByNameResponse struct {
+	HostedZones []Route53HostedZone `xml:"HostedZones>HostedZone"`
+}
+
+// route53ErrorResponse covers both the generic error response, and the response for rejected change batches
+type route53ErrorResponse struct {
+	XMLName xml.Name
+	Error   struct {
+		Code    string
+		Message string
+	}
+	Messages []string `xml:"Messages>Message"`
+}
+
+// makeAPIRequest is a helper function that makes signed HTTP requests to the Route 53 API
+// It handles common tasks like encoding the request body, and checking for API errors
+func (r *Route53Provider) makeAPIRequest(ctx context.Context, method, path string, query url.Values, body interface{}, result interface{}) error {
+	var bodyBytes []byte
+	if body != nil {
+		xmlData, err := xml.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		bodyBytes = append([]byte(xml.Header), xmlData...)
+	}
+
+	requestURL := fmt.Sprintf("%s/%s%s", r.endpoint, route53APIVersion, path)
+	if len(query) > 0 {
+		requestURL += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "text/xml")
+	}
+	r.signer.sign(req, bodyBytes)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	responseBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var errorResponse route53ErrorResponse
+		if err := xml.Unmarshal(responseBytes, &errorResponse); err != nil {
+			return fmt.Errorf("Route 53 API returned status %d: %s", resp.StatusCode, string(responseBytes))
+		}
+
+		apiErr := &Route53APIError{StatusCode: resp.StatusCode, Code: errorResponse.Error.Code, Message: errorResponse.Error.Message}
+		if errorResponse.XMLName.Local == "InvalidChangeBatch" {
+			apiErr.Code = errorResponse.XMLName.Local
+			apiErr.Message = strings.Join(errorResponse.Messages, "; ")
+		}
+		return apiErr
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	if err := xml.Unmarshal(responseBytes, result); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return nil
+}
+
+// NewRoute53Provider creates a new Route 53 DDNS provider. The endpoint replaces the public Route 53 API endpoint when
+// set. If the hosted zone ID is empty, the public hosted zone of the hostname is looked up. With the multivalue and
+// weighted routing policies, each IP address gets its own record set, which is associated with the health check of the
+// IP address in the health checks, if any.
+func NewRoute53Provider(endpoint, hostedZoneID, hostname string, timeout, recordTTL time.Duration, accessKeyID, secretAccessKey, routingPolicy string, healthChecks map[string]string, comment string) (*Route53Provider, error) {
+	if endpoint == "" {
+		endpoint = route53BaseURL
+	}
+
+	switch routingPolicy {
+	case "":
+		routingPolicy = Route53RoutingPolicySimple
+	case Route53RoutingPolicySimple, Route53RoutingPolicyMultivalue, Route53RoutingPolicyWeighted:
+	default:
+		return nil, fmt.Errorf("unsupported Route 53 routing policy: %s", routingPolicy)
+	}
+
+	if routingPolicy == Route53RoutingPolicySimple && len(healthChecks) > 0 {
+		return nil, fmt.Errorf("health checks are not supported with the %s routing policy", routingPolicy)
+	}
+
+	r := &Route53Provider{
+		endpoint:      strings.TrimSuffix(endpoint, "/"),
+		hostname:      strings.ToLower(strings.TrimSuffix(hostname, ".")) + ".",
+		recordTTL:     recordTTL,
+		routingPolicy: routingPolicy,
+		healthChecks:  healthChecks,
+		comment:       comment,
+		signer:        newSigV4Signer(accessKeyID, secretAccessKey, route53SigningRegion, "route53"),
+		client: &http.Client{
+			Timeout: timeout,
+		},
+		pollInterval: route53ChangePollInterval,
+	}
+
+	if hostedZoneID != "" {
+		r.hostedZoneID = strings.TrimPrefix(hostedZoneID, "/hostedzone/")
+		r.initialized.Store(true)
+	}
+
+	return r, nil
+}
+
+// Name returns the provider name
+func (r *Route53Provider) Name() string {
+	return "Route53"
+}
+
+// initializeZoneInfo looks up the public hosted zone that contains the hostname. The hostname and its parent domains
+// are tried in order, so that the most specific zone is used.
+func (r *Route53Provider) initializeZoneInfo(ctx context.Context) error {
+	logger := slog.With("provider", r.Name(), "hostname", r.hostname)
+
+	labels := strings.Split(strings.TrimSuffix(r.hostname, "."), ".")
+	for i := 0; i < len(labels)-1; i++ {
+		zoneName := strings.Join(labels[i:], ".") + "."
+
+		logger.DebugContext(ctx, "Looking up Route 53 hosted zone", "zone", zoneName)
+
+		// Zones are listed in order of their names, starting with the zone name
+		var response Route53ListHostedZonesByNameResponse
+		query := url.Values{"dnsname": {zoneName}, "maxitems": {"10"}}
+		if err := r.makeAPIRequest(ctx, "GET", "/hostedzonesbyname", query, nil, &response); err != nil {
+			return err
+		}
+
+		for _, zone := range response.HostedZones {
+			if !strings.EqualFold(zone.Name, zoneName) || zone.Config.PrivateZone {
+				continue
+			}
+
+			r.hostedZoneID = strings.TrimPrefix(zone.Id, "/hostedzone/")
+			logger.InfoContext(ctx, "Initialized Route 53 zone info", "hostedZoneID", r.hostedZoneID, "zone", zone.Name)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("no public Route 53 hosted zone found for hostname %s", r.hostname)
+}
+
+// UpdateRecords updates the DNS records with the provided IP addresses. All changes are sent in a single change batch,
+// and the update completes once the change has reached all Route 53 name servers.
+func (r *Route53Provider) UpdateRecords(ctx context.Context, newPublicIPs []string) error {
+	logger := slog.With("provider", r.Name(), "hostname", r.hostname, "ips", newPublicIPs)
+
+	// This cannot be done at provider creation time because it requires network access, which may not be available then
+	if !r.initialized.Load() {
+		logger.Info("Initializing Route 53 zone info")
+
+		if err := r.initializeZoneInfo(ctx); err != nil {
+			return fmt.Errorf("failed to initialize zone info: %w", err)
+		}
+		r.initialized.Store(true)
+	}
+
+	existingSets, err := r.getExistingRecordSets(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get existing record sets: %w", err)
+	}
+
+	changes := r.calculateChanges(existingSets, r.desiredRecordSets(newPublicIPs))
+	if len(changes) == 0 {
+		logger.InfoContext(ctx, "DNS records are already up to date")
+		return nil
+	}
+
+	logger.InfoContext(ctx, "Calculated DNS record changes", "changes", len(changes))
+
+	request := Route53ChangeResourceRecordSetsRequest{
+		ChangeBatch: Route53ChangeBatch{
+			Comment: r.comment,
+			Changes: changes,
+		},
+	}
+
+	var response Route53ChangeInfoResponse
+	if err := r.makeAPIRequest(ctx, "POST", fmt.Sprintf("/hostedzone/%s/rrset", r.hostedZoneID), nil, request, &response); err != nil {
+		return fmt.Errorf("failed to change record sets: %w", err)
+	}
+
+	logger.DebugContext(ctx, "Submitted change batch", "changeID", response.ChangeInfo.Id)
+
+	if err := r.waitForChange(ctx, response.ChangeInfo); err != nil {
+		return fmt.Errorf("DNS record update failed: %w", err)
+	}
+
+	logger.InfoContext(ctx, "Successfully updated DNS records")
+	return nil
+}
+
+// getExistingRecordSets retrieves the existing A and AAAA record sets of the hostname, from all result pages
+func (r *Route53Provider) getExistingRecordSets(ctx context.Context) ([]Route53ResourceRecordSet, error) {
+	path := fmt.Sprintf("/hostedzone/%s/rrset", r.hostedZoneID)
+
+	// Record sets are listed in order of their names and types, starting with the given name and type
+	query := url.Values{
+		"name":     {r.hostname},
+		"type":     {"A"},
+		"maxitems": {fmt.Sprint(route53MaxItems)},
+	}
+
+	var recordSets []Route53ResourceRecordSet
+	for {
+		var response Route53ListResourceRecordSetsResponse
+		if err := r.makeAPIRequest(ctx, "GET", path, query, nil, &response); err != nil {
+			return nil, err
+		}
+
+		for _, recordSet := range response.ResourceRecordSets {
+			if !strings.EqualFold(recordSet.Name, r.hostname) || (recordSet.Type != "A" && recordSet.Type != "AAAA") {
+				continue
+			}
+
+			recordSets = append(recordSets, recordSet)
+		}
+
+		if !response.IsTruncated || !strings.EqualFold(response.NextRecordName, r.hostname) {
+			return recordSets, nil
+		}
+
+		query.Set("name", response.NextRecordName)
+		query.Set("type", response.NextRecordType)
+		query.Del("identifier")
+		if response.NextRecordIdentifier != "" {
+			query.Set("identifier", response.NextRecordIdentifier)
+		}
+	}
+}
+
+// desiredRecordSets returns the record sets that publish the IP addresses with the configured routing policy
+func (r *Route53Provider) desiredRecordSets(ips []string) []Route53ResourceRecordSet {
+	ttl := int64(r.recordTTL.Seconds())
+
+	if r.routingPolicy == Route53RoutingPolicySimple {
+		recordsByType := make(map[string][]Route53ResourceRecord)
+		for _, ip := range ips {
+			rrType := recordType(ip)
+			recordsByType[rrType] = append(recordsByType[rrType], Route53ResourceRecord{Value: ip})
+		}
+
+		var recordSets []Route53ResourceRecordSet
+		for _, rrType := range []string{"A", "AAAA"} {
+			if records, ok := recordsByType[rrType]; ok {
+				recordSets = append(recordSets, Route53ResourceRecordSet{Name: r.hostname, Type: rrType, TTL: ttl, ResourceRecords: records})
+			}
+		}
+		return recordSets
+	}
+
+	recordSets := make([]Route53ResourceRecordSet, 0, len(ips))
+	for _, ip := range ips {
+		recordSet := Route53ResourceRecordSet{
+			Name:            r.hostname,
+			Type:            recordType(ip),
+			SetIdentifier:   ip,
+			TTL:             ttl,
+			ResourceRecords: []Route53ResourceRecord{{Value: ip}},
+			HealthCheckId:   r.healthChecks[ip],
+		}
+
+		if r.routingPolicy == Route53RoutingPolicyWeighted {
+			weight := int64(route53Weight)
+			recordSet.Weight = &weight
+		} else {
+			multiValueAnswer := true
+			recordSet.MultiValueAnswer = &multiValueAnswer
+		}
+
+		recordSets = append(recordSets, recordSet)
+	}
+	return recordSets
+}
+
+// calculateChanges returns the changes that replace the existing record sets with the desired record sets. Record sets
+// that are already up to date are left alone. Record sets that use another routing policy are deleted and recreated,
+// because the routing policy of a record set cannot be changed.
+func (r *Route53Provider) calculateChanges(existingSets, desiredSets []Route53ResourceRecordSet) []Route53Change {
+	recordSetKey := func(recordSet Route53ResourceRecordSet) string {
+		return recordSet.Type + "/" + recordSet.SetIdentifier
+	}
+
+	existingByKey := make(map[string]Route53ResourceRecordSet, len(existingSets))
+	for _, recordSet := range existingSets {
+		existingByKey[recordSetKey(recordSet)] = recordSet
+	}
+
+	desiredKeys := make(map[string]bool, len(desiredSets))
+	for _, recordSet := range desiredSets {
+		desiredKeys[recordSetKey(recordSet)] = true
+	}
+
+	var changes []Route53Change
+	for _, recordSet := range existingSets {
+		if !desiredKeys[recordSetKey(recordSet)] {
+			changes = append(changes, Route53Change{Action: "DELETE", ResourceRecordSet: recordSet})
+		}
+	}
+
+	for _, recordSet := range desiredSets {
+		existing, exists := existingByKey[recordSetKey(recordSet)]
+		if exists && recordSetsEqual(existing, recordSet) {
+			continue
+		}
+
+		if exists && routingPolicy(existing) != routingPolicy(recordSet) {
+			changes = append(changes, Route53Change{Action: "DELETE", ResourceRecordSet: existing})
+		}
+
+		changes = append(changes, Route53Change{Action: "UPSERT", ResourceRecordSet: recordSet})
+	}
+
+	return changes
+}
+
+// routingPolicy returns the routing policy of a record set
+func routingPolicy(recordSet Route53ResourceRecordSet) string {
+	switch {
+	case recordSet.Weight != nil:
+		return Route53RoutingPolicyWeighted
+	case recordSet.MultiValueAnswer != nil:
+		return Route53RoutingPolicyMultivalue
+	case recordSet.Region != "":
+		return "latency"
+	case recordSet.Failover != "":
+		return "failover"
+	default:
+		return Route53RoutingPolicySimple
+	}
+}
+
+// recordSetsEqual returns whether two record sets have the same settings and values, in any order
+func recordSetsEqual(a, b Route53ResourceRecordSet) bool {
+	values := func(recordSet Route53ResourceRecordSet) []string {
+		values := make([]string, 0, len(recordSet.ResourceRecords))
+		for _, record := range recordSet.ResourceRecords {
+			values = append(values, record.Value)
+		}
+		slices.Sort(values)
+		return values
+	}
+
+	return routingPolicy(a) == routingPolicy(b) &&
+		(a.Weight == nil || *a.Weight == *b.Weight) &&
+		a.AliasTarget == nil && b.AliasTarget == nil &&
+		a.TTL == b.TTL &&
+		a.HealthCheckId == b.HealthCheckId &&
+		slices.Equal(values(a), values(b))
+}
+
+// waitForChange waits until the change has reached INSYNC, which means that it has been applied on all Route 53 name
+// servers
+func (r *Route53Provider) waitForChange(ctx context.Context, changeInfo Route53ChangeInfo) error {
+	changeID := strings.TrimPrefix(changeInfo.Id, "/change/")
+
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for changeInfo.Status != "INSYNC" {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("change %s did not reach INSYNC (status %s): %w", changeID, changeInfo.Status, ctx.Err())
+		case <-ticker.C:
+		}
+
+		var response Route53ChangeInfoResponse
+		if err := r.makeAPIRequest(ctx, "GET", "/change/"+changeID, nil, nil, &response); err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("change %s did not reach INSYNC (status %s): %w", changeID, changeInfo.Status, ctx.Err())
+			}
+			return fmt.Errorf("failed to get status of change %s: %w", changeID, err)
+		}
+		changeInfo = response.ChangeInfo
+
+		slog.DebugContext(ctx, "Checked status of change batch", "provider", r.Name(), "changeID", changeID, "status", changeInfo.Status)
+	}
+
+	return nil
+}
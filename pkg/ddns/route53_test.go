@@ -0,0 +1,441 @@
+package ddns
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testRoute53AccessKeyID     = "AKIDEXAMPLE"
+	testRoute53SecretAccessKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+)
+
+// fakeRoute53 is a minimal Route 53 API that serves record set pages, records submitted change batches, and reports
+// changes as INSYNC after a number of status checks
+type fakeRoute53 struct {
+	t *testing.T
+
+	mu              sync.Mutex
+	hostedZones     []Route53HostedZone
+	recordSetPages  []Route53ListResourceRecordSetsResponse
+	pendingChecks   int // Number of GetChange requests that report the change as PENDING
+	zoneLookups     []string
+	recordSetQuery  []string
+	changeBatches   []Route53ChangeBatch
+	getChangeChecks int
+	errorStatus     int
+	errorBody       string
+}
+
+// newFakeRoute53 starts the fake API, and returns it with its endpoint URL
+func newFakeRoute53(t *testing.T) (*fakeRoute53, string) {
+	fake := &fakeRoute53{t: t}
+
+	server := httptest.NewServer(http.HandlerFunc(fake.handle))
+	t.Cleanup(server.Close)
+
+	return fake, server.URL
+}
+
+func (f *fakeRoute53) handle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	body, err := io.ReadAll(r.Body)
+	require.NoError(f.t, err)
+	verifyRoute53Signature(f.t, r, body)
+
+	if f.errorStatus != 0 {
+		w.WriteHeader(f.errorStatus)
+		io.WriteString(w, f.errorBody)
+		return
+	}
+
+	writeXML := func(v interface{}) {
+		w.Header().Set("Content-Type", "text/xml")
+		require.NoError(f.t, xml.NewEncoder(w).Encode(v))
+	}
+
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/2013-04-01/hostedzonesbyname":
+		f.zoneLookups = append(f.zoneLookups, r.URL.Query().Get("dnsname"))
+		writeXML(Route53ListHostedZonesByNameResponse{HostedZones: f.hostedZones})
+
+	case r.Method == "GET" && r.URL.Path == "/2013-04-01/hostedzone/Z123/rrset":
+		f.recordSetQuery = append(f.recordSetQuery, r.URL.RawQuery)
+
+		page := Route53ListResourceRecordSetsResponse{}
+		if len(f.recordSetPages) > 0 {
+			page = f.recordSetPages[0]
+			f.recordSetPages = f.recordSetPages[1:]
+		}
+		writeXML(page)
+
+	case r.Method == "POST" && r.URL.Path == "/2013-04-01/hostedzone/Z123/rrset":
+		assert.Equal(f.t, "text/xml", r.Header.Get("Content-Type"))
+
+		var request Route53ChangeResourceRecordSetsRequest
+		require.NoError(f.t, xml.Unmarshal(body, &request))
+		assert.Equal(f.t, "https://route53.amazonaws.com/doc/2013-04-01/", request.XMLName.Space)
+		f.changeBatches = append(f.changeBatches, request.ChangeBatch)
+
+		status := "INSYNC"
+		if f.pendingChecks > 0 {
+			status = "PENDING"
+		}
+		writeXML(Route53ChangeInfoResponse{ChangeInfo: Route53ChangeInfo{Id: "/change/C1", Status: status}})
+
+	case r.Method == "GET" && r.URL.Path == "/2013-04-01/change/C1":
+		f.getChangeChecks++
+
+		status := "INSYNC"
+		if f.getChangeChecks < f.pendingChecks {
+			status = "PENDING"
+		}
+		writeXML(Route53ChangeInfoResponse{ChangeInfo: Route53ChangeInfo{Id: "/change/C1", Status: status}})
+
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// verifyRoute53Signature checks that the request is signed with the test credentials, for the headers and body that
+// were received
+func verifyRoute53Signature(t *testing.T, r *http.Request, body []byte) {
+	authorization := r.Header.Get("Authorization")
+	require.True(t, strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/"), "unexpected authorization %q", authorization)
+	assert.Contains(t, authorization, "/us-east-1/route53/aws4_request")
+
+	signingTime, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	require.NoError(t, err)
+
+	_, signedHeaders, ok := strings.Cut(authorization, "SignedHeaders=")
+	require.True(t, ok)
+	signedHeaders, _, _ = strings.Cut(signedHeaders, ",")
+
+	// Rebuild the request as it was before signing
+	signed := r.Clone(context.Background())
+	signed.Header = http.Header{}
+	for _, name := range strings.Split(signedHeaders, ";") {
+		if name != "host" && name != "x-amz-date" {
+			signed.Header[http.CanonicalHeaderKey(name)] = r.Header.Values(name)
+		}
+	}
+
+	signer := newSigV4Signer(testRoute53AccessKeyID, testRoute53SecretAccessKey, "us-east-1", "route53")
+	signer.now = func() time.Time { return signingTime }
+	signer.sign(signed, body)
+
+	assert.Equal(t, signed.Header.Get("Authorization"), authorization)
+}
+
+// newTestRoute53Provider creates a provider for the fake API, which polls the change status without delay
+func newTestRoute53Provider(t *testing.T, endpoint, hostedZoneID, routingPolicy string, healthChecks map[string]string) *Route53Provider {
+	provider, err := NewRoute53Provider(endpoint, hostedZoneID, "gateways.example.com", 10*time.Second, 2*time.Minute, testRoute53AccessKeyID, testRoute53SecretAccessKey, routingPolicy, healthChecks, "gateways")
+	require.NoError(t, err)
+	provider.pollInterval = time.Millisecond
+
+	return provider
+}
+
+func int64Ptr(v int64) *int64 { return &v }
+
+func boolPtr(v bool) *bool { return &v }
+
+// TestRoute53Provider_UpdateRecords tests that the records are replaced in a single change batch, and that the update
+// waits for the change to reach INSYNC
+func TestRoute53Provider_UpdateRecords(t *testing.T) {
+	fake, endpoint := newFakeRoute53(t)
+	fake.hostedZones = []Route53HostedZone{
+		{Id: "/hostedzone/ZPRIVATE", Name: "example.com.", Config: struct{ PrivateZone bool }{PrivateZone: true}},
+		{Id: "/hostedzone/Z123", Name: "example.com."},
+	}
+	fake.recordSetPages = []Route53ListResourceRecordSetsResponse{{
+		ResourceRecordSets: []Route53ResourceRecordSet{
+			{Name: "gateways.example.com.", Type: "A", TTL: 60, ResourceRecords: []Route53ResourceRecord{{Value: "1.2.3.4"}, {Value: "5.6.7.8"}}},
+			{Name: "gateways.example.com.", Type: "AAAA", TTL: 60, ResourceRecords: []Route53ResourceRecord{{Value: "2001:db8::1"}}},
+			{Name: "gateways.example.com.", Type: "TXT", TTL: 60, ResourceRecords: []Route53ResourceRecord{{Value: `"9.9.9.9"`}}},
+			{Name: "other.example.com.", Type: "A", TTL: 60, ResourceRecords: []Route53ResourceRecord{{Value: "9.9.9.9"}}},
+		},
+	}}
+	fake.pendingChecks = 2
+
+	provider := newTestRoute53Provider(t, endpoint, "", "", nil)
+
+	err := provider.UpdateRecords(t.Context(), []string{"5.6.7.8", "9.9.9.9"})
+	require.NoError(t, err, "UpdateRecords failed")
+
+	// The hostname is tried before its parent domains, and private zones are skipped
+	assert.Equal(t, []string{"gateways.example.com.", "example.com."}, fake.zoneLookups)
+	assert.Equal(t, []string{"maxitems=300&name=gateways.example.com.&type=A"}, fake.recordSetQuery)
+
+	require.Len(t, fake.changeBatches, 1)
+	assert.Equal(t, Route53ChangeBatch{
+		Comment: "gateways",
+		Changes: []Route53Change{
+			{Action: "DELETE", ResourceRecordSet: Route53ResourceRecordSet{Name: "gateways.example.com.", Type: "AAAA", TTL: 60, ResourceRecords: []Route53ResourceRecord{{Value: "2001:db8::1"}}}},
+			{Action: "UPSERT", ResourceRecordSet: Route53ResourceRecordSet{Name: "gateways.example.com.", Type: "A", TTL: 120, ResourceRecords: []Route53ResourceRecord{{Value: "5.6.7.8"}, {Value: "9.9.9.9"}}}},
+		},
+	}, fake.changeBatches[0])
+
+	// The change status is checked until it is INSYNC
+	assert.Equal(t, 2, fake.getChangeChecks)
+
+	// The zone is only looked up once
+	fake.zoneLookups = nil
+	require.NoError(t, provider.UpdateRecords(t.Context(), []string{"5.6.7.8", "9.9.9.9"}))
+	assert.Empty(t, fake.zoneLookups)
+}
+
+// TestRoute53Provider_UpdateRecords_Unchanged tests that no change batch is sent when the records are up to date
+func TestRoute53Provider_UpdateRecords_Unchanged(t *testing.T) {
+	fake, endpoint := newFakeRoute53(t)
+	fake.recordSetPages = []Route53ListResourceRecordSetsResponse{{
+		ResourceRecordSets: []Route53ResourceRecordSet{
+			{Name: "Gateways.Example.com.", Type: "A", TTL: 120, ResourceRecords: []Route53ResourceRecord{{Value: "5.6.7.8"}, {Value: "1.2.3.4"}}},
+		},
+	}}
+
+	provider := newTestRoute53Provider(t, endpoint, "/hostedzone/Z123", "simple", nil)
+
+	err := provider.UpdateRecords(t.Context(), []string{"1.2.3.4", "5.6.7.8"})
+	require.NoError(t, err, "UpdateRecords failed")
+
+	assert.Empty(t, fake.zoneLookups)
+	assert.Empty(t, fake.changeBatches)
+}
+
+// TestRoute53Provider_UpdateRecords_RoutingPolicies tests that each IP address gets its own record set, with its
+// health check, for the multivalue and weighted routing policies
+func TestRoute53Provider_UpdateRecords_RoutingPolicies(t *testing.T) {
+	tests := []struct {
+		name            string
+		routingPolicy   string
+		existingSets    []Route53ResourceRecordSet
+		expectedChanges []Route53Change
+	}{
+		{
+			name:          "multivalue",
+			routingPolicy: "multivalue",
+			existingSets: []Route53ResourceRecordSet{
+				{Name: "gateways.example.com.", Type: "A", TTL: 120, ResourceRecords: []Route53ResourceRecord{{Value: "1.2.3.4"}}},
+				{Name: "gateways.example.com.", Type: "A", SetIdentifier: "5.6.7.8", MultiValueAnswer: boolPtr(true), TTL: 120, ResourceRecords: []Route53ResourceRecord{{Value: "5.6.7.8"}}, HealthCheckId: "hc-2"},
+			},
+			expectedChanges: []Route53Change{
+				{Action: "DELETE", ResourceRecordSet: Route53ResourceRecordSet{Name: "gateways.example.com.", Type: "A", TTL: 120, ResourceRecords: []Route53ResourceRecord{{Value: "1.2.3.4"}}}},
+				{Action: "UPSERT", ResourceRecordSet: Route53ResourceRecordSet{Name: "gateways.example.com.", Type: "A", SetIdentifier: "1.2.3.4", MultiValueAnswer: boolPtr(true), TTL: 120, ResourceRecords: []Route53ResourceRecord{{Value: "1.2.3.4"}}, HealthCheckId: "hc-1"}},
+				{Action: "UPSERT", ResourceRecordSet: Route53ResourceRecordSet{Name: "gateways.example.com.", Type: "AAAA", SetIdentifier: "2001:db8::1", MultiValueAnswer: boolPtr(true), TTL: 120, ResourceRecords: []Route53ResourceRecord{{Value: "2001:db8::1"}}}},
+			},
+		},
+		{
+			name:          "weighted",
+			routingPolicy: "weighted",
+			existingSets: []Route53ResourceRecordSet{
+				{Name: "gateways.example.com.", Type: "A", SetIdentifier: "1.2.3.4", MultiValueAnswer: boolPtr(true), TTL: 120, ResourceRecords: []Route53ResourceRecord{{Value: "1.2.3.4"}}, HealthCheckId: "hc-1"},
+				{Name: "gateways.example.com.", Type: "A", SetIdentifier: "5.6.7.8", Weight: int64Ptr(1), TTL: 120, ResourceRecords: []Route53ResourceRecord{{Value: "5.6.7.8"}}, HealthCheckId: "hc-2"},
+				{Name: "gateways.example.com.", Type: "A", SetIdentifier: "manual", Weight: int64Ptr(10), TTL: 60, ResourceRecords: []Route53ResourceRecord{{Value: "9.9.9.9"}}},
+			},
+			expectedChanges: []Route53Change{
+				{Action: "DELETE", ResourceRecordSet: Route53ResourceRecordSet{Name: "gateways.example.com.", Type: "A", SetIdentifier: "manual", Weight: int64Ptr(10), TTL: 60, ResourceRecords: []Route53ResourceRecord{{Value: "9.9.9.9"}}}},
+				// The routing policy of a record set cannot be changed, so it is recreated
+				{Action: "DELETE", ResourceRecordSet: Route53ResourceRecordSet{Name: "gateways.example.com.", Type: "A", SetIdentifier: "1.2.3.4", MultiValueAnswer: boolPtr(true), TTL: 120, ResourceRecords: []Route53ResourceRecord{{Value: "1.2.3.4"}}, HealthCheckId: "hc-1"}},
+				{Action: "UPSERT", ResourceRecordSet: Route53ResourceRecordSet{Name: "gateways.example.com.", Type: "A", SetIdentifier: "1.2.3.4", Weight: int64Ptr(1), TTL: 120, ResourceRecords: []Route53ResourceRecord{{Value: "1.2.3.4"}}, HealthCheckId: "hc-1"}},
+				{Action: "UPSERT", ResourceRecordSet: Route53ResourceRecordSet{Name: "gateways.example.com.", Type: "AAAA", SetIdentifier: "2001:db8::1", Weight: int64Ptr(1), TTL: 120, ResourceRecords: []Route53ResourceRecord{{Value: "2001:db8::1"}}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, endpoint := newFakeRoute53(t)
+			fake.recordSetPages = []Route53ListResourceRecordSetsResponse{{ResourceRecordSets: tt.existingSets}}
+
+			healthChecks := map[string]string{"1.2.3.4": "hc-1", "5.6.7.8": "hc-2"}
+			provider := newTestRoute53Provider(t, endpoint, "Z123", tt.routingPolicy, healthChecks)
+
+			err := provider.UpdateRecords(t.Context(), []string{"1.2.3.4", "5.6.7.8", "2001:db8::1"})
+			require.NoError(t, err, "UpdateRecords failed")
+
+			require.Len(t, fake.changeBatches, 1)
+			assert.Equal(t, tt.expectedChanges, fake.changeBatches[0].Changes)
+		})
+	}
+}
+
+// TestRoute53Provider_UpdateRecords_Pagination tests that record sets on all result pages are managed
+func TestRoute53Provider_UpdateRecords_Pagination(t *testing.T) {
+	fake, endpoint := newFakeRoute53(t)
+	fake.recordSetPages = []Route53ListResourceRecordSetsResponse{
+		{
+			ResourceRecordSets: []Route53ResourceRecordSet{
+				{Name: "gateways.example.com.", Type: "A", SetIdentifier: "1.2.3.4", MultiValueAnswer: boolPtr(true), TTL: 120, ResourceRecords: []Route53ResourceRecord{{Value: "1.2.3.4"}}},
+			},
+			IsTruncated:          true,
+			NextRecordName:       "gateways.example.com.",
+			NextRecordType:       "A",
+			NextRecordIdentifier: "5.6.7.8",
+		},
+		{
+			ResourceRecordSets: []Route53ResourceRecordSet{
+				{Name: "gateways.example.com.", Type: "A", SetIdentifier: "5.6.7.8", MultiValueAnswer: boolPtr(true), TTL: 120, ResourceRecords: []Route53ResourceRecord{{Value: "5.6.7.8"}}},
+			},
+			// The next page is for another name
+			IsTruncated:    true,
+			NextRecordName: "other.example.com.",
+			NextRecordType: "A",
+		},
+	}
+
+	provider := newTestRoute53Provider(t, endpoint, "Z123", "multivalue", nil)
+
+	err := provider.UpdateRecords(t.Context(), []string{})
+	require.NoError(t, err, "UpdateRecords failed")
+
+	assert.Equal(t, []string{
+		"maxitems=300&name=gateways.example.com.&type=A",
+		"identifier=5.6.7.8&maxitems=300&name=gateways.example.com.&type=A",
+	}, fake.recordSetQuery)
+
+	require.Len(t, fake.changeBatches, 1)
+	require.Len(t, fake.changeBatches[0].Changes, 2)
+	for _, change := range fake.changeBatches[0].Changes {
+		assert.Equal(t, "DELETE", change.Action)
+	}
+}
+
+// TestRoute53Provider_UpdateRecords_Errors tests that zone lookup, API and synchronization errors are reported
+func TestRoute53Provider_UpdateRecords_Errors(t *testing.T) {
+	tests := []struct {
+		name          string
+		hostedZoneID  string
+		setup         func(fake *fakeRoute53)
+		timeout       time.Duration
+		expectedError string
+	}{
+		{
+			name: "zone not found",
+			setup: func(fake *fakeRoute53) {
+				fake.hostedZones = []Route53HostedZone{{Id: "/hostedzone/Z999", Name: "example.net."}}
+			},
+			expectedError: "no public Route 53 hosted zone found for hostname gateways.example.com.",
+		},
+		{
+			name:         "API error",
+			hostedZoneID: "Z123",
+			setup: func(fake *fakeRoute53) {
+				fake.errorStatus = http.StatusForbidden
+				fake.errorBody = `<ErrorResponse xmlns="https://route53.amazonaws.com/doc/2013-04-01/"><Error><Type>Sender</Type><Code>AccessDenied</Code><Message>Not authorized</Message></Error><RequestId>1</RequestId></ErrorResponse>`
+			},
+			expectedError: "Route 53 API error: AccessDenied: Not authorized (403)",
+		},
+		{
+			name:         "invalid change batch",
+			hostedZoneID: "Z123",
+			setup: func(fake *fakeRoute53) {
+				fake.errorStatus = http.StatusBadRequest
+				fake.errorBody = `<InvalidChangeBatch xmlns="https://route53.amazonaws.com/doc/2013-04-01/"><Messages><Message>First problem</Message><Message>Second problem</Message></Messages><RequestId>1</RequestId></InvalidChangeBatch>`
+			},
+			expectedError: "Route 53 API error: InvalidChangeBatch: First problem; Second problem (400)",
+		},
+		{
+			name:         "non-XML error",
+			hostedZoneID: "Z123",
+			setup: func(fake *fakeRoute53) {
+				fake.errorStatus = http.StatusBadGateway
+				fake.errorBody = "Bad gateway"
+			},
+			expectedError: "Route 53 API returned status 502: Bad gateway",
+		},
+		{
+			name:         "change not in sync",
+			hostedZoneID: "Z123",
+			setup: func(fake *fakeRoute53) {
+				fake.pendingChecks = 1000000
+			},
+			timeout:       50 * time.Millisecond,
+			expectedError: "change C1 did not reach INSYNC (status PENDING): context deadline exceeded",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, endpoint := newFakeRoute53(t)
+			tt.setup(fake)
+
+			ctx := t.Context()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			provider := newTestRoute53Provider(t, endpoint, tt.hostedZoneID, "simple", nil)
+
+			err := provider.UpdateRecords(ctx, []string{"1.2.3.4"})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.expectedError)
+		})
+	}
+}
+
+func TestNewRoute53Provider(t *testing.T) {
+	tests := []struct {
+		name          string
+		endpoint      string
+		routingPolicy string
+		healthChecks  map[string]string
+		expectedError string
+	}{
+		{
+			name: "defaults",
+		},
+		{
+			name:          "weighted with health checks",
+			endpoint:      "http://localhost:4566/",
+			routingPolicy: "weighted",
+			healthChecks:  map[string]string{"1.2.3.4": "hc-1"},
+		},
+		{
+			name:          "unsupported routing policy",
+			routingPolicy: "latency",
+			expectedError: "unsupported Route 53 routing policy: latency",
+		},
+		{
+			name:          "health checks with simple routing policy",
+			routingPolicy: "simple",
+			healthChecks:  map[string]string{"1.2.3.4": "hc-1"},
+			expectedError: "health checks are not supported with the simple routing policy",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, err := NewRoute53Provider(tt.endpoint, "", "gateways.example.com", time.Minute, time.Minute, testRoute53AccessKeyID, testRoute53SecretAccessKey, tt.routingPolicy, tt.healthChecks, "")
+
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, "Route53", provider.Name())
+
+			expectedEndpoint := route53BaseURL
+			if tt.endpoint != "" {
+				expectedEndpoint = strings.TrimSuffix(tt.endpoint, "/")
+			}
+			assert.Equal(t, expectedEndpoint, provider.endpoint, fmt.Sprintf("endpoint %q", tt.endpoint))
+		})
+	}
+}
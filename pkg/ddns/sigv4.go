@@ -0,0 +1,149 @@
+package ddns
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// sigV4Algorithm is the name of the AWS Signature Version 4 signing algorithm
+const sigV4Algorithm = "AWS4-HMAC-SHA256"
+
+// sigV4Signer signs HTTP requests to AWS APIs with Signature Version 4
+type sigV4Signer struct {
+	accessKeyID     string
+	secretAccessKey string
+	region          string
+	service         string
+
+	now func() time.Time // Replaceable for testing
+}
+
+// newSigV4Signer creates a signer for requests to the service in the region
+func newSigV4Signer(accessKeyID, secretAccessKey, region, service string) *sigV4Signer {
+	return &sigV4Signer{
+		accessKeyID:     accessKeyID,
+		secretAccessKey: secretAccessKey,
+		region:          region,
+		service:         service,
+		now:             time.Now,
+	}
+}
+
+// sign adds the date and authorization headers to the request. The body is the request payload, which has to be
+// passed separately because it cannot be read from the request without consuming it. All headers that are set on the
+// request at this point are signed, so headers must not be changed afterwards.
+func (s *sigV4Signer) sign(req *http.Request, body []byte) {
+	signingTime := s.now().UTC()
+	date := signingTime.Format("20060102")
+	req.Header.Set("X-Amz-Date", signingTime.Format("20060102T150405Z"))
+
+	canonicalRequest, signedHeaders := s.canonicalRequest(req, body)
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, s.region, s.service)
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		req.Header.Get("X-Amz-Date"),
+		scope,
+		hashHex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signature := hex.EncodeToString(hmacSHA256(s.signingKey(date), []byte(stringToSign)))
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s", sigV4Algorithm, s.accessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalRequest builds the canonical form of the request, and returns it with the list of signed headers
+func (s *sigV4Signer) canonicalRequest(req *http.Request, body []byte) (string, string) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		trimmed := make([]string, 0, len(values))
+		for _, value := range values {
+			trimmed = append(trimmed, strings.Join(strings.Fields(value), " "))
+		}
+		headers[strings.ToLower(name)] = strings.Join(trimmed, ",")
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	signedHeaders := strings.Join(names, ";")
+	return strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hashHex(body),
+	}, "\n"), signedHeaders
+}
+
+// signingKey derives the key that requests on the date are signed with
+func (s *sigV4Signer) signingKey(date string) []byte {
+	key := hmacSHA256([]byte("AWS4"+s.secretAccessKey), []byte(date))
+	key = hmacSHA256(key, []byte(s.region))
+	key = hmacSHA256(key, []byte(s.service))
+	return hmacSHA256(key, []byte("aws4_request"))
+}
+
+// canonicalQuery encodes the query parameters sorted by name and value, with spaces encoded as %20
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a, b string) int { return strings.Compare(sigV4Escape(a), sigV4Escape(b)) })
+
+	var params []string
+	for _, name := range names {
+		values := make([]string, 0, len(query[name]))
+		for _, value := range query[name] {
+			values = append(values, sigV4Escape(value))
+		}
+		slices.Sort(values)
+
+		for _, value := range values {
+			params = append(params, sigV4Escape(name)+"="+value)
+		}
+	}
+
+	return strings.Join(params, "&")
+}
+
+// sigV4Escape percent-encodes everything except the unreserved characters of RFC 3986
+func sigV4Escape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,37 @@
+package ddns
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSigV4Signer_Sign tests the signer against the example request from the AWS Signature Version 4 documentation
+func TestSigV4Signer_Sign(t *testing.T) {
+	signer := newSigV4Signer("AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "us-east-1", "iam")
+	signer.now = func() time.Time { return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC) }
+
+	req, err := http.NewRequest("GET", "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	signer.sign(req, nil)
+
+	assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7", req.Header.Get("Authorization"))
+}
+
+func TestCanonicalQuery(t *testing.T) {
+	query := url.Values{
+		"name":  {"b value", "a~value"},
+		"a-":    {"1"},
+		"a":     {"2"},
+		"empty": {""},
+	}
+
+	assert.Equal(t, "a=2&a-=1&empty=&name=a~value&name=b%20value", canonicalQuery(query))
+}
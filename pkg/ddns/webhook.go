@@ -0,0 +1,309 @@
+package ddns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/config"
+	"golang.org/x/sync/errgroup"
+)
+
+// Actions of webhook requests
+const (
+	// WebhookActionUpdate publishes the IP addresses
+	WebhookActionUpdate = "update"
+	// WebhookActionDelete removes an IP address that is no longer active. Only used in per-IP mode.
+	WebhookActionDelete = "delete"
+)
+
+// webhookTemplateFuncs are the functions that are available to the webhook templates, in addition to the built-in
+// template functions
+var webhookTemplateFuncs = template.FuncMap{
+	"join": func(sep string, values []string) string { return strings.Join(values, sep) },
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// WebhookTemplateData is passed to the webhook templates
+type WebhookTemplateData struct {
+	Hostname    string
+	IPs         []string // All public IP addresses
+	IPv4        []string // Public IPv4 addresses
+	IPv6        []string // Public IPv6 addresses
+	PreviousIPs []string // Public IP addresses of the last successful update. Empty until the first update succeeds.
+	TTL         int      // Record TTL in seconds
+	Action      string   // Either update or delete
+	IP          string   // IP address of the request in per-IP mode
+	Type        string   // Record type (A or AAAA) of the IP address in per-IP mode
+	Username    string
+	Password    string
+}
+
+// WebhookResponseError is returned when a webhook response does not meet the success criterion
+type WebhookResponseError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *WebhookResponseError) Error() string {
+	return fmt.Sprintf("webhook returned unsuccessful response (status %d): %s", e.StatusCode, e.Body)
+}
+
+// WebhookProvider implements the DDNS Provider interface with HTTP requests that are built from templates, for DNS
+// hosts without a dedicated provider
+type WebhookProvider struct {
+	hostname        string
+	recordTTL       time.Duration
+	username        string
+	password        string
+	method          *template.Template
+	url             *template.Template
+	headers         map[string][]*template.Template
+	body            *template.Template // Nil when requests have no body
+	successStatuses []config.StatusRange
+	successRegex    *regexp.Regexp // Nil when the response body is not checked
+	perIP           bool
+	client          *http.Client
+
+	mu          sync.Mutex
+	previousIPs []string
+}
+
+// NewWebhookProvider creates a new webhook DDNS provider. The templates of the webhook config are parsed with the
+// template functions join (`join "," .IPs`) and json (`json .IPs`). The username and password are passed to the
+// templates, and are not used otherwise.
+func NewWebhookProvider(webhook config.DDNSWebhookConfig, hostname string, timeout, recordTTL time.Duration, username, password string) (*WebhookProvider, error) {
+	parse := func(name, text string) (*template.Template, error) {
+		tmpl, err := template.New(name).Funcs(webhookTemplateFuncs).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse webhook %s template: %w", name, err)
+		}
+		return tmpl, nil
+	}
+
+	w := &WebhookProvider{
+		hostname:        strings.TrimSuffix(hostname, "."),
+		recordTTL:       recordTTL,
+		username:        username,
+		password:        password,
+		headers:         make(map[string][]*template.Template, len(webhook.Headers)),
+		successStatuses: webhook.SuccessStatuses,
+		successRegex:    webhook.SuccessRegex,
+		perIP:           webhook.Mode == config.WebhookModePerIP,
+		client: &http.Client{
+			Timeout: timeout,
+		},
+	}
+
+	if len(w.successStatuses) == 0 {
+		w.successStatuses = config.DefaultExpectedStatuses
+	}
+
+	method := webhook.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	var err error
+	if w.method, err = parse("method", method); err != nil {
+		return nil, err
+	}
+
+	if w.url, err = parse("URL", webhook.URL); err != nil {
+		return nil, err
+	}
+
+	if webhook.Body != "" {
+		if w.body, err = parse("body", webhook.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	for name, values := range webhook.Headers {
+		for _, value := range values {
+			tmpl, err := parse(name+" header", value)
+			if err != nil {
+				return nil, err
+			}
+			w.headers[name] = append(w.headers[name], tmpl)
+		}
+	}
+
+	return w, nil
+}
+
+// Name returns the provider name
+func (w *WebhookProvider) Name() string {
+	return "Webhook"
+}
+
+// UpdateRecords sends the webhook requests for the IP addresses. In per-IP mode, one request is sent for each IP
+// address, and for each IP address of the last update that has been removed.
+func (w *WebhookProvider) UpdateRecords(ctx context.Context, newPublicIPs []string) error {
+	logger := slog.With("provider", w.Name(), "hostname", w.hostname, "ips", newPublicIPs)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	data := w.newTemplateData(newPublicIPs)
+
+	if !w.perIP {
+		if err := w.send(ctx, data); err != nil {
+			return fmt.Errorf("DNS record update failed: %w", err)
+		}
+
+		w.previousIPs = slices.Clone(data.IPs)
+		logger.InfoContext(ctx, "Successfully updated DNS records")
+		return nil
+	}
+
+	var removedIPs []string
+	for _, ip := range w.previousIPs {
+		if !slices.Contains(newPublicIPs, ip) {
+			removedIPs = append(removedIPs, ip)
+		}
+	}
+
+	logger.InfoContext(ctx, "Calculated webhook requests", "ipsToUpdate", len(newPublicIPs), "ipsToDelete", len(removedIPs))
+
+	eg, gctx := errgroup.WithContext(ctx)
+
+	send := func(ip, action string) {
+		ipData := data
+		ipData.IP = ip
+		ipData.Type = recordType(ip)
+		ipData.Action = action
+
+		eg.Go(func() error {
+			if err := w.send(gctx, ipData); err != nil {
+				return fmt.Errorf("failed to %s IP %s: %w", action, ip, err)
+			}
+
+			logger.DebugContext(gctx, "Sent webhook request", "ip", ip, "action", action)
+			return nil
+		})
+	}
+
+	for _, ip := range removedIPs {
+		send(ip, WebhookActionDelete)
+	}
+
+	for _, ip := range newPublicIPs {
+		send(ip, WebhookActionUpdate)
+	}
+
+	if err := eg.Wait(); err != nil {
+		return fmt.Errorf("DNS record update failed: %w", err)
+	}
+
+	w.previousIPs = slices.Clone(data.IPs)
+	logger.InfoContext(ctx, "Successfully updated DNS records")
+	return nil
+}
+
+// newTemplateData returns the template data of an update of the IP addresses. Lists are never nil, so that they are
+// rendered as empty JSON arrays.
+func (w *WebhookProvider) newTemplateData(ips []string) WebhookTemplateData {
+	data := WebhookTemplateData{
+		Hostname:    w.hostname,
+		IPs:         append([]string{}, ips...),
+		IPv4:        []string{},
+		IPv6:        []string{},
+		PreviousIPs: append([]string{}, w.previousIPs...),
+		TTL:         int(w.recordTTL.Seconds()),
+		Action:      WebhookActionUpdate,
+		Username:    w.username,
+		Password:    w.password,
+	}
+
+	for _, ip := range ips {
+		if recordType(ip) == "AAAA" {
+			data.IPv6 = append(data.IPv6, ip)
+		} else {
+			data.IPv4 = append(data.IPv4, ip)
+		}
+	}
+
+	return data
+}
+
+// send renders the request templates with the data, sends the request, and checks the response against the success
+// criterion
+func (w *WebhookProvider) send(ctx context.Context, data WebhookTemplateData) error {
+	render := func(tmpl *template.Template) (string, error) {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return "", fmt.Errorf("failed to render webhook %s template: %w", tmpl.Name(), err)
+		}
+		return buf.String(), nil
+	}
+
+	method, err := render(w.method)
+	if err != nil {
+		return err
+	}
+
+	url, err := render(w.url)
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader
+	if w.body != nil {
+		renderedBody, err := render(w.body)
+		if err != nil {
+			return err
+		}
+		body = strings.NewReader(renderedBody)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, strings.TrimSpace(method), strings.TrimSpace(url), body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	for name, values := range w.headers {
+		for _, value := range values {
+			renderedValue, err := render(value)
+			if err != nil {
+				return err
+			}
+			req.Header.Add(name, renderedValue)
+		}
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := io.ReadAll(io.LimitReader(resp.Body, config.DefaultHTTPMaxBodySize))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	succeeded := slices.ContainsFunc(w.successStatuses, func(r config.StatusRange) bool { return r.Contains(resp.StatusCode) })
+	if succeeded && w.successRegex != nil {
+		succeeded = w.successRegex.Match(responseBody)
+	}
+
+	if !succeeded {
+		return &WebhookResponseError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(responseBody))}
+	}
+
+	return nil
+}
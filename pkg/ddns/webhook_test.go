@@ -0,0 +1,255 @@
+package ddns
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// webhookRequest is a request that was received by the test webhook server
+type webhookRequest struct {
+	Method        string
+	URL           string
+	Authorization string
+	Body          string
+}
+
+// useWebhookServer starts a webhook server that records the requests and responds with the handler, and returns its URL
+func useWebhookServer(t *testing.T, handler http.HandlerFunc) (string, func() []webhookRequest) {
+	var mu sync.Mutex
+	var requests []webhookRequest
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		mu.Lock()
+		requests = append(requests, webhookRequest{Method: r.Method, URL: r.URL.String(), Authorization: r.Header.Get("Authorization"), Body: string(body)})
+		mu.Unlock()
+
+		if handler != nil {
+			handler(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server.URL, func() []webhookRequest {
+		mu.Lock()
+		defer mu.Unlock()
+
+		// Per-IP requests are sent in parallel
+		sorted := append([]webhookRequest{}, requests...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i].URL < sorted[j].URL })
+		requests = nil
+		return sorted
+	}
+}
+
+// TestWebhookProvider_UpdateRecords tests that a single request with all IP addresses is sent in set mode
+func TestWebhookProvider_UpdateRecords(t *testing.T) {
+	serverURL, requests := useWebhookServer(t, nil)
+
+	provider, err := NewWebhookProvider(config.DDNSWebhookConfig{
+		Method:  "PUT",
+		URL:     serverURL + "/records/{{.Hostname}}?ips={{join \",\" .IPs | urlquery}}",
+		Headers: http.Header{"Authorization": {"Bearer {{.Password}}"}},
+		Body:    `{"ipv4": {{json .IPv4}}, "ipv6": {{json .IPv6}}, "previous": {{json .PreviousIPs}}, "ttl": {{.TTL}}}`,
+	}, "gateways.example.com.", 10*time.Second, 2*time.Minute, "", "test-token")
+	require.NoError(t, err)
+
+	err = provider.UpdateRecords(t.Context(), []string{"1.2.3.4", "2001:db8::1"})
+	require.NoError(t, err, "UpdateRecords failed")
+
+	assert.Equal(t, []webhookRequest{{
+		Method:        "PUT",
+		URL:           "/records/gateways.example.com?ips=1.2.3.4%2C2001%3Adb8%3A%3A1",
+		Authorization: "Bearer test-token",
+		Body:          `{"ipv4": ["1.2.3.4"], "ipv6": ["2001:db8::1"], "previous": [], "ttl": 120}`,
+	}}, requests())
+
+	// The IP addresses of the last update are passed on to the next update
+	err = provider.UpdateRecords(t.Context(), []string{})
+	require.NoError(t, err, "UpdateRecords failed")
+
+	assert.Equal(t, []webhookRequest{{
+		Method:        "PUT",
+		URL:           "/records/gateways.example.com?ips=",
+		Authorization: "Bearer test-token",
+		Body:          `{"ipv4": [], "ipv6": [], "previous": ["1.2.3.4","2001:db8::1"], "ttl": 120}`,
+	}}, requests())
+}
+
+// TestWebhookProvider_UpdateRecords_PerIP tests that a request is sent for each IP address, and for each removed IP
+// address, in per-IP mode
+func TestWebhookProvider_UpdateRecords_PerIP(t *testing.T) {
+	serverURL, requests := useWebhookServer(t, nil)
+
+	provider, err := NewWebhookProvider(config.DDNSWebhookConfig{
+		Method: `{{if eq .Action "delete"}}DELETE{{else}}POST{{end}}`,
+		URL:    serverURL + "/{{.Type}}/{{.IP}}",
+		Body:   "{{.Action}} {{.IP}} of {{json .IPs}}",
+		Mode:   config.WebhookModePerIP,
+	}, "gateways.example.com", 10*time.Second, time.Minute, "", "")
+	require.NoError(t, err)
+
+	err = provider.UpdateRecords(t.Context(), []string{"1.2.3.4", "5.6.7.8"})
+	require.NoError(t, err, "UpdateRecords failed")
+
+	assert.Equal(t, []webhookRequest{
+		{Method: "POST", URL: "/A/1.2.3.4", Body: `update 1.2.3.4 of ["1.2.3.4","5.6.7.8"]`},
+		{Method: "POST", URL: "/A/5.6.7.8", Body: `update 5.6.7.8 of ["1.2.3.4","5.6.7.8"]`},
+	}, requests())
+
+	err = provider.UpdateRecords(t.Context(), []string{"5.6.7.8", "2001:db8::1"})
+	require.NoError(t, err, "UpdateRecords failed")
+
+	assert.Equal(t, []webhookRequest{
+		{Method: "DELETE", URL: "/A/1.2.3.4", Body: `delete 1.2.3.4 of ["5.6.7.8","2001:db8::1"]`},
+		{Method: "POST", URL: "/A/5.6.7.8", Body: `update 5.6.7.8 of ["5.6.7.8","2001:db8::1"]`},
+		{Method: "POST", URL: "/AAAA/2001:db8::1", Body: `update 2001:db8::1 of ["5.6.7.8","2001:db8::1"]`},
+	}, requests())
+}
+
+// TestWebhookProvider_UpdateRecords_SuccessCriterion tests that responses are checked against the success statuses and
+// body regex
+func TestWebhookProvider_UpdateRecords_SuccessCriterion(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		body          string
+		webhook       config.DDNSWebhookConfig
+		expectedError string
+	}{
+		{
+			name:   "default statuses",
+			status: http.StatusNoContent,
+		},
+		{
+			name:          "default statuses with error status",
+			status:        http.StatusUnauthorized,
+			body:          "badauth\n",
+			expectedError: "webhook returned unsuccessful response (status 401): badauth",
+		},
+		{
+			name:    "configured statuses",
+			status:  http.StatusFound,
+			webhook: config.DDNSWebhookConfig{SuccessStatuses: []config.StatusRange{{Min: 200, Max: 200}, {Min: 302, Max: 302}}},
+		},
+		{
+			name:          "status outside of configured statuses",
+			status:        http.StatusAccepted,
+			webhook:       config.DDNSWebhookConfig{SuccessStatuses: []config.StatusRange{{Min: 200, Max: 200}}},
+			expectedError: "webhook returned unsuccessful response (status 202)",
+		},
+		{
+			name:    "body matches regex",
+			status:  http.StatusOK,
+			body:    `{"result": "ok"}`,
+			webhook: config.DDNSWebhookConfig{SuccessRegex: regexp.MustCompile(`"result":\s*"ok"`)},
+		},
+		{
+			name:          "body does not match regex",
+			status:        http.StatusOK,
+			body:          `{"result": "error"}`,
+			webhook:       config.DDNSWebhookConfig{SuccessRegex: regexp.MustCompile(`"result":\s*"ok"`)},
+			expectedError: `webhook returned unsuccessful response (status 200): {"result": "error"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverURL, _ := useWebhookServer(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			})
+
+			tt.webhook.URL = serverURL
+			provider, err := NewWebhookProvider(tt.webhook, "gateways.example.com", 10*time.Second, time.Minute, "", "")
+			require.NoError(t, err)
+
+			err = provider.UpdateRecords(t.Context(), []string{"1.2.3.4"})
+
+			if tt.expectedError == "" {
+				require.NoError(t, err)
+				assert.Equal(t, []string{"1.2.3.4"}, provider.previousIPs)
+				return
+			}
+
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.expectedError)
+
+			var responseErr *WebhookResponseError
+			require.True(t, errors.As(err, &responseErr))
+			assert.Equal(t, tt.status, responseErr.StatusCode)
+
+			// Failed updates are not passed on as previous IP addresses
+			assert.Empty(t, provider.previousIPs)
+		})
+	}
+}
+
+func TestNewWebhookProvider(t *testing.T) {
+	tests := []struct {
+		name          string
+		webhook       config.DDNSWebhookConfig
+		expectedError string
+	}{
+		{
+			name:    "defaults",
+			webhook: config.DDNSWebhookConfig{URL: "https://example.com/update"},
+		},
+		{
+			name:          "invalid URL template",
+			webhook:       config.DDNSWebhookConfig{URL: "https://example.com/{{.Hostname"},
+			expectedError: "failed to parse webhook URL template",
+		},
+		{
+			name:          "undefined function",
+			webhook:       config.DDNSWebhookConfig{URL: "https://example.com/", Body: "{{upper .Hostname}}"},
+			expectedError: "failed to parse webhook body template",
+		},
+		{
+			name:          "invalid header template",
+			webhook:       config.DDNSWebhookConfig{URL: "https://example.com/", Headers: http.Header{"X-Token": {"{{end}}"}}},
+			expectedError: "failed to parse webhook X-Token header template",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, err := NewWebhookProvider(tt.webhook, "gateways.example.com", time.Minute, time.Minute, "", "")
+
+			if tt.expectedError != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedError)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, "Webhook", provider.Name())
+			assert.Equal(t, config.DefaultExpectedStatuses, provider.successStatuses)
+			assert.Nil(t, provider.body)
+		})
+	}
+}
+
+// TestWebhookProvider_UpdateRecords_RenderError tests that templates that fail to render are reported
+func TestWebhookProvider_UpdateRecords_RenderError(t *testing.T) {
+	provider, err := NewWebhookProvider(config.DDNSWebhookConfig{URL: "https://example.com/{{.Zone}}"}, "gateways.example.com", time.Minute, time.Minute, "", "")
+	require.NoError(t, err)
+
+	err = provider.UpdateRecords(t.Context(), []string{"1.2.3.4"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to render webhook URL template")
+}
@@ -1,6 +1,7 @@
 package gateway
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -8,6 +9,8 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -18,14 +21,31 @@ import (
 
 // Gateway represents a single gateway with its health status
 type Gateway struct {
-	IP                  net.IP
-	URL                 string
-	IsActive            bool
-	ConsecutiveFailures int
-	PublicIP            string // Public IP address obtained from public IP service
-	metrics             *metrics.Metrics
+	IP                   net.IP
+	URL                  string   // Health check URL, used by HTTP health checks
+	Port                 int      // Health check port, used by port-based health checks
+	Scheme               string   // Health check scheme, used to enable TLS for gRPC health checks
+	CheckType            string   // Health check type, one of the config.CheckType* values
+	Weight               int      // Configured ECMP weight. Zero is treated as 1.
+	Priority             int      // Priority tier. Lower values are preferred.
+	Pools                []string // Named pools that the gateway belongs to, in addition to config.DefaultPool
+	Interface            string   // Interface that the gateway is reached through. Empty lets the kernel resolve it.
+	OnLink               bool     // Whether the gateway is used even though no route on the interface covers it
+	PreferredSource      net.IP   // Source address hint for locally generated traffic routed via the gateway
+	IsActive             bool
+	ConsecutiveFailures  int
+	ConsecutiveSuccesses int
+	Latency              time.Duration // Smoothed duration of successful health checks, zero until a check succeeds
+	PublicIP             string        // Public IP address obtained from public IP service
+	metrics              *metrics.Metrics
+
+	// True until the first health check result is recorded, if the gateway state should be taken from it
+	awaitingFirstCheck bool
 }
 
+// Upper limit for the number of gateways, to prevent accidentally monitoring huge (e.g. IPv6 /64) networks
+const maxGateways = 65536
+
 // GenerateGateways creates a slice of Gateway structs for the IP range
 func GenerateGateways(startIPStr, endIPStr string, port int, path, scheme string, m *metrics.Metrics) ([]Gateway, error) {
 	startIP := net.ParseIP(startIPStr)
@@ -38,6 +58,91 @@ func GenerateGateways(startIPStr, endIPStr string, port int, path, scheme string
 		return nil, fmt.Errorf("invalid end IP: %s", endIPStr)
 	}
 
+	if iputil.Family(startIP) != iputil.Family(endIP) {
+		return nil, fmt.Errorf("start IP %s and end IP %s are not of the same IP family", startIPStr, endIPStr)
+	}
+
+	return generateRange(startIP, endIP, config.CheckTypeHTTP, port, path, scheme, m)
+}
+
+// GenerateGatewaysFromConfig creates a slice of Gateway structs for the start/end IP range (if set) and all
+// explicit gateway entries in the config. Entries inherit the top-level check type, port, path and scheme unless
+// overridden. Gateways with DNS checks use the DNS port instead of the top-level port. Each gateway IP may only be
+// configured once.
+func GenerateGatewaysFromConfig(cfg config.Config, m *metrics.Metrics) ([]Gateway, error) {
+	var gateways []Gateway
+
+	if cfg.StartIP != "" || cfg.EndIP != "" {
+		rangeGateways, err := GenerateGateways(cfg.StartIP, cfg.EndIP, cfg.Port, cfg.URLPath, cfg.Scheme, m)
+		if err != nil {
+			return nil, err
+		}
+
+		checkType := cmp.Or(cfg.CheckType, config.CheckTypeHTTP)
+		for i := range rangeGateways {
+			rangeGateways[i].CheckType = checkType
+			if checkType == config.CheckTypeDNS {
+				rangeGateways[i].Port = cmp.Or(cfg.DNSPort, config.DefaultDNSPort)
+			}
+		}
+		gateways = append(gateways, rangeGateways...)
+	}
+
+	for _, gatewayConfig := range cfg.Gateways {
+		firstIP, lastIP, err := iputil.ParseAddressRange(gatewayConfig.Address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gateway address %s: %w", gatewayConfig.Address, err)
+		}
+
+		checkType := cmp.Or(gatewayConfig.CheckType, cfg.CheckType, config.CheckTypeHTTP)
+		port := cmp.Or(gatewayConfig.Port, cfg.Port)
+		if checkType == config.CheckTypeDNS {
+			// The shared health check port is meant for HTTP and TCP based checks
+			port = cmp.Or(gatewayConfig.Port, cfg.DNSPort, config.DefaultDNSPort)
+		}
+		path := cmp.Or(gatewayConfig.Path, cfg.URLPath)
+		scheme := cmp.Or(gatewayConfig.Scheme, cfg.Scheme)
+
+		entryGateways, err := generateRange(firstIP, lastIP, checkType, port, path, scheme, m)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate gateways for %s: %w", gatewayConfig.Address, err)
+		}
+		for i := range entryGateways {
+			entryGateways[i].Weight = gatewayConfig.Weight
+			entryGateways[i].Priority = gatewayConfig.Priority
+			entryGateways[i].Pools = gatewayConfig.Pools
+			entryGateways[i].Interface = gatewayConfig.Interface
+			entryGateways[i].OnLink = gatewayConfig.OnLink
+			entryGateways[i].PreferredSource = gatewayConfig.PreferredSource
+		}
+		gateways = append(gateways, entryGateways...)
+
+		if len(gateways) > maxGateways {
+			return nil, fmt.Errorf("too many gateways (maximum is %d)", maxGateways)
+		}
+	}
+
+	seen := make(map[string]struct{}, len(gateways))
+	for i, gw := range gateways {
+		gatewayIP := gw.IP.String()
+		if _, ok := seen[gatewayIP]; ok {
+			return nil, fmt.Errorf("gateway %s is configured more than once", gatewayIP)
+		}
+		seen[gatewayIP] = struct{}{}
+
+		switch cmp.Or(cfg.InitialState, config.InitialStateFirstCheck) {
+		case config.InitialStateFirstCheck:
+			gateways[i].awaitingFirstCheck = true
+		case config.InitialStateUp:
+			gateways[i].IsActive = true
+		}
+	}
+
+	return gateways, nil
+}
+
+// generateRange creates a Gateway for each IP between startIP and endIP (inclusive)
+func generateRange(startIP, endIP net.IP, checkType string, port int, path, scheme string, m *metrics.Metrics) ([]Gateway, error) {
 	// Convert to 4-byte representation for easier iteration
 	if startIP.To4() != nil {
 		startIP = startIP.To4()
@@ -54,16 +159,23 @@ func GenerateGateways(startIPStr, endIPStr string, port int, path, scheme string
 
 	// Iterate from startIP to endIP (inclusive)
 	for {
+		if len(gateways) >= maxGateways {
+			return nil, fmt.Errorf("too many gateways in range %s-%s (maximum is %d)", startIP, endIP, maxGateways)
+		}
+
 		// Create a copy of the current IP
 		ipCopy := make(net.IP, len(currentIP))
 		copy(ipCopy, currentIP)
 
-		url := fmt.Sprintf("%s://%s:%d%s", scheme, ipCopy.String(), port, path)
+		url := fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(ipCopy.String(), strconv.Itoa(port)), path)
 
 		gateways = append(gateways, Gateway{
-			IP:      ipCopy,
-			URL:     url,
-			metrics: m,
+			IP:        ipCopy,
+			URL:       url,
+			Port:      port,
+			Scheme:    scheme,
+			CheckType: checkType,
+			metrics:   m,
 		})
 
 		// Check if we've reached the end IP
@@ -85,6 +197,60 @@ func GenerateGateways(startIPStr, endIPStr string, port int, path, scheme string
 	return gateways, nil
 }
 
+// RecordCheckResult updates the consecutive success and failure counts with a health check result, and changes
+// the gateway state once the rise (for inactive gateways) or fall (for active gateways) threshold is reached.
+// Thresholds below 1 are treated as 1. Returns true if the state changed.
+func (g *Gateway) RecordCheckResult(healthy bool, rise, fall int) bool {
+	if healthy {
+		g.ConsecutiveSuccesses++
+		g.ConsecutiveFailures = 0
+	} else {
+		g.ConsecutiveFailures++
+		g.ConsecutiveSuccesses = 0
+	}
+
+	wasActive := g.IsActive
+	switch {
+	case g.awaitingFirstCheck:
+		g.awaitingFirstCheck = false
+		g.IsActive = healthy
+	case g.IsActive && g.ConsecutiveFailures >= max(fall, 1):
+		g.IsActive = false
+	case !g.IsActive && g.ConsecutiveSuccesses >= max(rise, 1):
+		g.IsActive = true
+	}
+
+	return g.IsActive != wasActive
+}
+
+// InPool returns true if the gateway belongs to the named pool
+func (g *Gateway) InPool(pool string) bool {
+	return pool == config.DefaultPool || slices.Contains(g.Pools, pool)
+}
+
+// Weight given to the latest health check duration when smoothing the latency
+const latencySmoothingFactor = 0.3
+
+// RecordLatency updates the smoothed latency with the duration of a successful health check
+func (g *Gateway) RecordLatency(latency time.Duration) {
+	if g.Latency == 0 {
+		g.Latency = latency
+		return
+	}
+
+	g.Latency += time.Duration(latencySmoothingFactor * float64(latency-g.Latency))
+}
+
+// CopyState copies the health state of another gateway, such as the same gateway from before a reload
+func (g *Gateway) CopyState(other Gateway) {
+	g.IsActive = other.IsActive
+	g.ConsecutiveFailures = other.ConsecutiveFailures
+	g.ConsecutiveSuccesses = other.ConsecutiveSuccesses
+	g.Latency = other.Latency
+	g.PublicIP = other.PublicIP
+	g.awaitingFirstCheck = other.awaitingFirstCheck
+}
+
 // FetchPublicIP fetches the public IP address from the gateway's public IP service
 func (g *Gateway) FetchPublicIP(ctx context.Context, cfg config.PublicIPServiceConfig, timeout time.Duration) error {
 	gatewayIP := g.IP.String()
@@ -180,14 +346,9 @@ func (g *Gateway) FetchPublicIP(ctx context.Context, cfg config.PublicIPServiceC
 		return fmt.Errorf("received invalid public IP '%s' from gateway %s", publicIP, g.IP.String())
 	}
 
-	if parsedIP.To4() == nil {
-		g.metrics.PublicIPFetchTotal.WithLabelValues(gatewayIP, "failure").Inc()
-		return fmt.Errorf("received non-IPv4 public IP '%s' from gateway %s", publicIP, g.IP.String())
-	}
-
 	// Success case - record successful metric
 	g.metrics.PublicIPFetchTotal.WithLabelValues(gatewayIP, "success").Inc()
 
-	g.PublicIP = publicIP
+	g.PublicIP = parsedIP.String()
 	return nil
 }
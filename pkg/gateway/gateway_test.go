@@ -89,6 +89,15 @@ func TestGateway_FetchPublicIP(t *testing.T) {
 			serverResponse: `{"public_ip": "203.0.113.10", "ip": "192.0.2.20"}`,
 			expectedIP:     "203.0.113.10",
 		},
+		{
+			name: "successful fetch - IPv6 public IP",
+			gateway: Gateway{
+				IP:       parseIP("192.168.1.1"),
+				IsActive: true,
+			},
+			serverResponse: `{"public_ip": "2001:DB8:0::45"}`,
+			expectedIP:     "2001:db8::45",
+		},
 		{
 			name: "successful fetch - JSON with non-string value, falls to next key",
 			gateway: Gateway{
@@ -381,6 +390,378 @@ func TestGateway_FetchPublicIP_WithCustomPath(t *testing.T) {
 	assert.Equal(t, "9.10.11.12", gateway.PublicIP)
 }
 
+func TestGenerateGateways(t *testing.T) {
+	tests := []struct {
+		name         string
+		startIP      string
+		endIP        string
+		expectedURLs []string
+		errFunc      require.ErrorAssertionFunc
+	}{
+		{
+			name:         "IPv4 range",
+			startIP:      "192.168.1.254",
+			endIP:        "192.168.2.0",
+			expectedURLs: []string{"http://192.168.1.254:8080/healthz", "http://192.168.1.255:8080/healthz", "http://192.168.2.0:8080/healthz"},
+		},
+		{
+			name:         "IPv6 range",
+			startIP:      "2001:db8::ffff",
+			endIP:        "2001:db8::1:1",
+			expectedURLs: []string{"http://[2001:db8::ffff]:8080/healthz", "http://[2001:db8::1:0]:8080/healthz", "http://[2001:db8::1:1]:8080/healthz"},
+		},
+		{
+			name:    "mixed IP families",
+			startIP: "192.168.1.1",
+			endIP:   "2001:db8::1",
+			errFunc: require.Error,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.errFunc == nil {
+				tt.errFunc = require.NoError
+			}
+
+			gateways, err := GenerateGateways(tt.startIP, tt.endIP, 8080, "/healthz", "http", nil)
+			tt.errFunc(t, err)
+
+			urls := make([]string, 0, len(gateways))
+			for _, gw := range gateways {
+				urls = append(urls, gw.URL)
+			}
+			assert.Equal(t, len(tt.expectedURLs), len(urls))
+			if len(tt.expectedURLs) > 0 {
+				assert.Equal(t, tt.expectedURLs, urls)
+			}
+		})
+	}
+}
+
+func TestGenerateGatewaysFromConfig(t *testing.T) {
+	baseConfig := config.Config{
+		Port:    8080,
+		URLPath: "/healthz",
+		Scheme:  "http",
+	}
+
+	tests := []struct {
+		name         string
+		startIP      string
+		endIP        string
+		gateways     []config.GatewayConfig
+		expectedURLs []string
+		errFunc      require.ErrorAssertionFunc
+	}{
+		{
+			name:         "range only",
+			startIP:      "192.168.1.1",
+			endIP:        "192.168.1.2",
+			expectedURLs: []string{"http://192.168.1.1:8080/healthz", "http://192.168.1.2:8080/healthz"},
+		},
+		{
+			name: "explicit gateways only",
+			gateways: []config.GatewayConfig{
+				{Address: "10.0.0.5"},
+				{Address: "10.1.0.0/30", Port: 9000},
+				{Address: "172.16.0.1-172.16.0.2", Path: "/ready", Scheme: "https"},
+			},
+			expectedURLs: []string{
+				"http://10.0.0.5:8080/healthz",
+				"http://10.1.0.1:9000/healthz",
+				"http://10.1.0.2:9000/healthz",
+				"https://172.16.0.1:8080/ready",
+				"https://172.16.0.2:8080/ready",
+			},
+		},
+		{
+			name:    "range and explicit gateways",
+			startIP: "192.168.1.1",
+			endIP:   "192.168.1.1",
+			gateways: []config.GatewayConfig{
+				{Address: "2001:db8::1", Scheme: "https"},
+			},
+			expectedURLs: []string{"http://192.168.1.1:8080/healthz", "https://[2001:db8::1]:8080/healthz"},
+		},
+		{
+			name:    "duplicate gateway",
+			startIP: "192.168.1.1",
+			endIP:   "192.168.1.5",
+			gateways: []config.GatewayConfig{
+				{Address: "192.168.1.3"},
+			},
+			errFunc: require.Error,
+		},
+		{
+			name: "invalid address",
+			gateways: []config.GatewayConfig{
+				{Address: "not-an-ip"},
+			},
+			errFunc: require.Error,
+		},
+		{
+			name: "too many gateways",
+			gateways: []config.GatewayConfig{
+				{Address: "2001:db8::/64"},
+			},
+			errFunc: require.Error,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.errFunc == nil {
+				tt.errFunc = require.NoError
+			}
+
+			cfg := baseConfig
+			cfg.StartIP = tt.startIP
+			cfg.EndIP = tt.endIP
+			cfg.Gateways = tt.gateways
+
+			gateways, err := GenerateGatewaysFromConfig(cfg, nil)
+			tt.errFunc(t, err)
+
+			urls := make([]string, 0, len(gateways))
+			for _, gw := range gateways {
+				urls = append(urls, gw.URL)
+			}
+			assert.Equal(t, len(tt.expectedURLs), len(urls))
+			if len(tt.expectedURLs) > 0 {
+				assert.Equal(t, tt.expectedURLs, urls)
+			}
+		})
+	}
+}
+
+func TestGenerateGatewaysFromConfig_CheckType(t *testing.T) {
+	cfg := config.Config{
+		StartIP:   "192.168.1.1",
+		EndIP:     "192.168.1.1",
+		CheckType: config.CheckTypeTCP,
+		Port:      8080,
+		Scheme:    "http",
+		Gateways: []config.GatewayConfig{
+			{Address: "10.0.0.1"},
+			{Address: "10.0.0.2", CheckType: config.CheckTypeGRPC, Port: 50051, Scheme: "https", Weight: 5, Pools: []string{"fast"},
+				Interface: "wg0", OnLink: true, PreferredSource: net.ParseIP("10.0.0.100")},
+		},
+	}
+
+	gateways, err := GenerateGatewaysFromConfig(cfg, nil)
+	require.NoError(t, err)
+	require.Len(t, gateways, 3)
+
+	assert.Equal(t, config.CheckTypeTCP, gateways[0].CheckType)
+	assert.Equal(t, 8080, gateways[0].Port)
+	assert.Equal(t, config.CheckTypeTCP, gateways[1].CheckType)
+	assert.Equal(t, config.CheckTypeGRPC, gateways[2].CheckType)
+	assert.Equal(t, 50051, gateways[2].Port)
+	assert.Equal(t, "https", gateways[2].Scheme)
+	assert.Zero(t, gateways[0].Weight)
+	assert.Equal(t, 5, gateways[2].Weight)
+	assert.Equal(t, []string{"fast"}, gateways[2].Pools)
+	assert.Empty(t, gateways[1].Interface)
+	assert.Equal(t, "wg0", gateways[2].Interface)
+	assert.True(t, gateways[2].OnLink)
+	assert.Equal(t, net.ParseIP("10.0.0.100"), gateways[2].PreferredSource)
+}
+
+// TestGenerateGatewaysFromConfig_DNSPort tests that DNS checks query the DNS port instead of the shared health check
+// port, unless the gateway entry sets a port
+func TestGenerateGatewaysFromConfig_DNSPort(t *testing.T) {
+	cfg := config.Config{
+		StartIP:   "192.168.1.1",
+		EndIP:     "192.168.1.1",
+		CheckType: config.CheckTypeDNS,
+		Port:      9999,
+		Scheme:    "http",
+		Gateways: []config.GatewayConfig{
+			{Address: "10.0.0.1"},
+			{Address: "10.0.0.2", Port: 5353},
+			{Address: "10.0.0.3", CheckType: config.CheckTypeTCP},
+		},
+	}
+
+	gateways, err := GenerateGatewaysFromConfig(cfg, nil)
+	require.NoError(t, err)
+	require.Len(t, gateways, 4)
+
+	assert.Equal(t, config.DefaultDNSPort, gateways[0].Port)
+	assert.Equal(t, config.DefaultDNSPort, gateways[1].Port)
+	assert.Equal(t, 5353, gateways[2].Port)
+	assert.Equal(t, 9999, gateways[3].Port)
+
+	cfg.DNSPort = 5300
+	gateways, err = GenerateGatewaysFromConfig(cfg, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 5300, gateways[0].Port)
+	assert.Equal(t, 5300, gateways[1].Port)
+	assert.Equal(t, 5353, gateways[2].Port)
+}
+
+func TestGateway_InPool(t *testing.T) {
+	gw := Gateway{Pools: []string{"fast"}}
+	assert.True(t, gw.InPool("fast"))
+	assert.True(t, gw.InPool(config.DefaultPool))
+	assert.False(t, gw.InPool("cheap"))
+
+	// Every gateway is in the default pool
+	gw = Gateway{}
+	assert.True(t, gw.InPool(config.DefaultPool))
+}
+
+func TestGateway_RecordLatency(t *testing.T) {
+	gw := &Gateway{}
+
+	// The first measurement is used as-is
+	gw.RecordLatency(100 * time.Millisecond)
+	assert.Equal(t, 100*time.Millisecond, gw.Latency)
+
+	// Later measurements are smoothed
+	gw.RecordLatency(200 * time.Millisecond)
+	assert.Equal(t, 130*time.Millisecond, gw.Latency)
+}
+
+func TestGenerateGatewaysFromConfig_InitialState(t *testing.T) {
+	tests := []struct {
+		name           string
+		initialState   string
+		expectedActive bool
+	}{
+		{
+			name: "default waits for first check",
+		},
+		{
+			name:         "first check",
+			initialState: config.InitialStateFirstCheck,
+		},
+		{
+			name:         "down",
+			initialState: config.InitialStateDown,
+		},
+		{
+			name:           "up",
+			initialState:   config.InitialStateUp,
+			expectedActive: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Config{
+				Gateways:     []config.GatewayConfig{{Address: "10.0.0.1"}},
+				Port:         80,
+				Scheme:       "http",
+				InitialState: tt.initialState,
+			}
+
+			gateways, err := GenerateGatewaysFromConfig(cfg, nil)
+			require.NoError(t, err)
+			require.Len(t, gateways, 1)
+			assert.Equal(t, tt.expectedActive, gateways[0].IsActive)
+		})
+	}
+}
+
+func TestGateway_RecordCheckResult(t *testing.T) {
+	tests := []struct {
+		name               string
+		initialState       string
+		rise               int
+		fall               int
+		results            []bool
+		expectedActive     []bool
+		expectedTransition []bool
+	}{
+		{
+			name:               "single check thresholds follow every result",
+			initialState:       config.InitialStateDown,
+			rise:               1,
+			fall:               1,
+			results:            []bool{true, false, true},
+			expectedActive:     []bool{true, false, true},
+			expectedTransition: []bool{true, true, true},
+		},
+		{
+			name:               "rise threshold",
+			initialState:       config.InitialStateDown,
+			rise:               3,
+			fall:               1,
+			results:            []bool{true, true, false, true, true, true},
+			expectedActive:     []bool{false, false, false, false, false, true},
+			expectedTransition: []bool{false, false, false, false, false, true},
+		},
+		{
+			name:               "fall threshold",
+			initialState:       config.InitialStateUp,
+			rise:               1,
+			fall:               2,
+			results:            []bool{false, true, false, false},
+			expectedActive:     []bool{true, true, true, false},
+			expectedTransition: []bool{false, false, false, true},
+		},
+		{
+			name:               "first check ignores thresholds",
+			initialState:       config.InitialStateFirstCheck,
+			rise:               3,
+			fall:               3,
+			results:            []bool{true, false, false, false},
+			expectedActive:     []bool{true, true, true, false},
+			expectedTransition: []bool{true, false, false, true},
+		},
+		{
+			name:               "first check failure",
+			initialState:       config.InitialStateFirstCheck,
+			rise:               2,
+			fall:               2,
+			results:            []bool{false, true, true},
+			expectedActive:     []bool{false, false, true},
+			expectedTransition: []bool{false, false, true},
+		},
+		{
+			name:               "zero thresholds are treated as one",
+			initialState:       config.InitialStateDown,
+			results:            []bool{true, false},
+			expectedActive:     []bool{true, false},
+			expectedTransition: []bool{true, true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gateways, err := GenerateGatewaysFromConfig(config.Config{
+				Gateways:     []config.GatewayConfig{{Address: "10.0.0.1"}},
+				Port:         80,
+				Scheme:       "http",
+				InitialState: tt.initialState,
+			}, nil)
+			require.NoError(t, err)
+			gw := &gateways[0]
+
+			for i, healthy := range tt.results {
+				changed := gw.RecordCheckResult(healthy, tt.rise, tt.fall)
+				assert.Equal(t, tt.expectedTransition[i], changed, "transition after check %d", i)
+				assert.Equal(t, tt.expectedActive[i], gw.IsActive, "state after check %d", i)
+			}
+		})
+	}
+}
+
+func TestGateway_RecordCheckResult_Counters(t *testing.T) {
+	gw := &Gateway{}
+
+	gw.RecordCheckResult(true, 1, 1)
+	gw.RecordCheckResult(true, 1, 1)
+	assert.Equal(t, 2, gw.ConsecutiveSuccesses)
+	assert.Equal(t, 0, gw.ConsecutiveFailures)
+
+	gw.RecordCheckResult(false, 1, 1)
+	assert.Equal(t, 0, gw.ConsecutiveSuccesses)
+	assert.Equal(t, 1, gw.ConsecutiveFailures)
+}
+
 // Helper function to parse IP for tests
 func parseIP(s string) net.IP {
 	return net.ParseIP(s)
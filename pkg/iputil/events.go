@@ -0,0 +1,245 @@
+package iputil
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+// Size of struct fib_rule_hdr, which precedes the attributes of rule messages
+const fibRuleHeaderSize = 12
+
+// RuleUpdate is a rule change notification. The netlink package does not support subscribing to rules, so only the
+// fields needed to identify the rule are parsed.
+type RuleUpdate struct {
+	Type     uint16 // unix.RTM_NEWRULE or unix.RTM_DELRULE
+	Family   int
+	Table    int
+	Priority int
+}
+
+// Event is a change to the kernel network state. Exactly one of the fields is set.
+type Event struct {
+	Link    *netlink.LinkUpdate
+	Address *netlink.AddrUpdate
+	Route   *netlink.RouteUpdate
+	Rule    *RuleUpdate
+}
+
+// EventSource subscribes to link, address, route and rule changes once, and delivers them to any number of
+// handlers. This allows components to react to changes immediately instead of polling for them.
+type EventSource struct {
+	mu       sync.Mutex
+	handlers map[int]func(Event)
+	nextID   int
+}
+
+func NewEventSource() *EventSource {
+	return &EventSource{handlers: make(map[int]func(Event))}
+}
+
+// Subscribe registers a handler that is called with every event. Handlers are called from a single goroutine, one
+// at a time, and must not block. The returned function unregisters the handler. After it returns, the handler is
+// not called again.
+func (s *EventSource) Subscribe(handler func(Event)) (unsubscribe func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := s.nextID
+	s.nextID++
+	s.handlers[id] = handler
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.handlers, id)
+	}
+}
+
+// Publish delivers the event to all handlers
+func (s *EventSource) Publish(event Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, handler := range s.handlers {
+		handler(event)
+	}
+}
+
+// Start subscribes to changes until the context is cancelled. Returns an error if any of the subscriptions fail, in
+// which case no events are delivered.
+func (s *EventSource) Start(ctx context.Context) error {
+	done := make(chan struct{})
+	stop := sync.OnceFunc(func() { close(done) })
+	context.AfterFunc(ctx, stop)
+
+	errorCallback := func(kind string) func(error) {
+		return func(err error) {
+			// Closing the subscriptions interrupts pending reads
+			select {
+			case <-done:
+				return
+			default:
+			}
+			slog.WarnContext(ctx, "Failed to receive netlink updates", "kind", kind, "error", err)
+		}
+	}
+
+	links := make(chan netlink.LinkUpdate)
+	addresses := make(chan netlink.AddrUpdate)
+	routes := make(chan netlink.RouteUpdate)
+	rules := make(chan RuleUpdate)
+
+	err := netlink.LinkSubscribeWithOptions(links, done, netlink.LinkSubscribeOptions{ErrorCallback: errorCallback("link")})
+	if err != nil {
+		stop()
+		return fmt.Errorf("failed to subscribe to link updates: %w", err)
+	}
+
+	err = netlink.AddrSubscribeWithOptions(addresses, done, netlink.AddrSubscribeOptions{ErrorCallback: errorCallback("address")})
+	if err != nil {
+		stop()
+		return fmt.Errorf("failed to subscribe to address updates: %w", err)
+	}
+
+	err = netlink.RouteSubscribeWithOptions(routes, done, netlink.RouteSubscribeOptions{ErrorCallback: errorCallback("route")})
+	if err != nil {
+		stop()
+		return fmt.Errorf("failed to subscribe to route updates: %w", err)
+	}
+
+	if err := ruleSubscribe(rules, done, errorCallback("rule")); err != nil {
+		stop()
+		return fmt.Errorf("failed to subscribe to rule updates: %w", err)
+	}
+
+	go s.forward(ctx, links, addresses, routes, rules)
+	return nil
+}
+
+// forward publishes the updates from each subscription until all of them are closed
+func (s *EventSource) forward(ctx context.Context, links chan netlink.LinkUpdate, addresses chan netlink.AddrUpdate,
+	routes chan netlink.RouteUpdate, rules chan RuleUpdate) {
+	for links != nil || addresses != nil || routes != nil || rules != nil {
+		select {
+		case update, ok := <-links:
+			if !ok {
+				links = nil
+				continue
+			}
+			s.Publish(Event{Link: &update})
+		case update, ok := <-addresses:
+			if !ok {
+				addresses = nil
+				continue
+			}
+			s.Publish(Event{Address: &update})
+		case update, ok := <-routes:
+			if !ok {
+				routes = nil
+				continue
+			}
+			s.Publish(Event{Route: &update})
+		case update, ok := <-rules:
+			if !ok {
+				rules = nil
+				continue
+			}
+			s.Publish(Event{Rule: &update})
+		}
+	}
+
+	if ctx.Err() == nil {
+		slog.WarnContext(ctx, "Stopped receiving netlink updates")
+	}
+}
+
+// ruleSubscribe sends IPv4 and IPv6 rule updates to the channel until done is closed, following the conventions of
+// the netlink package subscription functions
+func ruleSubscribe(ch chan<- RuleUpdate, done <-chan struct{}, errorCallback func(error)) error {
+	socket, err := nl.Subscribe(unix.NETLINK_ROUTE, unix.RTNLGRP_IPV4_RULE, unix.RTNLGRP_IPV6_RULE)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		<-done
+		socket.Close()
+	}()
+
+	go func() {
+		defer close(ch)
+		for {
+			msgs, from, err := socket.Receive()
+			if err != nil {
+				errorCallback(fmt.Errorf("receive failed: %w", err))
+				return
+			}
+
+			if from.Pid != nl.PidKernel {
+				continue
+			}
+
+			for _, msg := range msgs {
+				update, err := parseRuleUpdate(msg)
+				if err != nil {
+					errorCallback(err)
+					continue
+				}
+
+				if update != nil {
+					ch <- *update
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// parseRuleUpdate parses a rule message. Returns nil for other messages.
+func parseRuleUpdate(msg syscall.NetlinkMessage) (*RuleUpdate, error) {
+	if msg.Header.Type != unix.RTM_NEWRULE && msg.Header.Type != unix.RTM_DELRULE {
+		return nil, nil
+	}
+
+	if len(msg.Data) < fibRuleHeaderSize {
+		return nil, errors.New("rule message is too short")
+	}
+
+	// struct fib_rule_hdr: family, dst_len, src_len, tos, table, res1, res2, action, flags (uint32)
+	update := &RuleUpdate{
+		Type:   msg.Header.Type,
+		Family: int(msg.Data[0]),
+		Table:  int(msg.Data[4]),
+	}
+
+	attrs, err := nl.ParseRouteAttr(msg.Data[fibRuleHeaderSize:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rule attributes: %w", err)
+	}
+
+	for _, attr := range attrs {
+		if len(attr.Value) < 4 {
+			continue
+		}
+
+		switch attr.Attr.Type {
+		case nl.FRA_PRIORITY:
+			update.Priority = int(binary.NativeEndian.Uint32(attr.Value))
+		case nl.FRA_TABLE:
+			// Tables above 255 are only stored in the attribute
+			update.Table = int(binary.NativeEndian.Uint32(attr.Value))
+		}
+	}
+
+	return update, nil
+}
@@ -0,0 +1,82 @@
+package iputil
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+func TestEventSource(t *testing.T) {
+	source := NewEventSource()
+
+	var first, second []Event
+	unsubscribeFirst := source.Subscribe(func(event Event) { first = append(first, event) })
+	source.Subscribe(func(event Event) { second = append(second, event) })
+
+	routeEvent := Event{Route: &netlink.RouteUpdate{Type: unix.RTM_NEWROUTE}}
+	source.Publish(routeEvent)
+
+	unsubscribeFirst()
+	ruleEvent := Event{Rule: &RuleUpdate{Type: unix.RTM_DELRULE}}
+	source.Publish(ruleEvent)
+
+	assert.Equal(t, []Event{routeEvent}, first)
+	assert.Equal(t, []Event{routeEvent, ruleEvent}, second)
+}
+
+// ruleMessage builds a rule message as sent by the kernel
+func ruleMessage(msgType uint16, family uint8, table uint8, attrs ...*nl.RtAttr) syscall.NetlinkMessage {
+	data := make([]byte, fibRuleHeaderSize)
+	data[0] = family
+	data[4] = table
+	for _, attr := range attrs {
+		data = append(data, attr.Serialize()...)
+	}
+
+	return syscall.NetlinkMessage{Header: syscall.NlMsghdr{Type: msgType}, Data: data}
+}
+
+func TestParseRuleUpdate(t *testing.T) {
+	tests := []struct {
+		name     string
+		msg      syscall.NetlinkMessage
+		expected *RuleUpdate
+		errFunc  require.ErrorAssertionFunc
+	}{
+		{
+			name:     "new rule",
+			msg:      ruleMessage(unix.RTM_NEWRULE, unix.AF_INET, 100, uint32Attr(nl.FRA_PRIORITY, 10888), uint32Attr(nl.FRA_TABLE, 100)),
+			expected: &RuleUpdate{Type: unix.RTM_NEWRULE, Family: netlink.FAMILY_V4, Table: 100, Priority: 10888},
+			errFunc:  require.NoError,
+		},
+		{
+			name:     "deleted rule with large table ID",
+			msg:      ruleMessage(unix.RTM_DELRULE, unix.AF_INET6, unix.RT_TABLE_COMPAT, uint32Attr(nl.FRA_PRIORITY, 1001), uint32Attr(nl.FRA_TABLE, 1000)),
+			expected: &RuleUpdate{Type: unix.RTM_DELRULE, Family: netlink.FAMILY_V6, Table: 1000, Priority: 1001},
+			errFunc:  require.NoError,
+		},
+		{
+			name:    "other message",
+			msg:     syscall.NetlinkMessage{Header: syscall.NlMsghdr{Type: unix.NLMSG_DONE}},
+			errFunc: require.NoError,
+		},
+		{
+			name:    "short message",
+			msg:     syscall.NetlinkMessage{Header: syscall.NlMsghdr{Type: unix.RTM_NEWRULE}, Data: []byte{unix.AF_INET}},
+			errFunc: require.Error,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			update, err := parseRuleUpdate(tt.msg)
+			tt.errFunc(t, err)
+			assert.Equal(t, tt.expected, update)
+		})
+	}
+}
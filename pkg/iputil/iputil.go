@@ -1,52 +1,71 @@
-// Package iputil provides utility functions for working with IPv4 addresses
+// Package iputil provides utility functions for working with IPv4 and IPv6 addresses
 package iputil
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"net"
 	"sort"
+	"strings"
 
 	"github.com/vishvananda/netlink"
 )
 
-// IsIPGreater returns true if ip1 is greater than ip2.
-// Both IPs must be valid IPv4 addresses.
-func IsIPGreater(ip1, ip2 net.IP) bool {
-	// Convert to IPv4 representation
-	ip1 = ip1.To4()
-	ip2 = ip2.To4()
+// Family returns the netlink address family of the given IP address
+// (netlink.FAMILY_V4 or netlink.FAMILY_V6).
+func Family(ip net.IP) int {
+	if ip.To4() != nil {
+		return netlink.FAMILY_V4
+	}
 
-	// Both must be valid IPv4 addresses
-	if ip1 == nil || ip2 == nil {
-		return false
+	return netlink.FAMILY_V6
+}
+
+// normalizeIP returns the 4-byte representation of IPv4 addresses, and the 16-byte representation of
+// IPv6 addresses. The returned slice shares its backing array with the provided IP.
+func normalizeIP(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
 	}
 
-	for i := range ip1 {
-		if ip1[i] == ip2[i] {
-			continue
-		}
+	return ip.To16()
+}
 
-		return ip1[i] > ip2[i]
+// IsIPGreater returns true if ip1 is greater than ip2.
+// Both IPs must be valid addresses of the same family (IPv4 or IPv6).
+func IsIPGreater(ip1, ip2 net.IP) bool {
+	ip1 = normalizeIP(ip1)
+	ip2 = normalizeIP(ip2)
+
+	// Both must be valid addresses of the same family
+	if ip1 == nil || ip2 == nil || len(ip1) != len(ip2) {
+		return false
 	}
 
-	return false // They are equal
+	return bytes.Compare(ip1, ip2) > 0
 }
 
-// IncrementIP increments the given IPv4 address by 1.
+// IncrementIP increments the given IPv4 or IPv6 address by 1.
 // The function modifies the IP in place.
 // Returns an error if the IP would overflow (e.g., 255.255.255.255 -> 0.0.0.0).
-// For example, `192.168.1.1` becomes `192.168.1.2`.
+// For example, `192.168.1.1` becomes `192.168.1.2`, and `2001:db8::ff` becomes `2001:db8::100`.
 func IncrementIP(ip net.IP) error {
-	// Convert to IPv4 representation
-	ip = ip.To4()
+	ip = normalizeIP(ip)
 	if ip == nil {
-		return fmt.Errorf("invalid IPv4 address")
+		return fmt.Errorf("invalid IP address")
 	}
 
-	// Check for maximum IPv4 address
-	if ip.Equal(net.IPv4bcast) {
-		return fmt.Errorf("IP address overflow: maximum IPv4 address reached")
+	// Check for the maximum address of the family
+	overflow := true
+	for _, b := range ip {
+		if b != 0xff {
+			overflow = false
+			break
+		}
+	}
+	if overflow {
+		return fmt.Errorf("IP address overflow: maximum address reached")
 	}
 
 	// Increment from least significant byte
@@ -60,6 +79,63 @@ func IncrementIP(ip net.IP) error {
 	return nil
 }
 
+// ParseAddressRange parses a single IP address (`192.168.1.1`), a CIDR (`192.168.1.0/24`), or an inclusive range
+// (`192.168.1.10-192.168.1.20`), and returns the first and last addresses that it covers.
+// For IPv4 CIDRs larger than a /31, the network and broadcast addresses are excluded.
+func ParseAddressRange(s string) (first, last net.IP, err error) {
+	s = strings.TrimSpace(s)
+
+	if startStr, endStr, ok := strings.Cut(s, "-"); ok {
+		first = normalizeIP(net.ParseIP(strings.TrimSpace(startStr)))
+		if first == nil {
+			return nil, nil, fmt.Errorf("invalid range start IP: %s", startStr)
+		}
+
+		last = normalizeIP(net.ParseIP(strings.TrimSpace(endStr)))
+		if last == nil {
+			return nil, nil, fmt.Errorf("invalid range end IP: %s", endStr)
+		}
+
+		if Family(first) != Family(last) {
+			return nil, nil, fmt.Errorf("range start IP %s and end IP %s are not of the same IP family", startStr, endStr)
+		}
+
+		if IsIPGreater(first, last) {
+			return nil, nil, fmt.Errorf("range start IP %s is greater than end IP %s", startStr, endStr)
+		}
+
+		return first, last, nil
+	}
+
+	if strings.Contains(s, "/") {
+		_, network, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid CIDR: %w", err)
+		}
+
+		first = normalizeIP(network.IP)
+		last = make(net.IP, len(first))
+		for i := range first {
+			last[i] = first[i] | ^network.Mask[i]
+		}
+
+		// Skip the IPv4 network and broadcast addresses, which cannot be gateways
+		if ones, bits := network.Mask.Size(); bits == 32 && ones < 31 {
+			first[len(first)-1]++
+			last[len(last)-1]--
+		}
+
+		return first, last, nil
+	}
+
+	ip := normalizeIP(net.ParseIP(s))
+	if ip == nil {
+		return nil, nil, fmt.Errorf("invalid IP address: %s", s)
+	}
+
+	return ip, ip, nil
+}
+
 // ReduceNetworks reduces a slice of *net.IPNet networks into the smallest possible set.
 // This function:
 // 1. Removes duplicate networks
@@ -110,21 +186,24 @@ func ReduceNetworks(networks []*net.IPNet) []*net.IPNet {
 	return result
 }
 
-// sortNetworks sorts networks by IP address first, then by prefix length (longer prefixes first)
+// sortNetworks sorts networks by address family (IPv4 first), then by IP address, then by prefix
+// length (longer prefixes first)
 func sortNetworks(networks []*net.IPNet) {
 	sort.Slice(networks, func(i, j int) bool {
-		// First compare by IP address
-		iIP := networks[i].IP.To4()
-		jIP := networks[j].IP.To4()
+		// First compare by family, then by IP address
+		iIP := normalizeIP(networks[i].IP)
+		jIP := normalizeIP(networks[j].IP)
 
 		if iIP == nil || jIP == nil {
 			return false
 		}
 
-		for k := 0; k < 4; k++ {
-			if iIP[k] != jIP[k] {
-				return iIP[k] < jIP[k]
-			}
+		if len(iIP) != len(jIP) {
+			return len(iIP) < len(jIP)
+		}
+
+		if cmp := bytes.Compare(iIP, jIP); cmp != 0 {
+			return cmp < 0
 		}
 
 		// If IPs are equal, sort by prefix length (longer prefixes first)
@@ -248,23 +327,19 @@ func tryMergeNetworks(net1, net2 *net.IPNet) *net.IPNet {
 		return nil
 	}
 
-	// Must be IPv4 for simplicity
-	if bits1 != 32 {
-		return nil
-	}
-
 	// Calculate network addresses
-	ip1 := net1.IP.To4()
-	ip2 := net2.IP.To4()
-	if ip1 == nil || ip2 == nil {
+	ip1 := normalizeIP(net1.IP)
+	ip2 := normalizeIP(net2.IP)
+	if ip1 == nil || ip2 == nil || len(ip1)*8 != bits1 || len(ip2)*8 != bits2 {
 		return nil
 	}
 
 	// Apply masks to get network addresses
 	mask := net1.Mask
-	net1Addr := make(net.IP, 4)
-	net2Addr := make(net.IP, 4)
-	for i := 0; i < 4; i++ {
+	addrLen := len(ip1)
+	net1Addr := make(net.IP, addrLen)
+	net2Addr := make(net.IP, addrLen)
+	for i := 0; i < addrLen; i++ {
 		net1Addr[i] = ip1[i] & mask[i]
 		net2Addr[i] = ip2[i] & mask[i]
 	}
@@ -275,10 +350,10 @@ func tryMergeNetworks(net1, net2 *net.IPNet) *net.IPNet {
 	}
 
 	// Calculate the parent network (one bit less specific)
-	parentMask := net.CIDRMask(ones1-1, 32)
-	parentNet1 := make(net.IP, 4)
-	parentNet2 := make(net.IP, 4)
-	for i := 0; i < 4; i++ {
+	parentMask := net.CIDRMask(ones1-1, bits1)
+	parentNet1 := make(net.IP, addrLen)
+	parentNet2 := make(net.IP, addrLen)
+	for i := 0; i < addrLen; i++ {
 		parentNet1[i] = net1Addr[i] & parentMask[i]
 		parentNet2[i] = net2Addr[i] & parentMask[i]
 	}
@@ -327,7 +402,7 @@ func HasInterfaceWithIP(targetIP string) (bool, error) {
 	// Check each interface for addresses
 	addrListErrs := make([]error, 0, len(links))
 	for _, link := range links {
-		addrs, err := netlink.AddrList(link, netlink.FAMILY_V4)
+		addrs, err := netlink.AddrList(link, netlink.FAMILY_ALL)
 		if err != nil {
 			addrListErrs = append(addrListErrs, fmt.Errorf("failed to list addresses for interface %s: %w", link.Attrs().Name, err))
 			continue
@@ -342,3 +417,17 @@ func HasInterfaceWithIP(targetIP string) (bool, error) {
 
 	return false, errors.Join(addrListErrs...)
 }
+
+// LinkIndexOf returns the index of the link that traffic to the IP address is sent through
+func LinkIndexOf(ip net.IP) (int, error) {
+	routes, err := netlink.RouteGet(ip)
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up route to %s: %w", ip, err)
+	}
+
+	if len(routes) == 0 {
+		return 0, fmt.Errorf("no route to %s", ip)
+	}
+
+	return routes[0].LinkIndex, nil
+}
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
 )
 
 func TestIsIPGreater(t *testing.T) {
@@ -42,7 +43,18 @@ func TestIsIPGreater(t *testing.T) {
 			ip2:  "192.168.2.1",
 		},
 		{
-			name: "invalid IPv6 address should return false",
+			name:     "IPv6 - ip1 greater than ip2",
+			ip1:      "2001:db8::10",
+			ip2:      "2001:db8::1",
+			expected: true,
+		},
+		{
+			name: "IPv6 - ip1 less than ip2",
+			ip1:  "2001:db8::1",
+			ip2:  "2001:db8:0:1::",
+		},
+		{
+			name: "mixed address families should return false",
 			ip1:  "2001:db8::1",
 			ip2:  "192.168.1.1",
 		},
@@ -91,8 +103,18 @@ func TestIncrementIP(t *testing.T) {
 			errFunc: require.Error,
 		},
 		{
-			name:    "invalid IPv6 address should error",
-			input:   "2001:db8::1",
+			name:     "IPv6 simple increment",
+			input:    "2001:db8::1",
+			expected: "2001:db8::2",
+		},
+		{
+			name:     "IPv6 increment with carry",
+			input:    "2001:db8::ffff",
+			expected: "2001:db8::1:0",
+		},
+		{
+			name:    "IPv6 overflow should error",
+			input:   "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff",
 			errFunc: require.Error,
 		},
 	}
@@ -107,6 +129,9 @@ func TestIncrementIP(t *testing.T) {
 			err := IncrementIP(ip)
 
 			tt.errFunc(t, err)
+			if tt.expected != "" {
+				require.Equal(t, tt.expected, ip.String())
+			}
 		})
 	}
 }
@@ -252,6 +277,21 @@ func TestReduceNetworks(t *testing.T) {
 			input:    []string{"0.0.0.0/0", "10.0.0.0/8"},
 			expected: []string{"0.0.0.0/0"},
 		},
+		{
+			name:     "IPv6 adjacent network merging",
+			input:    []string{"2001:db8::/33", "2001:db8:8000::/33"},
+			expected: []string{"2001:db8::/32"},
+		},
+		{
+			name:     "IPv6 subset removal",
+			input:    []string{"fc00::/7", "fd00:1234::/32"},
+			expected: []string{"fc00::/7"},
+		},
+		{
+			name:     "mixed IPv4 and IPv6 networks",
+			input:    []string{"10.0.0.0/9", "10.128.0.0/9", "fe80::/10", "fe80::/64"},
+			expected: []string{"10.0.0.0/8", "fe80::/10"},
+		},
 		{
 			name:     "multiple layers of subsets and merges",
 			input:    []string{"10.0.0.0/24", "10.0.1.0/24", "10.0.2.0/24", "10.0.3.0/24", "10.0.4.0/22"},
@@ -389,6 +429,18 @@ func TestTryMergeNetworks(t *testing.T) {
 			net2:     "192.168.1.64/26",
 			expected: "",
 		},
+		{
+			name:     "adjacent IPv6 /128 networks",
+			net1:     "::/128",
+			net2:     "::1/128",
+			expected: "::/127",
+		},
+		{
+			name:     "different address families",
+			net1:     "0.0.0.0/1",
+			net2:     "8000::/1",
+			expected: "",
+		},
 		{
 			name:     "two /0 networks cannot merge",
 			net1:     "0.0.0.0/0",
@@ -413,3 +465,108 @@ func TestTryMergeNetworks(t *testing.T) {
 		})
 	}
 }
+
+func TestFamily(t *testing.T) {
+	require.Equal(t, netlink.FAMILY_V4, Family(parseIP(t, "192.168.1.1")))
+	require.Equal(t, netlink.FAMILY_V4, Family(net.IPv4(10, 0, 0, 1).To4()))
+	require.Equal(t, netlink.FAMILY_V6, Family(parseIP(t, "2001:db8::1")))
+	require.Equal(t, netlink.FAMILY_V6, Family(parseIP(t, "::")))
+}
+
+func TestParseAddressRange(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		expectedFirst string
+		expectedLast  string
+		errFunc       require.ErrorAssertionFunc
+	}{
+		{
+			name:          "single IPv4 address",
+			input:         "192.168.1.1",
+			expectedFirst: "192.168.1.1",
+			expectedLast:  "192.168.1.1",
+		},
+		{
+			name:          "single IPv6 address",
+			input:         "2001:db8::1",
+			expectedFirst: "2001:db8::1",
+			expectedLast:  "2001:db8::1",
+		},
+		{
+			name:          "IPv4 range",
+			input:         "192.168.1.10-192.168.1.20",
+			expectedFirst: "192.168.1.10",
+			expectedLast:  "192.168.1.20",
+		},
+		{
+			name:          "IPv6 range",
+			input:         "2001:db8::1-2001:db8::ff",
+			expectedFirst: "2001:db8::1",
+			expectedLast:  "2001:db8::ff",
+		},
+		{
+			name:          "IPv4 CIDR excludes network and broadcast addresses",
+			input:         "10.0.0.0/29",
+			expectedFirst: "10.0.0.1",
+			expectedLast:  "10.0.0.6",
+		},
+		{
+			name:          "IPv4 /31 CIDR",
+			input:         "10.0.0.0/31",
+			expectedFirst: "10.0.0.0",
+			expectedLast:  "10.0.0.1",
+		},
+		{
+			name:          "IPv4 /32 CIDR",
+			input:         "10.0.0.5/32",
+			expectedFirst: "10.0.0.5",
+			expectedLast:  "10.0.0.5",
+		},
+		{
+			name:          "IPv6 CIDR",
+			input:         "2001:db8::/126",
+			expectedFirst: "2001:db8::",
+			expectedLast:  "2001:db8::3",
+		},
+		{
+			name:    "invalid IP",
+			input:   "not-an-ip",
+			errFunc: require.Error,
+		},
+		{
+			name:    "invalid CIDR",
+			input:   "10.0.0.0/33",
+			errFunc: require.Error,
+		},
+		{
+			name:    "mixed family range",
+			input:   "10.0.0.1-2001:db8::1",
+			errFunc: require.Error,
+		},
+		{
+			name:    "reversed range",
+			input:   "10.0.0.20-10.0.0.10",
+			errFunc: require.Error,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, last, err := ParseAddressRange(tt.input)
+
+			errFunc := tt.errFunc
+			if errFunc == nil {
+				errFunc = require.NoError
+			}
+			errFunc(t, err)
+
+			if tt.errFunc != nil {
+				return
+			}
+
+			require.Equal(t, tt.expectedFirst, first.String())
+			require.Equal(t, tt.expectedLast, last.String())
+		})
+	}
+}
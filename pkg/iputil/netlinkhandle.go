@@ -1,7 +1,12 @@
 package iputil
 
 import (
+	"fmt"
+
 	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
 )
 
 // netlinkHandle is an interface that abstracts the netlink.Handle methods used in this package.
@@ -13,6 +18,9 @@ type NetlinkHandle interface {
 	RouteReplace(route *netlink.Route) error
 	RouteDel(route *netlink.Route) error
 
+	// Links
+	LinkByName(name string) (netlink.Link, error)
+
 	// Rules
 	RuleList(family int) ([]netlink.Rule, error)
 	RuleAdd(rule *netlink.Rule) error
@@ -30,5 +38,25 @@ func NewRealNetlinkHandle() NetlinkHandle {
 	// Using an empty handle seems to work fine, and is what the netlink package uses internally when no
 	// specific handle is provided.
 	// TODO file a bug report with the netlink package about this issue
-	return &netlink.Handle{}
+	return &realNetlinkHandle{Handle: &netlink.Handle{}}
+}
+
+// NewRealNetlinkHandleAt returns a handle that manages the network namespace, instead of the network namespace of the
+// calling thread
+func NewRealNetlinkHandleAt(ns netns.NsHandle) (NetlinkHandle, error) {
+	handle, err := netlink.NewHandleAt(ns, unix.NETLINK_ROUTE)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create netlink handle: %w", err)
+	}
+
+	socket, err := nl.GetNetlinkSocketAt(ns, netns.None(), unix.NETLINK_ROUTE)
+	if err != nil {
+		handle.Close()
+		return nil, fmt.Errorf("failed to create netlink socket: %w", err)
+	}
+
+	return &realNetlinkHandle{
+		Handle:  handle,
+		sockets: map[int]*nl.SocketHandle{unix.NETLINK_ROUTE: {Socket: socket}},
+	}, nil
 }
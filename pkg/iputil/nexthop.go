@@ -0,0 +1,424 @@
+package iputil
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"unsafe"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+// Netlink values for nexthop objects that are not defined by the unix package
+const (
+	rtaNexthopID = 30 // RTA_NH_ID
+
+	nhaResGroup        = 12 // NHA_RES_GROUP
+	nhaResGroupBuckets = 1  // NHA_RES_GROUP_BUCKETS
+
+	nexthopGroupTypeMultipath = 0 // NEXTHOP_GRP_TYPE_MPATH
+	nexthopGroupTypeResilient = 1 // NEXTHOP_GRP_TYPE_RES
+
+	nexthopMsgSize        = int(unsafe.Sizeof(unix.Nhmsg{}))
+	nexthopGroupEntrySize = int(unsafe.Sizeof(unix.NexthopGrp{}))
+)
+
+// NexthopObject is a kernel nexthop object (see ip-nexthop(8)). It is either a single gateway, or a group of other
+// nexthop objects that routes are balanced across. Changing a group changes every route that uses it at once.
+type NexthopObject struct {
+	ID uint32
+
+	// Address family of the gateway. The kernel does not store the family of groups, so it is zero for groups that
+	// are listed.
+	Family int
+
+	// Gateway nexthops
+	Gateway   net.IP
+	LinkIndex int // The kernel requires the interface of gateway nexthops
+	OnLink    bool
+
+	// Group nexthops
+	Group []NexthopGroupMember
+	// Number of buckets of a resilient group, which only moves the flows of members that are added or removed.
+	// Zero for a plain group, which may move any flow when the members change.
+	Buckets uint16
+}
+
+// NexthopGroupMember is a gateway nexthop in a group
+type NexthopGroupMember struct {
+	ID     uint32
+	Weight int // Relative share of the traffic, between 1 and 256
+}
+
+// IsGroup returns whether the nexthop is a group of other nexthops
+func (n NexthopObject) IsGroup() bool {
+	return len(n.Group) > 0
+}
+
+func (n NexthopObject) String() string {
+	if n.IsGroup() {
+		members := make([]string, 0, len(n.Group))
+		for _, member := range n.Group {
+			members = append(members, fmt.Sprintf("%d,%d", member.ID, member.Weight))
+		}
+
+		description := fmt.Sprintf("id %d group %s", n.ID, strings.Join(members, "/"))
+		if n.Buckets != 0 {
+			description += fmt.Sprintf(" type resilient buckets %d", n.Buckets)
+		}
+		return description
+	}
+
+	description := fmt.Sprintf("id %d via %s dev %d", n.ID, n.Gateway, n.LinkIndex)
+	if n.OnLink {
+		description += " onlink"
+	}
+	return description
+}
+
+// Equal returns whether both nexthops have the same attributes. The order of group members does not matter.
+func (n NexthopObject) Equal(other NexthopObject) bool {
+	if n.IsGroup() || other.IsGroup() {
+		sortedMembers := func(members []NexthopGroupMember) []NexthopGroupMember {
+			sorted := slices.Clone(members)
+			slices.SortFunc(sorted, func(a, b NexthopGroupMember) int { return int(a.ID) - int(b.ID) })
+			return sorted
+		}
+
+		return n.ID == other.ID && n.Buckets == other.Buckets && slices.Equal(sortedMembers(n.Group), sortedMembers(other.Group))
+	}
+
+	return n.ID == other.ID &&
+		n.Family == other.Family &&
+		n.Gateway.Equal(other.Gateway) &&
+		n.LinkIndex == other.LinkIndex &&
+		n.OnLink == other.OnLink
+}
+
+// NexthopRoute is a route that sends traffic via a nexthop object
+type NexthopRoute struct {
+	Dst       *net.IPNet
+	Table     int
+	Src       net.IP // Preferred source address. Optional.
+	NexthopID uint32
+}
+
+func (r NexthopRoute) String() string {
+	description := fmt.Sprintf("%s nhid %d table %d", r.Dst, r.NexthopID, r.Table)
+	if r.Src != nil {
+		description += " src " + r.Src.String()
+	}
+	return description
+}
+
+// NexthopHandle manages nexthop objects and the routes that use them. The netlink package does not support these, so
+// they are implemented with raw netlink messages.
+type NexthopHandle interface {
+	NexthopList() ([]NexthopObject, error)
+	// NexthopReplace adds the nexthop, or replaces the nexthop with the same ID
+	NexthopReplace(nexthop *NexthopObject) error
+	// NexthopDel deletes the nexthop. The kernel also deletes routes that use it, and removes it from groups.
+	NexthopDel(id uint32) error
+
+	// NexthopRouteList returns the routes of the address family in the table. Routes that do not use a nexthop
+	// object have a zero NexthopID.
+	NexthopRouteList(family, table int) ([]NexthopRoute, error)
+	NexthopRouteReplace(route *NexthopRoute) error
+}
+
+// nexthopMsg is struct nhmsg, which precedes the attributes of nexthop messages
+type nexthopMsg struct {
+	unix.Nhmsg
+}
+
+func (msg *nexthopMsg) Len() int {
+	return nexthopMsgSize
+}
+
+func (msg *nexthopMsg) Serialize() []byte {
+	return (*(*[nexthopMsgSize]byte)(unsafe.Pointer(msg)))[:]
+}
+
+func uint16Attr(attrType int, value uint16) *nl.RtAttr {
+	return nl.NewRtAttr(attrType, binary.NativeEndian.AppendUint16(nil, value))
+}
+
+func uint32Attr(attrType int, value uint32) *nl.RtAttr {
+	return nl.NewRtAttr(attrType, binary.NativeEndian.AppendUint32(nil, value))
+}
+
+// familyIP returns the address in the representation of the address family
+func familyIP(ip net.IP, family int) []byte {
+	if family == netlink.FAMILY_V4 {
+		return ip.To4()
+	}
+
+	return ip.To16()
+}
+
+// nexthopRequestData returns the message body that adds or replaces the nexthop
+func nexthopRequestData(nexthop *NexthopObject) []nl.NetlinkRequestData {
+	msg := &nexthopMsg{}
+	data := []nl.NetlinkRequestData{msg, uint32Attr(unix.NHA_ID, nexthop.ID)}
+
+	if !nexthop.IsGroup() {
+		msg.Family = uint8(nexthop.Family)
+		if nexthop.OnLink {
+			msg.Flags |= unix.RTNH_F_ONLINK
+		}
+
+		return append(data,
+			uint32Attr(unix.NHA_OIF, uint32(nexthop.LinkIndex)),
+			nl.NewRtAttr(unix.NHA_GATEWAY, familyIP(nexthop.Gateway, nexthop.Family)))
+	}
+
+	// The kernel stores weights minus one, like the hop count of multipath routes
+	group := make([]byte, 0, len(nexthop.Group)*nexthopGroupEntrySize)
+	for _, member := range nexthop.Group {
+		entry := unix.NexthopGrp{Id: member.ID, Weight: uint8(member.Weight - 1)}
+		group = append(group, (*(*[nexthopGroupEntrySize]byte)(unsafe.Pointer(&entry)))[:]...)
+	}
+	data = append(data, nl.NewRtAttr(unix.NHA_GROUP, group))
+
+	if nexthop.Buckets == 0 {
+		return append(data, uint16Attr(unix.NHA_GROUP_TYPE, nexthopGroupTypeMultipath))
+	}
+
+	resilient := nl.NewRtAttr(nhaResGroup|unix.NLA_F_NESTED, nil)
+	resilient.AddChild(uint16Attr(nhaResGroupBuckets, nexthop.Buckets))
+	return append(data, uint16Attr(unix.NHA_GROUP_TYPE, nexthopGroupTypeResilient), resilient)
+}
+
+// parseNexthop parses a nexthop message sent by the kernel
+func parseNexthop(msg []byte) (NexthopObject, error) {
+	if len(msg) < nexthopMsgSize {
+		return NexthopObject{}, fmt.Errorf("nexthop message too short: %d bytes", len(msg))
+	}
+
+	header := (*unix.Nhmsg)(unsafe.Pointer(&msg[0]))
+	nexthop := NexthopObject{
+		Family: int(header.Family),
+		OnLink: header.Flags&unix.RTNH_F_ONLINK != 0,
+	}
+
+	attrs, err := nl.ParseRouteAttr(msg[nexthopMsgSize:])
+	if err != nil {
+		return NexthopObject{}, fmt.Errorf("failed to parse nexthop attributes: %w", err)
+	}
+
+	for _, attr := range attrs {
+		switch attr.Attr.Type & nl.NLA_TYPE_MASK {
+		case unix.NHA_ID:
+			nexthop.ID = binary.NativeEndian.Uint32(attr.Value)
+		case unix.NHA_OIF:
+			nexthop.LinkIndex = int(binary.NativeEndian.Uint32(attr.Value))
+		case unix.NHA_GATEWAY:
+			nexthop.Gateway = net.IP(attr.Value)
+		case unix.NHA_GROUP:
+			for entry := range slices.Chunk(attr.Value, nexthopGroupEntrySize) {
+				if len(entry) < nexthopGroupEntrySize {
+					return NexthopObject{}, fmt.Errorf("nexthop group entry too short: %d bytes", len(entry))
+				}
+
+				member := (*unix.NexthopGrp)(unsafe.Pointer(&entry[0]))
+				nexthop.Group = append(nexthop.Group, NexthopGroupMember{ID: member.Id, Weight: int(member.Weight) + 1})
+			}
+		case nhaResGroup:
+			resilientAttrs, err := nl.ParseRouteAttr(attr.Value)
+			if err != nil {
+				return NexthopObject{}, fmt.Errorf("failed to parse resilient group attributes: %w", err)
+			}
+
+			for _, resilientAttr := range resilientAttrs {
+				if resilientAttr.Attr.Type&nl.NLA_TYPE_MASK == nhaResGroupBuckets {
+					nexthop.Buckets = binary.NativeEndian.Uint16(resilientAttr.Value)
+				}
+			}
+		}
+	}
+
+	return nexthop, nil
+}
+
+// nexthopRouteRequestData returns the message body that adds or replaces the route
+func nexthopRouteRequestData(route *NexthopRoute) []nl.NetlinkRequestData {
+	family := Family(route.Dst.IP)
+	prefixLength, _ := route.Dst.Mask.Size()
+
+	msg := nl.NewRtMsg()
+	msg.Family = uint8(family)
+	msg.Dst_len = uint8(prefixLength)
+	msg.Table = unix.RT_TABLE_UNSPEC
+	if route.Table < 256 {
+		msg.Table = uint8(route.Table)
+	}
+
+	data := []nl.NetlinkRequestData{
+		msg,
+		nl.NewRtAttr(unix.RTA_DST, familyIP(route.Dst.IP, family)),
+		uint32Attr(unix.RTA_TABLE, uint32(route.Table)),
+		uint32Attr(rtaNexthopID, route.NexthopID),
+	}
+	if route.Src != nil {
+		data = append(data, nl.NewRtAttr(unix.RTA_PREFSRC, familyIP(route.Src, family)))
+	}
+
+	return data
+}
+
+// parseNexthopRoute parses a route message sent by the kernel
+func parseNexthopRoute(msg []byte) (NexthopRoute, error) {
+	if len(msg) < unix.SizeofRtMsg {
+		return NexthopRoute{}, fmt.Errorf("route message too short: %d bytes", len(msg))
+	}
+
+	header := nl.DeserializeRtMsg(msg)
+	addressLength := net.IPv4len
+	if header.Family == unix.AF_INET6 {
+		addressLength = net.IPv6len
+	}
+
+	route := NexthopRoute{
+		// Default routes do not have a destination attribute
+		Dst: &net.IPNet{
+			IP:   make(net.IP, addressLength),
+			Mask: net.CIDRMask(int(header.Dst_len), addressLength*8),
+		},
+		Table: int(header.Table),
+	}
+
+	attrs, err := nl.ParseRouteAttr(msg[unix.SizeofRtMsg:])
+	if err != nil {
+		return NexthopRoute{}, fmt.Errorf("failed to parse route attributes: %w", err)
+	}
+
+	for _, attr := range attrs {
+		switch attr.Attr.Type {
+		case unix.RTA_DST:
+			route.Dst.IP = net.IP(attr.Value)
+		case unix.RTA_TABLE:
+			route.Table = int(binary.NativeEndian.Uint32(attr.Value))
+		case unix.RTA_PREFSRC:
+			route.Src = net.IP(attr.Value)
+		case rtaNexthopID:
+			route.NexthopID = binary.NativeEndian.Uint32(attr.Value)
+		}
+	}
+
+	return route, nil
+}
+
+// realNetlinkHandle is the netlink package handle, extended with support for nexthop objects
+type realNetlinkHandle struct {
+	*netlink.Handle
+	// Sockets that requests which the netlink package does not support are sent with. These are opened in the same
+	// network namespace as the sockets of the handle. Nil to use the netlink package sockets, like an empty handle.
+	sockets map[int]*nl.SocketHandle
+}
+
+var _ NexthopHandle = (*realNetlinkHandle)(nil)
+
+// newRequest creates a request that is sent with the sockets of the handle
+func (h *realNetlinkHandle) newRequest(proto, flags int) *nl.NetlinkRequest {
+	if h.sockets == nil {
+		return nl.NewNetlinkRequest(proto, flags)
+	}
+
+	return &nl.NetlinkRequest{
+		NlMsghdr: unix.NlMsghdr{
+			Len:   uint32(unix.SizeofNlMsghdr),
+			Type:  uint16(proto),
+			Flags: unix.NLM_F_REQUEST | uint16(flags),
+		},
+		Sockets: h.sockets,
+	}
+}
+
+func (h *realNetlinkHandle) Close() {
+	h.Handle.Close()
+	for _, socket := range h.sockets {
+		socket.Close()
+	}
+	h.sockets = nil
+}
+
+func (h *realNetlinkHandle) NexthopList() ([]NexthopObject, error) {
+	req := h.newRequest(unix.RTM_GETNEXTHOP, unix.NLM_F_DUMP)
+	req.AddData(&nexthopMsg{})
+
+	msgs, err := req.Execute(unix.NETLINK_ROUTE, unix.RTM_NEWNEXTHOP)
+	if err != nil {
+		return nil, err
+	}
+
+	nexthops := make([]NexthopObject, 0, len(msgs))
+	for _, msg := range msgs {
+		nexthop, err := parseNexthop(msg)
+		if err != nil {
+			return nil, err
+		}
+		nexthops = append(nexthops, nexthop)
+	}
+
+	return nexthops, nil
+}
+
+func (h *realNetlinkHandle) NexthopReplace(nexthop *NexthopObject) error {
+	req := h.newRequest(unix.RTM_NEWNEXTHOP, unix.NLM_F_CREATE|unix.NLM_F_REPLACE|unix.NLM_F_ACK)
+	for _, data := range nexthopRequestData(nexthop) {
+		req.AddData(data)
+	}
+
+	_, err := req.Execute(unix.NETLINK_ROUTE, 0)
+	return err
+}
+
+func (h *realNetlinkHandle) NexthopDel(id uint32) error {
+	req := h.newRequest(unix.RTM_DELNEXTHOP, unix.NLM_F_ACK)
+	req.AddData(&nexthopMsg{})
+	req.AddData(uint32Attr(unix.NHA_ID, id))
+
+	_, err := req.Execute(unix.NETLINK_ROUTE, 0)
+	return err
+}
+
+func (h *realNetlinkHandle) NexthopRouteList(family, table int) ([]NexthopRoute, error) {
+	req := h.newRequest(unix.RTM_GETROUTE, unix.NLM_F_DUMP)
+	msg := nl.NewRtMsg()
+	msg.Family = uint8(family)
+	req.AddData(msg)
+
+	var routes []NexthopRoute
+	var parseErr error
+	err := req.ExecuteIter(unix.NETLINK_ROUTE, unix.RTM_NEWROUTE, func(msg []byte) bool {
+		route, err := parseNexthopRoute(msg)
+		if err != nil {
+			parseErr = err
+			return false
+		}
+
+		if route.Table == table {
+			routes = append(routes, route)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return routes, parseErr
+}
+
+func (h *realNetlinkHandle) NexthopRouteReplace(route *NexthopRoute) error {
+	req := h.newRequest(unix.RTM_NEWROUTE, unix.NLM_F_CREATE|unix.NLM_F_REPLACE|unix.NLM_F_ACK)
+	for _, data := range nexthopRouteRequestData(route) {
+		req.AddData(data)
+	}
+
+	_, err := req.Execute(unix.NETLINK_ROUTE, 0)
+	return err
+}
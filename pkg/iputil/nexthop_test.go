@@ -0,0 +1,108 @@
+package iputil
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+)
+
+// serialize builds a message from request data, as the kernel would send it back
+func serialize(data []nl.NetlinkRequestData) []byte {
+	var msg []byte
+	for _, part := range data {
+		msg = append(msg, part.Serialize()...)
+	}
+
+	return msg
+}
+
+func TestNexthopMessages(t *testing.T) {
+	tests := []struct {
+		name    string
+		nexthop NexthopObject
+	}{
+		{
+			name:    "IPv4 gateway",
+			nexthop: NexthopObject{ID: 1, Family: netlink.FAMILY_V4, Gateway: net.ParseIP("192.168.1.1").To4(), LinkIndex: 2},
+		},
+		{
+			name:    "IPv6 onlink gateway",
+			nexthop: NexthopObject{ID: 2, Family: netlink.FAMILY_V6, Gateway: net.ParseIP("fd00::1"), LinkIndex: 3, OnLink: true},
+		},
+		{
+			name:    "group",
+			nexthop: NexthopObject{ID: 3, Group: []NexthopGroupMember{{ID: 1, Weight: 1}, {ID: 2, Weight: 256}}},
+		},
+		{
+			name:    "resilient group",
+			nexthop: NexthopObject{ID: 4, Group: []NexthopGroupMember{{ID: 1, Weight: 10}}, Buckets: 128},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := parseNexthop(serialize(nexthopRequestData(&tt.nexthop)))
+			require.NoError(t, err)
+			assert.Equal(t, tt.nexthop, parsed)
+			assert.True(t, tt.nexthop.Equal(parsed))
+		})
+	}
+
+	_, err := parseNexthop([]byte{0})
+	assert.Error(t, err)
+}
+
+func TestNexthopRouteMessages(t *testing.T) {
+	tests := []struct {
+		name  string
+		route NexthopRoute
+	}{
+		{
+			name:  "IPv4 default route",
+			route: NexthopRoute{Dst: &net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)}, Table: 180, NexthopID: 3},
+		},
+		{
+			name: "IPv6 route with source in large table",
+			route: NexthopRoute{
+				Dst:       &net.IPNet{IP: net.ParseIP("fd00:1::"), Mask: net.CIDRMask(64, 128)},
+				Table:     1000,
+				Src:       net.ParseIP("fd00::2"),
+				NexthopID: 4,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := parseNexthopRoute(serialize(nexthopRouteRequestData(&tt.route)))
+			require.NoError(t, err)
+			assert.Equal(t, tt.route, parsed)
+		})
+	}
+}
+
+func TestNexthopObject_Equal(t *testing.T) {
+	group := NexthopObject{ID: 3, Group: []NexthopGroupMember{{ID: 1, Weight: 1}, {ID: 2, Weight: 2}}}
+
+	reordered := group
+	reordered.Group = []NexthopGroupMember{{ID: 2, Weight: 2}, {ID: 1, Weight: 1}}
+	assert.True(t, group.Equal(reordered))
+
+	reweighted := group
+	reweighted.Group = []NexthopGroupMember{{ID: 1, Weight: 1}, {ID: 2, Weight: 3}}
+	assert.False(t, group.Equal(reweighted))
+
+	resilient := group
+	resilient.Buckets = 64
+	assert.False(t, group.Equal(resilient))
+
+	gateway := NexthopObject{ID: 1, Family: netlink.FAMILY_V4, Gateway: net.ParseIP("192.168.1.1"), LinkIndex: 2}
+	moved := gateway
+	moved.LinkIndex = 3
+	assert.False(t, gateway.Equal(moved))
+	assert.False(t, gateway.Equal(group))
+}
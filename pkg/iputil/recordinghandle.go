@@ -0,0 +1,360 @@
+package iputil
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// Maximum number of operations kept by a RecordingNetlinkHandle. The oldest operations are dropped first.
+const maxRecordedOperations = 1000
+
+// Operation is a change to the kernel networking state that was recorded instead of being applied
+type Operation struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"` // What would have been done, such as "route replace" or "rule add"
+	Object string    `json:"object"` // The object that the action applies to, such as the route
+}
+
+// RecordingNetlinkHandle is a NetlinkHandle that records changes instead of applying them, for dry runs. Reads are
+// passed through to the wrapped handle, with the recorded changes applied on top, so that the planned changes are
+// based on the actual kernel state and each change is only planned once. The latest change of each rule, route and
+// nexthop is kept, so the recorded operations are the changes that are pending. They are logged, and served as JSON
+// over HTTP.
+type RecordingNetlinkHandle struct {
+	handle NetlinkHandle
+
+	mu         sync.Mutex
+	operations []recordedOperation
+	rules      map[string]*netlink.Rule  // Recorded rules by ruleKey. Deleted rules are nil.
+	routes     map[string]recordedRoute  // Recorded routes by routeKey
+	nexthops   map[uint32]*NexthopObject // Recorded nexthops by ID. Deleted nexthops are nil.
+}
+
+// recordedOperation is an operation with the key of the object that it changes. Each key has a single operation.
+type recordedOperation struct {
+	Operation
+	key string
+}
+
+// recordedRoute is a recorded route, which uses either gateways or a nexthop group. Deleted routes have neither.
+type recordedRoute struct {
+	route        *netlink.Route
+	nexthopRoute *NexthopRoute
+}
+
+// routeKey identifies a route by its table and destination, as the route manager does
+func routeKey(table int, destination *net.IPNet) string {
+	if table == 0 {
+		table = unix.RT_TABLE_MAIN
+	}
+
+	return fmt.Sprintf("route %d %s", table, destination)
+}
+
+// ruleKey identifies a rule by the attributes that the route manager sets
+func ruleKey(rule *netlink.Rule) string {
+	var mask uint32
+	if rule.Mask != nil {
+		mask = *rule.Mask
+	}
+
+	return fmt.Sprintf("rule %d family %d from %s to %s fwmark %#x/%#x table %d goto %d", rule.Priority, rule.Family,
+		rule.Src, rule.Dst, rule.Mark, mask, rule.Table, rule.Goto)
+}
+
+var _ NetlinkHandle = (*RecordingNetlinkHandle)(nil)
+var _ NexthopHandle = (*RecordingNetlinkHandle)(nil)
+var _ http.Handler = (*RecordingNetlinkHandle)(nil)
+
+// NewRecordingNetlinkHandle creates a handle that reads the kernel state via the provided handle, and records all
+// changes
+func NewRecordingNetlinkHandle(handle NetlinkHandle) *RecordingNetlinkHandle {
+	return &RecordingNetlinkHandle{
+		handle:   handle,
+		rules:    make(map[string]*netlink.Rule),
+		routes:   make(map[string]recordedRoute),
+		nexthops: make(map[uint32]*NexthopObject),
+	}
+}
+
+// Record records an operation that was not applied. This can be used to add changes that are not made via netlink
+// to the report. The same operation is only kept once.
+func (h *RecordingNetlinkHandle) Record(action, object string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.record(action+" "+object, action, object)
+}
+
+// record records an operation that replaces the earlier operation with the same key. The caller must hold the lock.
+func (h *RecordingNetlinkHandle) record(key, action, object string) {
+	slog.Info("Dry run, skipping operation", "action", action, "object", object)
+
+	h.operations = slices.DeleteFunc(h.operations, func(operation recordedOperation) bool { return operation.key == key })
+	if len(h.operations) >= maxRecordedOperations {
+		h.operations = h.operations[len(h.operations)-maxRecordedOperations+1:]
+	}
+	h.operations = append(h.operations, recordedOperation{
+		Operation: Operation{Time: time.Now(), Action: action, Object: object},
+		key:       key,
+	})
+}
+
+// Operations returns the recorded operations, oldest first
+func (h *RecordingNetlinkHandle) Operations() []Operation {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	operations := make([]Operation, 0, len(h.operations))
+	for _, operation := range h.operations {
+		operations = append(operations, operation.Operation)
+	}
+	return operations
+}
+
+// ServeHTTP writes the recorded operations as a JSON array
+func (h *RecordingNetlinkHandle) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.Operations()); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to write planned changes", "error", err)
+	}
+}
+
+// RouteListFilteredIter lists the routes of the wrapped handle, with the recorded routes applied. Only the table of
+// the filter is applied to the recorded routes.
+func (h *RecordingNetlinkHandle) RouteListFilteredIter(family int, filter *netlink.Route, filterMask uint64, f func(netlink.Route) (cont bool)) error {
+	h.mu.Lock()
+	recordedRoutes := maps.Clone(h.routes)
+	h.mu.Unlock()
+
+	stopped := false
+	err := h.handle.RouteListFilteredIter(family, filter, filterMask, func(route netlink.Route) bool {
+		if _, ok := recordedRoutes[routeKey(route.Table, route.Dst)]; ok {
+			return true
+		}
+
+		stopped = !f(route)
+		return !stopped
+	})
+	if err != nil || stopped {
+		return err
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(recordedRoutes)) {
+		recorded := recordedRoutes[key]
+
+		var route netlink.Route
+		switch {
+		case recorded.route != nil:
+			route = *recorded.route
+		case recorded.nexthopRoute != nil:
+			// Routes that use nexthop groups are listed without their gateways, like the kernel does
+			route = netlink.Route{Dst: recorded.nexthopRoute.Dst, Table: recorded.nexthopRoute.Table, Src: recorded.nexthopRoute.Src}
+		default:
+			continue
+		}
+
+		if family != netlink.FAMILY_ALL && Family(route.Dst.IP) != family {
+			continue
+		}
+		if filter != nil && filterMask&netlink.RT_FILTER_TABLE != 0 && route.Table != filter.Table {
+			continue
+		}
+
+		if !f(route) {
+			break
+		}
+	}
+
+	return nil
+}
+
+func (h *RecordingNetlinkHandle) RouteReplace(route *netlink.Route) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	recorded := *route
+	key := routeKey(route.Table, route.Dst)
+	h.routes[key] = recordedRoute{route: &recorded}
+	h.record(key, "route replace", route.String())
+	return nil
+}
+
+func (h *RecordingNetlinkHandle) RouteDel(route *netlink.Route) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := routeKey(route.Table, route.Dst)
+	h.routes[key] = recordedRoute{}
+	h.record(key, "route delete", route.String())
+	return nil
+}
+
+func (h *RecordingNetlinkHandle) LinkByName(name string) (netlink.Link, error) {
+	return h.handle.LinkByName(name)
+}
+
+// RuleList lists the rules of the wrapped handle, with the recorded rules applied
+func (h *RecordingNetlinkHandle) RuleList(family int) ([]netlink.Rule, error) {
+	rules, err := h.handle.RuleList(family)
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	rules = slices.DeleteFunc(rules, func(rule netlink.Rule) bool {
+		_, ok := h.rules[ruleKey(&rule)]
+		return ok
+	})
+	for _, key := range slices.Sorted(maps.Keys(h.rules)) {
+		if rule := h.rules[key]; rule != nil && (family == netlink.FAMILY_ALL || rule.Family == family) {
+			rules = append(rules, *rule)
+		}
+	}
+
+	return rules, nil
+}
+
+func (h *RecordingNetlinkHandle) RuleAdd(rule *netlink.Rule) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	recorded := *rule
+	key := ruleKey(rule)
+	h.rules[key] = &recorded
+	h.record(key, "rule add", rule.String())
+	return nil
+}
+
+func (h *RecordingNetlinkHandle) RuleDel(rule *netlink.Rule) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := ruleKey(rule)
+	h.rules[key] = nil
+	h.record(key, "rule delete", rule.String())
+	return nil
+}
+
+// nexthopHandle returns the wrapped handle if it supports nexthop objects
+func (h *RecordingNetlinkHandle) nexthopHandle() (NexthopHandle, error) {
+	handle, ok := h.handle.(NexthopHandle)
+	if !ok {
+		return nil, fmt.Errorf("handle does not support nexthop objects")
+	}
+
+	return handle, nil
+}
+
+// NexthopList lists the nexthops of the wrapped handle, with the recorded nexthops applied
+func (h *RecordingNetlinkHandle) NexthopList() ([]NexthopObject, error) {
+	handle, err := h.nexthopHandle()
+	if err != nil {
+		return nil, err
+	}
+
+	nexthops, err := handle.NexthopList()
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	nexthops = slices.DeleteFunc(nexthops, func(nexthop NexthopObject) bool {
+		_, ok := h.nexthops[nexthop.ID]
+		return ok
+	})
+	for _, id := range slices.Sorted(maps.Keys(h.nexthops)) {
+		if nexthop := h.nexthops[id]; nexthop != nil {
+			nexthops = append(nexthops, *nexthop)
+		}
+	}
+
+	return nexthops, nil
+}
+
+func (h *RecordingNetlinkHandle) NexthopReplace(nexthop *NexthopObject) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	recorded := *nexthop
+	h.nexthops[nexthop.ID] = &recorded
+	h.record(fmt.Sprintf("nexthop %d", nexthop.ID), "nexthop replace", nexthop.String())
+	return nil
+}
+
+func (h *RecordingNetlinkHandle) NexthopDel(id uint32) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.nexthops[id] = nil
+	h.record(fmt.Sprintf("nexthop %d", id), "nexthop delete", fmt.Sprintf("id %d", id))
+	return nil
+}
+
+// NexthopRouteList lists the routes of the wrapped handle, with the recorded routes applied
+func (h *RecordingNetlinkHandle) NexthopRouteList(family, table int) ([]NexthopRoute, error) {
+	handle, err := h.nexthopHandle()
+	if err != nil {
+		return nil, err
+	}
+
+	routes, err := handle.NexthopRouteList(family, table)
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	routes = slices.DeleteFunc(routes, func(route NexthopRoute) bool {
+		_, ok := h.routes[routeKey(route.Table, route.Dst)]
+		return ok
+	})
+	for _, key := range slices.Sorted(maps.Keys(h.routes)) {
+		var route NexthopRoute
+		switch recorded := h.routes[key]; {
+		case recorded.nexthopRoute != nil:
+			route = *recorded.nexthopRoute
+		case recorded.route != nil:
+			// Routes that use gateways are listed without a nexthop group
+			route = NexthopRoute{Dst: recorded.route.Dst, Table: recorded.route.Table, Src: recorded.route.Src}
+		default:
+			continue
+		}
+
+		if Family(route.Dst.IP) == family && route.Table == table {
+			routes = append(routes, route)
+		}
+	}
+
+	return routes, nil
+}
+
+func (h *RecordingNetlinkHandle) NexthopRouteReplace(route *NexthopRoute) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	recorded := *route
+	key := routeKey(route.Table, route.Dst)
+	h.routes[key] = recordedRoute{nexthopRoute: &recorded}
+	h.record(key, "route replace", route.String())
+	return nil
+}
+
+func (h *RecordingNetlinkHandle) Close() {
+	h.handle.Close()
+}
@@ -0,0 +1,208 @@
+package iputil
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+)
+
+var errKernelModified = errors.New("kernel modified")
+
+// readOnlyNetlinkHandle serves fixed kernel state, and fails all changes
+type readOnlyNetlinkHandle struct {
+	rules  []netlink.Rule
+	routes []netlink.Route
+	closed bool
+}
+
+func (h *readOnlyNetlinkHandle) RouteListFilteredIter(family int, filter *netlink.Route, filterMask uint64, f func(netlink.Route) (cont bool)) error {
+	for _, route := range h.routes {
+		if !f(route) {
+			break
+		}
+	}
+
+	return nil
+}
+
+func (h *readOnlyNetlinkHandle) RouteReplace(route *netlink.Route) error { return errKernelModified }
+func (h *readOnlyNetlinkHandle) RouteDel(route *netlink.Route) error     { return errKernelModified }
+func (h *readOnlyNetlinkHandle) LinkByName(name string) (netlink.Link, error) {
+	return &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: name, Index: 2}}, nil
+}
+func (h *readOnlyNetlinkHandle) RuleList(family int) ([]netlink.Rule, error) {
+	return h.rules, nil
+}
+func (h *readOnlyNetlinkHandle) RuleAdd(rule *netlink.Rule) error { return errKernelModified }
+func (h *readOnlyNetlinkHandle) RuleDel(rule *netlink.Rule) error { return errKernelModified }
+func (h *readOnlyNetlinkHandle) Close()                           { h.closed = true }
+
+func TestRecordingNetlinkHandle(t *testing.T) {
+	_, destination, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+
+	rule := netlink.NewRule()
+	rule.Table = 180
+	rule.Priority = 10888
+
+	wrapped := &readOnlyNetlinkHandle{
+		rules:  []netlink.Rule{*rule},
+		routes: []netlink.Route{{Dst: destination, Table: 180}},
+	}
+	handle := NewRecordingNetlinkHandle(wrapped)
+
+	// Reads are passed through
+	rules, err := handle.RuleList(netlink.FAMILY_V4)
+	require.NoError(t, err)
+	assert.Equal(t, wrapped.rules, rules)
+
+	var routes []netlink.Route
+	require.NoError(t, handle.RouteListFilteredIter(netlink.FAMILY_V4, nil, 0, func(route netlink.Route) bool {
+		routes = append(routes, route)
+		return true
+	}))
+	assert.Equal(t, wrapped.routes, routes)
+
+	// Changes are recorded instead of applied, and only the latest change of each object is kept
+	route := &netlink.Route{Dst: destination, Table: 180, Gw: net.ParseIP("192.168.1.1")}
+	require.NoError(t, handle.RuleAdd(rule))
+	require.NoError(t, handle.RouteReplace(route))
+	require.NoError(t, handle.RouteDel(route))
+	require.NoError(t, handle.RuleDel(rule))
+	handle.Record("nftables apply", "table inet test {}")
+	handle.Record("nftables apply", "table inet test {}")
+
+	operations := handle.Operations()
+	require.Len(t, operations, 3)
+	actions := make([]string, 0, len(operations))
+	for _, operation := range operations {
+		actions = append(actions, operation.Action)
+	}
+	assert.Equal(t, []string{"route delete", "rule delete", "nftables apply"}, actions)
+	assert.Equal(t, route.String(), operations[0].Object)
+
+	// Reads include the recorded changes
+	rules, err = handle.RuleList(netlink.FAMILY_V4)
+	require.NoError(t, err)
+	assert.Empty(t, rules)
+
+	routes = nil
+	require.NoError(t, handle.RouteListFilteredIter(netlink.FAMILY_V4, nil, 0, func(route netlink.Route) bool {
+		routes = append(routes, route)
+		return true
+	}))
+	assert.Empty(t, routes)
+
+	// The operations are served as JSON
+	recorder := httptest.NewRecorder()
+	handle.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/dry-run", nil))
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+
+	var served []Operation
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &served))
+	require.Len(t, served, 3)
+	assert.Equal(t, operations[2].Object, served[2].Object)
+
+	handle.Close()
+	assert.True(t, wrapped.closed)
+}
+
+func TestRecordingNetlinkHandle_Limit(t *testing.T) {
+	handle := NewRecordingNetlinkHandle(&readOnlyNetlinkHandle{})
+
+	for i := range maxRecordedOperations + 10 {
+		handle.Record("route replace", strconv.Itoa(i))
+	}
+	handle.Record("route delete", "last")
+
+	operations := handle.Operations()
+	require.Len(t, operations, maxRecordedOperations)
+	assert.Equal(t, "last", operations[len(operations)-1].Object)
+}
+
+func TestRecordingNetlinkHandle_Nexthops(t *testing.T) {
+	handle := NewRecordingNetlinkHandle(&readOnlyNetlinkHandle{})
+
+	// Reads fail if the wrapped handle does not support nexthop objects
+	_, err := handle.NexthopList()
+	assert.Error(t, err)
+
+	_, destination, err := net.ParseCIDR("0.0.0.0/0")
+	require.NoError(t, err)
+
+	nexthop := &NexthopObject{ID: 1, Family: netlink.FAMILY_V4, Gateway: net.ParseIP("192.168.1.1"), LinkIndex: 2}
+	route := &NexthopRoute{Dst: destination, Table: 180, NexthopID: 1}
+	require.NoError(t, handle.NexthopReplace(nexthop))
+	require.NoError(t, handle.NexthopRouteReplace(route))
+	require.NoError(t, handle.NexthopDel(1))
+
+	operations := handle.Operations()
+	require.Len(t, operations, 2)
+	assert.Equal(t, Operation{Time: operations[0].Time, Action: "route replace", Object: route.String()}, operations[0])
+	assert.Equal(t, Operation{Time: operations[1].Time, Action: "nexthop delete", Object: "id 1"}, operations[1])
+}
+
+// TestRecordingNetlinkHandle_PendingChanges tests that changes are compared against the recorded state, so that the
+// same change is not planned again on every update
+func TestRecordingNetlinkHandle_PendingChanges(t *testing.T) {
+	_, office, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+	_, other, err := net.ParseCIDR("172.16.0.0/12")
+	require.NoError(t, err)
+
+	rule := netlink.NewRule()
+	rule.Family = netlink.FAMILY_V4
+	rule.Table = 180
+	rule.Priority = 10888
+
+	kernelRoute := netlink.Route{Dst: office, Table: 180, Gw: net.ParseIP("192.168.1.1")}
+	otherRoute := netlink.Route{Dst: other, Table: 180, Gw: net.ParseIP("192.168.1.1")}
+	handle := NewRecordingNetlinkHandle(&readOnlyNetlinkHandle{routes: []netlink.Route{kernelRoute, otherRoute}})
+
+	listRoutes := func() []netlink.Route {
+		var routes []netlink.Route
+		require.NoError(t, handle.RouteListFilteredIter(netlink.FAMILY_V4, &netlink.Route{Table: 180}, netlink.RT_FILTER_TABLE, func(route netlink.Route) bool {
+			routes = append(routes, route)
+			return true
+		}))
+		return routes
+	}
+
+	// A recorded route replaces the kernel route when the routes are read
+	replacedRoute := netlink.Route{Dst: office, Table: 180, Gw: net.ParseIP("192.168.1.2")}
+	require.NoError(t, handle.RouteReplace(&replacedRoute))
+	assert.Equal(t, []netlink.Route{otherRoute, replacedRoute}, listRoutes())
+
+	// Replacing the route again only keeps the latest change
+	require.NoError(t, handle.RouteReplace(&replacedRoute))
+	require.NoError(t, handle.RuleAdd(rule))
+	operations := handle.Operations()
+	require.Len(t, operations, 2)
+	assert.Equal(t, replacedRoute.String(), operations[0].Object)
+	assert.Equal(t, "rule add", operations[1].Action)
+
+	rules, err := handle.RuleList(netlink.FAMILY_V4)
+	require.NoError(t, err)
+	assert.Equal(t, []netlink.Rule{*rule}, rules)
+
+	rules, err = handle.RuleList(netlink.FAMILY_V6)
+	require.NoError(t, err)
+	assert.Empty(t, rules)
+
+	// Recorded routes that use nexthop groups are listed without gateways
+	nexthopRoute := &NexthopRoute{Dst: office, Table: 180, NexthopID: 1}
+	require.NoError(t, handle.NexthopRouteReplace(nexthopRoute))
+	assert.Equal(t, []netlink.Route{otherRoute, {Dst: office, Table: 180}}, listRoutes())
+
+	operations = handle.Operations()
+	require.Len(t, operations, 2)
+	assert.Equal(t, nexthopRoute.String(), operations[1].Object)
+}
@@ -19,11 +19,25 @@ type Metrics struct {
 	HealthCheckDurationSeconds *prometheus.HistogramVec
 	ActiveGatewayCount         prometheus.Gauge
 	TotalGatewayCount          prometheus.Gauge
+	StateTransitionsTotal      *prometheus.CounterVec
+	SuppressedGateways         *prometheus.GaugeVec
+	FlapPenalty                *prometheus.GaugeVec
 
 	// Route Management Metrics
 	RouteUpdatesTotal          *prometheus.CounterVec
 	RouteUpdateDurationSeconds prometheus.Histogram
 	DefaultRouteGateways       prometheus.Gauge
+	GatewayWeight              *prometheus.GaugeVec
+	ActivePriorityTier         *prometheus.GaugeVec
+	PoolRoutedGateways         *prometheus.GaugeVec
+	PoolFallbackActive         *prometheus.GaugeVec
+	DriftEventsTotal           *prometheus.CounterVec
+	RouteWritesTotal           *prometheus.CounterVec
+
+	// Conntrack Metrics
+	ConntrackFlushesTotal         *prometheus.CounterVec
+	ConntrackFlushedEntriesTotal  prometheus.Counter
+	ConntrackFlushDurationSeconds prometheus.Histogram
 
 	// HTTP Client Metrics
 	HTTPRequestsTotal          *prometheus.CounterVec
@@ -35,8 +49,9 @@ type Metrics struct {
 	ApplicationUptimeSeconds  prometheus.Gauge
 
 	// Error Metrics
-	ErrorsTotal         *prometheus.CounterVec
-	ConsecutiveFailures *prometheus.GaugeVec
+	ErrorsTotal          *prometheus.CounterVec
+	ConsecutiveFailures  *prometheus.GaugeVec
+	ConsecutiveSuccesses *prometheus.GaugeVec
 
 	// Public IP Service Metrics
 	PublicIPFetchTotal           *prometheus.CounterVec
@@ -81,6 +96,27 @@ func New(registry prometheus.Registerer) (*Metrics, error) {
 				Help: "Total number of configured gateways",
 			},
 		),
+		StateTransitionsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "gateway_state_transitions_total",
+				Help: "Total number of gateway state changes",
+			},
+			[]string{"gateway_ip", "state"},
+		),
+		SuppressedGateways: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gateway_suppressed",
+				Help: "Whether a gateway is suppressed by flap damping (1) or not (0)",
+			},
+			[]string{"gateway_ip"},
+		),
+		FlapPenalty: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gateway_flap_penalty",
+				Help: "Current flap damping penalty per gateway",
+			},
+			[]string{"gateway_ip"},
+		),
 
 		// Route Management Metrics
 		RouteUpdatesTotal: prometheus.NewCounterVec(
@@ -103,6 +139,70 @@ func New(registry prometheus.Registerer) (*Metrics, error) {
 				Help: "Current number of gateways in the default route",
 			},
 		),
+		GatewayWeight: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gateway_route_weight",
+				Help: "Current ECMP weight of each gateway in the routes of each pool",
+			},
+			[]string{"gateway_ip", "pool"},
+		),
+		ActivePriorityTier: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "active_priority_tier",
+				Help: "Priority tier of the gateways that routes currently use, per pool and IP family",
+			},
+			[]string{"pool", "family"},
+		),
+		PoolRoutedGateways: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "pool_routed_gateways_count",
+				Help: "Number of gateways that the routes of each pool are currently sent via, per IP family",
+			},
+			[]string{"pool", "family"},
+		),
+		PoolFallbackActive: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "pool_fallback_active",
+				Help: "Whether the routes of each pool are currently sent via a fallback pool (1) or not (0), per IP family",
+			},
+			[]string{"pool", "family"},
+		),
+		DriftEventsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "drift_events_total",
+				Help: "Total number of differences between the kernel rules and routes and the desired state that were repaired, per IP family",
+			},
+			[]string{"kind", "family"},
+		),
+		RouteWritesTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "route_writes_total",
+				Help: "Total number of routes that were written to the kernel (applied) or already matched it (skipped) during route updates",
+			},
+			[]string{"result"},
+		),
+
+		// Conntrack Metrics
+		ConntrackFlushesTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "conntrack_flushes_total",
+				Help: "Total number of conntrack flushes after gateways were removed from the routes",
+			},
+			[]string{"status"},
+		),
+		ConntrackFlushedEntriesTotal: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "conntrack_flushed_entries_total",
+				Help: "Total number of conntrack entries deleted after gateways were removed from the routes",
+			},
+		),
+		ConntrackFlushDurationSeconds: prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "conntrack_flush_duration_seconds",
+				Help:    "Time taken to flush conntrack entries in seconds",
+				Buckets: prometheus.DefBuckets,
+			},
+		),
 
 		// HTTP Client Metrics
 		HTTPRequestsTotal: prometheus.NewCounterVec(
@@ -157,6 +257,13 @@ func New(registry prometheus.Registerer) (*Metrics, error) {
 			},
 			[]string{"gateway_ip"},
 		),
+		ConsecutiveSuccesses: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "consecutive_successes_count",
+				Help: "Current consecutive successful health checks per gateway",
+			},
+			[]string{"gateway_ip"},
+		),
 
 		// Public IP Service Metrics
 		PublicIPFetchTotal: prometheus.NewCounterVec(
@@ -218,9 +325,21 @@ func New(registry prometheus.Registerer) (*Metrics, error) {
 		metrics.HealthCheckDurationSeconds,
 		metrics.ActiveGatewayCount,
 		metrics.TotalGatewayCount,
+		metrics.StateTransitionsTotal,
+		metrics.SuppressedGateways,
+		metrics.FlapPenalty,
 		metrics.RouteUpdatesTotal,
 		metrics.RouteUpdateDurationSeconds,
 		metrics.DefaultRouteGateways,
+		metrics.GatewayWeight,
+		metrics.ActivePriorityTier,
+		metrics.PoolRoutedGateways,
+		metrics.PoolFallbackActive,
+		metrics.DriftEventsTotal,
+		metrics.RouteWritesTotal,
+		metrics.ConntrackFlushesTotal,
+		metrics.ConntrackFlushedEntriesTotal,
+		metrics.ConntrackFlushDurationSeconds,
 		metrics.HTTPRequestsTotal,
 		metrics.HTTPRequestDurationSeconds,
 		metrics.CheckCyclesTotal,
@@ -228,6 +347,7 @@ func New(registry prometheus.Registerer) (*Metrics, error) {
 		metrics.ApplicationUptimeSeconds,
 		metrics.ErrorsTotal,
 		metrics.ConsecutiveFailures,
+		metrics.ConsecutiveSuccesses,
 		metrics.PublicIPFetchTotal,
 		metrics.PublicIPFetchDurationSeconds,
 		metrics.UniquePublicIPsGauge,
@@ -246,14 +366,23 @@ func New(registry prometheus.Registerer) (*Metrics, error) {
 	return metrics, nil
 }
 
-// StartMetricsServer starts the Prometheus metrics HTTP server
-func StartMetricsServer(ctx context.Context, cancel context.CancelFunc, port int) error {
+// Endpoint is an additional HTTP endpoint that is served by the metrics server
+type Endpoint struct {
+	Path    string
+	Handler http.Handler
+}
+
+// StartMetricsServer starts the Prometheus metrics HTTP server, along with any additional endpoints
+func StartMetricsServer(ctx context.Context, cancel context.CancelFunc, port int, endpoints ...Endpoint) error {
 	// Start metrics server
 	metricsAddr := fmt.Sprintf(":%d", port)
 
 	// Create a new ServeMux to avoid conflicts with global DefaultServeMux in tests
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", promhttp.Handler())
+	for _, endpoint := range endpoints {
+		mux.Handle(endpoint.Path, endpoint.Handler)
+	}
 
 	server := &http.Server{
 		Addr:    metricsAddr,
@@ -43,9 +43,21 @@ func TestNew(t *testing.T) {
 			metrics.HealthCheckDurationSeconds.WithLabelValues("test")
 			metrics.ActiveGatewayCount.Set(0)
 			metrics.TotalGatewayCount.Set(0)
+			metrics.StateTransitionsTotal.WithLabelValues("test", "test")
+			metrics.SuppressedGateways.WithLabelValues("test")
+			metrics.FlapPenalty.WithLabelValues("test")
 			metrics.RouteUpdatesTotal.WithLabelValues("test", "test")
 			metrics.RouteUpdateDurationSeconds.Observe(0)
 			metrics.DefaultRouteGateways.Set(0)
+			metrics.GatewayWeight.WithLabelValues("test", "test")
+			metrics.ActivePriorityTier.WithLabelValues("test", "test")
+			metrics.PoolRoutedGateways.WithLabelValues("test", "test")
+			metrics.PoolFallbackActive.WithLabelValues("test", "test")
+			metrics.DriftEventsTotal.WithLabelValues("test", "test")
+			metrics.RouteWritesTotal.WithLabelValues("test")
+			metrics.ConntrackFlushesTotal.WithLabelValues("test")
+			metrics.ConntrackFlushedEntriesTotal.Add(0)
+			metrics.ConntrackFlushDurationSeconds.Observe(0)
 			metrics.HTTPRequestsTotal.WithLabelValues("test", "test", "test")
 			metrics.HTTPRequestDurationSeconds.WithLabelValues("test")
 			metrics.CheckCyclesTotal.Add(0)
@@ -53,6 +65,7 @@ func TestNew(t *testing.T) {
 			metrics.ApplicationUptimeSeconds.Set(0)
 			metrics.ErrorsTotal.WithLabelValues("test")
 			metrics.ConsecutiveFailures.WithLabelValues("test")
+			metrics.ConsecutiveSuccesses.WithLabelValues("test")
 			metrics.PublicIPFetchTotal.WithLabelValues("test", "test")
 			metrics.PublicIPFetchDurationSeconds.WithLabelValues("test")
 			metrics.UniquePublicIPsGauge.Set(0)
@@ -74,16 +87,21 @@ func TestMetrics_StructureValidation(t *testing.T) {
 	t.Run("counter metrics are properly configured", func(t *testing.T) {
 		// Test CounterVec metrics
 		require.IsType(t, &prometheus.CounterVec{}, metrics.HealthCheckTotal)
+		require.IsType(t, &prometheus.CounterVec{}, metrics.StateTransitionsTotal)
 		require.IsType(t, &prometheus.CounterVec{}, metrics.RouteUpdatesTotal)
 		require.IsType(t, &prometheus.CounterVec{}, metrics.HTTPRequestsTotal)
 		require.IsType(t, &prometheus.CounterVec{}, metrics.ErrorsTotal)
 		require.IsType(t, &prometheus.CounterVec{}, metrics.PublicIPFetchTotal)
 		require.IsType(t, &prometheus.CounterVec{}, metrics.DDNSUpdatesTotal)
 		require.IsType(t, &prometheus.CounterVec{}, metrics.DDNSUpdatesSkippedTotal)
+		require.IsType(t, &prometheus.CounterVec{}, metrics.ConntrackFlushesTotal)
+		require.IsType(t, &prometheus.CounterVec{}, metrics.DriftEventsTotal)
+		require.IsType(t, &prometheus.CounterVec{}, metrics.RouteWritesTotal)
 
 		// Test Counter metrics (check that they implement the Counter interface)
 		require.Implements(t, (*prometheus.Counter)(nil), metrics.CheckCyclesTotal)
 		require.Implements(t, (*prometheus.Counter)(nil), metrics.PublicIPChangesTotal)
+		require.Implements(t, (*prometheus.Counter)(nil), metrics.ConntrackFlushedEntriesTotal)
 	})
 
 	t.Run("gauge metrics are properly configured", func(t *testing.T) {
@@ -96,6 +114,13 @@ func TestMetrics_StructureValidation(t *testing.T) {
 
 		// Test GaugeVec metrics
 		require.IsType(t, &prometheus.GaugeVec{}, metrics.ConsecutiveFailures)
+		require.IsType(t, &prometheus.GaugeVec{}, metrics.GatewayWeight)
+		require.IsType(t, &prometheus.GaugeVec{}, metrics.ActivePriorityTier)
+		require.IsType(t, &prometheus.GaugeVec{}, metrics.PoolRoutedGateways)
+		require.IsType(t, &prometheus.GaugeVec{}, metrics.PoolFallbackActive)
+		require.IsType(t, &prometheus.GaugeVec{}, metrics.ConsecutiveSuccesses)
+		require.IsType(t, &prometheus.GaugeVec{}, metrics.SuppressedGateways)
+		require.IsType(t, &prometheus.GaugeVec{}, metrics.FlapPenalty)
 	})
 
 	t.Run("histogram metrics are properly configured", func(t *testing.T) {
@@ -108,6 +133,7 @@ func TestMetrics_StructureValidation(t *testing.T) {
 		// Test Histogram metrics (check that they implement the Histogram interface)
 		require.Implements(t, (*prometheus.Histogram)(nil), metrics.RouteUpdateDurationSeconds)
 		require.Implements(t, (*prometheus.Histogram)(nil), metrics.CheckCycleDurationSeconds)
+		require.Implements(t, (*prometheus.Histogram)(nil), metrics.ConntrackFlushDurationSeconds)
 	})
 }
 
@@ -121,6 +147,7 @@ func TestMetrics_FunctionalValidation(t *testing.T) {
 		// Test that counter metrics can be used without panicking
 		require.NotPanics(t, func() {
 			metrics.HealthCheckTotal.WithLabelValues("192.168.1.1", "success").Inc()
+			metrics.StateTransitionsTotal.WithLabelValues("192.168.1.1", "up").Inc()
 			metrics.RouteUpdatesTotal.WithLabelValues("add", "success").Inc()
 			metrics.HTTPRequestsTotal.WithLabelValues("192.168.1.1", "200", "GET").Inc()
 			metrics.ErrorsTotal.WithLabelValues("network").Inc()
@@ -138,8 +165,20 @@ func TestMetrics_FunctionalValidation(t *testing.T) {
 			metrics.ActiveGatewayCount.Set(5)
 			metrics.TotalGatewayCount.Set(10)
 			metrics.DefaultRouteGateways.Set(3)
+			metrics.GatewayWeight.WithLabelValues("192.168.1.1", "default").Set(10)
+			metrics.ActivePriorityTier.WithLabelValues("default", "ipv4").Set(0)
+			metrics.PoolRoutedGateways.WithLabelValues("default", "ipv4").Set(2)
+			metrics.PoolFallbackActive.WithLabelValues("default", "ipv4").Set(0)
+			metrics.DriftEventsTotal.WithLabelValues("missing_route", "ipv4").Inc()
+			metrics.RouteWritesTotal.WithLabelValues("skipped").Add(3)
+			metrics.ConntrackFlushesTotal.WithLabelValues("success").Inc()
+			metrics.ConntrackFlushedEntriesTotal.Add(10)
+			metrics.ConntrackFlushDurationSeconds.Observe(0.01)
 			metrics.ApplicationUptimeSeconds.Set(3600)
 			metrics.ConsecutiveFailures.WithLabelValues("192.168.1.1").Set(2)
+			metrics.ConsecutiveSuccesses.WithLabelValues("192.168.1.1").Set(0)
+			metrics.SuppressedGateways.WithLabelValues("192.168.1.1").Set(1)
+			metrics.FlapPenalty.WithLabelValues("192.168.1.1").Set(1500)
 			metrics.UniquePublicIPsGauge.Set(2)
 		})
 	})
@@ -208,6 +247,33 @@ func TestStartMetricsServer(t *testing.T) {
 		time.Sleep(100 * time.Millisecond)
 	})
 
+	t.Run("server serves additional endpoints", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		port := findAvailablePort(t)
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, "planned")
+		})
+		err := StartMetricsServer(ctx, cancel, port, Endpoint{Path: "/dry-run", Handler: handler})
+		require.NoError(t, err)
+
+		// Give the server a moment to start
+		time.Sleep(100 * time.Millisecond)
+
+		resp, err := http.Get(fmt.Sprintf("http://localhost:%d/dry-run", port))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "planned", string(body))
+
+		cancel()
+		time.Sleep(100 * time.Millisecond)
+	})
+
 	t.Run("server handles port binding failure", func(t *testing.T) {
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
@@ -0,0 +1,295 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/iputil"
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/routes"
+	"github.com/vishvananda/netlink"
+)
+
+// conntrackHandle deletes connection tracking entries, and looks up the routes to gateways. This is satisfied by
+// netlink.Handle.
+type conntrackHandle interface {
+	ConntrackDeleteFilters(table netlink.ConntrackTableType, family netlink.InetFamily, filters ...netlink.CustomConntrackFilter) (uint, error)
+	RouteGet(destination net.IP) ([]netlink.Route, error)
+}
+
+var _ conntrackHandle = (*netlink.Handle)(nil)
+
+// recordingConntrackHandle records conntrack flushes instead of applying them, for dry runs. Reads are passed
+// through to the wrapped handle.
+type recordingConntrackHandle struct {
+	conntrackHandle
+	recorder *iputil.RecordingNetlinkHandle
+}
+
+func (h recordingConntrackHandle) ConntrackDeleteFilters(table netlink.ConntrackTableType, family netlink.InetFamily, filters ...netlink.CustomConntrackFilter) (uint, error) {
+	for _, filter := range filters {
+		h.recorder.Record("conntrack delete", fmt.Sprintf("%s %v", familyLabel(int(family)), filter))
+	}
+
+	return 0, nil
+}
+
+// routedFlowFilter matches the connections that may be routed via the gateway table to any of the destinations
+type routedFlowFilter struct {
+	destinations []*net.IPNet
+	excluded     []*net.IPNet // Destinations that bypass the gateway table
+	sources      []*net.IPNet // Sources that are routed via the gateway table. Empty matches all sources.
+}
+
+var _ netlink.CustomConntrackFilter = routedFlowFilter{}
+
+func (f routedFlowFilter) String() string {
+	description := fmt.Sprintf("to %v", f.destinations)
+	if len(f.excluded) > 0 {
+		description += fmt.Sprintf(" except %v", f.excluded)
+	}
+	if len(f.sources) > 0 {
+		description += fmt.Sprintf(" from %v", f.sources)
+	}
+
+	return description
+}
+
+func (f routedFlowFilter) MatchConntrackFlow(flow *netlink.ConntrackFlow) bool {
+	contains := func(ip net.IP) func(*net.IPNet) bool {
+		return func(network *net.IPNet) bool { return network.Contains(ip) }
+	}
+
+	if !slices.ContainsFunc(f.destinations, contains(flow.Forward.DstIP)) {
+		return false
+	}
+
+	if slices.ContainsFunc(f.excluded, contains(flow.Forward.DstIP)) {
+		return false
+	}
+
+	return len(f.sources) == 0 || slices.ContainsFunc(f.sources, contains(flow.Forward.SrcIP))
+}
+
+// removedGatewayFlowFilter matches the connections that were routed via removed gateways. Each connection is matched
+// against the most specific route that contains its destination.
+type removedGatewayFlowFilter struct {
+	routedFlowFilter                         // Destinations are the destinations of all routes
+	removed          map[string]removedRoute // Routes that lost gateways, by destination
+}
+
+var _ netlink.CustomConntrackFilter = removedGatewayFlowFilter{}
+
+func (f removedGatewayFlowFilter) String() string {
+	var destinations []*net.IPNet
+	var gateways []net.IP
+	for _, destination := range f.destinations {
+		if route, ok := f.removed[destination.String()]; ok {
+			destinations = append(destinations, destination)
+			gateways = append(gateways, route.gateways...)
+		}
+	}
+
+	routed := routedFlowFilter{destinations: destinations, excluded: f.excluded, sources: f.sources}
+	return fmt.Sprintf("%s via %v", routed, gateways)
+}
+
+func (f removedGatewayFlowFilter) MatchConntrackFlow(flow *netlink.ConntrackFlow) bool {
+	if !f.routedFlowFilter.MatchConntrackFlow(flow) {
+		return false
+	}
+
+	var destination *net.IPNet
+	for _, routeDestination := range f.destinations {
+		if routeDestination.Contains(flow.Forward.DstIP) && (destination == nil || prefixLength(routeDestination) > prefixLength(destination)) {
+			destination = routeDestination
+		}
+	}
+
+	route, ok := f.removed[destination.String()]
+	if !ok {
+		return false
+	}
+
+	// The reply direction is addressed to the local address that the connection was translated to, or that it was
+	// sent from
+	return route.allRemoved || slices.ContainsFunc(route.addresses, flow.Reverse.DstIP.Equal)
+}
+
+func prefixLength(network *net.IPNet) int {
+	ones, _ := network.Mask.Size()
+	return ones
+}
+
+// removedRoute is a route that lost gateways since the previous update
+type removedRoute struct {
+	destination *net.IPNet
+	gateways    []net.IP
+	allRemoved  bool     // All gateways that the route was sent via were removed
+	addresses   []net.IP // Local addresses that the removed gateways were reached from
+}
+
+// removedGatewayRoutes returns the routes that lost at least one nexthop since the previous update, with the
+// gateways that they lost
+func (gm *GatewayMonitor) removedGatewayRoutes(desiredRoutes []routes.Route) []removedRoute {
+	var removed []removedRoute
+	for _, route := range desiredRoutes {
+		previousIPs := gm.routedNexthops[route.Destination.String()]
+
+		var removedGateways, addresses []net.IP
+		for _, previousIP := range previousIPs {
+			if slices.ContainsFunc(route.Nexthops, func(nexthop routes.Nexthop) bool { return nexthop.Gateway.String() == previousIP }) {
+				continue
+			}
+
+			removedGateways = append(removedGateways, net.ParseIP(previousIP))
+			if address := gm.gatewayAddresses[previousIP]; address != nil && !slices.ContainsFunc(addresses, address.Equal) {
+				addresses = append(addresses, address)
+			}
+		}
+
+		if len(removedGateways) > 0 {
+			removed = append(removed, removedRoute{
+				destination: route.Destination,
+				gateways:    removedGateways,
+				allRemoved:  len(removedGateways) == len(previousIPs),
+				addresses:   addresses,
+			})
+		}
+	}
+
+	return removed
+}
+
+// recordRoutedNexthops records the nexthops of each route, and the local address that each gateway is reached from,
+// for the next update. Addresses are only looked up for gateways that were not routed via before.
+func (gm *GatewayMonitor) recordRoutedNexthops(ctx context.Context, desiredRoutes []routes.Route) {
+	routedNexthops := make(map[string][]string, len(desiredRoutes))
+	gatewayAddresses := make(map[string]net.IP)
+	for _, route := range desiredRoutes {
+		gatewayIPs := make([]string, 0, len(route.Nexthops))
+		for _, nexthop := range route.Nexthops {
+			gatewayIP := nexthop.Gateway.String()
+			gatewayIPs = append(gatewayIPs, gatewayIP)
+
+			if _, ok := gatewayAddresses[gatewayIP]; ok {
+				continue
+			}
+
+			address := gm.gatewayAddresses[gatewayIP]
+			if address == nil {
+				address = gm.lookupGatewayAddress(ctx, nexthop.Gateway)
+			}
+			gatewayAddresses[gatewayIP] = address
+		}
+		routedNexthops[route.Destination.String()] = gatewayIPs
+	}
+
+	gm.routedNexthops = routedNexthops
+	gm.gatewayAddresses = gatewayAddresses
+}
+
+// lookupGatewayAddress returns the local address that the gateway is reached from, which is the source address of
+// connections sent from this host via the gateway, and the address that forwarded connections are masqueraded to.
+// Returns nil if the route to the gateway cannot be looked up.
+func (gm *GatewayMonitor) lookupGatewayAddress(ctx context.Context, gatewayIP net.IP) net.IP {
+	gatewayRoutes, err := gm.conntrack.RouteGet(gatewayIP)
+	if err != nil {
+		gm.metrics.ErrorsTotal.WithLabelValues("conntrack_error").Inc()
+		slog.WarnContext(ctx, "Failed to look up the route to gateway, connections via it may not be flushed", "gateway", gatewayIP.String(), "error", err)
+		return nil
+	}
+
+	if len(gatewayRoutes) == 0 {
+		return nil
+	}
+
+	return gatewayRoutes[0].Src
+}
+
+// flushConntrack deletes the connection tracking entries of connections that were routed via gateways that were
+// removed from the routes. Without this, these connections hang until they time out, rather than failing quickly and
+// being reestablished via the remaining gateways. This is called after the routes are updated, so that new
+// connections are not routed via the removed gateways. Failures are logged, but do not stop the check cycle.
+//
+// The kernel does not record which nexthop of a multipath route a connection was sent via. All connections to a route
+// that lost all of its gateways were sent via removed gateways. When some gateways remain, connections are matched by
+// the local address of their reply direction, which only identifies the gateway when the gateways are reached from
+// different local addresses. Other connections to these routes are left alone.
+func (gm *GatewayMonitor) flushConntrack(ctx context.Context, removed []removedRoute, desiredRoutes []routes.Route) {
+	if gm.conntrack == nil || len(removed) == 0 {
+		return
+	}
+
+	filter := removedGatewayFlowFilter{
+		routedFlowFilter: routedFlowFilter{excluded: gm.config.CIDRsToExclude},
+		removed:          make(map[string]removedRoute, len(removed)),
+	}
+	for _, route := range desiredRoutes {
+		filter.destinations = append(filter.destinations, route.Destination)
+	}
+
+	// Connections selected by firewall mark cannot be identified from their entries, so sources are only used to
+	// narrow down the connections when they are the only selectors
+	if len(gm.config.FWMarks) == 0 && !gm.config.NFTables.SelectsGateways() {
+		filter.sources = gm.config.SourceCIDRs
+	}
+
+	routesByDestination := make(map[string]routes.Route, len(desiredRoutes))
+	for _, route := range desiredRoutes {
+		routesByDestination[route.Destination.String()] = route
+	}
+
+	var families []int
+	for _, route := range removed {
+		// Connections translated to an address that a remaining gateway is reached from may be routed via it
+		if !route.allRemoved {
+			route.addresses = slices.DeleteFunc(slices.Clone(route.addresses), func(address net.IP) bool {
+				return slices.ContainsFunc(routesByDestination[route.destination.String()].Nexthops, func(nexthop routes.Nexthop) bool {
+					return address.Equal(gm.gatewayAddresses[nexthop.Gateway.String()])
+				})
+			})
+
+			if len(route.addresses) == 0 {
+				slog.DebugContext(ctx, "Connections via removed gateways cannot be told apart from connections via the remaining gateways, leaving them alone", "destination", route.destination.String(), "gateways", route.gateways)
+				continue
+			}
+		}
+
+		filter.removed[route.destination.String()] = route
+		if family := iputil.Family(route.destination.IP); !slices.Contains(families, family) {
+			families = append(families, family)
+		}
+	}
+
+	if len(families) == 0 {
+		return
+	}
+
+	start := time.Now()
+	defer func() {
+		gm.metrics.ConntrackFlushDurationSeconds.Observe(time.Since(start).Seconds())
+	}()
+
+	for _, family := range families {
+		familyFilter := filter
+		familyFilter.destinations = slices.DeleteFunc(slices.Clone(filter.destinations), func(destination *net.IPNet) bool {
+			return iputil.Family(destination.IP) != family
+		})
+
+		deleted, err := gm.conntrack.ConntrackDeleteFilters(netlink.ConntrackTable, netlink.InetFamily(family), familyFilter)
+		gm.metrics.ConntrackFlushedEntriesTotal.Add(float64(deleted))
+		if err != nil {
+			gm.metrics.ConntrackFlushesTotal.WithLabelValues("failure").Inc()
+			gm.metrics.ErrorsTotal.WithLabelValues("conntrack_error").Inc()
+			slog.ErrorContext(ctx, "Failed to flush conntrack entries", "family", familyLabel(family), "deleted", deleted, "error", err)
+			continue
+		}
+
+		gm.metrics.ConntrackFlushesTotal.WithLabelValues("success").Inc()
+		slog.InfoContext(ctx, "Flushed conntrack entries of connections via removed gateways", "family", familyLabel(family), "filter", familyFilter.String(), "deleted", deleted)
+	}
+}
@@ -0,0 +1,267 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/config"
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/metrics"
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/routes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+)
+
+// fakeConntrackHandle holds connection tracking entries, and the local address that each gateway is reached from
+type fakeConntrackHandle struct {
+	flows     []*netlink.ConntrackFlow
+	addresses map[string]string // Local address of each gateway
+	deleted   []*netlink.ConntrackFlow
+	routeErr  error
+	deleteErr error
+}
+
+func (f *fakeConntrackHandle) ConntrackDeleteFilters(table netlink.ConntrackTableType, family netlink.InetFamily, filters ...netlink.CustomConntrackFilter) (uint, error) {
+	if f.deleteErr != nil {
+		return 0, f.deleteErr
+	}
+
+	var deleted uint
+	for _, flow := range f.flows {
+		if flow.FamilyType != uint8(family) {
+			continue
+		}
+
+		for _, filter := range filters {
+			if filter.MatchConntrackFlow(flow) {
+				f.deleted = append(f.deleted, flow)
+				deleted++
+				break
+			}
+		}
+	}
+
+	return deleted, nil
+}
+
+func (f *fakeConntrackHandle) RouteGet(destination net.IP) ([]netlink.Route, error) {
+	if f.routeErr != nil {
+		return nil, f.routeErr
+	}
+
+	return []netlink.Route{{Dst: &net.IPNet{IP: destination, Mask: net.CIDRMask(32, 32)}, Src: net.ParseIP(f.addresses[destination.String()])}}, nil
+}
+
+func testFlow(family int, src, dst string) *netlink.ConntrackFlow {
+	return &netlink.ConntrackFlow{
+		FamilyType: uint8(family),
+		Forward:    netlink.IPTuple{SrcIP: net.ParseIP(src), DstIP: net.ParseIP(dst)},
+		Reverse:    netlink.IPTuple{SrcIP: net.ParseIP(dst), DstIP: net.ParseIP(src)},
+	}
+}
+
+// testFlowVia returns a connection tracking entry of a connection that was masqueraded to the local address
+func testFlowVia(family int, src, dst, address string) *netlink.ConntrackFlow {
+	flow := testFlow(family, src, dst)
+	flow.Reverse.DstIP = net.ParseIP(address)
+	return flow
+}
+
+func routeVia(destination *net.IPNet, gatewayIPs ...string) routes.Route {
+	route := routes.Route{Destination: destination}
+	for _, gatewayIP := range gatewayIPs {
+		route.Nexthops = append(route.Nexthops, routes.Nexthop{Gateway: net.ParseIP(gatewayIP)})
+	}
+	return route
+}
+
+func TestRoutedFlowFilter(t *testing.T) {
+	_, defaultV4, _ := net.ParseCIDR("0.0.0.0/0")
+	_, office, _ := net.ParseCIDR("10.0.0.0/8")
+	_, excluded, _ := net.ParseCIDR("10.1.0.0/16")
+	_, clients, _ := net.ParseCIDR("192.168.20.0/24")
+
+	tests := []struct {
+		name     string
+		filter   routedFlowFilter
+		flow     *netlink.ConntrackFlow
+		expected bool
+	}{
+		{
+			name:     "destination in route",
+			filter:   routedFlowFilter{destinations: []*net.IPNet{office}},
+			flow:     testFlow(netlink.FAMILY_V4, "192.168.1.5", "10.2.3.4"),
+			expected: true,
+		},
+		{
+			name:   "destination outside of route",
+			filter: routedFlowFilter{destinations: []*net.IPNet{office}},
+			flow:   testFlow(netlink.FAMILY_V4, "192.168.1.5", "203.0.113.1"),
+		},
+		{
+			name:   "excluded destination",
+			filter: routedFlowFilter{destinations: []*net.IPNet{defaultV4}, excluded: []*net.IPNet{excluded}},
+			flow:   testFlow(netlink.FAMILY_V4, "192.168.1.5", "10.1.2.3"),
+		},
+		{
+			name:     "selected source",
+			filter:   routedFlowFilter{destinations: []*net.IPNet{defaultV4}, sources: []*net.IPNet{clients}},
+			flow:     testFlow(netlink.FAMILY_V4, "192.168.20.5", "203.0.113.1"),
+			expected: true,
+		},
+		{
+			name:   "unselected source",
+			filter: routedFlowFilter{destinations: []*net.IPNet{defaultV4}, sources: []*net.IPNet{clients}},
+			flow:   testFlow(netlink.FAMILY_V4, "192.168.1.5", "203.0.113.1"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.filter.MatchConntrackFlow(tt.flow))
+		})
+	}
+}
+
+func TestGatewayMonitor_RemovedGatewayRoutes(t *testing.T) {
+	_, defaultV4, _ := net.ParseCIDR("0.0.0.0/0")
+	_, defaultV6, _ := net.ParseCIDR("::/0")
+	_, office, _ := net.ParseCIDR("10.0.0.0/8")
+
+	m, err := metrics.New(prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	handle := &fakeConntrackHandle{addresses: map[string]string{"192.168.1.1": "192.168.1.100", "192.168.2.1": "192.168.2.100", "2001:db8::ff": "2001:db8::100"}}
+	gm := &GatewayMonitor{metrics: m, conntrack: handle}
+
+	// Nothing is removed on the first update
+	initialRoutes := []routes.Route{
+		routeVia(office, "192.168.1.1", "192.168.2.1"),
+		routeVia(defaultV4, "192.168.1.1"),
+		routeVia(defaultV6, "2001:db8::ff"),
+	}
+	assert.Empty(t, gm.removedGatewayRoutes(initialRoutes))
+	gm.recordRoutedNexthops(context.Background(), initialRoutes)
+
+	// Adding gateways does not remove any, but removing them (including the last one) does
+	removed := gm.removedGatewayRoutes([]routes.Route{
+		routeVia(office, "192.168.1.1"),
+		routeVia(defaultV4, "192.168.1.1", "192.168.1.3"),
+		routeVia(defaultV6),
+	})
+	assert.Equal(t, []removedRoute{
+		{destination: office, gateways: []net.IP{net.ParseIP("192.168.2.1")}, addresses: []net.IP{net.ParseIP("192.168.2.100")}},
+		{destination: defaultV6, gateways: []net.IP{net.ParseIP("2001:db8::ff")}, allRemoved: true, addresses: []net.IP{net.ParseIP("2001:db8::100")}},
+	}, removed)
+
+	// Addresses are only looked up for new gateways
+	handle.routeErr = errors.New("network is unreachable")
+	gm.recordRoutedNexthops(context.Background(), initialRoutes)
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.ErrorsTotal.WithLabelValues("conntrack_error")))
+	gm.recordRoutedNexthops(context.Background(), []routes.Route{routeVia(defaultV4, "192.168.1.1", "192.168.1.3")})
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.ErrorsTotal.WithLabelValues("conntrack_error")))
+	assert.Equal(t, map[string]net.IP{"192.168.1.1": net.ParseIP("192.168.1.100"), "192.168.1.3": nil}, gm.gatewayAddresses)
+}
+
+func TestGatewayMonitor_FlushConntrack(t *testing.T) {
+	_, defaultV4, _ := net.ParseCIDR("0.0.0.0/0")
+	_, defaultV6, _ := net.ParseCIDR("::/0")
+	_, office, _ := net.ParseCIDR("10.0.0.0/8")
+	_, excluded, _ := net.ParseCIDR("10.1.0.0/16")
+
+	m, err := metrics.New(prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	handle := &fakeConntrackHandle{
+		flows: []*netlink.ConntrackFlow{
+			testFlowVia(netlink.FAMILY_V4, "192.168.10.5", "10.2.3.4", "192.168.1.100"),
+			testFlowVia(netlink.FAMILY_V4, "192.168.10.5", "10.2.3.4", "192.168.2.100"),
+			testFlowVia(netlink.FAMILY_V4, "192.168.10.5", "203.0.113.1", "192.168.2.100"),
+			testFlowVia(netlink.FAMILY_V4, "192.168.10.5", "10.1.2.3", "192.168.2.100"),
+			testFlow(netlink.FAMILY_V6, "fd00::5", "2001:db8::1"),
+		},
+		addresses: map[string]string{"192.168.1.1": "192.168.1.100", "192.168.2.1": "192.168.2.100"},
+	}
+	gm := &GatewayMonitor{metrics: m, conntrack: handle, config: config.Config{CIDRsToExclude: []*net.IPNet{excluded}}}
+
+	gm.recordRoutedNexthops(context.Background(), []routes.Route{
+		routeVia(office, "192.168.1.1", "192.168.2.1"),
+		routeVia(defaultV4, "192.168.2.1"),
+		routeVia(defaultV6, "2001:db8::ff"),
+	})
+	desiredRoutes := []routes.Route{
+		routeVia(office, "192.168.1.1"),
+		routeVia(defaultV4, "192.168.2.1"),
+		routeVia(defaultV6),
+	}
+	removed := gm.removedGatewayRoutes(desiredRoutes)
+	gm.recordRoutedNexthops(context.Background(), desiredRoutes)
+
+	// Only the connections via the removed gateways are deleted. The connection via the removed gateway to a
+	// destination of another route is routed by that route, which still uses the gateway. All connections to a route
+	// without any of its previous gateways are deleted.
+	gm.flushConntrack(context.Background(), removed, desiredRoutes)
+	assert.Equal(t, []*netlink.ConntrackFlow{handle.flows[1], handle.flows[4]}, handle.deleted)
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.ConntrackFlushedEntriesTotal))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.ConntrackFlushesTotal.WithLabelValues("success")))
+
+	// Failures are counted, but do not stop the check cycle
+	handle.deleted = nil
+	handle.deleteErr = errors.New("operation not permitted")
+	gm.flushConntrack(context.Background(), removed, desiredRoutes)
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.ConntrackFlushesTotal.WithLabelValues("failure")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.ErrorsTotal.WithLabelValues("conntrack_error")))
+	assert.Empty(t, handle.deleted)
+}
+
+func TestGatewayMonitor_FlushConntrack_SharedAddress(t *testing.T) {
+	_, defaultV4, _ := net.ParseCIDR("0.0.0.0/0")
+
+	m, err := metrics.New(prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	// Both gateways are reached from the same address, so the connections via them cannot be told apart
+	handle := &fakeConntrackHandle{
+		flows:     []*netlink.ConntrackFlow{testFlowVia(netlink.FAMILY_V4, "192.168.10.5", "203.0.113.1", "192.168.1.100")},
+		addresses: map[string]string{"192.168.1.1": "192.168.1.100", "192.168.1.2": "192.168.1.100"},
+	}
+	gm := &GatewayMonitor{metrics: m, conntrack: handle}
+
+	gm.recordRoutedNexthops(context.Background(), []routes.Route{routeVia(defaultV4, "192.168.1.1", "192.168.1.2")})
+	desiredRoutes := []routes.Route{routeVia(defaultV4, "192.168.1.1")}
+	gm.flushConntrack(context.Background(), gm.removedGatewayRoutes(desiredRoutes), desiredRoutes)
+	assert.Empty(t, handle.deleted)
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.ConntrackFlushesTotal.WithLabelValues("success")))
+}
+
+func TestGatewayMonitor_FlushConntrack_Selectors(t *testing.T) {
+	_, defaultV4, _ := net.ParseCIDR("0.0.0.0/0")
+	_, clients, _ := net.ParseCIDR("192.168.20.0/24")
+
+	m, err := metrics.New(prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	flows := []*netlink.ConntrackFlow{
+		testFlow(netlink.FAMILY_V4, "192.168.20.5", "203.0.113.1"),
+		testFlow(netlink.FAMILY_V4, "192.168.1.5", "203.0.113.1"),
+	}
+	removed := []removedRoute{{destination: defaultV4, gateways: []net.IP{net.ParseIP("192.168.1.1")}, allRemoved: true}}
+	desiredRoutes := []routes.Route{routeVia(defaultV4)}
+
+	// Only connections from the selected sources are routed via the gateways
+	handle := &fakeConntrackHandle{flows: flows}
+	gm := &GatewayMonitor{metrics: m, conntrack: handle, config: config.Config{SourceCIDRs: []*net.IPNet{clients}}}
+	gm.flushConntrack(context.Background(), removed, desiredRoutes)
+	assert.Equal(t, flows[:1], handle.deleted)
+
+	// Marked connections may come from any source
+	handle = &fakeConntrackHandle{flows: flows}
+	gm.conntrack = handle
+	gm.config.FWMarks = []config.FWMark{{Mark: 0x10, Mask: 0xff}}
+	gm.flushConntrack(context.Background(), removed, desiredRoutes)
+	assert.Equal(t, flows, handle.deleted)
+}
@@ -0,0 +1,115 @@
+package monitor
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/config"
+)
+
+// flapDamper implements route flap damping for gateways, similar to BGP route flap damping (RFC 2439). Each state
+// change adds a penalty to the gateway that decays exponentially over time. Gateways whose penalty reaches the
+// suppress threshold are suppressed until their penalty decays below the reuse threshold.
+type flapDamper struct {
+	mu     sync.Mutex
+	config config.FlapDampingConfig
+	states map[string]*flapState // Keyed by gateway IP
+	now    func() time.Time
+}
+
+type flapState struct {
+	penalty    float64
+	updated    time.Time
+	suppressed bool
+}
+
+func newFlapDamper(cfg config.FlapDampingConfig) *flapDamper {
+	return &flapDamper{
+		config: cfg,
+		states: make(map[string]*flapState),
+		now:    time.Now,
+	}
+}
+
+// setConfig replaces the damping options. Existing penalties are kept, unless damping is disabled.
+func (d *flapDamper) setConfig(cfg config.FlapDampingConfig) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.config = cfg
+	if !cfg.Enabled {
+		clear(d.states)
+	}
+}
+
+// recordTransition adds the flap penalty to a gateway after a state change
+func (d *flapDamper) recordTransition(gatewayIP string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.config.Enabled {
+		return
+	}
+
+	state, ok := d.states[gatewayIP]
+	if !ok {
+		state = &flapState{}
+		d.states[gatewayIP] = state
+	}
+
+	d.decay(state)
+	state.penalty += float64(d.config.Penalty)
+	if maxPenalty := d.config.MaxPenalty(); maxPenalty != 0 {
+		state.penalty = min(state.penalty, maxPenalty)
+	}
+}
+
+// evaluate decays the penalty of a gateway and updates whether it is suppressed. Returns the current penalty,
+// whether the gateway is suppressed, and whether the suppression state changed.
+func (d *flapDamper) evaluate(gatewayIP string) (penalty float64, suppressed, changed bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	state, ok := d.states[gatewayIP]
+	if !ok || !d.config.Enabled {
+		return 0, false, false
+	}
+
+	d.decay(state)
+
+	wasSuppressed := state.suppressed
+	switch {
+	case state.penalty >= float64(d.config.SuppressThreshold):
+		state.suppressed = true
+	case state.penalty < float64(d.config.ReuseThreshold):
+		state.suppressed = false
+	}
+
+	// Forget gateways that have been stable for a while, so that their penalty does not need to be tracked
+	if !state.suppressed && state.penalty < float64(d.config.ReuseThreshold)/2 {
+		delete(d.states, gatewayIP)
+		return 0, false, wasSuppressed
+	}
+
+	return state.penalty, state.suppressed, state.suppressed != wasSuppressed
+}
+
+// forget drops the state of a gateway that is no longer monitored
+func (d *flapDamper) forget(gatewayIP string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.states, gatewayIP)
+}
+
+// decay reduces the penalty by the time elapsed since it was last updated. This must be called with the lock held.
+func (d *flapDamper) decay(state *flapState) {
+	now := d.now()
+	if !state.updated.IsZero() && d.config.HalfLife > 0 {
+		halfLives := now.Sub(state.updated).Seconds() / d.config.HalfLife.Seconds()
+		state.penalty *= math.Exp2(-halfLives)
+	}
+
+	state.updated = now
+}
@@ -0,0 +1,111 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testFlapDampingConfig() config.FlapDampingConfig {
+	return config.FlapDampingConfig{
+		Enabled:           true,
+		Penalty:           500,
+		SuppressThreshold: 2000,
+		ReuseThreshold:    750,
+		HalfLife:          15 * time.Minute,
+		MaxSuppressTime:   time.Hour,
+	}
+}
+
+// testFlapDamper creates a damper with a clock that only moves when advanced
+func testFlapDamper(cfg config.FlapDampingConfig) (*flapDamper, func(time.Duration)) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	damper := newFlapDamper(cfg)
+	damper.now = func() time.Time { return now }
+
+	return damper, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestFlapDamper(t *testing.T) {
+	damper, advance := testFlapDamper(testFlapDampingConfig())
+	const gatewayIP = "192.168.1.1"
+
+	// Three transitions are not enough to be suppressed
+	for range 3 {
+		damper.recordTransition(gatewayIP)
+	}
+	penalty, suppressed, changed := damper.evaluate(gatewayIP)
+	assert.InDelta(t, 1500, penalty, 0.001)
+	assert.False(t, suppressed)
+	assert.False(t, changed)
+
+	// The fourth transition reaches the suppress threshold
+	damper.recordTransition(gatewayIP)
+	penalty, suppressed, changed = damper.evaluate(gatewayIP)
+	assert.InDelta(t, 2000, penalty, 0.001)
+	assert.True(t, suppressed)
+	assert.True(t, changed)
+
+	// The penalty halves after each half-life. The gateway stays suppressed until it is below the reuse threshold.
+	advance(15 * time.Minute)
+	penalty, suppressed, changed = damper.evaluate(gatewayIP)
+	assert.InDelta(t, 1000, penalty, 0.001)
+	assert.True(t, suppressed)
+	assert.False(t, changed)
+
+	advance(15 * time.Minute)
+	penalty, suppressed, changed = damper.evaluate(gatewayIP)
+	assert.InDelta(t, 500, penalty, 0.001)
+	assert.False(t, suppressed)
+	assert.True(t, changed)
+
+	// Stable gateways are eventually forgotten
+	advance(15 * time.Minute)
+	penalty, suppressed, changed = damper.evaluate(gatewayIP)
+	assert.Zero(t, penalty)
+	assert.False(t, suppressed)
+	assert.False(t, changed)
+	assert.Empty(t, damper.states)
+}
+
+func TestFlapDamper_MaxPenalty(t *testing.T) {
+	cfg := testFlapDampingConfig()
+	damper, advance := testFlapDamper(cfg)
+	const gatewayIP = "192.168.1.1"
+
+	for range 100 {
+		damper.recordTransition(gatewayIP)
+	}
+
+	penalty, suppressed, _ := damper.evaluate(gatewayIP)
+	assert.InDelta(t, cfg.MaxPenalty(), penalty, 0.001)
+	assert.True(t, suppressed)
+
+	// The gateway is reused after at most the max suppress time
+	advance(cfg.MaxSuppressTime + time.Second)
+	_, suppressed, changed := damper.evaluate(gatewayIP)
+	assert.False(t, suppressed)
+	assert.True(t, changed)
+}
+
+func TestFlapDamper_Disabled(t *testing.T) {
+	damper, _ := testFlapDamper(testFlapDampingConfig())
+	const gatewayIP = "192.168.1.1"
+
+	for range 10 {
+		damper.recordTransition(gatewayIP)
+	}
+	_, suppressed, _ := damper.evaluate(gatewayIP)
+	require.True(t, suppressed)
+
+	// Disabling damping releases suppressed gateways and stops tracking penalties
+	damper.setConfig(config.FlapDampingConfig{})
+	damper.recordTransition(gatewayIP)
+	penalty, suppressed, _ := damper.evaluate(gatewayIP)
+	assert.Zero(t, penalty)
+	assert.False(t, suppressed)
+	assert.Empty(t, damper.states)
+}
@@ -0,0 +1,105 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/gateway"
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/iputil"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// requestCheck schedules an immediate check cycle. If one is already pending, this is a no-op.
+func (gm *GatewayMonitor) requestCheck() {
+	select {
+	case gm.checkRequests <- struct{}{}:
+	default:
+	}
+}
+
+// eventHandler returns the handler for netlink events. Gateways are checked as soon as a link that they are reached
+// through goes down, and the managed rules and routes are reconciled when they are changed by something else.
+// Changes made by the monitor itself are reported too, but reconciling them finds no drift.
+func (gm *GatewayMonitor) eventHandler(tableID int) func(iputil.Event) {
+	reconcileDebouncer := time.AfterFunc(reconcileDebounce, gm.requestReconcile)
+	reconcileDebouncer.Stop()
+
+	// Links are reported whenever any of their attributes change, so only transitions to down are acted on
+	downLinks := make(map[int]struct{})
+
+	return func(event iputil.Event) {
+		switch {
+		case event.Link != nil:
+			index := event.Link.Attrs().Index
+			up := event.Link.Header.Type != unix.RTM_DELLINK && event.Link.Flags&unix.IFF_LOWER_UP != 0
+			if up {
+				delete(downLinks, index)
+				return
+			}
+
+			if _, ok := downLinks[index]; ok {
+				return
+			}
+			downLinks[index] = struct{}{}
+
+			if gm.usesLink(index) {
+				slog.Info("Gateway link went down, checking gateways", "link", event.Link.Attrs().Name)
+				gm.requestCheck()
+			}
+		case event.Route != nil:
+			// Nothing is repaired in dry run mode, because the desired state is never applied
+			if event.Route.Table == tableID && gm.recorder == nil {
+				reconcileDebouncer.Reset(reconcileDebounce)
+			}
+		case event.Rule != nil:
+			if gm.recorder == nil {
+				reconcileDebouncer.Reset(reconcileDebounce)
+			}
+		}
+	}
+}
+
+// usesLink returns whether any gateway is reached through the link
+func (gm *GatewayMonitor) usesLink(index int) bool {
+	links := gm.gatewayLinks.Load()
+	if links == nil {
+		return false
+	}
+
+	_, ok := (*links)[index]
+	return ok
+}
+
+// refreshGatewayLinks records the links that the gateways are reached through, so that link changes can be matched
+// to gateways
+func (gm *GatewayMonitor) refreshGatewayLinks(ctx context.Context) {
+	links := make(map[int]struct{}, len(gm.gateways))
+	for _, gw := range gm.gateways {
+		index, err := gatewayLinkIndex(gw)
+		if err != nil {
+			slog.DebugContext(ctx, "Failed to find the link of gateway", "gateway", gw.IP, "error", err)
+			continue
+		}
+
+		links[index] = struct{}{}
+	}
+
+	gm.gatewayLinks.Store(&links)
+}
+
+// gatewayLinkIndex returns the index of the link that the gateway is reached through
+func gatewayLinkIndex(gw gateway.Gateway) (int, error) {
+	if gw.Interface == "" {
+		return iputil.LinkIndexOf(gw.IP)
+	}
+
+	link, err := netlink.LinkByName(gw.Interface)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find interface %s: %w", gw.Interface, err)
+	}
+
+	return link.Attrs().Index, nil
+}
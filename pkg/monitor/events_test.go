@@ -0,0 +1,78 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/iputil"
+	"github.com/stretchr/testify/assert"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+func linkEvent(index int, flags uint32) iputil.Event {
+	update := &netlink.LinkUpdate{
+		Header: unix.NlMsghdr{Type: unix.RTM_NEWLINK},
+		Link:   &netlink.Device{LinkAttrs: netlink.LinkAttrs{Index: index, Name: "eth0"}},
+	}
+	update.IfInfomsg = nl.IfInfomsg{IfInfomsg: unix.IfInfomsg{Index: int32(index), Flags: flags}}
+	return iputil.Event{Link: update}
+}
+
+func newEventTestMonitor() *GatewayMonitor {
+	gm := &GatewayMonitor{
+		checkRequests:     make(chan struct{}, 1),
+		reconcileRequests: make(chan struct{}, 1),
+	}
+	gm.gatewayLinks.Store(&map[int]struct{}{2: {}})
+	return gm
+}
+
+func TestEventHandler_Links(t *testing.T) {
+	gm := newEventTestMonitor()
+	handler := gm.eventHandler(100)
+
+	// Links that are not used by gateways are ignored
+	handler(linkEvent(3, unix.IFF_UP))
+	assert.Empty(t, gm.checkRequests)
+
+	handler(linkEvent(2, unix.IFF_UP|unix.IFF_LOWER_UP))
+	assert.Empty(t, gm.checkRequests)
+
+	handler(linkEvent(2, unix.IFF_UP))
+	assert.Len(t, gm.checkRequests, 1)
+	<-gm.checkRequests
+
+	// Changes to links that are already down are ignored
+	handler(linkEvent(2, 0))
+	assert.Empty(t, gm.checkRequests)
+
+	handler(linkEvent(2, unix.IFF_UP|unix.IFF_LOWER_UP))
+	handler(linkEvent(2, unix.IFF_UP))
+	assert.Len(t, gm.checkRequests, 1)
+}
+
+func TestEventHandler_Routes(t *testing.T) {
+	gm := newEventTestMonitor()
+	handler := gm.eventHandler(100)
+
+	handler(iputil.Event{Route: &netlink.RouteUpdate{Type: unix.RTM_NEWROUTE, Route: netlink.Route{Table: unix.RT_TABLE_MAIN}}})
+	time.Sleep(reconcileDebounce + 100*time.Millisecond)
+	assert.Empty(t, gm.reconcileRequests)
+
+	handler(iputil.Event{Route: &netlink.RouteUpdate{Type: unix.RTM_DELROUTE, Route: netlink.Route{Table: 100}}})
+	handler(iputil.Event{Rule: &iputil.RuleUpdate{Type: unix.RTM_DELRULE}})
+	assert.Eventually(t, func() bool { return len(gm.reconcileRequests) == 1 }, 2*reconcileDebounce, 10*time.Millisecond)
+}
+
+func TestEventHandler_DryRun(t *testing.T) {
+	gm := newEventTestMonitor()
+	gm.recorder = iputil.NewRecordingNetlinkHandle(nil)
+	handler := gm.eventHandler(100)
+
+	handler(iputil.Event{Route: &netlink.RouteUpdate{Type: unix.RTM_DELROUTE, Route: netlink.Route{Table: 100}}})
+	handler(iputil.Event{Rule: &iputil.RuleUpdate{Type: unix.RTM_DELRULE}})
+	time.Sleep(reconcileDebounce + 100*time.Millisecond)
+	assert.Empty(t, gm.reconcileRequests)
+}
@@ -0,0 +1,401 @@
+package monitor
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/config"
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/gateway"
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/iputil"
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/metrics"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// Error types, used as the `type` label of the errors_total metric
+const (
+	errorTypeNetwork         = "network_error"
+	errorTypeTimeout         = "timeout"
+	errorTypeInvalidResponse = "invalid_response"
+	errorTypeBodyTooLarge    = "body_too_large"
+	errorTypeBodyMismatch    = "body_mismatch"
+	errorTypeJSONMismatch    = "json_mismatch"
+)
+
+// HealthChecker probes a single gateway
+type HealthChecker interface {
+	// Check probes the gateway, returning nil if it is healthy. The context deadline is the health check timeout.
+	// Failures should be returned as a *CheckError so that they are recorded with the correct error type.
+	Check(ctx context.Context, gw *gateway.Gateway) error
+}
+
+// CheckError is a failed health check, along with the type of failure
+type CheckError struct {
+	Type string // One of the errorType* values
+	Err  error
+}
+
+func (e *CheckError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *CheckError) Unwrap() error {
+	return e.Err
+}
+
+// networkError wraps an error that occurred while communicating with a gateway, classifying timeouts
+func networkError(err error) error {
+	errorType := errorTypeNetwork
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		errorType = errorTypeTimeout
+	}
+
+	return &CheckError{Type: errorType, Err: err}
+}
+
+// invalidResponseError creates an error for a gateway that responded, but not with a healthy response
+func invalidResponseError(format string, args ...any) error {
+	return &CheckError{Type: errorTypeInvalidResponse, Err: fmt.Errorf(format, args...)}
+}
+
+// errorTypeOf returns the error type of a health check failure
+func errorTypeOf(err error) string {
+	var checkErr *CheckError
+	if errors.As(err, &checkErr) {
+		return checkErr.Type
+	}
+
+	return errorTypeNetwork
+}
+
+// newHealthCheckers creates a health checker for each supported check type
+func newHealthCheckers(cfg config.Config, client *http.Client, metrics *metrics.Metrics) map[string]HealthChecker {
+	return map[string]HealthChecker{
+		config.CheckTypeHTTP: &httpChecker{client: client, metrics: metrics, options: cfg.HTTPCheck},
+		config.CheckTypeTCP:  &tcpChecker{},
+		config.CheckTypeICMP: newICMPChecker(),
+		config.CheckTypeDNS:  &dnsChecker{queryName: cfg.DNSQueryName},
+		config.CheckTypeGRPC: &grpcChecker{service: cfg.GRPCService},
+	}
+}
+
+// httpChecker considers a gateway healthy if a request to its URL returns an expected status code (any 2xx by
+// default), and the response body matches all configured assertions
+type httpChecker struct {
+	client  *http.Client
+	metrics *metrics.Metrics
+	options config.HTTPCheckConfig
+}
+
+func (c *httpChecker) Check(ctx context.Context, gw *gateway.Gateway) error {
+	gatewayIP := gw.IP.String()
+	method := cmp.Or(c.options.Method, http.MethodGet)
+
+	req, err := http.NewRequestWithContext(ctx, method, gw.URL, nil)
+	if err != nil {
+		return &CheckError{Type: errorTypeNetwork, Err: fmt.Errorf("failed to create request: %w", err)}
+	}
+
+	for name, values := range c.options.Headers {
+		if http.CanonicalHeaderKey(name) == "Host" && len(values) > 0 {
+			req.Host = values[0]
+			continue
+		}
+		req.Header[http.CanonicalHeaderKey(name)] = values
+	}
+
+	start := time.Now()
+	resp, err := c.client.Do(req)
+	c.metrics.HTTPRequestDurationSeconds.WithLabelValues(gatewayIP).Observe(time.Since(start).Seconds())
+	if err != nil {
+		return networkError(err)
+	}
+	defer resp.Body.Close()
+
+	c.metrics.HTTPRequestsTotal.WithLabelValues(gatewayIP, strconv.Itoa(resp.StatusCode), method).Inc()
+
+	expectedStatuses := c.options.ExpectedStatuses
+	if len(expectedStatuses) == 0 {
+		expectedStatuses = config.DefaultExpectedStatuses
+	}
+	if !slices.ContainsFunc(expectedStatuses, func(r config.StatusRange) bool { return r.Contains(resp.StatusCode) }) {
+		return invalidResponseError("unexpected status code %d", resp.StatusCode)
+	}
+
+	if !c.options.ReadsBody() {
+		return nil
+	}
+
+	maxBodySize := cmp.Or(c.options.MaxBodySize, config.DefaultHTTPMaxBodySize)
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize+1))
+	if err != nil {
+		return networkError(fmt.Errorf("failed to read response body: %w", err))
+	}
+	if int64(len(body)) > maxBodySize {
+		return &CheckError{Type: errorTypeBodyTooLarge, Err: fmt.Errorf("response body is larger than %d bytes", maxBodySize)}
+	}
+
+	return c.checkBody(body)
+}
+
+// checkBody checks the response body against the configured assertions
+func (c *httpChecker) checkBody(body []byte) error {
+	if c.options.BodyContains != "" && !bytes.Contains(body, []byte(c.options.BodyContains)) {
+		return &CheckError{Type: errorTypeBodyMismatch, Err: fmt.Errorf("response body does not contain %q", c.options.BodyContains)}
+	}
+
+	if c.options.BodyRegex != nil && !c.options.BodyRegex.Match(body) {
+		return &CheckError{Type: errorTypeBodyMismatch, Err: fmt.Errorf("response body does not match %q", c.options.BodyRegex.String())}
+	}
+
+	if c.options.JSONPath == "" {
+		return nil
+	}
+
+	var document any
+	if err := json.Unmarshal(body, &document); err != nil {
+		return &CheckError{Type: errorTypeJSONMismatch, Err: fmt.Errorf("failed to parse response body as JSON: %w", err)}
+	}
+
+	value, ok := lookupJSONPath(document, c.options.JSONPath)
+	if !ok || value == nil {
+		return &CheckError{Type: errorTypeJSONMismatch, Err: fmt.Errorf("JSON path %q not found in response body", c.options.JSONPath)}
+	}
+
+	if c.options.JSONValue != "" && jsonValueString(value) != c.options.JSONValue {
+		return &CheckError{Type: errorTypeJSONMismatch, Err: fmt.Errorf("JSON path %q is %q, expected %q", c.options.JSONPath, jsonValueString(value), c.options.JSONValue)}
+	}
+
+	return nil
+}
+
+// lookupJSONPath returns the value at the dot-separated path in a decoded JSON document. Path segments select object
+// keys, or indices of arrays. A leading `$.` is ignored.
+func lookupJSONPath(document any, path string) (any, bool) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return document, true
+	}
+
+	current := document
+	for _, segment := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]any:
+			value, ok := node[segment]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		case []any:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, false
+			}
+			current = node[index]
+		default:
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+// jsonValueString formats a decoded JSON value for comparison with the expected value
+func jsonValueString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(encoded)
+	}
+}
+
+// tcpChecker considers a gateway healthy if a TCP connection to its port can be established
+type tcpChecker struct{}
+
+func (c *tcpChecker) Check(ctx context.Context, gw *gateway.Gateway) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(gw.IP.String(), strconv.Itoa(gw.Port)))
+	if err != nil {
+		return networkError(err)
+	}
+
+	return conn.Close()
+}
+
+// icmpChecker considers a gateway healthy if it replies to an ICMP (or ICMPv6) echo request.
+// This requires raw socket access (CAP_NET_RAW).
+type icmpChecker struct {
+	id  int
+	seq atomic.Uint32
+}
+
+func newICMPChecker() *icmpChecker {
+	return &icmpChecker{id: os.Getpid() & 0xffff}
+}
+
+func (c *icmpChecker) Check(ctx context.Context, gw *gateway.Gateway) error {
+	network, protocol := "ip4:icmp", 1
+	var requestType, replyType icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	if iputil.Family(gw.IP) == netlink.FAMILY_V6 {
+		network, protocol = "ip6:ipv6-icmp", 58
+		requestType, replyType = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+	}
+
+	conn, err := icmp.ListenPacket(network, "")
+	if err != nil {
+		return &CheckError{Type: errorTypeNetwork, Err: fmt.Errorf("failed to open ICMP socket: %w", err)}
+	}
+	defer conn.Close()
+
+	// Unblock reads when the context is cancelled
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return &CheckError{Type: errorTypeNetwork, Err: fmt.Errorf("failed to set ICMP socket deadline: %w", err)}
+		}
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	// Every raw socket receives all echo replies, so the sequence number is used to match the reply to this check
+	seq := int(c.seq.Add(1) & 0xffff)
+	request := icmp.Message{
+		Type: requestType,
+		Body: &icmp.Echo{ID: c.id, Seq: seq, Data: []byte("gateway-route-manager")},
+	}
+	requestBytes, err := request.Marshal(nil)
+	if err != nil {
+		return &CheckError{Type: errorTypeNetwork, Err: fmt.Errorf("failed to marshal ICMP echo request: %w", err)}
+	}
+
+	if _, err := conn.WriteTo(requestBytes, &net.IPAddr{IP: gw.IP}); err != nil {
+		return networkError(fmt.Errorf("failed to send ICMP echo request: %w", err))
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			return networkError(fmt.Errorf("failed to receive ICMP echo reply: %w", err))
+		}
+
+		if peerAddr, ok := peer.(*net.IPAddr); !ok || !peerAddr.IP.Equal(gw.IP) {
+			continue
+		}
+
+		reply, err := icmp.ParseMessage(protocol, buf[:n])
+		if err != nil || reply.Type != replyType {
+			continue
+		}
+
+		if echo, ok := reply.Body.(*icmp.Echo); ok && echo.ID == c.id && echo.Seq == seq {
+			return nil
+		}
+	}
+}
+
+// dnsChecker considers a gateway healthy if it can resolve the query name, using the gateway as the DNS server.
+// As the gateway must forward the query upstream, this verifies that the internet is reachable via the gateway.
+type dnsChecker struct {
+	queryName string
+}
+
+func (c *dnsChecker) Check(ctx context.Context, gw *gateway.Gateway) error {
+	server := net.JoinHostPort(gw.IP.String(), strconv.Itoa(gw.Port))
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, server)
+		},
+	}
+
+	addrs, err := resolver.LookupIPAddr(ctx, c.queryName)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return invalidResponseError("failed to resolve %s: %w", c.queryName, err)
+		}
+
+		return networkError(err)
+	}
+
+	if len(addrs) == 0 {
+		return invalidResponseError("no addresses returned for %s", c.queryName)
+	}
+
+	return nil
+}
+
+// grpcChecker considers a gateway healthy if the gRPC health checking protocol (grpc.health.v1) reports the
+// service as serving. TLS is used when the gateway scheme is https.
+type grpcChecker struct {
+	service string
+}
+
+func (c *grpcChecker) Check(ctx context.Context, gw *gateway.Gateway) error {
+	creds := insecure.NewCredentials()
+	if gw.Scheme == "https" {
+		creds = credentials.NewTLS(&tls.Config{})
+	}
+
+	target := "passthrough:///" + net.JoinHostPort(gw.IP.String(), strconv.Itoa(gw.Port))
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return &CheckError{Type: errorTypeNetwork, Err: fmt.Errorf("failed to create gRPC client: %w", err)}
+	}
+	defer conn.Close()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: c.service})
+	if err != nil {
+		switch status.Code(err) {
+		case codes.DeadlineExceeded:
+			return &CheckError{Type: errorTypeTimeout, Err: err}
+		case codes.Unavailable, codes.Canceled:
+			return &CheckError{Type: errorTypeNetwork, Err: err}
+		default:
+			return invalidResponseError("gRPC health check failed: %w", err)
+		}
+	}
+
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return invalidResponseError("gRPC health status is %s", resp.GetStatus())
+	}
+
+	return nil
+}
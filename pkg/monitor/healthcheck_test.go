@@ -0,0 +1,321 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/config"
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/gateway"
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// testGateway creates a gateway targeting the given listener address
+func testGateway(t *testing.T, addr string) *gateway.Gateway {
+	host, portStr, err := net.SplitHostPort(addr)
+	require.NoError(t, err)
+
+	port, err := strconv.Atoi(portStr)
+	require.NoError(t, err)
+
+	return &gateway.Gateway{
+		IP:     net.ParseIP(host),
+		URL:    "http://" + addr + "/",
+		Port:   port,
+		Scheme: "http",
+	}
+}
+
+func checkContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestHTTPChecker_Check(t *testing.T) {
+	tests := []struct {
+		name              string
+		statusCode        int
+		body              string
+		options           config.HTTPCheckConfig
+		expectedErrorType string
+	}{
+		{
+			name:       "healthy",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "healthy with other 2xx status",
+			statusCode: http.StatusNoContent,
+		},
+		{
+			name:              "unhealthy status",
+			statusCode:        http.StatusServiceUnavailable,
+			expectedErrorType: errorTypeInvalidResponse,
+		},
+		{
+			name:       "accepted status set",
+			statusCode: http.StatusServiceUnavailable,
+			options: config.HTTPCheckConfig{
+				ExpectedStatuses: []config.StatusRange{{Min: 200, Max: 200}, {Min: 500, Max: 599}},
+			},
+		},
+		{
+			name:       "status not in accepted set",
+			statusCode: http.StatusNoContent,
+			options: config.HTTPCheckConfig{
+				ExpectedStatuses: []config.StatusRange{{Min: 200, Max: 200}},
+			},
+			expectedErrorType: errorTypeInvalidResponse,
+		},
+		{
+			name:       "body contains",
+			statusCode: http.StatusOK,
+			body:       `{"status":"ok"}`,
+			options:    config.HTTPCheckConfig{BodyContains: `"ok"`},
+		},
+		{
+			name:              "body does not contain",
+			statusCode:        http.StatusOK,
+			body:              `{"status":"degraded"}`,
+			options:           config.HTTPCheckConfig{BodyContains: `"ok"`},
+			expectedErrorType: errorTypeBodyMismatch,
+		},
+		{
+			name:       "body matches regex",
+			statusCode: http.StatusOK,
+			body:       "uptime: 1234s",
+			options:    config.HTTPCheckConfig{BodyRegex: regexp.MustCompile(`^uptime: \d+s$`)},
+		},
+		{
+			name:              "body does not match regex",
+			statusCode:        http.StatusOK,
+			body:              "uptime: unknown",
+			options:           config.HTTPCheckConfig{BodyRegex: regexp.MustCompile(`^uptime: \d+s$`)},
+			expectedErrorType: errorTypeBodyMismatch,
+		},
+		{
+			name:       "JSON path value matches",
+			statusCode: http.StatusOK,
+			body:       `{"vpn":{"status":"running","peers":[{"connected":true}]}}`,
+			options:    config.HTTPCheckConfig{JSONPath: "vpn.peers.0.connected", JSONValue: "true"},
+		},
+		{
+			name:       "JSON path present",
+			statusCode: http.StatusOK,
+			body:       `{"public_ip":"203.0.113.1"}`,
+			options:    config.HTTPCheckConfig{JSONPath: "$.public_ip"},
+		},
+		{
+			name:              "JSON path value mismatch",
+			statusCode:        http.StatusOK,
+			body:              `{"status":"degraded"}`,
+			options:           config.HTTPCheckConfig{JSONPath: "status", JSONValue: "ok"},
+			expectedErrorType: errorTypeJSONMismatch,
+		},
+		{
+			name:              "JSON path missing",
+			statusCode:        http.StatusOK,
+			body:              `{"status":null}`,
+			options:           config.HTTPCheckConfig{JSONPath: "status"},
+			expectedErrorType: errorTypeJSONMismatch,
+		},
+		{
+			name:              "invalid JSON",
+			statusCode:        http.StatusOK,
+			body:              `not json`,
+			options:           config.HTTPCheckConfig{JSONPath: "status"},
+			expectedErrorType: errorTypeJSONMismatch,
+		},
+		{
+			name:              "body too large",
+			statusCode:        http.StatusOK,
+			body:              `{"status":"ok"}`,
+			options:           config.HTTPCheckConfig{BodyContains: "ok", MaxBodySize: 4},
+			expectedErrorType: errorTypeBodyTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.statusCode)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			m, err := metrics.New(prometheus.NewRegistry())
+			require.NoError(t, err)
+
+			checker := &httpChecker{client: &http.Client{}, metrics: m, options: tt.options}
+			err = checker.Check(checkContext(t), testGateway(t, server.Listener.Addr().String()))
+
+			if tt.expectedErrorType == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			require.Error(t, err)
+			assert.Equal(t, tt.expectedErrorType, errorTypeOf(err))
+		})
+	}
+}
+
+func TestHTTPChecker_Check_Request(t *testing.T) {
+	var receivedMethod, receivedHost, receivedAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedMethod = r.Method
+		receivedHost = r.Host
+		receivedAuth = r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	m, err := metrics.New(prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	checker := &httpChecker{
+		client:  &http.Client{},
+		metrics: m,
+		options: config.HTTPCheckConfig{
+			Method: http.MethodHead,
+			Headers: http.Header{
+				"Authorization": []string{"Bearer token"},
+				"Host":          []string{"gateway.example.com"},
+			},
+		},
+	}
+
+	require.NoError(t, checker.Check(checkContext(t), testGateway(t, server.Listener.Addr().String())))
+	assert.Equal(t, http.MethodHead, receivedMethod)
+	assert.Equal(t, "gateway.example.com", receivedHost)
+	assert.Equal(t, "Bearer token", receivedAuth)
+}
+
+func TestTCPChecker_Check(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	checker := &tcpChecker{}
+	require.NoError(t, checker.Check(checkContext(t), testGateway(t, listener.Addr().String())))
+
+	// Nothing is listening on the port after the listener is closed
+	require.NoError(t, listener.Close())
+	err = checker.Check(checkContext(t), testGateway(t, listener.Addr().String()))
+	require.Error(t, err)
+	assert.Equal(t, errorTypeNetwork, errorTypeOf(err))
+}
+
+func TestDNSChecker_Check_Timeout(t *testing.T) {
+	// A UDP listener that never responds
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	checker := &dnsChecker{queryName: "example.com."}
+	err = checker.Check(ctx, testGateway(t, conn.LocalAddr().String()))
+	require.Error(t, err)
+	assert.Equal(t, errorTypeTimeout, errorTypeOf(err))
+}
+
+func TestGRPCChecker_Check(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("gateway", healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus("draining", healthpb.HealthCheckResponse_NOT_SERVING)
+
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	tests := []struct {
+		name              string
+		service           string
+		expectedErrorType string
+	}{
+		{
+			name: "overall server health",
+		},
+		{
+			name:    "serving service",
+			service: "gateway",
+		},
+		{
+			name:              "not serving service",
+			service:           "draining",
+			expectedErrorType: errorTypeInvalidResponse,
+		},
+		{
+			name:              "unknown service",
+			service:           "unknown",
+			expectedErrorType: errorTypeInvalidResponse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := &grpcChecker{service: tt.service}
+			err := checker.Check(checkContext(t), testGateway(t, listener.Addr().String()))
+
+			if tt.expectedErrorType == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			require.Error(t, err)
+			assert.Equal(t, tt.expectedErrorType, errorTypeOf(err))
+		})
+	}
+}
+
+func TestErrorTypeOf(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{
+			name:     "check error",
+			err:      invalidResponseError("bad response"),
+			expected: errorTypeInvalidResponse,
+		},
+		{
+			name:     "deadline exceeded",
+			err:      networkError(context.DeadlineExceeded),
+			expected: errorTypeTimeout,
+		},
+		{
+			name:     "network error",
+			err:      networkError(errors.New("connection refused")),
+			expected: errorTypeNetwork,
+		},
+		{
+			name:     "untyped error",
+			err:      errors.New("something went wrong"),
+			expected: errorTypeNetwork,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, errorTypeOf(tt.err))
+		})
+	}
+}
@@ -7,15 +7,21 @@ import (
 	"log/slog"
 	"net"
 	"net/http"
-	"strconv"
+	"os"
+	"os/signal"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/config"
 	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/ddns"
 	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/gateway"
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/iputil"
 	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/metrics"
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/nftables"
 	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/routes"
+	"github.com/vishvananda/netlink"
 )
 
 // GatewayMonitor manages the monitoring of gateways and route updates
@@ -26,11 +32,60 @@ type GatewayMonitor struct {
 	metrics      *metrics.Metrics
 	routeManager routes.Manager
 	ddnsUpdater  *ddns.Updater
+
+	// Marks packets that bypass or use the gateways. Nil when nftables integration is disabled.
+	nftables *nftables.Manager
+
+	// Deletes the conntrack entries of connections via removed gateways. Nil when conntrack flushing is disabled.
+	conntrack conntrackHandle
+
+	// Records the kernel changes instead of applying them. Nil when dry run mode is disabled.
+	recorder *iputil.RecordingNetlinkHandle
+
+	// Reports link, route and rule changes. Nil when netlink events are unavailable.
+	events *iputil.EventSource
+
+	// Indexes of the links that the gateways are reached through, as of the last check cycle
+	gatewayLinks atomic.Pointer[map[int]struct{}]
+
+	// Gateway IPs that each route was sent via after the last update, keyed by destination
+	routedNexthops map[string][]string
+
+	// Local address that each routed gateway is reached from, keyed by gateway IP. Nil when unknown.
+	gatewayAddresses map[string]net.IP
+
+	// Health checkers by check type
+	checkers map[string]HealthChecker
+
+	// Suppresses unstable gateways
+	damper *flapDamper
+
+	// Gateways that each pool is currently routed via
+	poolSelections map[poolFamily]poolSelection
+
+	// Receives requests to reload the configuration file
+	reloadRequests chan struct{}
+
+	// Receives requests to repair the kernel rules and routes
+	reconcileRequests chan struct{}
+
+	// Receives requests to check the gateways immediately
+	checkRequests chan struct{}
+}
+
+// Route manager actions for each no gateway policy. Unset policies fall through.
+var noGatewayActions = map[string]routes.NoGatewayAction{
+	config.NoGatewayPolicyFallthrough: routes.NoGatewayFallthrough,
+	config.NoGatewayPolicyBlackhole:   routes.NoGatewayBlackhole,
+	config.NoGatewayPolicyUnreachable: routes.NoGatewayUnreachable,
+	config.NoGatewayPolicyProhibit:    routes.NoGatewayProhibit,
+	config.NoGatewayPolicyGateway:     routes.NoGatewayFallbackGateway,
 }
 
-// New creates a new GatewayMonitor instance
-func New(cfg config.Config, metrics *metrics.Metrics, ddnsUpdater *ddns.Updater) (*GatewayMonitor, error) {
-	gateways, err := gateway.GenerateGateways(cfg.StartIP, cfg.EndIP, cfg.Port, cfg.URLPath, cfg.Scheme, metrics)
+// New creates a new GatewayMonitor instance. The events are optional, and are used to react to network changes
+// immediately.
+func New(cfg config.Config, metrics *metrics.Metrics, ddnsUpdater *ddns.Updater, events *iputil.EventSource) (*GatewayMonitor, error) {
+	gateways, err := gateway.GenerateGatewaysFromConfig(cfg, metrics)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate gateways: %w", err)
 	}
@@ -38,8 +93,93 @@ func New(cfg config.Config, metrics *metrics.Metrics, ddnsUpdater *ddns.Updater)
 	// Set total gateway count
 	metrics.TotalGatewayCount.Set(float64(len(gateways)))
 
-	routeManager, err := routes.NewNetlinkManager(cfg.CIDRsToExclude, cfg.FirstRoutingTableID, cfg.FirstRulePreference)
+	var families []int
+	if cfg.UsesIPv4() {
+		families = append(families, netlink.FAMILY_V4)
+	}
+	if cfg.UsesIPv6() {
+		families = append(families, netlink.FAMILY_V6)
+	}
+
+	// Without any selectors, all traffic is routed via the gateways
+	selectors := make([]routes.Selector, 0, len(cfg.SourceCIDRs)+len(cfg.FWMarks)+1)
+	for _, source := range cfg.SourceCIDRs {
+		selectors = append(selectors, routes.Selector{Source: source})
+	}
+	for _, fwmark := range cfg.FWMarks {
+		selectors = append(selectors, routes.Selector{Mark: fwmark.Mark, Mask: fwmark.Mask})
+	}
+	if cfg.NFTables.SelectsGateways() {
+		mark := cfg.NFTables.UseGatewayMark()
+		selectors = append(selectors, routes.Selector{Mark: mark.Mark, Mask: mark.Mask})
+	}
+
+	bypassSelectors := make([]routes.Selector, 0, len(cfg.BypassFWMarks)+1)
+	for _, fwmark := range cfg.BypassFWMarks {
+		bypassSelectors = append(bypassSelectors, routes.Selector{Mark: fwmark.Mark, Mask: fwmark.Mask})
+	}
+
+	// In dry run mode, all changes are recorded instead of being applied
+	handle := iputil.NewRealNetlinkHandle()
+	var recorder *iputil.RecordingNetlinkHandle
+	var nftablesOpts []nftables.Option
+	if cfg.DryRun {
+		recorder = iputil.NewRecordingNetlinkHandle(handle)
+		handle = recorder
+		nftablesOpts = append(nftablesOpts, nftables.WithRunner(func(ctx context.Context, script string) error {
+			recorder.Record("nftables apply", script)
+			return nil
+		}))
+		slog.Warn("Dry run mode enabled, rule, route and DDNS changes will not be applied")
+	}
+
+	var conntrack conntrackHandle
+	if cfg.ConntrackFlush {
+		conntrack = &netlink.Handle{}
+		if recorder != nil {
+			conntrack = recordingConntrackHandle{conntrackHandle: conntrack, recorder: recorder}
+		}
+	}
+
+	// The table is populated before the rules are added, so that excluded destinations are marked as soon as the
+	// gateway table is used
+	var nftablesManager *nftables.Manager
+	if cfg.NFTables.Enabled {
+		mark := cfg.NFTables.BypassMark()
+		gatewayMark := cfg.NFTables.UseGatewayMark()
+		nftablesOpts = append(nftablesOpts,
+			nftables.WithBypassSources(cfg.NFTables.BypassSources),
+			nftables.WithGatewayMark(gatewayMark.Mark, gatewayMark.Mask, cfg.NFTables.GatewayDestinations, cfg.NFTables.GatewaySources),
+		)
+		nftablesManager = nftables.NewManager(cfg.NFTables.Table, mark.Mark, mark.Mask, families, nftablesOpts...)
+		if err := nftablesManager.Sync(context.Background(), cfg.CIDRsToExclude); err != nil {
+			return nil, fmt.Errorf("failed to create nftables table: %w", err)
+		}
+		bypassSelectors = append(bypassSelectors, routes.Selector{Mark: mark.Mark, Mask: mark.Mask})
+		slog.Info("nftables integration enabled", "table", cfg.NFTables.Table, "mark", mark.String(), "gateway_mark", gatewayMark.String())
+	}
+
+	noGatewayPolicy := routes.NoGatewayPolicy{
+		Action:           noGatewayActions[cfg.NoGateway.Policy],
+		FallbackGateways: cfg.NoGateway.FallbackGateways,
+	}
+
+	routeOpts := []routes.Option{
+		routes.WithFamilies(families...), routes.WithSelectors(selectors...), routes.WithBypassSelectors(bypassSelectors...),
+		routes.WithNoGatewayPolicy(noGatewayPolicy), routes.WithHandle(handle),
+	}
+	if cfg.NexthopGroups {
+		routeOpts = append(routeOpts, routes.WithNexthopGroups(uint16(cfg.NexthopGroupBuckets)))
+		slog.Info("Routing via nexthop groups", "resilient_buckets", cfg.NexthopGroupBuckets)
+	}
+
+	routeManager, err := routes.NewNetlinkManager(cfg.CIDRsToExclude, cfg.FirstRoutingTableID, cfg.FirstRulePreference, routeOpts...)
 	if err != nil {
+		if nftablesManager != nil {
+			if closeErr := nftablesManager.Close(context.Background()); closeErr != nil {
+				slog.Error("Failed to remove nftables table after route manager creation failure", "error", closeErr)
+			}
+		}
 		return nil, fmt.Errorf("failed to create route manager: %w", err)
 	}
 
@@ -47,29 +187,64 @@ func New(cfg config.Config, metrics *metrics.Metrics, ddnsUpdater *ddns.Updater)
 	if cfg.IsDDNSEnabled() {
 		ddnsProvider, err = ddns.NewProvider(cfg)
 		if err != nil {
+			if closeErr := routeManager.Close(); closeErr != nil {
+				slog.Error("Failed to remove routes after DDNS provider creation failure", "error", closeErr)
+			}
+			if nftablesManager != nil {
+				if closeErr := nftablesManager.Close(context.Background()); closeErr != nil {
+					slog.Error("Failed to remove nftables table after DDNS provider creation failure", "error", closeErr)
+				}
+			}
 			return nil, fmt.Errorf("failed to create DDNS provider: %w", err)
 		}
 		slog.Info("DDNS enabled", "provider", ddnsProvider.Name(), "hostname", cfg.DDNSHostname)
 	}
 
+	client := &http.Client{
+		Timeout: cfg.Timeout,
+	}
+
 	return &GatewayMonitor{
-		config:   cfg,
-		gateways: gateways,
-		client: &http.Client{
-			Timeout: cfg.Timeout,
-		},
-		metrics:      metrics,
-		routeManager: routeManager,
-		ddnsUpdater:  ddnsUpdater,
+		config:            cfg,
+		gateways:          gateways,
+		client:            client,
+		checkers:          newHealthCheckers(cfg, client, metrics),
+		damper:            newFlapDamper(cfg.FlapDamping),
+		metrics:           metrics,
+		routeManager:      routeManager,
+		ddnsUpdater:       ddnsUpdater,
+		nftables:          nftablesManager,
+		conntrack:         conntrack,
+		recorder:          recorder,
+		events:            events,
+		reloadRequests:    make(chan struct{}, 1),
+		reconcileRequests: make(chan struct{}, 1),
+		checkRequests:     make(chan struct{}, 1),
 	}, nil
 }
 
 func (gm *GatewayMonitor) Close() error {
+	var routesErr, nftablesErr error
 	if closeableManager, ok := gm.routeManager.(routes.CloseableManager); ok {
-		return closeableManager.Close()
+		routesErr = closeableManager.Close()
 	}
 
-	return nil
+	// The table is removed after the rules, so that excluded destinations are never routed via the gateways
+	if gm.nftables != nil {
+		nftablesErr = gm.nftables.Close(context.Background())
+	}
+
+	return errors.Join(routesErr, nftablesErr)
+}
+
+// PlannedChanges returns a handler that reports the changes recorded in dry run mode, or nil if dry run mode is
+// disabled
+func (gm *GatewayMonitor) PlannedChanges() http.Handler {
+	if gm.recorder == nil {
+		return nil
+	}
+
+	return gm.recorder
 }
 
 // Run starts the main monitoring loop
@@ -77,6 +252,28 @@ func (gm *GatewayMonitor) Run(ctx context.Context) error {
 	ticker := time.NewTicker(gm.config.CheckPeriod)
 	defer ticker.Stop()
 
+	// Reload the configuration on SIGHUP, or when the configuration file changes
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+
+	if gm.config.ConfigFile != "" {
+		go gm.watchConfigFile(ctx, gm.config.ConfigFile)
+	}
+
+	if gm.events != nil {
+		unsubscribe := gm.events.Subscribe(gm.eventHandler(gm.config.FirstRoutingTableID))
+		defer unsubscribe()
+	}
+
+	// Repair rules and routes that are changed by something else. This is skipped in dry run mode, because the
+	// desired state is never applied.
+	reconcileTicker := newReconcileTicker(gm.config.ReconcilePeriod)
+	defer reconcileTicker.Stop()
+	if gm.recorder != nil {
+		reconcileTicker.Stop()
+	}
+
 	// Initial check
 	if err := gm.performCheckCycle(ctx); err != nil {
 		return err
@@ -92,6 +289,38 @@ func (gm *GatewayMonitor) Run(ctx context.Context) error {
 			if err := gm.performCheckCycle(ctx); err != nil {
 				return err
 			}
+		case <-gm.checkRequests:
+			if err := gm.performCheckCycle(ctx); err != nil {
+				return err
+			}
+		case <-reconcileTicker.C:
+			gm.reconcile(ctx)
+		case <-gm.reconcileRequests:
+			gm.reconcile(ctx)
+		case <-hangups:
+			slog.InfoContext(ctx, "Received SIGHUP, reloading configuration")
+			gm.Reload()
+		case <-gm.reloadRequests:
+			previousCheckPeriod := gm.config.CheckPeriod
+			previousReconcilePeriod := gm.config.ReconcilePeriod
+			if err := gm.reloadConfig(ctx); err != nil {
+				gm.metrics.ErrorsTotal.WithLabelValues("config_error").Inc()
+				slog.ErrorContext(ctx, "Failed to reload configuration, keeping current configuration", "error", err)
+				continue
+			}
+
+			if gm.config.CheckPeriod != previousCheckPeriod {
+				ticker.Reset(gm.config.CheckPeriod)
+			}
+
+			if gm.config.ReconcilePeriod != previousReconcilePeriod && gm.recorder == nil {
+				resetReconcileTicker(reconcileTicker, gm.config.ReconcilePeriod)
+			}
+
+			// Apply the new configuration immediately rather than waiting for the next tick
+			if err := gm.performCheckCycle(ctx); err != nil {
+				return err
+			}
 		}
 	}
 }
@@ -103,19 +332,32 @@ func (gm *GatewayMonitor) performCheckCycle(ctx context.Context) error {
 	// Collect active gateways
 	activeGateways := make([]gateway.Gateway, 0, len(gm.gateways))
 	for _, gateway := range gm.gateways {
+		if gm.isSuppressed(ctx, gateway) {
+			continue
+		}
+
 		if gateway.IsActive {
 			activeGateways = append(activeGateways, gateway)
 		}
 	}
 
-	if err := gm.updateRoutes(activeGateways); err != nil {
+	// Each route is only routed via the preferred priority tier of its pool
+	selections := selectPoolGateways(gm.config, activeGateways)
+
+	routedGateways, err := gm.updateRoutes(ctx, selections)
+	if err != nil {
 		gm.metrics.ErrorsTotal.WithLabelValues("route_error").Inc()
 		return fmt.Errorf("failed to update routes: %w", err)
 	}
+	gm.updatePoolState(ctx, selections)
 
 	// This must be done after the routes are updated to ensure that the DDNS provider
 	// can make network requests
-	gm.ddnsUpdater.ScheduleUpdate(activeGateways)
+	gm.ddnsUpdater.ScheduleUpdate(routedGateways)
+
+	if gm.events != nil {
+		gm.refreshGatewayLinks(ctx)
+	}
 
 	gm.metrics.CheckCycleDurationSeconds.Observe(time.Since(start).Seconds())
 	gm.metrics.CheckCyclesTotal.Inc()
@@ -131,16 +373,24 @@ func (gm *GatewayMonitor) checkGateways(ctx context.Context) {
 		wg.Add(1)
 		go func(gateway *gateway.Gateway) {
 			defer wg.Done()
-			gateway.IsActive = gm.checkGateway(ctx, gateway)
-
-			if gateway.IsActive {
-				gateway.ConsecutiveFailures = 0
-			} else {
-				gateway.ConsecutiveFailures++
+			healthy := gm.checkGateway(ctx, gateway)
+			gatewayIP := gateway.IP.String()
+
+			if gateway.RecordCheckResult(healthy, gm.config.Rise, gm.config.Fall) {
+				state := "down"
+				if gateway.IsActive {
+					state = "up"
+				}
+
+				gm.metrics.StateTransitionsTotal.WithLabelValues(gatewayIP, state).Inc()
+				gm.damper.recordTransition(gatewayIP)
+				slog.InfoContext(ctx, "Gateway state changed", "gateway", gateway.IP, "state", state,
+					"consecutive_successes", gateway.ConsecutiveSuccesses, "consecutive_failures", gateway.ConsecutiveFailures)
 			}
 
-			// Update consecutive failures metric
-			gm.metrics.ConsecutiveFailures.WithLabelValues(gateway.IP.String()).Set(float64(gateway.ConsecutiveFailures))
+			// Update consecutive check result metrics
+			gm.metrics.ConsecutiveFailures.WithLabelValues(gatewayIP).Set(float64(gateway.ConsecutiveFailures))
+			gm.metrics.ConsecutiveSuccesses.WithLabelValues(gatewayIP).Set(float64(gateway.ConsecutiveSuccesses))
 		}(&gm.gateways[i])
 	}
 
@@ -159,75 +409,121 @@ func (gm *GatewayMonitor) checkGateways(ctx context.Context) {
 	slog.DebugContext(ctx, "Gateway check complete", "active_count", activeCount, "total_count", len(gm.gateways))
 }
 
+// isSuppressed returns true if the gateway is suppressed by flap damping, and should not be used regardless of its
+// health. Changes to the suppression state are logged.
+func (gm *GatewayMonitor) isSuppressed(ctx context.Context, gw gateway.Gateway) bool {
+	if !gm.config.FlapDamping.Enabled {
+		return false
+	}
+
+	gatewayIP := gw.IP.String()
+	penalty, suppressed, changed := gm.damper.evaluate(gatewayIP)
+
+	gm.metrics.FlapPenalty.WithLabelValues(gatewayIP).Set(penalty)
+	if suppressed {
+		gm.metrics.SuppressedGateways.WithLabelValues(gatewayIP).Set(1)
+	} else {
+		gm.metrics.SuppressedGateways.WithLabelValues(gatewayIP).Set(0)
+	}
+
+	if changed {
+		if suppressed {
+			slog.WarnContext(ctx, "Gateway is flapping, suppressing it until it stabilizes", "gateway", gw.IP, "penalty", penalty)
+		} else {
+			slog.InfoContext(ctx, "Gateway is no longer suppressed", "gateway", gw.IP, "penalty", penalty)
+		}
+	}
+
+	return suppressed
+}
+
 func (gm *GatewayMonitor) checkGateway(ctx context.Context, gw *gateway.Gateway) bool {
 	start := time.Now()
 	gatewayIP := gw.IP.String()
 
-	reqCtx, cancel := context.WithTimeout(ctx, gm.config.Timeout)
-	defer cancel()
-
-	req, err := http.NewRequestWithContext(reqCtx, "GET", gw.URL, nil)
-	if err != nil {
-		gm.metrics.ErrorsTotal.WithLabelValues("network_error").Inc()
+	checker, ok := gm.checkers[gw.CheckType]
+	if !ok {
+		gm.metrics.ErrorsTotal.WithLabelValues(errorTypeNetwork).Inc()
 		gm.metrics.HealthCheckTotal.WithLabelValues(gatewayIP, "failure").Inc()
-		gm.metrics.HealthCheckDurationSeconds.WithLabelValues(gatewayIP).Observe(time.Since(start).Seconds())
-		slog.DebugContext(ctx, "Failed to create request", "gateway", gw.IP, "error", err)
+		slog.ErrorContext(ctx, "Unsupported health check type", "gateway", gw.IP, "type", gw.CheckType)
 		return false
 	}
 
-	resp, err := gm.client.Do(req)
-	duration := time.Since(start).Seconds()
+	checkCtx, cancel := context.WithTimeout(ctx, gm.config.Timeout)
+	defer cancel()
+
+	err := checker.Check(checkCtx, gw)
+	gm.metrics.HealthCheckDurationSeconds.WithLabelValues(gatewayIP).Observe(time.Since(start).Seconds())
 
 	if err != nil {
-		errorType := "network_error"
-		if errors.Is(err, context.DeadlineExceeded) {
-			errorType = "timeout"
-		}
-		gm.metrics.ErrorsTotal.WithLabelValues(errorType).Inc()
+		gm.metrics.ErrorsTotal.WithLabelValues(errorTypeOf(err)).Inc()
 		gm.metrics.HealthCheckTotal.WithLabelValues(gatewayIP, "failure").Inc()
-		gm.metrics.HealthCheckDurationSeconds.WithLabelValues(gatewayIP).Observe(duration)
-		gm.metrics.HTTPRequestDurationSeconds.WithLabelValues(gatewayIP).Observe(duration)
-
-		slog.DebugContext(ctx, "Health check failed", "gateway", gw.IP, "error", err)
+		slog.DebugContext(ctx, "Health check failed", "gateway", gw.IP, "type", gw.CheckType, "error", err)
 		return false
 	}
-	defer resp.Body.Close()
-
-	// Record HTTP metrics
-	gm.metrics.HTTPRequestsTotal.WithLabelValues(gatewayIP, strconv.Itoa(resp.StatusCode), "GET").Inc()
-	gm.metrics.HTTPRequestDurationSeconds.WithLabelValues(gatewayIP).Observe(duration)
-	gm.metrics.HealthCheckDurationSeconds.WithLabelValues(gatewayIP).Observe(duration)
 
-	// Check for any 2xx status code (200-299) as successful
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		gm.metrics.HealthCheckTotal.WithLabelValues(gatewayIP, "success").Inc()
-		slog.DebugContext(ctx, "Gateway is healthy", "gateway", gw.IP, "status", resp.StatusCode)
-		return true
-	}
-
-	gm.metrics.HealthCheckTotal.WithLabelValues(gatewayIP, "failure").Inc()
-	gm.metrics.ErrorsTotal.WithLabelValues("invalid_response").Inc()
-	slog.DebugContext(ctx, "Gateway returned unhealthy status", "gateway", gw.IP, "status", resp.StatusCode)
-	return false
+	gm.metrics.HealthCheckTotal.WithLabelValues(gatewayIP, "success").Inc()
+	gw.RecordLatency(time.Since(start))
+	slog.DebugContext(ctx, "Gateway is healthy", "gateway", gw.IP, "type", gw.CheckType, "latency", gw.Latency)
+	return true
 }
 
-func (gm *GatewayMonitor) updateRoutes(activeGateways []gateway.Gateway) error {
+// updateRoutes routes each configured destination via the gateways selected for its pool. Returns every gateway
+// that at least one route is sent via.
+func (gm *GatewayMonitor) updateRoutes(ctx context.Context, selections map[poolFamily]poolSelection) ([]gateway.Gateway, error) {
 	start := time.Now()
-	defer func() {
-		gm.metrics.RouteUpdateDurationSeconds.Observe(time.Since(start).Seconds())
-	}()
 
-	activeGatewayAddresses := make([]net.IP, len(activeGateways))
-	for i, gw := range activeGateways {
-		activeGatewayAddresses[i] = gw.IP
+	desiredRoutes := make([]routes.Route, 0, len(gm.config.Routes))
+	poolNexthops := make(map[string][]routes.Nexthop)
+	routedIPs := make(map[string]struct{})
+	for _, route := range gm.config.Routes {
+		selection := selections[poolFamily{pool: route.PoolName(), family: iputil.Family(route.Destination.IP)}]
+
+		nexthops := gatewayNexthops(selection.gateways, gm.config.WeightMode)
+		desiredRoutes = append(desiredRoutes, routes.Route{Destination: route.Destination, Nexthops: nexthops, Pool: route.PoolName()})
+
+		poolNexthops[route.PoolName()] = append(poolNexthops[route.PoolName()], nexthops...)
+		for _, gw := range selection.gateways {
+			routedIPs[gw.IP.String()] = struct{}{}
+		}
 	}
 
-	if err := gm.routeManager.UpdateRoutes(gm.config.Routes, activeGatewayAddresses); err != nil {
+	err := gm.routeManager.UpdateRoutes(desiredRoutes)
+	gm.metrics.RouteUpdateDurationSeconds.Observe(time.Since(start).Seconds())
+	if statsManager, ok := gm.routeManager.(routes.UpdateStatsManager); ok {
+		stats := statsManager.LastUpdateStats()
+		gm.metrics.RouteWritesTotal.WithLabelValues("applied").Add(float64(stats.Applied))
+		gm.metrics.RouteWritesTotal.WithLabelValues("skipped").Add(float64(stats.Skipped))
+	}
+	if err != nil {
 		gm.metrics.RouteUpdatesTotal.WithLabelValues("update", "failure").Inc()
-		return err
+		return nil, err
+	}
+
+	// The connections via removed gateways are flushed once new connections are routed via the remaining gateways
+	if gm.conntrack != nil {
+		removed := gm.removedGatewayRoutes(desiredRoutes)
+		gm.recordRoutedNexthops(ctx, desiredRoutes)
+		gm.flushConntrack(ctx, removed, desiredRoutes)
+	}
+
+	// Keep the configured gateway order so that consumers see a stable list
+	routedGateways := make([]gateway.Gateway, 0, len(routedIPs))
+	for _, gw := range gm.gateways {
+		if _, ok := routedIPs[gw.IP.String()]; ok {
+			routedGateways = append(routedGateways, gw)
+		}
 	}
 
 	gm.metrics.RouteUpdatesTotal.WithLabelValues("update", "success").Inc()
-	gm.metrics.DefaultRouteGateways.Set(float64(len(activeGateways)))
-	return nil
+	gm.metrics.DefaultRouteGateways.Set(float64(len(routedGateways)))
+
+	// Only gateways that are in the routes have a weight
+	gm.metrics.GatewayWeight.Reset()
+	for pool, nexthops := range poolNexthops {
+		for _, nexthop := range nexthops {
+			gm.metrics.GatewayWeight.WithLabelValues(nexthop.Gateway.String(), pool).Set(float64(nexthop.Weight))
+		}
+	}
+	return routedGateways, nil
 }
@@ -0,0 +1,57 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/metrics"
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/routes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeUpdateStatsManager struct {
+	stats routes.UpdateStats
+	err   error
+}
+
+func (f *fakeUpdateStatsManager) UpdateRoutes([]routes.Route) error {
+	return f.err
+}
+
+func (f *fakeUpdateStatsManager) LastUpdateStats() routes.UpdateStats {
+	return f.stats
+}
+
+func TestUpdateRoutes_WriteStats(t *testing.T) {
+	m, err := metrics.New(prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	manager := &fakeUpdateStatsManager{stats: routes.UpdateStats{Applied: 1, Skipped: 3}}
+	gm := &GatewayMonitor{metrics: m, routeManager: manager}
+
+	_, err = gm.updateRoutes(context.Background(), nil)
+	require.NoError(t, err)
+
+	// Writes of failed updates are counted as well
+	manager.err = errors.New("netlink error")
+	_, err = gm.updateRoutes(context.Background(), nil)
+	require.Error(t, err)
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.RouteWritesTotal.WithLabelValues("applied")))
+	assert.Equal(t, 6.0, testutil.ToFloat64(m.RouteWritesTotal.WithLabelValues("skipped")))
+}
+
+func TestUpdateRoutes_WriteStatsUnsupported(t *testing.T) {
+	m, err := metrics.New(prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	gm := &GatewayMonitor{metrics: m, routeManager: &fakeReconcilingManager{}}
+
+	_, err = gm.updateRoutes(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, testutil.CollectAndCount(m.RouteWritesTotal))
+}
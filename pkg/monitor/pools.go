@@ -0,0 +1,149 @@
+package monitor
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/config"
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/gateway"
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/iputil"
+	"github.com/vishvananda/netlink"
+)
+
+// poolFamily identifies the gateways of a pool in one IP family
+type poolFamily struct {
+	pool   string
+	family int
+}
+
+// poolSelection holds the gateways that routes using a pool are sent via
+type poolSelection struct {
+	pool     string // Pool that the gateways were selected from. This differs from the route's pool after a fallback.
+	tier     int
+	gateways []gateway.Gateway
+}
+
+// selectPoolGateways selects the gateways to route via for the pool and IP family of each route. Each pool uses the
+// preferred priority tier of its own active gateways. If a pool has no active gateways in a family, its fallback
+// pools are tried in order. Pools without any usable gateways have an empty selection.
+func selectPoolGateways(cfg config.Config, activeGateways []gateway.Gateway) map[poolFamily]poolSelection {
+	type tierSelection struct {
+		gateways []gateway.Gateway
+		tiers    map[int]int
+	}
+
+	// Selects the priority tier of a pool, caching the result as a pool may be used by several routes
+	poolTiers := make(map[string]tierSelection)
+	selectPool := func(pool string) tierSelection {
+		if selection, ok := poolTiers[pool]; ok {
+			return selection
+		}
+
+		var members []gateway.Gateway
+		for _, gw := range activeGateways {
+			if gw.InPool(pool) {
+				members = append(members, gw)
+			}
+		}
+
+		var selection tierSelection
+		selection.gateways, selection.tiers = selectPriorityTiers(members, cfg.Pool(pool).MinTierGateways)
+		poolTiers[pool] = selection
+		return selection
+	}
+
+	selections := make(map[poolFamily]poolSelection)
+	for _, route := range cfg.Routes {
+		key := poolFamily{pool: route.PoolName(), family: iputil.Family(route.Destination.IP)}
+		if _, ok := selections[key]; ok {
+			continue
+		}
+		selections[key] = poolSelection{}
+
+		// Fallback loops are rejected when the configuration is validated, but are guarded against here anyway
+		var visited []string
+		for pool := key.pool; pool != "" && !slices.Contains(visited, pool); pool = cfg.Pool(pool).Fallback {
+			visited = append(visited, pool)
+
+			selection := selectPool(pool)
+			tier, ok := selection.tiers[key.family]
+			if !ok {
+				continue
+			}
+
+			selections[key] = poolSelection{
+				pool: pool,
+				tier: tier,
+				gateways: slices.DeleteFunc(slices.Clone(selection.gateways), func(gw gateway.Gateway) bool {
+					return iputil.Family(gw.IP) != key.family
+				}),
+			}
+			break
+		}
+	}
+
+	return selections
+}
+
+// updatePoolState records the selected gateways of each pool, logging failovers between priority tiers and pools
+func (gm *GatewayMonitor) updatePoolState(ctx context.Context, selections map[poolFamily]poolSelection) {
+	for key, selection := range selections {
+		familyName := familyLabel(key.family)
+		hasSelection := len(selection.gateways) > 0
+		previous := gm.poolSelections[key]
+		hadSelection := len(previous.gateways) > 0
+
+		gm.metrics.PoolRoutedGateways.WithLabelValues(key.pool, familyName).Set(float64(len(selection.gateways)))
+		if !hasSelection {
+			gm.metrics.ActivePriorityTier.DeleteLabelValues(key.pool, familyName)
+			gm.metrics.PoolFallbackActive.DeleteLabelValues(key.pool, familyName)
+
+			if hadSelection {
+				slog.WarnContext(ctx, "Gateway pool has no active gateways", "pool", key.pool, "family", familyName)
+			}
+			continue
+		}
+
+		gm.metrics.ActivePriorityTier.WithLabelValues(key.pool, familyName).Set(float64(selection.tier))
+		if selection.pool != key.pool {
+			gm.metrics.PoolFallbackActive.WithLabelValues(key.pool, familyName).Set(1)
+		} else {
+			gm.metrics.PoolFallbackActive.WithLabelValues(key.pool, familyName).Set(0)
+		}
+
+		if !hadSelection {
+			continue
+		}
+
+		switch {
+		case previous.pool != selection.pool && selection.pool != key.pool:
+			slog.WarnContext(ctx, "Gateway pool has no active gateways, using fallback pool", "pool", key.pool, "family", familyName, "fallback_pool", selection.pool)
+		case previous.pool != selection.pool:
+			slog.InfoContext(ctx, "Gateway pool has active gateways again, no longer using fallback pool", "pool", key.pool, "family", familyName, "fallback_pool", previous.pool)
+		case previous.tier != selection.tier:
+			slog.WarnContext(ctx, "Switched active gateway priority tier", "pool", key.pool, "family", familyName, "previous_tier", previous.tier, "tier", selection.tier)
+		}
+	}
+
+	// Drop the metrics of pools that are no longer used by any routes
+	for key := range gm.poolSelections {
+		if _, ok := selections[key]; !ok {
+			familyName := familyLabel(key.family)
+			gm.metrics.PoolRoutedGateways.DeleteLabelValues(key.pool, familyName)
+			gm.metrics.ActivePriorityTier.DeleteLabelValues(key.pool, familyName)
+			gm.metrics.PoolFallbackActive.DeleteLabelValues(key.pool, familyName)
+		}
+	}
+
+	gm.poolSelections = selections
+}
+
+// familyLabel returns the metric label value for an IP family
+func familyLabel(family int) string {
+	if family == netlink.FAMILY_V6 {
+		return config.IPFamilyIPv6
+	}
+
+	return config.IPFamilyIPv4
+}
@@ -0,0 +1,105 @@
+package monitor
+
+import (
+	"net"
+	"testing"
+
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/config"
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/gateway"
+	"github.com/stretchr/testify/assert"
+	"github.com/vishvananda/netlink"
+)
+
+func TestSelectPoolGateways(t *testing.T) {
+	_, defaultV4, _ := net.ParseCIDR("0.0.0.0/0")
+	_, defaultV6, _ := net.ParseCIDR("::/0")
+	_, office, _ := net.ParseCIDR("10.0.0.0/8")
+
+	fast1 := gateway.Gateway{IP: net.ParseIP("192.168.1.1"), Pools: []string{"fast"}}
+	fast2 := gateway.Gateway{IP: net.ParseIP("192.168.1.2"), Pools: []string{"fast"}, Priority: 1}
+	fast3 := gateway.Gateway{IP: net.ParseIP("192.168.1.3"), Pools: []string{"fast"}, Priority: 1}
+	cheap := gateway.Gateway{IP: net.ParseIP("192.168.2.1"), Pools: []string{"cheap"}}
+	fast6 := gateway.Gateway{IP: net.ParseIP("2001:db8::1"), Pools: []string{"fast"}}
+
+	defaultRoutes := []config.RouteConfig{
+		{Destination: defaultV4},
+		{Destination: defaultV6},
+		{Destination: office, Pool: "fast"},
+	}
+
+	tests := []struct {
+		name           string
+		pools          []config.PoolConfig
+		activeGateways []gateway.Gateway
+		expected       map[poolFamily]poolSelection
+	}{
+		{
+			name: "no active gateways",
+			expected: map[poolFamily]poolSelection{
+				{pool: config.DefaultPool, family: netlink.FAMILY_V4}: {},
+				{pool: config.DefaultPool, family: netlink.FAMILY_V6}: {},
+				{pool: "fast", family: netlink.FAMILY_V4}:             {},
+			},
+		},
+		{
+			name:           "pools only use their members",
+			activeGateways: []gateway.Gateway{fast1, cheap, fast6},
+			expected: map[poolFamily]poolSelection{
+				{pool: config.DefaultPool, family: netlink.FAMILY_V4}: {pool: config.DefaultPool, gateways: []gateway.Gateway{fast1, cheap}},
+				{pool: config.DefaultPool, family: netlink.FAMILY_V6}: {pool: config.DefaultPool, gateways: []gateway.Gateway{fast6}},
+				{pool: "fast", family: netlink.FAMILY_V4}:             {pool: "fast", gateways: []gateway.Gateway{fast1}},
+			},
+		},
+		{
+			name:           "priority tiers are selected per pool",
+			activeGateways: []gateway.Gateway{fast2, cheap},
+			expected: map[poolFamily]poolSelection{
+				{pool: config.DefaultPool, family: netlink.FAMILY_V4}: {pool: config.DefaultPool, gateways: []gateway.Gateway{cheap}},
+				{pool: config.DefaultPool, family: netlink.FAMILY_V6}: {},
+				{pool: "fast", family: netlink.FAMILY_V4}:             {pool: "fast", tier: 1, gateways: []gateway.Gateway{fast2}},
+			},
+		},
+		{
+			name:           "empty pool uses fallback",
+			pools:          []config.PoolConfig{{Name: "fast", Fallback: "cheap"}},
+			activeGateways: []gateway.Gateway{cheap},
+			expected: map[poolFamily]poolSelection{
+				{pool: config.DefaultPool, family: netlink.FAMILY_V4}: {pool: config.DefaultPool, gateways: []gateway.Gateway{cheap}},
+				{pool: config.DefaultPool, family: netlink.FAMILY_V6}: {},
+				{pool: "fast", family: netlink.FAMILY_V4}:             {pool: "cheap", gateways: []gateway.Gateway{cheap}},
+			},
+		},
+		{
+			name:           "fallback is per family",
+			pools:          []config.PoolConfig{{Name: "fast", Fallback: "cheap"}},
+			activeGateways: []gateway.Gateway{fast6, cheap},
+			expected: map[poolFamily]poolSelection{
+				{pool: config.DefaultPool, family: netlink.FAMILY_V4}: {pool: config.DefaultPool, gateways: []gateway.Gateway{cheap}},
+				{pool: config.DefaultPool, family: netlink.FAMILY_V6}: {pool: config.DefaultPool, gateways: []gateway.Gateway{fast6}},
+				{pool: "fast", family: netlink.FAMILY_V4}:             {pool: "cheap", gateways: []gateway.Gateway{cheap}},
+			},
+		},
+		{
+			name:           "pool minimum overrides the global minimum",
+			pools:          []config.PoolConfig{{Name: "fast", MinTierGateways: 2}},
+			activeGateways: []gateway.Gateway{fast1, fast2, fast3},
+			expected: map[poolFamily]poolSelection{
+				{pool: config.DefaultPool, family: netlink.FAMILY_V4}: {pool: config.DefaultPool, gateways: []gateway.Gateway{fast1}},
+				{pool: config.DefaultPool, family: netlink.FAMILY_V6}: {},
+				{pool: "fast", family: netlink.FAMILY_V4}:             {pool: "fast", tier: 1, gateways: []gateway.Gateway{fast2, fast3}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Config{
+				Routes:          defaultRoutes,
+				Pools:           tt.pools,
+				MinTierGateways: 1,
+			}
+
+			assert.Equal(t, tt.expected, selectPoolGateways(cfg, tt.activeGateways))
+		})
+	}
+}
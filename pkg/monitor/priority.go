@@ -0,0 +1,56 @@
+package monitor
+
+import (
+	"slices"
+
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/gateway"
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/iputil"
+	"github.com/vishvananda/netlink"
+)
+
+// selectPriorityTiers returns the active gateways of the preferred priority tier of each IP family, and the selected
+// tier of each family that has active gateways. The preferred tier is the highest priority (lowest value) tier with
+// at least minActive active gateways. If no tier has enough active gateways, the highest priority tier with any
+// active gateways is used, so that traffic is still routed.
+func selectPriorityTiers(activeGateways []gateway.Gateway, minActive int) ([]gateway.Gateway, map[int]int) {
+	minActive = max(minActive, 1)
+
+	selectedTiers := make(map[int]int)
+	for _, family := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		// Count the active gateways of each tier
+		tierCounts := make(map[int]int)
+		for _, gw := range activeGateways {
+			if iputil.Family(gw.IP) == family {
+				tierCounts[gw.Priority]++
+			}
+		}
+
+		if len(tierCounts) == 0 {
+			continue
+		}
+
+		tiers := make([]int, 0, len(tierCounts))
+		for tier := range tierCounts {
+			tiers = append(tiers, tier)
+		}
+		slices.Sort(tiers)
+
+		selectedTier := tiers[0]
+		for _, tier := range tiers {
+			if tierCounts[tier] >= minActive {
+				selectedTier = tier
+				break
+			}
+		}
+		selectedTiers[family] = selectedTier
+	}
+
+	selectedGateways := make([]gateway.Gateway, 0, len(activeGateways))
+	for _, gw := range activeGateways {
+		if tier, ok := selectedTiers[iputil.Family(gw.IP)]; ok && tier == gw.Priority {
+			selectedGateways = append(selectedGateways, gw)
+		}
+	}
+
+	return selectedGateways, selectedTiers
+}
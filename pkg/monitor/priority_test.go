@@ -0,0 +1,80 @@
+package monitor
+
+import (
+	"net"
+	"testing"
+
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/gateway"
+	"github.com/stretchr/testify/assert"
+	"github.com/vishvananda/netlink"
+)
+
+func TestSelectPriorityTiers(t *testing.T) {
+	primary1 := gateway.Gateway{IP: net.ParseIP("192.168.1.1")}
+	primary2 := gateway.Gateway{IP: net.ParseIP("192.168.1.2")}
+	backup1 := gateway.Gateway{IP: net.ParseIP("192.168.2.1"), Priority: 1}
+	backup2 := gateway.Gateway{IP: net.ParseIP("192.168.2.2"), Priority: 1}
+	lastResort := gateway.Gateway{IP: net.ParseIP("192.168.3.1"), Priority: 2}
+	primary6 := gateway.Gateway{IP: net.ParseIP("2001:db8::1")}
+	backup6 := gateway.Gateway{IP: net.ParseIP("2001:db8::2"), Priority: 1}
+
+	tests := []struct {
+		name             string
+		activeGateways   []gateway.Gateway
+		minActive        int
+		expectedGateways []gateway.Gateway
+		expectedTiers    map[int]int
+	}{
+		{
+			name:             "no active gateways",
+			expectedGateways: []gateway.Gateway{},
+			expectedTiers:    map[int]int{},
+		},
+		{
+			name:             "single tier",
+			activeGateways:   []gateway.Gateway{primary1, primary2},
+			expectedGateways: []gateway.Gateway{primary1, primary2},
+			expectedTiers:    map[int]int{netlink.FAMILY_V4: 0},
+		},
+		{
+			name:             "highest priority tier is used",
+			activeGateways:   []gateway.Gateway{backup1, primary1, lastResort},
+			expectedGateways: []gateway.Gateway{primary1},
+			expectedTiers:    map[int]int{netlink.FAMILY_V4: 0},
+		},
+		{
+			name:             "fails over when primary tier is empty",
+			activeGateways:   []gateway.Gateway{backup1, backup2, lastResort},
+			expectedGateways: []gateway.Gateway{backup1, backup2},
+			expectedTiers:    map[int]int{netlink.FAMILY_V4: 1},
+		},
+		{
+			name:             "fails over when below minimum",
+			activeGateways:   []gateway.Gateway{primary1, backup1, backup2},
+			minActive:        2,
+			expectedGateways: []gateway.Gateway{backup1, backup2},
+			expectedTiers:    map[int]int{netlink.FAMILY_V4: 1},
+		},
+		{
+			name:             "highest priority tier is used when no tier meets the minimum",
+			activeGateways:   []gateway.Gateway{lastResort, primary1, backup1},
+			minActive:        2,
+			expectedGateways: []gateway.Gateway{primary1},
+			expectedTiers:    map[int]int{netlink.FAMILY_V4: 0},
+		},
+		{
+			name:             "tiers are selected per family",
+			activeGateways:   []gateway.Gateway{backup1, primary6, backup6},
+			expectedGateways: []gateway.Gateway{backup1, primary6},
+			expectedTiers:    map[int]int{netlink.FAMILY_V4: 1, netlink.FAMILY_V6: 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selectedGateways, selectedTiers := selectPriorityTiers(tt.activeGateways, tt.minActive)
+			assert.Equal(t, tt.expectedGateways, selectedGateways)
+			assert.Equal(t, tt.expectedTiers, selectedTiers)
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package monitor
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/routes"
+)
+
+// How long the managed rules and the gateway table must be unchanged before they are reconciled. Changes usually
+// come in bursts, such as when a table is flushed.
+const reconcileDebounce = time.Second
+
+// requestReconcile schedules a comparison of the kernel rules and routes with the desired state. If one is already
+// pending, this is a no-op.
+func (gm *GatewayMonitor) requestReconcile() {
+	select {
+	case gm.reconcileRequests <- struct{}{}:
+	default:
+	}
+}
+
+// newReconcileTicker returns a ticker for periodic reconciliation. The ticker is stopped when the period is zero.
+func newReconcileTicker(period time.Duration) *time.Ticker {
+	if period == 0 {
+		ticker := time.NewTicker(time.Hour)
+		ticker.Stop()
+		return ticker
+	}
+
+	return time.NewTicker(period)
+}
+
+// resetReconcileTicker changes the period of a ticker returned by newReconcileTicker
+func resetReconcileTicker(ticker *time.Ticker, period time.Duration) {
+	if period == 0 {
+		ticker.Stop()
+		return
+	}
+
+	ticker.Reset(period)
+}
+
+// reconcile repairs any differences between the kernel rules and routes and the desired state, and reports them
+func (gm *GatewayMonitor) reconcile(ctx context.Context) {
+	reconcilingManager, ok := gm.routeManager.(routes.ReconcilingManager)
+	if !ok {
+		return
+	}
+
+	drifts, err := reconcilingManager.Reconcile()
+	for _, drift := range drifts {
+		family := familyLabel(drift.Family)
+		gm.metrics.DriftEventsTotal.WithLabelValues(drift.Kind, family).Inc()
+		slog.WarnContext(ctx, "Repaired rule or route that was changed by something else", "kind", drift.Kind,
+			"family", family, "desired", drift.Desired, "observed", drift.Observed)
+	}
+
+	if err != nil {
+		gm.metrics.ErrorsTotal.WithLabelValues("reconcile_error").Inc()
+		slog.ErrorContext(ctx, "Failed to reconcile rules and routes", "error", err)
+	}
+}
@@ -0,0 +1,92 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/metrics"
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/routes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+)
+
+type fakeReconcilingManager struct {
+	drifts     []routes.Drift
+	err        error
+	reconciles int
+}
+
+func (f *fakeReconcilingManager) UpdateRoutes([]routes.Route) error {
+	return nil
+}
+
+func (f *fakeReconcilingManager) Reconcile() ([]routes.Drift, error) {
+	f.reconciles++
+	return f.drifts, f.err
+}
+
+func TestReconcile(t *testing.T) {
+	m, err := metrics.New(prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	manager := &fakeReconcilingManager{
+		drifts: []routes.Drift{
+			{Kind: routes.DriftMissingRule, Family: netlink.FAMILY_V4},
+			{Kind: routes.DriftMissingRoute, Family: netlink.FAMILY_V4},
+			{Kind: routes.DriftMissingRoute, Family: netlink.FAMILY_V6},
+		},
+		err: errors.New("netlink error"),
+	}
+	gm := &GatewayMonitor{metrics: m, routeManager: manager}
+
+	gm.reconcile(context.Background())
+
+	assert.Equal(t, 1, manager.reconciles)
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.DriftEventsTotal.WithLabelValues(routes.DriftMissingRule, "ipv4")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.DriftEventsTotal.WithLabelValues(routes.DriftMissingRoute, "ipv4")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.DriftEventsTotal.WithLabelValues(routes.DriftMissingRoute, "ipv6")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.ErrorsTotal.WithLabelValues("reconcile_error")))
+}
+
+func TestReconcile_Unsupported(t *testing.T) {
+	m, err := metrics.New(prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	gm := &GatewayMonitor{metrics: m, routeManager: struct{ routes.Manager }{}}
+
+	require.NotPanics(t, func() { gm.reconcile(context.Background()) })
+	assert.Equal(t, 0, testutil.CollectAndCount(m.DriftEventsTotal))
+}
+
+func TestRequestReconcile(t *testing.T) {
+	gm := &GatewayMonitor{reconcileRequests: make(chan struct{}, 1)}
+
+	// Requests are merged while one is pending
+	gm.requestReconcile()
+	gm.requestReconcile()
+
+	assert.Len(t, gm.reconcileRequests, 1)
+}
+
+func TestReconcileTicker(t *testing.T) {
+	ticker := newReconcileTicker(0)
+	defer ticker.Stop()
+
+	select {
+	case <-ticker.C:
+		t.Fatal("disabled ticker ticked")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	resetReconcileTicker(ticker, time.Millisecond)
+	select {
+	case <-ticker.C:
+	case <-time.After(time.Second):
+		t.Fatal("ticker did not tick after being enabled")
+	}
+}
@@ -0,0 +1,250 @@
+package monitor
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/config"
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/gateway"
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/routes"
+)
+
+// How often the configuration file is checked for changes
+const configFilePollInterval = 5 * time.Second
+
+// Reload schedules a reload of the configuration. This is safe to call from any goroutine. If a reload is already
+// pending, this is a no-op.
+func (gm *GatewayMonitor) Reload() {
+	select {
+	case gm.reloadRequests <- struct{}{}:
+	default:
+	}
+}
+
+// watchConfigFile polls the configuration file for content changes, and schedules a reload when it changes.
+// Polling is used instead of inotify so that atomic replacements (such as Kubernetes ConfigMap symlink swaps)
+// are picked up.
+func (gm *GatewayMonitor) watchConfigFile(ctx context.Context, path string) {
+	lastHash, err := hashFile(path)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to read configuration file for change detection", "path", path, "error", err)
+	}
+
+	ticker := time.NewTicker(configFilePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			hash, err := hashFile(path)
+			if err != nil {
+				slog.DebugContext(ctx, "Failed to read configuration file for change detection", "path", path, "error", err)
+				continue
+			}
+
+			if hash == lastHash {
+				continue
+			}
+
+			lastHash = hash
+			slog.InfoContext(ctx, "Configuration file changed, reloading configuration", "path", path)
+			gm.Reload()
+		}
+	}
+}
+
+func hashFile(path string) ([sha256.Size]byte, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+
+	return sha256.Sum256(contents), nil
+}
+
+// reloadConfig parses and applies the configuration again. The gateway range, health check settings, routes,
+// exclusions and log level are applied to the running monitor without removing the existing routes. Other
+// settings require a restart to take effect.
+func (gm *GatewayMonitor) reloadConfig(ctx context.Context) error {
+	newConfig, err := gm.config.Reload()
+	if err != nil {
+		return fmt.Errorf("failed to parse configuration: %w", err)
+	}
+
+	keepNonReloadableFields(ctx, gm.config, &newConfig)
+
+	if err := newConfig.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	gateways, err := gateway.GenerateGatewaysFromConfig(newConfig, gm.metrics)
+	if err != nil {
+		return fmt.Errorf("failed to generate gateways: %w", err)
+	}
+
+	exclusionManager, ok := gm.routeManager.(routes.ExclusionManager)
+	if ok {
+		if err := exclusionManager.UpdateExclusions(newConfig.CIDRsToExclude); err != nil {
+			return fmt.Errorf("failed to update excluded networks: %w", err)
+		}
+	} else {
+		slog.WarnContext(ctx, "Route manager does not support updating excluded networks, restart to apply changes")
+	}
+
+	if gm.nftables != nil {
+		if err := gm.nftables.Sync(ctx, newConfig.CIDRsToExclude); err != nil {
+			// Restore the exclusion rules of the configuration that stays in effect
+			if ok {
+				if rollbackErr := exclusionManager.UpdateExclusions(gm.config.CIDRsToExclude); rollbackErr != nil {
+					slog.ErrorContext(ctx, "Failed to restore excluded networks", "error", rollbackErr)
+				}
+			}
+			return fmt.Errorf("failed to update nftables table: %w", err)
+		}
+	}
+
+	gm.replaceGateways(gateways)
+	gm.client.Timeout = newConfig.Timeout
+	gm.checkers = newHealthCheckers(newConfig, gm.client, gm.metrics)
+	gm.damper.setConfig(newConfig.FlapDamping)
+	if !newConfig.FlapDamping.Enabled {
+		gm.metrics.SuppressedGateways.Reset()
+		gm.metrics.FlapPenalty.Reset()
+	}
+	gm.config = newConfig
+
+	slog.SetLogLoggerLevel(newConfig.GetSlogLevel())
+	slog.InfoContext(ctx, "Reloaded configuration", "gateway_count", len(gm.gateways), "routes", newConfig.Routes, "check_period", newConfig.CheckPeriod)
+	return nil
+}
+
+// replaceGateways swaps the monitored gateways for the provided ones, keeping the health state of gateways that
+// are in both sets so that routes are not disrupted by a reload
+func (gm *GatewayMonitor) replaceGateways(gateways []gateway.Gateway) {
+	existing := make(map[string]gateway.Gateway, len(gm.gateways))
+	for _, gw := range gm.gateways {
+		existing[gw.IP.String()] = gw
+	}
+
+	for i := range gateways {
+		gatewayIP := gateways[i].IP.String()
+		if previous, ok := existing[gatewayIP]; ok {
+			gateways[i].CopyState(previous)
+			delete(existing, gatewayIP)
+		}
+	}
+
+	// Drop the metrics of gateways that are no longer monitored
+	for gatewayIP := range existing {
+		gm.metrics.ConsecutiveFailures.DeleteLabelValues(gatewayIP)
+		gm.metrics.ConsecutiveSuccesses.DeleteLabelValues(gatewayIP)
+		gm.metrics.StateTransitionsTotal.DeletePartialMatch(prometheus.Labels{"gateway_ip": gatewayIP})
+		gm.metrics.SuppressedGateways.DeleteLabelValues(gatewayIP)
+		gm.metrics.FlapPenalty.DeleteLabelValues(gatewayIP)
+		gm.damper.forget(gatewayIP)
+	}
+
+	gm.gateways = gateways
+	gm.metrics.TotalGatewayCount.Set(float64(len(gateways)))
+}
+
+// keepNonReloadableFields copies settings that cannot be changed at runtime from the current configuration to the
+// new one, warning about any that were changed
+func keepNonReloadableFields(ctx context.Context, current config.Config, newConfig *config.Config) {
+	warn := func(field string, changed bool) {
+		if changed {
+			slog.WarnContext(ctx, "Configuration field cannot be changed without a restart, ignoring new value", "field", field)
+		}
+	}
+
+	warn("first-routing-table-id", newConfig.FirstRoutingTableID != current.FirstRoutingTableID)
+	newConfig.FirstRoutingTableID = current.FirstRoutingTableID
+
+	warn("first-rule-preference", newConfig.FirstRulePreference != current.FirstRulePreference)
+	newConfig.FirstRulePreference = current.FirstRulePreference
+
+	warn("ip-family", newConfig.IPFamily != current.IPFamily)
+	newConfig.IPFamily = current.IPFamily
+
+	sourceCIDRsChanged := !slices.EqualFunc(newConfig.SourceCIDRs, current.SourceCIDRs, func(a, b *net.IPNet) bool {
+		return a.String() == b.String()
+	})
+	warn("source-cidrs", sourceCIDRsChanged)
+	newConfig.SourceCIDRs = current.SourceCIDRs
+
+	warn("fwmarks", !slices.Equal(newConfig.FWMarks, current.FWMarks))
+	newConfig.FWMarks = current.FWMarks
+
+	warn("bypass-fwmarks", !slices.Equal(newConfig.BypassFWMarks, current.BypassFWMarks))
+	newConfig.BypassFWMarks = current.BypassFWMarks
+
+	warn("nftables-*", !newConfig.NFTables.Equal(current.NFTables))
+	newConfig.NFTables = current.NFTables
+
+	noGatewayChanged := newConfig.NoGateway.Policy != current.NoGateway.Policy ||
+		!slices.EqualFunc(newConfig.NoGateway.FallbackGateways, current.NoGateway.FallbackGateways, net.IP.Equal)
+	warn("no-gateway-*", noGatewayChanged)
+	newConfig.NoGateway = current.NoGateway
+
+	warn("nexthop-groups", newConfig.NexthopGroups != current.NexthopGroups)
+	newConfig.NexthopGroups = current.NexthopGroups
+
+	warn("nexthop-group-buckets", newConfig.NexthopGroupBuckets != current.NexthopGroupBuckets)
+	newConfig.NexthopGroupBuckets = current.NexthopGroupBuckets
+
+	warn("conntrack-flush", newConfig.ConntrackFlush != current.ConntrackFlush)
+	newConfig.ConntrackFlush = current.ConntrackFlush
+
+	warn("dry-run", newConfig.DryRun != current.DryRun)
+	newConfig.DryRun = current.DryRun
+
+	warn("metrics-port", newConfig.MetricsPort != current.MetricsPort)
+	newConfig.MetricsPort = current.MetricsPort
+
+	ddnsChanged := newConfig.DDNSProvider != current.DDNSProvider ||
+		newConfig.DDNSUsername != current.DDNSUsername ||
+		newConfig.DDNSPassword != current.DDNSPassword ||
+		newConfig.DDNSHostname != current.DDNSHostname ||
+		newConfig.DDNSRequireIPAddress != current.DDNSRequireIPAddress ||
+		newConfig.DDNSTimeout != current.DDNSTimeout ||
+		newConfig.DDNSTTL != current.DDNSTTL ||
+		newConfig.DDNSRecordComment != current.DDNSRecordComment ||
+		newConfig.DDNSCloudflareProxied != current.DDNSCloudflareProxied ||
+		newConfig.DDNSServer != current.DDNSServer ||
+		newConfig.DDNSZone != current.DDNSZone ||
+		newConfig.DDNSTSIGAlgorithm != current.DDNSTSIGAlgorithm ||
+		newConfig.DDNSRoute53RoutingPolicy != current.DDNSRoute53RoutingPolicy ||
+		!maps.Equal(newConfig.DDNSRoute53HealthChecks, current.DDNSRoute53HealthChecks) ||
+		!newConfig.DDNSWebhook.Equal(current.DDNSWebhook) ||
+		newConfig.DDNSDynDNS2MultipleIPs != current.DDNSDynDNS2MultipleIPs
+	warn("ddns-*", ddnsChanged)
+	newConfig.DDNSProvider = current.DDNSProvider
+	newConfig.DDNSUsername = current.DDNSUsername
+	newConfig.DDNSPassword = current.DDNSPassword
+	newConfig.DDNSHostname = current.DDNSHostname
+	newConfig.DDNSRequireIPAddress = current.DDNSRequireIPAddress
+	newConfig.DDNSTimeout = current.DDNSTimeout
+	newConfig.DDNSTTL = current.DDNSTTL
+	newConfig.DDNSRecordComment = current.DDNSRecordComment
+	newConfig.DDNSCloudflareProxied = current.DDNSCloudflareProxied
+	newConfig.DDNSServer = current.DDNSServer
+	newConfig.DDNSZone = current.DDNSZone
+	newConfig.DDNSTSIGAlgorithm = current.DDNSTSIGAlgorithm
+	newConfig.DDNSRoute53RoutingPolicy = current.DDNSRoute53RoutingPolicy
+	newConfig.DDNSRoute53HealthChecks = current.DDNSRoute53HealthChecks
+	newConfig.DDNSWebhook = current.DDNSWebhook
+	newConfig.DDNSDynDNS2MultipleIPs = current.DDNSDynDNS2MultipleIPs
+
+	warn("public-ip-service-*", newConfig.PublicIPService != current.PublicIPService)
+	newConfig.PublicIPService = current.PublicIPService
+}
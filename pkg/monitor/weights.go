@@ -0,0 +1,51 @@
+package monitor
+
+import (
+	"math"
+	"time"
+
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/config"
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/gateway"
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/routes"
+)
+
+// Multiplier for configured weights when weights are derived from latency. The fastest gateway gets its configured
+// weight times this value, and slower gateways get proportionally less, so that small latency differences still
+// result in different weights.
+const latencyWeightScale = 10
+
+// gatewayNexthops converts the active gateways to route nexthops, with weights determined by the weight mode
+func gatewayNexthops(gateways []gateway.Gateway, weightMode string) []routes.Nexthop {
+	// Find the fastest gateway, which latency-based weights are relative to
+	var fastest time.Duration
+	if weightMode == config.WeightModeLatency {
+		for _, gw := range gateways {
+			if gw.Latency > 0 && (fastest == 0 || gw.Latency < fastest) {
+				fastest = gw.Latency
+			}
+		}
+	}
+
+	nexthops := make([]routes.Nexthop, 0, len(gateways))
+	for _, gw := range gateways {
+		weight := max(gw.Weight, 1)
+		if weightMode == config.WeightModeLatency {
+			weight *= latencyWeightScale
+
+			// Gateways without a latency measurement yet are treated as the fastest
+			if gw.Latency > 0 {
+				weight = int(math.Round(float64(weight) * fastest.Seconds() / gw.Latency.Seconds()))
+			}
+		}
+
+		nexthops = append(nexthops, routes.Nexthop{
+			Gateway:         gw.IP,
+			Weight:          min(max(weight, 1), routes.MaxWeight),
+			Interface:       gw.Interface,
+			OnLink:          gw.OnLink,
+			PreferredSource: gw.PreferredSource,
+		})
+	}
+
+	return nexthops
+}
@@ -0,0 +1,106 @@
+package monitor
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/config"
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/gateway"
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/routes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGatewayNexthops(t *testing.T) {
+	gateway1 := net.ParseIP("192.168.1.1")
+	gateway2 := net.ParseIP("192.168.1.2")
+	gateway3 := net.ParseIP("192.168.1.3")
+
+	tests := []struct {
+		name       string
+		gateways   []gateway.Gateway
+		weightMode string
+		expected   []routes.Nexthop
+	}{
+		{
+			name: "default weights",
+			gateways: []gateway.Gateway{
+				{IP: gateway1},
+				{IP: gateway2, Latency: time.Second},
+			},
+			expected: []routes.Nexthop{
+				{Gateway: gateway1, Weight: 1},
+				{Gateway: gateway2, Weight: 1},
+			},
+		},
+		{
+			name: "interface settings",
+			gateways: []gateway.Gateway{
+				{IP: gateway1, Interface: "wg0", OnLink: true, PreferredSource: net.ParseIP("10.0.0.2")},
+				{IP: gateway2},
+			},
+			expected: []routes.Nexthop{
+				{Gateway: gateway1, Weight: 1, Interface: "wg0", OnLink: true, PreferredSource: net.ParseIP("10.0.0.2")},
+				{Gateway: gateway2, Weight: 1},
+			},
+		},
+		{
+			name: "static weights ignore latency",
+			gateways: []gateway.Gateway{
+				{IP: gateway1, Weight: 3, Latency: 10 * time.Millisecond},
+				{IP: gateway2, Weight: 1, Latency: time.Second},
+			},
+			weightMode: config.WeightModeStatic,
+			expected: []routes.Nexthop{
+				{Gateway: gateway1, Weight: 3},
+				{Gateway: gateway2, Weight: 1},
+			},
+		},
+		{
+			name: "latency weights are relative to the fastest gateway",
+			gateways: []gateway.Gateway{
+				{IP: gateway1, Latency: 10 * time.Millisecond},
+				{IP: gateway2, Latency: 20 * time.Millisecond},
+				{IP: gateway3, Latency: time.Second},
+			},
+			weightMode: config.WeightModeLatency,
+			expected: []routes.Nexthop{
+				{Gateway: gateway1, Weight: 10},
+				{Gateway: gateway2, Weight: 5},
+				{Gateway: gateway3, Weight: 1},
+			},
+		},
+		{
+			name: "latency weights scale configured weights",
+			gateways: []gateway.Gateway{
+				{IP: gateway1, Weight: 2, Latency: 10 * time.Millisecond},
+				{IP: gateway2, Weight: 100, Latency: 10 * time.Millisecond},
+				{IP: gateway3, Weight: 4, Latency: 40 * time.Millisecond},
+			},
+			weightMode: config.WeightModeLatency,
+			expected: []routes.Nexthop{
+				{Gateway: gateway1, Weight: 20},
+				{Gateway: gateway2, Weight: routes.MaxWeight},
+				{Gateway: gateway3, Weight: 10},
+			},
+		},
+		{
+			name: "gateways without latency are treated as the fastest",
+			gateways: []gateway.Gateway{
+				{IP: gateway1},
+				{IP: gateway2, Latency: 20 * time.Millisecond},
+			},
+			weightMode: config.WeightModeLatency,
+			expected: []routes.Nexthop{
+				{Gateway: gateway1, Weight: 10},
+				{Gateway: gateway2, Weight: 10},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, gatewayNexthops(tt.gateways, tt.weightMode))
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package nftables
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os/exec"
+	"strings"
+
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/iputil"
+	"github.com/vishvananda/netlink"
+)
+
+// Runner applies an nftables script, such as by running `nft -f -`
+type Runner func(ctx context.Context, script string) error
+
+// Manager maintains an nftables table that sets a firewall mark on packets sent to excluded destinations. Paired
+// with a routing rule for the mark, this keeps the packets out of the gateway table. The destination sets are kept
+// in sync with the excluded networks. Packets from bypassed sources can be marked the same way, and packets to or
+// from other networks can be given a second mark that is routed via the gateways.
+type Manager struct {
+	table    string
+	mark     uint32
+	mask     uint32
+	families []int
+	run      Runner
+
+	bypassSources       []*net.IPNet
+	gatewayMark         uint32
+	gatewayMask         uint32
+	gatewayDestinations []*net.IPNet
+	gatewaySources      []*net.IPNet
+}
+
+// markedSet is a set of networks that packets are marked by, by destination or source address
+type markedSet struct {
+	name     string
+	selector string // The address of the packet that is matched, daddr or saddr
+	networks []*net.IPNet
+	mark     uint32
+	mask     uint32
+}
+
+// Option configures optional Manager behavior
+type Option func(*Manager)
+
+// WithRunner replaces the function that applies nftables scripts. By default, scripts are applied with the nft
+// command.
+func WithRunner(run Runner) Option {
+	return func(m *Manager) {
+		m.run = run
+	}
+}
+
+// WithBypassSources sets the bypass mark on packets from the given networks as well
+func WithBypassSources(sources []*net.IPNet) Option {
+	return func(m *Manager) {
+		m.bypassSources = iputil.ReduceNetworks(sources)
+	}
+}
+
+// WithGatewayMark sets the bits of the mask in the firewall mark of packets to the destinations, or from the sources,
+// to the mark. Paired with a selector rule for the mark, this routes the packets via the gateways.
+func WithGatewayMark(mark, mask uint32, destinations, sources []*net.IPNet) Option {
+	return func(m *Manager) {
+		m.gatewayMark = mark
+		m.gatewayMask = mask
+		m.gatewayDestinations = iputil.ReduceNetworks(destinations)
+		m.gatewaySources = iputil.ReduceNetworks(sources)
+	}
+}
+
+// NewManager creates a manager for the named table in the inet family. Packets to excluded destinations have the bits
+// of the mask in their firewall mark set to the mark. The table is not created until Sync is called.
+func NewManager(table string, mark, mask uint32, families []int, opts ...Option) *Manager {
+	manager := &Manager{
+		table:    table,
+		mark:     mark,
+		mask:     mask,
+		families: families,
+		run:      runNFT,
+	}
+
+	for _, opt := range opts {
+		opt(manager)
+	}
+
+	return manager
+}
+
+// Sync replaces the table with one that marks packets to the given networks. The table is replaced atomically, so
+// there is no window where packets are not marked.
+func (m *Manager) Sync(ctx context.Context, netsToExclude []*net.IPNet) error {
+	if err := m.run(ctx, m.script(iputil.ReduceNetworks(netsToExclude))); err != nil {
+		return fmt.Errorf("failed to apply nftables table %s: %w", m.table, err)
+	}
+
+	slog.DebugContext(ctx, "Synced nftables table", "table", m.table, "excluded_networks", netsToExclude)
+	return nil
+}
+
+// Close removes the table
+func (m *Manager) Close(ctx context.Context) error {
+	// Declaring the table first prevents an error if it does not exist
+	script := fmt.Sprintf("table inet %s\ndelete table inet %s\n", m.table, m.table)
+	if err := m.run(ctx, script); err != nil {
+		return fmt.Errorf("failed to delete nftables table %s: %w", m.table, err)
+	}
+
+	return nil
+}
+
+// script builds an nftables script that replaces the table. The (already reduced) networks must not overlap, as
+// they are added to interval sets.
+func (m *Manager) script(netsToExclude []*net.IPNet) string {
+	var sb strings.Builder
+
+	// Declaring the table before deleting it makes the script work whether or not the table already exists. The whole
+	// script is applied as a single transaction.
+	fmt.Fprintf(&sb, "table inet %s\n", m.table)
+	fmt.Fprintf(&sb, "delete table inet %s\n", m.table)
+	fmt.Fprintf(&sb, "table inet %s {\n", m.table)
+
+	sets := m.markedSets(netsToExclude)
+	for _, set := range sets {
+		for _, family := range m.families {
+			fmt.Fprintf(&sb, "\tset %s {\n", setName(set.name, family))
+			fmt.Fprintf(&sb, "\t\ttype %s\n", setType(family))
+			sb.WriteString("\t\tflags interval\n")
+
+			var elements []string
+			for _, network := range set.networks {
+				if iputil.Family(network.IP) == family {
+					elements = append(elements, network.String())
+				}
+			}
+			if len(elements) > 0 {
+				fmt.Fprintf(&sb, "\t\telements = { %s }\n", strings.Join(elements, ", "))
+			}
+
+			sb.WriteString("\t}\n")
+		}
+	}
+
+	// Forwarded packets are marked before the routing decision is made. Locally generated packets are rerouted after
+	// their mark is changed by the route chain.
+	chains := []struct {
+		name string
+		kind string
+		hook string
+	}{
+		{name: "prerouting", kind: "filter", hook: "prerouting"},
+		{name: "output", kind: "route", hook: "output"},
+	}
+	for _, chain := range chains {
+		fmt.Fprintf(&sb, "\tchain %s {\n", chain.name)
+		fmt.Fprintf(&sb, "\t\ttype %s hook %s priority mangle; policy accept;\n", chain.kind, chain.hook)
+		for _, set := range sets {
+			for _, family := range m.families {
+				fmt.Fprintf(&sb, "\t\t%s %s @%s meta mark set %s\n", addressType(family), set.selector, setName(set.name, family), markExpression(set.mark, set.mask))
+			}
+		}
+		sb.WriteString("\t}\n")
+	}
+
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// markedSets returns the sets of the table. The set of excluded destinations always exists, so that other rules can
+// reference it, while the other sets only exist when they are configured.
+func (m *Manager) markedSets(netsToExclude []*net.IPNet) []markedSet {
+	sets := []markedSet{{name: "excluded", selector: "daddr", networks: netsToExclude, mark: m.mark, mask: m.mask}}
+	if len(m.bypassSources) > 0 {
+		sets = append(sets, markedSet{name: "bypass-sources", selector: "saddr", networks: m.bypassSources, mark: m.mark, mask: m.mask})
+	}
+	if len(m.gatewayDestinations) > 0 {
+		sets = append(sets, markedSet{name: "gateway-destinations", selector: "daddr", networks: m.gatewayDestinations, mark: m.gatewayMark, mask: m.gatewayMask})
+	}
+	if len(m.gatewaySources) > 0 {
+		sets = append(sets, markedSet{name: "gateway-sources", selector: "saddr", networks: m.gatewaySources, mark: m.gatewayMark, mask: m.gatewayMask})
+	}
+
+	return sets
+}
+
+// markExpression returns the expression that sets the masked bits of the packet mark, keeping the other bits
+func markExpression(mark, mask uint32) string {
+	if mask == ^uint32(0) {
+		return fmt.Sprintf("%#x", mark)
+	}
+
+	return fmt.Sprintf("meta mark and %#x or %#x", ^mask, mark)
+}
+
+func setName(name string, family int) string {
+	if family == netlink.FAMILY_V6 {
+		return name + "-ipv6"
+	}
+
+	return name + "-ipv4"
+}
+
+func setType(family int) string {
+	if family == netlink.FAMILY_V6 {
+		return "ipv6_addr"
+	}
+
+	return "ipv4_addr"
+}
+
+func addressType(family int) string {
+	if family == netlink.FAMILY_V6 {
+		return "ip6"
+	}
+
+	return "ip"
+}
+
+// runNFT applies a script with the nft command
+func runNFT(ctx context.Context, script string) error {
+	cmd := exec.CommandContext(ctx, "nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(script)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("nft failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
@@ -0,0 +1,158 @@
+package nftables
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+)
+
+func parseCIDR(t *testing.T, s string) *net.IPNet {
+	_, cidr, err := net.ParseCIDR(s)
+	require.NoError(t, err)
+	return cidr
+}
+
+func TestManager_Sync(t *testing.T) {
+	var scripts []string
+	manager := NewManager("grm", 0x10000, 0x10000, []int{netlink.FAMILY_V4, netlink.FAMILY_V6}, WithRunner(func(ctx context.Context, script string) error {
+		scripts = append(scripts, script)
+		return nil
+	}))
+
+	netsToExclude := []*net.IPNet{
+		parseCIDR(t, "10.0.0.0/8"),
+		parseCIDR(t, "10.1.0.0/16"), // Subset of 10.0.0.0/8, so it must be reduced away
+		parseCIDR(t, "192.168.0.0/16"),
+	}
+	require.NoError(t, manager.Sync(context.Background(), netsToExclude))
+
+	require.Len(t, scripts, 1)
+	assert.Equal(t, `table inet grm
+delete table inet grm
+table inet grm {
+	set excluded-ipv4 {
+		type ipv4_addr
+		flags interval
+		elements = { 10.0.0.0/8, 192.168.0.0/16 }
+	}
+	set excluded-ipv6 {
+		type ipv6_addr
+		flags interval
+	}
+	chain prerouting {
+		type filter hook prerouting priority mangle; policy accept;
+		ip daddr @excluded-ipv4 meta mark set meta mark and 0xfffeffff or 0x10000
+		ip6 daddr @excluded-ipv6 meta mark set meta mark and 0xfffeffff or 0x10000
+	}
+	chain output {
+		type route hook output priority mangle; policy accept;
+		ip daddr @excluded-ipv4 meta mark set meta mark and 0xfffeffff or 0x10000
+		ip6 daddr @excluded-ipv6 meta mark set meta mark and 0xfffeffff or 0x10000
+	}
+}
+`, scripts[0])
+}
+
+func TestManager_Sync_FullMask(t *testing.T) {
+	var script string
+	manager := NewManager("grm", 0x20, 0xffffffff, []int{netlink.FAMILY_V4}, WithRunner(func(ctx context.Context, s string) error {
+		script = s
+		return nil
+	}))
+
+	require.NoError(t, manager.Sync(context.Background(), nil))
+	assert.Contains(t, script, "ip daddr @excluded-ipv4 meta mark set 0x20\n")
+	assert.NotContains(t, script, "elements")
+	assert.NotContains(t, script, "ip6")
+}
+
+func TestManager_Sync_Sources(t *testing.T) {
+	var script string
+	manager := NewManager("grm", 0x1, 0x1, []int{netlink.FAMILY_V4, netlink.FAMILY_V6},
+		WithRunner(func(ctx context.Context, s string) error {
+			script = s
+			return nil
+		}),
+		WithBypassSources([]*net.IPNet{parseCIDR(t, "192.168.50.0/24")}),
+		WithGatewayMark(0x2, 0x2, []*net.IPNet{parseCIDR(t, "203.0.113.0/24")}, []*net.IPNet{parseCIDR(t, "fd00:10::/64")}),
+	)
+
+	require.NoError(t, manager.Sync(context.Background(), []*net.IPNet{parseCIDR(t, "10.0.0.0/8")}))
+	assert.Equal(t, `table inet grm
+delete table inet grm
+table inet grm {
+	set excluded-ipv4 {
+		type ipv4_addr
+		flags interval
+		elements = { 10.0.0.0/8 }
+	}
+	set excluded-ipv6 {
+		type ipv6_addr
+		flags interval
+	}
+	set bypass-sources-ipv4 {
+		type ipv4_addr
+		flags interval
+		elements = { 192.168.50.0/24 }
+	}
+	set bypass-sources-ipv6 {
+		type ipv6_addr
+		flags interval
+	}
+	set gateway-destinations-ipv4 {
+		type ipv4_addr
+		flags interval
+		elements = { 203.0.113.0/24 }
+	}
+	set gateway-destinations-ipv6 {
+		type ipv6_addr
+		flags interval
+	}
+	set gateway-sources-ipv4 {
+		type ipv4_addr
+		flags interval
+	}
+	set gateway-sources-ipv6 {
+		type ipv6_addr
+		flags interval
+		elements = { fd00:10::/64 }
+	}
+	chain prerouting {
+		type filter hook prerouting priority mangle; policy accept;
+		ip daddr @excluded-ipv4 meta mark set meta mark and 0xfffffffe or 0x1
+		ip6 daddr @excluded-ipv6 meta mark set meta mark and 0xfffffffe or 0x1
+		ip saddr @bypass-sources-ipv4 meta mark set meta mark and 0xfffffffe or 0x1
+		ip6 saddr @bypass-sources-ipv6 meta mark set meta mark and 0xfffffffe or 0x1
+		ip daddr @gateway-destinations-ipv4 meta mark set meta mark and 0xfffffffd or 0x2
+		ip6 daddr @gateway-destinations-ipv6 meta mark set meta mark and 0xfffffffd or 0x2
+		ip saddr @gateway-sources-ipv4 meta mark set meta mark and 0xfffffffd or 0x2
+		ip6 saddr @gateway-sources-ipv6 meta mark set meta mark and 0xfffffffd or 0x2
+	}
+	chain output {
+		type route hook output priority mangle; policy accept;
+		ip daddr @excluded-ipv4 meta mark set meta mark and 0xfffffffe or 0x1
+		ip6 daddr @excluded-ipv6 meta mark set meta mark and 0xfffffffe or 0x1
+		ip saddr @bypass-sources-ipv4 meta mark set meta mark and 0xfffffffe or 0x1
+		ip6 saddr @bypass-sources-ipv6 meta mark set meta mark and 0xfffffffe or 0x1
+		ip daddr @gateway-destinations-ipv4 meta mark set meta mark and 0xfffffffd or 0x2
+		ip6 daddr @gateway-destinations-ipv6 meta mark set meta mark and 0xfffffffd or 0x2
+		ip saddr @gateway-sources-ipv4 meta mark set meta mark and 0xfffffffd or 0x2
+		ip6 saddr @gateway-sources-ipv6 meta mark set meta mark and 0xfffffffd or 0x2
+	}
+}
+`, script)
+}
+
+func TestManager_Errors(t *testing.T) {
+	manager := NewManager("grm", 0x20, 0xff, []int{netlink.FAMILY_V4}, WithRunner(func(ctx context.Context, script string) error {
+		return errors.New("nft failed")
+	}))
+
+	require.Error(t, manager.Sync(context.Background(), nil))
+	require.Error(t, manager.Close(context.Background()))
+}
@@ -0,0 +1,438 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"syscall"
+
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/iputil"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// Nexthop groups are an alternative to multipath routes. Each gateway is a kernel nexthop object, and the gateways
+// of a pool are combined into a group object that all routes via the pool use:
+//
+// id 6553601 via 192.168.1.1 dev eth0
+// id 6553602 via 192.168.1.2 dev eth0
+// id 6553603 group 6553601,2/6553602,1 type resilient buckets 128
+// 0.0.0.0/0 nhid 6553603 table 100
+//
+// When a gateway becomes unhealthy, only the group is replaced, which changes every route that uses it at once.
+// With resilient hashing, the kernel only moves the flows that were sent via the removed gateway.
+//
+// Each manager uses the nexthop IDs whose upper 16 bits are its gateway table ID (100 above), so that the objects can
+// be found again after a restart, and are not confused with objects of other managers.
+
+// Number of low bits of nexthop IDs that are assigned by a manager
+const nexthopIDBits = 16
+
+// ownsNexthop returns whether the nexthop ID is in the block of IDs that the manager assigns
+func (m *NetlinkManager) ownsNexthop(id uint32) bool {
+	return id>>nexthopIDBits == uint32(m.gatewayTableID)
+}
+
+// nexthopID returns the ID of the nexthop object with the key, and assigns the lowest free ID if it has none
+func (m *NetlinkManager) nexthopID(key string) (uint32, error) {
+	if id, ok := m.nexthopIDs[key]; ok {
+		return id, nil
+	}
+
+	if m.nexthopIDs == nil {
+		m.nexthopIDs = make(map[string]uint32)
+	}
+
+	assigned := make(map[uint32]struct{}, len(m.nexthopIDs))
+	for _, id := range m.nexthopIDs {
+		assigned[id] = struct{}{}
+	}
+
+	// Zero is not a valid nexthop ID
+	for id := uint32(m.gatewayTableID)<<nexthopIDBits + 1; m.ownsNexthop(id); id++ {
+		if _, ok := assigned[id]; !ok {
+			m.nexthopIDs[key] = id
+			return id, nil
+		}
+	}
+
+	return 0, fmt.Errorf("no free nexthop IDs")
+}
+
+// gatewayNexthopKey identifies the nexthop object of a gateway
+func gatewayNexthopKey(nexthop Nexthop) string {
+	return fmt.Sprintf("gateway %s dev %s onlink %t", nexthop.Gateway, nexthop.Interface, nexthop.OnLink)
+}
+
+// groupNexthopKey identifies the nexthop group of a route
+func groupNexthopKey(route Route) string {
+	family := familyName(iputil.Family(route.Destination.IP))
+	if route.Pool == "" {
+		return fmt.Sprintf("group %s destination %s", family, route.Destination)
+	}
+
+	return fmt.Sprintf("group %s pool %s", family, route.Pool)
+}
+
+// replaceRouteGroup routes the destination via the nexthop group of the route, after updating the group to contain
+// the nexthops
+func (m *NetlinkManager) replaceRouteGroup(route Route, nexthops []Nexthop, update *routeUpdate) error {
+	family := iputil.Family(route.Destination.IP)
+
+	members := make([]iputil.NexthopGroupMember, 0, len(nexthops))
+	gatewayStrings := make([]string, 0, len(nexthops))
+	usedNexthops := make([]Nexthop, 0, len(nexthops))
+	for _, nexthop := range nexthops {
+		linkIndex, err := m.nexthopLinkIndex(nexthop, update)
+		if err != nil {
+			return err
+		}
+		if linkIndex == 0 {
+			continue
+		}
+
+		id, err := m.nexthopID(gatewayNexthopKey(nexthop))
+		if err != nil {
+			return fmt.Errorf("failed to assign ID to nexthop of gateway %s: %w", nexthop.Gateway, err)
+		}
+
+		gatewayNexthop := &iputil.NexthopObject{
+			ID:        id,
+			Family:    family,
+			Gateway:   nexthop.Gateway,
+			LinkIndex: linkIndex,
+			OnLink:    nexthop.OnLink,
+		}
+		if err := m.replaceNexthop(gatewayNexthop); err != nil {
+			return fmt.Errorf("failed to replace/add nexthop of gateway %s: %w", nexthop.Gateway, err)
+		}
+		update.usedNexthops[id] = struct{}{}
+
+		weight := min(max(nexthop.Weight, 1), MaxWeight)
+		members = append(members, iputil.NexthopGroupMember{ID: id, Weight: weight})
+		gatewayStrings = append(gatewayStrings, fmt.Sprintf("%s (weight %d)", nexthop.Gateway, weight))
+		usedNexthops = append(usedNexthops, nexthop)
+	}
+
+	if len(members) == 0 {
+		return m.applyNoGatewayPolicy(route.Destination, update)
+	}
+
+	groupID, err := m.nexthopID(groupNexthopKey(route))
+	if err != nil {
+		return fmt.Errorf("failed to assign ID to nexthop group: %w", err)
+	}
+
+	group := &iputil.NexthopObject{
+		ID:      groupID,
+		Family:  family,
+		Group:   members,
+		Buckets: m.resilientBuckets,
+	}
+	if err := m.replaceNexthop(group); err != nil {
+		return fmt.Errorf("failed to replace/add nexthop group: %w", err)
+	}
+	update.usedNexthops[groupID] = struct{}{}
+
+	nexthopRoute := &iputil.NexthopRoute{
+		Dst:       route.Destination,
+		Table:     m.gatewayTableID,
+		Src:       preferredSource(route.Destination, usedNexthops),
+		NexthopID: groupID,
+	}
+	if err := m.replaceNexthopRoute(nexthopRoute, update); err != nil {
+		return fmt.Errorf("failed to replace/add route via nexthop group: %w", err)
+	}
+
+	slog.Debug("Updated nexthop group route", "destination", route.Destination.String(), "group", groupID, "gateways", gatewayStrings)
+	return nil
+}
+
+// nexthopLinkIndex returns the index of the interface that the gateway is reached through, or zero if it cannot be
+// reached. Unlike multipath routes, the kernel requires nexthop objects to set their interface, so it is resolved
+// from the directly connected routes of the main table for gateways without one.
+func (m *NetlinkManager) nexthopLinkIndex(nexthop Nexthop, update *routeUpdate) (int, error) {
+	if nexthop.Interface != "" {
+		return m.interfaceIndex(nexthop)
+	}
+
+	family := iputil.Family(nexthop.Gateway)
+	connectedRoutes, ok := update.connectedRoutes[family]
+	if !ok {
+		err := m.handle.RouteListFilteredIter(family, &netlink.Route{Table: unix.RT_TABLE_MAIN}, netlink.RT_FILTER_TABLE, func(route netlink.Route) bool {
+			if route.Type == unix.RTN_UNICAST && route.Gw == nil && len(route.MultiPath) == 0 && route.Dst != nil && route.LinkIndex != 0 {
+				connectedRoutes = append(connectedRoutes, route)
+			}
+			return true
+		})
+		if err != nil {
+			return 0, fmt.Errorf("failed to list connected %s routes: %w", familyName(family), err)
+		}
+		update.connectedRoutes[family] = connectedRoutes
+	}
+
+	// The most specific network that contains the gateway is used, like the kernel does
+	linkIndex, longestPrefix := 0, -1
+	for _, route := range connectedRoutes {
+		prefixLength, _ := route.Dst.Mask.Size()
+		if route.Dst.Contains(nexthop.Gateway) && prefixLength > longestPrefix {
+			linkIndex, longestPrefix = route.LinkIndex, prefixLength
+		}
+	}
+
+	if linkIndex == 0 {
+		slog.Warn("Gateway is not in a directly connected network, not routing via it. Set the interface of the gateway if it is reached through a tunnel.", "gateway", nexthop.Gateway)
+	}
+
+	return linkIndex, nil
+}
+
+// replaceNexthop adds or replaces a nexthop object, and records it as installed. Objects that are already installed
+// are not replaced, so that the kernel does not have to rebuild groups on every update.
+func (m *NetlinkManager) replaceNexthop(nexthop *iputil.NexthopObject) error {
+	if installed, ok := m.installedNexthops[nexthop.ID]; ok && installed.Equal(*nexthop) {
+		return nil
+	}
+
+	if err := m.nexthopHandle.NexthopReplace(nexthop); err != nil {
+		return err
+	}
+
+	if m.installedNexthops == nil {
+		m.installedNexthops = make(map[uint32]*iputil.NexthopObject)
+	}
+	m.installedNexthops[nexthop.ID] = nexthop
+	slog.Debug("Updated nexthop", "nexthop", nexthop.String())
+	return nil
+}
+
+// replaceNexthopRoute adds or replaces a route that uses a nexthop group in the gateway table, and records it as
+// installed. Routes that are unchanged since the previous update are skipped.
+func (m *NetlinkManager) replaceNexthopRoute(route *iputil.NexthopRoute, update *routeUpdate) error {
+	if m.nexthopRouteUnchanged(route, update) {
+		update.stats.Skipped++
+		slog.Debug("Route unchanged, skipping replacement", "route", route.String())
+		return nil
+	}
+
+	if err := m.nexthopHandle.NexthopRouteReplace(route); err != nil {
+		// The group may have been removed by someone else, so all objects are replaced on the next update
+		m.installedNexthops = nil
+		return err
+	}
+	update.stats.Applied++
+
+	if m.installedNexthopRoutes == nil {
+		m.installedNexthopRoutes = make(map[string]*iputil.NexthopRoute)
+	}
+	m.installedNexthopRoutes[route.Dst.String()] = route
+	delete(m.installedRoutes, route.Dst.String())
+	return nil
+}
+
+// removeUnusedNexthops deletes the installed nexthop objects that are not used. Groups are deleted before the gateway
+// nexthops that they contain.
+func (m *NetlinkManager) removeUnusedNexthops(used map[uint32]struct{}) error {
+	var unused []*iputil.NexthopObject
+	for id, nexthop := range m.installedNexthops {
+		if _, ok := used[id]; !ok {
+			unused = append(unused, nexthop)
+		}
+	}
+	sortNexthopsForRemoval(unused)
+
+	for _, nexthop := range unused {
+		if err := m.deleteNexthop(nexthop.ID); err != nil {
+			return fmt.Errorf("failed to delete nexthop %d: %w", nexthop.ID, err)
+		}
+		slog.Debug("Removed unused nexthop", "nexthop", nexthop.String())
+	}
+
+	return nil
+}
+
+// deleteNexthop deletes the nexthop object, if it exists, and releases its ID
+func (m *NetlinkManager) deleteNexthop(id uint32) error {
+	if err := m.nexthopHandle.NexthopDel(id); err != nil && !errors.Is(err, syscall.ENOENT) {
+		return err
+	}
+
+	delete(m.installedNexthops, id)
+	for key, assignedID := range m.nexthopIDs {
+		if assignedID == id {
+			delete(m.nexthopIDs, key)
+		}
+	}
+
+	return nil
+}
+
+// removeNexthops deletes all nexthop objects with IDs of the manager, including objects of previous runs
+func (m *NetlinkManager) removeNexthops() error {
+	nexthops, err := m.nexthopHandle.NexthopList()
+	if err != nil {
+		return fmt.Errorf("failed to list nexthops: %w", err)
+	}
+
+	var owned []*iputil.NexthopObject
+	for _, nexthop := range nexthops {
+		if m.ownsNexthop(nexthop.ID) {
+			owned = append(owned, &nexthop)
+		}
+	}
+	sortNexthopsForRemoval(owned)
+
+	for _, nexthop := range owned {
+		if err := m.deleteNexthop(nexthop.ID); err != nil {
+			return fmt.Errorf("failed to delete nexthop %d: %w", nexthop.ID, err)
+		}
+		slog.Debug("Removed nexthop", "nexthop", nexthop.String())
+	}
+
+	m.installedNexthops = nil
+	m.nexthopIDs = nil
+	return nil
+}
+
+// sortNexthopsForRemoval orders groups before gateway nexthops, and otherwise by ID for consistent ordering. Deleting
+// a gateway nexthop first would needlessly rebuild the groups that contain it.
+func sortNexthopsForRemoval(nexthops []*iputil.NexthopObject) {
+	slices.SortFunc(nexthops, func(a, b *iputil.NexthopObject) int {
+		if a.IsGroup() != b.IsGroup() {
+			if a.IsGroup() {
+				return -1
+			}
+			return 1
+		}
+
+		return int(a.ID) - int(b.ID)
+	})
+}
+
+// reconcileNexthops replaces the installed nexthop objects of the address family that are missing or were changed,
+// and removes other objects with IDs of the manager. Gateway nexthops are repaired before the groups that contain
+// them.
+func (m *NetlinkManager) reconcileNexthops(family int) ([]Drift, error) {
+	nexthops, err := m.nexthopHandle.NexthopList()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nexthops: %w", err)
+	}
+
+	observedNexthops := make(map[uint32]iputil.NexthopObject, len(nexthops))
+	for _, nexthop := range nexthops {
+		if m.ownsNexthop(nexthop.ID) {
+			observedNexthops[nexthop.ID] = nexthop
+		}
+	}
+
+	var drifts []Drift
+	var unexpectedNexthops []*iputil.NexthopObject
+	for id, nexthop := range observedNexthops {
+		if _, ok := m.installedNexthops[id]; !ok && nexthopFamily(nexthop, observedNexthops) == family {
+			unexpectedNexthops = append(unexpectedNexthops, &nexthop)
+		}
+	}
+	sortNexthopsForRemoval(unexpectedNexthops)
+
+	for _, nexthop := range unexpectedNexthops {
+		drifts = append(drifts, Drift{Kind: DriftUnexpectedNexthop, Family: family, Observed: nexthop.String()})
+		if err := m.nexthopHandle.NexthopDel(nexthop.ID); err != nil && !errors.Is(err, syscall.ENOENT) {
+			return drifts, fmt.Errorf("failed to delete unexpected nexthop %d: %w", nexthop.ID, err)
+		}
+		slog.Debug("Removed unexpected nexthop", "family", familyName(family), "nexthop", nexthop.String())
+	}
+
+	// Gateway nexthops first, as groups can only contain existing nexthops
+	var desiredNexthops []*iputil.NexthopObject
+	for _, nexthop := range m.installedNexthops {
+		if nexthop.Family == family {
+			desiredNexthops = append(desiredNexthops, nexthop)
+		}
+	}
+	sortNexthopsForRemoval(desiredNexthops)
+	slices.Reverse(desiredNexthops)
+
+	for _, desiredNexthop := range desiredNexthops {
+		observedNexthop, ok := observedNexthops[desiredNexthop.ID]
+		if ok && desiredNexthop.Equal(observedNexthop) {
+			continue
+		}
+
+		drift := Drift{Kind: DriftMissingNexthop, Family: family, Desired: desiredNexthop.String()}
+		if ok {
+			drift.Kind = DriftModifiedNexthop
+			drift.Observed = observedNexthop.String()
+		}
+		drifts = append(drifts, drift)
+
+		if err := m.nexthopHandle.NexthopReplace(desiredNexthop); err != nil {
+			return drifts, fmt.Errorf("failed to replace nexthop %d: %w", desiredNexthop.ID, err)
+		}
+		slog.Debug("Repaired nexthop", "family", familyName(family), "nexthop", desiredNexthop.String())
+	}
+
+	return drifts, nil
+}
+
+// nexthopFamily returns the address family of a nexthop object in the kernel. The kernel does not store the family of
+// groups, so it is the family of their members.
+func nexthopFamily(nexthop iputil.NexthopObject, nexthops map[uint32]iputil.NexthopObject) int {
+	if !nexthop.IsGroup() {
+		return nexthop.Family
+	}
+
+	for _, member := range nexthop.Group {
+		if memberNexthop, ok := nexthops[member.ID]; ok {
+			return memberNexthop.Family
+		}
+	}
+
+	return unix.AF_UNSPEC
+}
+
+// reconcileNexthopRoutes replaces the installed routes of the address family that use nexthop groups, if they are
+// missing or do not use the installed group. Other routes in the gateway table are handled by reconcileRoutes.
+func (m *NetlinkManager) reconcileNexthopRoutes(family int) ([]Drift, error) {
+	routes, err := m.nexthopHandle.NexthopRouteList(family, m.gatewayTableID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list routes: %w", err)
+	}
+
+	observedRoutes := make(map[string]iputil.NexthopRoute, len(routes))
+	for _, route := range routes {
+		observedRoutes[route.Dst.String()] = route
+	}
+
+	// Sort the destinations for consistent ordering
+	destinations := make([]string, 0, len(m.installedNexthopRoutes))
+	for destination, route := range m.installedNexthopRoutes {
+		if iputil.Family(route.Dst.IP) == family {
+			destinations = append(destinations, destination)
+		}
+	}
+	slices.Sort(destinations)
+
+	var drifts []Drift
+	for _, destination := range destinations {
+		desiredRoute := m.installedNexthopRoutes[destination]
+		observedRoute, ok := observedRoutes[destination]
+		if ok && nexthopRoutesEqual(*desiredRoute, observedRoute) {
+			continue
+		}
+
+		drift := Drift{Kind: DriftMissingRoute, Family: family, Desired: desiredRoute.String()}
+		if ok {
+			drift.Kind = DriftModifiedRoute
+			drift.Observed = observedRoute.String()
+		}
+		drifts = append(drifts, drift)
+
+		if err := m.nexthopHandle.NexthopRouteReplace(desiredRoute); err != nil {
+			return drifts, fmt.Errorf("failed to replace route to %s: %w", destination, err)
+		}
+		slog.Debug("Repaired route", "family", familyName(family), "route", desiredRoute.String())
+	}
+
+	return drifts, nil
+}
@@ -0,0 +1,230 @@
+package routes
+
+import (
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/iputil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// First nexthop ID of the manager created by createTestNexthopGroupManager, which uses gateway table 100
+const firstTestNexthopID = 100<<16 + 1
+
+var (
+	tunnelGateway = net.ParseIP("10.200.0.1")
+	lanGateway    = net.ParseIP("192.168.1.1")
+
+	officeDestination  = &net.IPNet{IP: net.IPv4(10, 0, 0, 0).To4(), Mask: net.CIDRMask(8, 32)}
+	defaultDestination = &net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)}
+)
+
+// createTestNexthopGroupManager creates a NetlinkManager that uses resilient nexthop groups with a mocked handle
+func createTestNexthopGroupManager(mockHandle *mockNetlinkHandle) *NetlinkManager {
+	manager := createTestNetlinkManager(mockHandle)
+	manager.nexthopGroups = true
+	manager.resilientBuckets = 64
+	manager.nexthopHandle = mockHandle
+	return manager
+}
+
+// poolRoutes returns routes to the office and default destinations that share the pool
+func poolRoutes(nexthops ...Nexthop) []Route {
+	return []Route{
+		{Destination: officeDestination, Nexthops: nexthops, Pool: "vpn"},
+		{Destination: defaultDestination, Nexthops: nexthops, Pool: "vpn"},
+	}
+}
+
+// installNexthopGroupRoutes routes the office and default destinations via a group of a tunnel and a LAN gateway
+func installNexthopGroupRoutes(t *testing.T, mockHandle *mockNetlinkHandle, manager *NetlinkManager) {
+	t.Helper()
+
+	connectedRoutes := []netlink.Route{
+		{Dst: &net.IPNet{IP: net.IPv4(192, 168, 0, 0).To4(), Mask: net.CIDRMask(16, 32)}, LinkIndex: 3, Type: unix.RTN_UNICAST},
+		{Dst: &net.IPNet{IP: net.IPv4(192, 168, 1, 0).To4(), Mask: net.CIDRMask(24, 32)}, LinkIndex: 2, Type: unix.RTN_UNICAST},
+		{Dst: defaultDestination, Gw: net.ParseIP("192.168.1.254"), LinkIndex: 2, Type: unix.RTN_UNICAST},
+	}
+
+	calls := []*mock.Call{
+		mockHandle.On("LinkByName", "wg0").Return(&netlink.Wireguard{LinkAttrs: netlink.LinkAttrs{Name: "wg0", Index: 7}}, nil),
+		mockHandle.On("RouteListFilteredIter", netlink.FAMILY_V4, &netlink.Route{Table: unix.RT_TABLE_MAIN}, uint64(netlink.RT_FILTER_TABLE), mock.Anything).Return(nil, connectedRoutes).Once(),
+		mockHandle.On("NexthopReplace", &iputil.NexthopObject{ID: firstTestNexthopID, Family: netlink.FAMILY_V4, Gateway: tunnelGateway, LinkIndex: 7, OnLink: true}).Return(nil).Once(),
+		mockHandle.On("NexthopReplace", &iputil.NexthopObject{ID: firstTestNexthopID + 1, Family: netlink.FAMILY_V4, Gateway: lanGateway, LinkIndex: 2}).Return(nil).Once(),
+		mockHandle.On("NexthopReplace", &iputil.NexthopObject{ID: firstTestNexthopID + 2, Family: netlink.FAMILY_V4, Buckets: 64, Group: []iputil.NexthopGroupMember{
+			{ID: firstTestNexthopID, Weight: 2},
+			{ID: firstTestNexthopID + 1, Weight: 1},
+		}}).Return(nil).Once(),
+		mockHandle.On("NexthopRouteReplace", &iputil.NexthopRoute{Dst: officeDestination, Table: 100, NexthopID: firstTestNexthopID + 2}).Return(nil).Once(),
+		mockHandle.On("NexthopRouteReplace", &iputil.NexthopRoute{Dst: defaultDestination, Table: 100, NexthopID: firstTestNexthopID + 2}).Return(nil).Once(),
+	}
+
+	require.NoError(t, manager.UpdateRoutes(poolRoutes(
+		Nexthop{Gateway: tunnelGateway, Interface: "wg0", OnLink: true, Weight: 2},
+		Nexthop{Gateway: lanGateway},
+	)))
+	mockHandle.AssertExpectations(t)
+
+	for _, call := range calls {
+		call.Unset()
+	}
+}
+
+func TestNetlinkManager_UpdateRoutes_NexthopGroups(t *testing.T) {
+	mockHandle := &mockNetlinkHandle{}
+	manager := createTestNexthopGroupManager(mockHandle)
+
+	installNexthopGroupRoutes(t, mockHandle, manager)
+
+	// When the LAN gateway is removed, only the group is replaced, and the nexthop of the gateway is removed once no
+	// route uses it anymore. The routes still use the group, so they are not written again.
+	mockHandle.On("LinkByName", "wg0").Return(&netlink.Wireguard{LinkAttrs: netlink.LinkAttrs{Name: "wg0", Index: 7}}, nil)
+	mockHandle.On("NexthopReplace", &iputil.NexthopObject{ID: firstTestNexthopID + 2, Family: netlink.FAMILY_V4, Buckets: 64, Group: []iputil.NexthopGroupMember{
+		{ID: firstTestNexthopID, Weight: 2},
+	}}).Return(nil).Once()
+	mockHandle.On("NexthopRouteList", netlink.FAMILY_V4, 100).Return([]iputil.NexthopRoute{
+		{Dst: officeDestination, Table: 100, NexthopID: firstTestNexthopID + 2},
+		{Dst: defaultDestination, Table: 100, NexthopID: firstTestNexthopID + 2},
+	}, nil).Once()
+	mockHandle.On("NexthopDel", uint32(firstTestNexthopID+1)).Return(nil).Once()
+
+	err := manager.UpdateRoutes(poolRoutes(Nexthop{Gateway: tunnelGateway, Interface: "wg0", OnLink: true, Weight: 2}))
+
+	require.NoError(t, err)
+	mockHandle.AssertExpectations(t)
+	assert.Equal(t, "NexthopDel", mockHandle.Calls[len(mockHandle.Calls)-1].Method)
+	assert.NotContains(t, manager.installedNexthops, uint32(firstTestNexthopID+1))
+	assert.Len(t, manager.installedNexthopRoutes, 2)
+	assert.Equal(t, UpdateStats{Skipped: 2}, manager.LastUpdateStats())
+}
+
+func TestNetlinkManager_UpdateRoutes_NexthopGroupsNoGateways(t *testing.T) {
+	mockHandle := &mockNetlinkHandle{}
+	manager := createTestNexthopGroupManager(mockHandle)
+
+	installNexthopGroupRoutes(t, mockHandle, manager)
+
+	// The routes fall through before the group that they use is removed, followed by the gateway nexthops
+	mockHandle.On("RouteDel", &netlink.Route{Dst: officeDestination, Table: 100}).Return(nil).Once()
+	mockHandle.On("RouteDel", &netlink.Route{Dst: defaultDestination, Table: 100}).Return(nil).Once()
+	mockHandle.On("NexthopDel", uint32(firstTestNexthopID+2)).Return(nil).Once()
+	mockHandle.On("NexthopDel", uint32(firstTestNexthopID)).Return(nil).Once()
+	mockHandle.On("NexthopDel", uint32(firstTestNexthopID+1)).Return(syscall.ENOENT).Once()
+
+	err := manager.UpdateRoutes(poolRoutes())
+
+	require.NoError(t, err)
+	mockHandle.AssertExpectations(t)
+
+	var deleted []uint32
+	for _, call := range mockHandle.Calls {
+		if call.Method == "NexthopDel" {
+			deleted = append(deleted, call.Arguments.Get(0).(uint32))
+		}
+	}
+	assert.Equal(t, []uint32{firstTestNexthopID + 2, firstTestNexthopID, firstTestNexthopID + 1}, deleted)
+	assert.Empty(t, manager.installedNexthops)
+	assert.Empty(t, manager.installedNexthopRoutes)
+	assert.Empty(t, manager.nexthopIDs)
+}
+
+func TestNetlinkManager_UpdateRoutes_NexthopGroupsUnconnectedGateway(t *testing.T) {
+	mockHandle := &mockNetlinkHandle{}
+	manager := createTestNexthopGroupManager(mockHandle)
+
+	// Gateways that are not in a connected network cannot be reached without an interface
+	mockHandle.On("RouteListFilteredIter", netlink.FAMILY_V4, &netlink.Route{Table: unix.RT_TABLE_MAIN}, uint64(netlink.RT_FILTER_TABLE), mock.Anything).Return(nil, []netlink.Route{}).Once()
+	mockHandle.On("RouteDel", &netlink.Route{Dst: defaultDestination, Table: 100}).Return(nil).Once()
+
+	err := manager.UpdateRoutes([]Route{{Destination: defaultDestination, Nexthops: []Nexthop{{Gateway: lanGateway}}}})
+
+	require.NoError(t, err)
+	mockHandle.AssertExpectations(t)
+	mockHandle.AssertNotCalled(t, "NexthopReplace", mock.Anything)
+}
+
+func TestNetlinkManager_Reconcile_Nexthops(t *testing.T) {
+	mockHandle := &mockNetlinkHandle{}
+	manager := createTestNexthopGroupManager(mockHandle)
+
+	installNexthopGroupRoutes(t, mockHandle, manager)
+
+	// The tunnel gateway was removed, which also removed it from the group. Another nexthop was added with an ID of the
+	// manager, and the office route was replaced by a multipath route.
+	lanNexthop := *manager.installedNexthops[firstTestNexthopID+1]
+	modifiedGroup := iputil.NexthopObject{ID: firstTestNexthopID + 2, Buckets: 64, Group: []iputil.NexthopGroupMember{{ID: firstTestNexthopID + 1, Weight: 1}}}
+	unexpectedNexthop := iputil.NexthopObject{ID: firstTestNexthopID + 10, Family: netlink.FAMILY_V4, Gateway: net.ParseIP("192.168.1.99"), LinkIndex: 2}
+	otherManagerNexthop := iputil.NexthopObject{ID: 200<<16 + 1, Family: netlink.FAMILY_V4, Gateway: net.ParseIP("192.168.1.99"), LinkIndex: 2}
+	mockHandle.On("NexthopList").Return([]iputil.NexthopObject{lanNexthop, modifiedGroup, unexpectedNexthop, otherManagerNexthop}, nil)
+	mockHandle.On("NexthopDel", unexpectedNexthop.ID).Return(nil).Once()
+	mockHandle.On("NexthopReplace", manager.installedNexthops[firstTestNexthopID]).Return(nil).Once()
+	mockHandle.On("NexthopReplace", manager.installedNexthops[firstTestNexthopID+2]).Return(nil).Once()
+
+	// The routes that use the group are not unexpected
+	mockHandle.On("RuleList", netlink.FAMILY_V4).Return(kernelRules(), nil)
+	mockHandle.On("RouteListFilteredIter", netlink.FAMILY_V4, &netlink.Route{Table: 100}, uint64(netlink.RT_FILTER_TABLE), mock.Anything).Return(nil, []netlink.Route{
+		{Dst: officeDestination, Table: 100, Type: unix.RTN_UNICAST, Gw: lanGateway},
+		{Dst: defaultDestination, Table: 100, Type: unix.RTN_UNICAST, Gw: lanGateway},
+	})
+	mockHandle.On("NexthopRouteList", netlink.FAMILY_V4, 100).Return([]iputil.NexthopRoute{
+		{Dst: officeDestination, Table: 100},
+		{Dst: defaultDestination, Table: 100, NexthopID: firstTestNexthopID + 2},
+	}, nil)
+	mockHandle.On("NexthopRouteReplace", manager.installedNexthopRoutes[officeDestination.String()]).Return(nil).Once()
+
+	drifts, err := manager.Reconcile()
+
+	require.NoError(t, err)
+	kinds := make([]string, 0, len(drifts))
+	for _, drift := range drifts {
+		kinds = append(kinds, drift.Kind)
+	}
+	assert.Equal(t, []string{DriftUnexpectedNexthop, DriftMissingNexthop, DriftModifiedNexthop, DriftModifiedRoute}, kinds)
+	mockHandle.AssertExpectations(t)
+}
+
+func TestNetlinkManager_removeNexthops(t *testing.T) {
+	mockHandle := &mockNetlinkHandle{}
+	manager := createTestNexthopGroupManager(mockHandle)
+
+	// Objects of previous runs are removed, groups first, while objects of other managers are kept
+	mockHandle.On("NexthopList").Return([]iputil.NexthopObject{
+		{ID: firstTestNexthopID, Family: netlink.FAMILY_V4, Gateway: lanGateway, LinkIndex: 2},
+		{ID: firstTestNexthopID + 1, Group: []iputil.NexthopGroupMember{{ID: firstTestNexthopID, Weight: 1}}},
+		{ID: 200<<16 + 1, Family: netlink.FAMILY_V4, Gateway: lanGateway, LinkIndex: 2},
+	}, nil)
+	groupDel := mockHandle.On("NexthopDel", uint32(firstTestNexthopID+1)).Return(nil).Once()
+	mockHandle.On("NexthopDel", uint32(firstTestNexthopID)).Return(nil).Once().NotBefore(groupDel)
+
+	require.NoError(t, manager.removeNexthops())
+	mockHandle.AssertExpectations(t)
+}
+
+func TestNetlinkManager_nexthopID(t *testing.T) {
+	manager := createTestNexthopGroupManager(&mockNetlinkHandle{})
+
+	first, err := manager.nexthopID("first")
+	require.NoError(t, err)
+	second, err := manager.nexthopID("second")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(firstTestNexthopID), first)
+	assert.Equal(t, uint32(firstTestNexthopID+1), second)
+
+	// IDs are stable, and released IDs are assigned again
+	again, err := manager.nexthopID("first")
+	require.NoError(t, err)
+	assert.Equal(t, first, again)
+
+	delete(manager.nexthopIDs, "first")
+	third, err := manager.nexthopID("third")
+	require.NoError(t, err)
+	assert.Equal(t, first, third)
+
+	assert.True(t, manager.ownsNexthop(third))
+	assert.False(t, manager.ownsNexthop(200<<16+1))
+}
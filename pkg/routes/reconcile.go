@@ -0,0 +1,269 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"syscall"
+
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/iputil"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// Kinds of differences between the kernel state and the desired state
+const (
+	DriftMissingRule     = "missing_rule"     // A managed rule was removed
+	DriftModifiedRule    = "modified_rule"    // A rule with a managed preference does not match the desired rule
+	DriftMissingRoute    = "missing_route"    // A route was removed from the gateway table
+	DriftModifiedRoute   = "modified_route"   // A route in the gateway table does not match the desired route
+	DriftUnexpectedRoute = "unexpected_route" // A route was added to the gateway table by someone else
+
+	DriftMissingNexthop    = "missing_nexthop"    // A nexthop object of a gateway or group was removed
+	DriftModifiedNexthop   = "modified_nexthop"   // A nexthop object does not match the desired gateway or group
+	DriftUnexpectedNexthop = "unexpected_nexthop" // A nexthop object with an ID of the manager was added by someone else
+)
+
+// Drift is a difference between the kernel state and the desired state that was found by Reconcile
+type Drift struct {
+	Kind     string // One of the Drift* values
+	Family   int
+	Desired  string // Desired rule, route or nexthop. Empty for unexpected routes and nexthops.
+	Observed string // Rules, routes or nexthops found in the kernel. Empty for missing rules, routes and nexthops.
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("%s (%s): desired %q, observed %q", d.Kind, familyName(d.Family), d.Desired, d.Observed)
+}
+
+// Reconcile compares the managed rules and routes in the kernel with the desired state, and repairs any differences.
+// Returns the differences that were found. This is needed because other programs (or people) can flush the rules or
+// rewrite the gateway table at any time, and the manager otherwise only changes them when the desired state changes.
+func (m *NetlinkManager) Reconcile() ([]Drift, error) {
+	var drifts []Drift
+	var errs []error
+	for _, family := range m.ipFamilies() {
+		ruleDrifts, err := m.reconcileRules(family)
+		drifts = append(drifts, ruleDrifts...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to reconcile %s rules: %w", familyName(family), err))
+		}
+
+		// Nexthops are repaired before the routes that use them
+		if m.nexthopGroups {
+			nexthopDrifts, err := m.reconcileNexthops(family)
+			drifts = append(drifts, nexthopDrifts...)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to reconcile %s nexthops: %w", familyName(family), err))
+			}
+		}
+
+		routeDrifts, err := m.reconcileRoutes(family)
+		drifts = append(drifts, routeDrifts...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to reconcile %s routes: %w", familyName(family), err))
+		}
+
+		if m.nexthopGroups {
+			nexthopRouteDrifts, err := m.reconcileNexthopRoutes(family)
+			drifts = append(drifts, nexthopRouteDrifts...)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to reconcile %s nexthop group routes: %w", familyName(family), err))
+			}
+		}
+	}
+
+	return drifts, errors.Join(errs...)
+}
+
+// reconcileRules adds any managed rules of the address family that are missing, and replaces rules with managed
+// preferences that do not match the desired rules. Rules are repaired in the order that they are added, so that
+// traffic to excluded destinations is never routed via the gateways.
+func (m *NetlinkManager) reconcileRules(family int) ([]Drift, error) {
+	rules, err := m.handle.RuleList(family)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rules: %w", err)
+	}
+
+	rulesByPreference := make(map[int][]netlink.Rule, len(rules))
+	for _, rule := range rules {
+		rulesByPreference[rule.Priority] = append(rulesByPreference[rule.Priority], rule)
+	}
+
+	var drifts []Drift
+	for _, desiredRule := range m.desiredRules(family) {
+		observedRules := rulesByPreference[desiredRule.Priority]
+		if slices.ContainsFunc(observedRules, func(rule netlink.Rule) bool { return rulesEqual(desiredRule, rule) }) {
+			continue
+		}
+
+		drift := Drift{Kind: DriftMissingRule, Family: family, Desired: desiredRule.String()}
+		if len(observedRules) > 0 {
+			drift.Kind = DriftModifiedRule
+			drift.Observed = fmt.Sprint(observedRules)
+		}
+		drifts = append(drifts, drift)
+
+		// Only one rule may use each managed preference
+		for _, observedRule := range observedRules {
+			if err := m.handle.RuleDel(&observedRule); err != nil {
+				return drifts, fmt.Errorf("failed to delete modified rule with preference %d: %w", observedRule.Priority, err)
+			}
+		}
+
+		if err := m.handle.RuleAdd(desiredRule); err != nil {
+			return drifts, fmt.Errorf("failed to add rule with preference %d: %w", desiredRule.Priority, err)
+		}
+		slog.Debug("Repaired rule", "family", familyName(family), "rule", desiredRule.String())
+	}
+
+	return drifts, nil
+}
+
+// reconcileRoutes replaces routes of the address family in the gateway table that are missing or do not match the
+// installed routes, and removes any other routes from the gateway table. Routes that use nexthop groups are only
+// checked for being expected.
+func (m *NetlinkManager) reconcileRoutes(family int) ([]Drift, error) {
+	observedRoutes := make(map[string]netlink.Route)
+	var unexpectedRoutes []netlink.Route
+	err := m.handle.RouteListFilteredIter(family, &netlink.Route{Table: m.gatewayTableID}, netlink.RT_FILTER_TABLE, func(route netlink.Route) bool {
+		// Routes that use nexthop groups are compared by reconcileNexthopRoutes
+		if _, ok := m.installedNexthopRoutes[route.Dst.String()]; ok {
+			return true
+		}
+
+		if _, ok := m.installedRoutes[route.Dst.String()]; !ok {
+			unexpectedRoutes = append(unexpectedRoutes, route)
+			return true
+		}
+
+		observedRoutes[route.Dst.String()] = route
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list routes: %w", err)
+	}
+
+	var drifts []Drift
+	for _, unexpectedRoute := range unexpectedRoutes {
+		drifts = append(drifts, Drift{Kind: DriftUnexpectedRoute, Family: family, Observed: unexpectedRoute.String()})
+		if err := m.handle.RouteDel(&unexpectedRoute); err != nil && !errors.Is(err, syscall.ESRCH) {
+			return drifts, fmt.Errorf("failed to delete unexpected route to %s: %w", unexpectedRoute.Dst, err)
+		}
+		slog.Debug("Removed unexpected route", "family", familyName(family), "route", unexpectedRoute.String())
+	}
+
+	// Sort the destinations for consistent ordering
+	destinations := make([]string, 0, len(m.installedRoutes))
+	for destination, route := range m.installedRoutes {
+		if iputil.Family(route.Dst.IP) == family {
+			destinations = append(destinations, destination)
+		}
+	}
+	slices.Sort(destinations)
+
+	for _, destination := range destinations {
+		desiredRoute := m.installedRoutes[destination]
+		observedRoute, ok := observedRoutes[destination]
+		if ok && routesEqual(*desiredRoute, observedRoute) {
+			continue
+		}
+
+		drift := Drift{Kind: DriftMissingRoute, Family: family, Desired: desiredRoute.String()}
+		if ok {
+			drift.Kind = DriftModifiedRoute
+			drift.Observed = observedRoute.String()
+		}
+		drifts = append(drifts, drift)
+
+		if err := m.handle.RouteReplace(desiredRoute); err != nil {
+			return drifts, fmt.Errorf("failed to replace route to %s: %w", destination, err)
+		}
+		slog.Debug("Repaired route", "family", familyName(family), "route", desiredRoute.String())
+	}
+
+	return drifts, nil
+}
+
+// rulesEqual returns whether the rule in the kernel matches the desired rule
+func rulesEqual(desired *netlink.Rule, observed netlink.Rule) bool {
+	maskValue := func(mask *uint32) uint32 {
+		if mask == nil {
+			return 0
+		}
+		return *mask
+	}
+
+	return desired.Priority == observed.Priority &&
+		desired.Table == observed.Table &&
+		desired.Goto == observed.Goto &&
+		desired.Src.String() == observed.Src.String() &&
+		desired.Dst.String() == observed.Dst.String() &&
+		desired.Mark == observed.Mark &&
+		maskValue(desired.Mask) == maskValue(observed.Mask)
+}
+
+// routesEqual returns whether the route in the kernel sends traffic where the desired route does
+func routesEqual(desired, observed netlink.Route) bool {
+	routeType := func(route netlink.Route) int {
+		if route.Type == 0 {
+			return unix.RTN_UNICAST
+		}
+		return route.Type
+	}
+
+	if routeType(desired) != routeType(observed) || !desired.Src.Equal(observed.Src) {
+		return false
+	}
+
+	desiredNexthops := routeNexthops(desired)
+	observedNexthops := routeNexthops(observed)
+	if len(desiredNexthops) != len(observedNexthops) {
+		return false
+	}
+
+	// The kernel resolves the interface of nexthops that do not set one, so it is only compared when set
+	desiredLinks := make(map[string]bool, len(desiredNexthops))
+	for _, nexthop := range desiredNexthops {
+		desiredLinks[nexthop.Gw.String()] = nexthop.LinkIndex != 0
+	}
+
+	// Weights are meaningless for routes with a single nexthop
+	weighted := len(desiredNexthops) > 1
+	describe := func(nexthops []*netlink.NexthopInfo) []string {
+		descriptions := make([]string, 0, len(nexthops))
+		for _, nexthop := range nexthops {
+			description := nexthop.Gw.String()
+			if desiredLinks[nexthop.Gw.String()] {
+				description += " dev " + strconv.Itoa(nexthop.LinkIndex)
+			}
+			if nexthop.Flags&int(netlink.FLAG_ONLINK) != 0 {
+				description += " onlink"
+			}
+			if weighted {
+				description += " weight " + strconv.Itoa(nexthop.Hops+1)
+			}
+			descriptions = append(descriptions, description)
+		}
+		slices.Sort(descriptions)
+		return descriptions
+	}
+
+	return slices.Equal(describe(desiredNexthops), describe(observedNexthops))
+}
+
+// routeNexthops returns the nexthops of a route. The kernel stores multipath routes with a single nexthop as a plain
+// route, so these are treated the same.
+func routeNexthops(route netlink.Route) []*netlink.NexthopInfo {
+	if len(route.MultiPath) > 0 {
+		return route.MultiPath
+	}
+
+	if route.Gw == nil {
+		return nil
+	}
+
+	return []*netlink.NexthopInfo{{LinkIndex: route.LinkIndex, Gw: route.Gw, Flags: route.Flags}}
+}
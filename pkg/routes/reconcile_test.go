@@ -0,0 +1,210 @@
+package routes
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// kernelRules returns the rules that the kernel reports for the manager created by createTestNetlinkManager
+func kernelRules() []netlink.Rule {
+	fallthroughRule := netlink.NewRule()
+	fallthroughRule.Family = netlink.FAMILY_V4
+	fallthroughRule.Table = 101
+	fallthroughRule.Priority = 1002
+
+	gatewayRule := netlink.NewRule()
+	gatewayRule.Family = netlink.FAMILY_V4
+	gatewayRule.Table = 100
+	gatewayRule.Priority = 1001
+
+	return []netlink.Rule{*gatewayRule, *fallthroughRule}
+}
+
+// installRoutes applies the routes to the manager, so that they are part of the desired state
+func installRoutes(t *testing.T, mockHandle *mockNetlinkHandle, manager *NetlinkManager, routes []Route) {
+	t.Helper()
+
+	call := mockHandle.On("RouteReplace", mock.Anything).Return(nil)
+	require.NoError(t, manager.UpdateRoutes(routes))
+	call.Unset()
+}
+
+func TestNetlinkManager_Reconcile_NoDrift(t *testing.T) {
+	mockHandle := &mockNetlinkHandle{}
+	manager := createTestNetlinkManager(mockHandle)
+
+	office := &net.IPNet{IP: net.IPv4(10, 0, 0, 0).To4(), Mask: net.CIDRMask(8, 32)}
+	defaultRoute := &net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)}
+	installRoutes(t, mockHandle, manager, []Route{
+		{Destination: office, Nexthops: []Nexthop{{Gateway: net.ParseIP("192.168.1.1")}}},
+		{Destination: defaultRoute, Nexthops: []Nexthop{{Gateway: net.ParseIP("192.168.1.1"), Weight: 2}, {Gateway: net.ParseIP("192.168.1.2")}}},
+	})
+
+	// The kernel reports multipath routes with a single nexthop as plain routes
+	observedRoutes := []netlink.Route{
+		{Dst: office, Table: 100, Type: unix.RTN_UNICAST, Gw: net.ParseIP("192.168.1.1")},
+		{Dst: defaultRoute, Table: 100, Type: unix.RTN_UNICAST, MultiPath: []*netlink.NexthopInfo{
+			{Gw: net.ParseIP("192.168.1.2")},
+			{Gw: net.ParseIP("192.168.1.1"), Hops: 1},
+		}},
+	}
+
+	mockHandle.On("RuleList", netlink.FAMILY_V4).Return(kernelRules(), nil)
+	mockHandle.On("RouteListFilteredIter", netlink.FAMILY_V4, &netlink.Route{Table: 100}, uint64(netlink.RT_FILTER_TABLE), mock.Anything).Return(nil, observedRoutes)
+
+	drifts, err := manager.Reconcile()
+
+	require.NoError(t, err)
+	assert.Empty(t, drifts)
+	mockHandle.AssertExpectations(t)
+}
+
+func TestNetlinkManager_Reconcile_Drift(t *testing.T) {
+	mockHandle := &mockNetlinkHandle{}
+	manager := createTestNetlinkManager(mockHandle)
+
+	office := &net.IPNet{IP: net.IPv4(10, 0, 0, 0).To4(), Mask: net.CIDRMask(8, 32)}
+	defaultRoute := &net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)}
+	unexpected := &net.IPNet{IP: net.IPv4(172, 16, 0, 0).To4(), Mask: net.CIDRMask(12, 32)}
+	installRoutes(t, mockHandle, manager, []Route{
+		{Destination: office, Nexthops: []Nexthop{{Gateway: net.ParseIP("192.168.1.1")}}},
+		{Destination: defaultRoute, Nexthops: []Nexthop{{Gateway: net.ParseIP("192.168.1.1")}}},
+	})
+
+	// The gateway table rule was flushed, and the fallthrough rule was replaced
+	rules := kernelRules()[1:]
+	rules[0].Table = 200
+
+	// The office route was changed, the default route was removed, and another route was added
+	modifiedRoute := netlink.Route{Dst: office, Table: 100, Type: unix.RTN_UNICAST, Gw: net.ParseIP("192.168.1.99")}
+	unexpectedRoute := netlink.Route{Dst: unexpected, Table: 100, Type: unix.RTN_UNICAST, Gw: net.ParseIP("192.168.1.1")}
+
+	mockHandle.On("RuleList", netlink.FAMILY_V4).Return(rules, nil)
+	mockHandle.On("RuleDel", &rules[0]).Return(nil).Once()
+	mockHandle.On("RuleAdd", mock.MatchedBy(func(rule *netlink.Rule) bool {
+		return rule.Table == 101 && rule.Priority == 1002
+	})).Return(nil).Once()
+	mockHandle.On("RuleAdd", mock.MatchedBy(func(rule *netlink.Rule) bool {
+		return rule.Table == 100 && rule.Priority == 1001
+	})).Return(nil).Once()
+
+	mockHandle.On("RouteListFilteredIter", netlink.FAMILY_V4, &netlink.Route{Table: 100}, uint64(netlink.RT_FILTER_TABLE), mock.Anything).Return(nil, []netlink.Route{modifiedRoute, unexpectedRoute})
+	mockHandle.On("RouteDel", &unexpectedRoute).Return(nil).Once()
+	mockHandle.On("RouteReplace", manager.installedRoutes[office.String()]).Return(nil).Once()
+	mockHandle.On("RouteReplace", manager.installedRoutes[defaultRoute.String()]).Return(nil).Once()
+
+	drifts, err := manager.Reconcile()
+
+	require.NoError(t, err)
+	kinds := make([]string, 0, len(drifts))
+	for _, drift := range drifts {
+		kinds = append(kinds, drift.Kind)
+	}
+	assert.Equal(t, []string{DriftModifiedRule, DriftMissingRule, DriftUnexpectedRoute, DriftMissingRoute, DriftModifiedRoute}, kinds)
+	mockHandle.AssertExpectations(t)
+}
+
+func TestNetlinkManager_Reconcile_RemovedRoutesAreUnexpected(t *testing.T) {
+	mockHandle := &mockNetlinkHandle{}
+	manager := createTestNetlinkManager(mockHandle)
+
+	office := &net.IPNet{IP: net.IPv4(10, 0, 0, 0).To4(), Mask: net.CIDRMask(8, 32)}
+	installRoutes(t, mockHandle, manager, []Route{
+		{Destination: office, Nexthops: []Nexthop{{Gateway: net.ParseIP("192.168.1.1")}}},
+	})
+
+	// Without active gateways, the route falls through and should not exist
+	mockHandle.On("RouteDel", &netlink.Route{Dst: office, Table: 100}).Return(nil).Once()
+	require.NoError(t, manager.UpdateRoutes([]Route{{Destination: office}}))
+
+	staleRoute := netlink.Route{Dst: office, Table: 100, Type: unix.RTN_UNICAST, Gw: net.ParseIP("192.168.1.1")}
+	mockHandle.On("RuleList", netlink.FAMILY_V4).Return(kernelRules(), nil)
+	mockHandle.On("RouteListFilteredIter", netlink.FAMILY_V4, &netlink.Route{Table: 100}, uint64(netlink.RT_FILTER_TABLE), mock.Anything).Return(nil, []netlink.Route{staleRoute})
+	mockHandle.On("RouteDel", &staleRoute).Return(nil).Once()
+
+	drifts, err := manager.Reconcile()
+
+	require.NoError(t, err)
+	require.Len(t, drifts, 1)
+	assert.Equal(t, DriftUnexpectedRoute, drifts[0].Kind)
+	mockHandle.AssertExpectations(t)
+}
+
+func TestNetlinkManager_Reconcile_ListError(t *testing.T) {
+	mockHandle := &mockNetlinkHandle{}
+	manager := createTestNetlinkManager(mockHandle)
+
+	mockHandle.On("RuleList", netlink.FAMILY_V4).Return([]netlink.Rule{}, errors.New("netlink error"))
+	mockHandle.On("RouteListFilteredIter", netlink.FAMILY_V4, &netlink.Route{Table: 100}, uint64(netlink.RT_FILTER_TABLE), mock.Anything).Return(nil, []netlink.Route{})
+
+	drifts, err := manager.Reconcile()
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to reconcile IPv4 rules")
+	assert.Empty(t, drifts)
+	mockHandle.AssertExpectations(t)
+}
+
+func TestRoutesEqual(t *testing.T) {
+	destination := &net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)}
+	gateway1 := net.ParseIP("10.200.0.1")
+	gateway2 := net.ParseIP("192.168.1.1")
+	onlink := int(netlink.FLAG_ONLINK)
+
+	tests := []struct {
+		name     string
+		desired  netlink.Route
+		observed netlink.Route
+		expected bool
+	}{
+		{
+			name:     "resolved interface is ignored",
+			desired:  netlink.Route{Dst: destination, MultiPath: []*netlink.NexthopInfo{{Gw: gateway2}}},
+			observed: netlink.Route{Dst: destination, Type: unix.RTN_UNICAST, Gw: gateway2, LinkIndex: 2},
+			expected: true,
+		},
+		{
+			name:     "configured interface and onlink flag",
+			desired:  netlink.Route{Dst: destination, MultiPath: []*netlink.NexthopInfo{{Gw: gateway1, LinkIndex: 7, Flags: onlink}}},
+			observed: netlink.Route{Dst: destination, Type: unix.RTN_UNICAST, Gw: gateway1, LinkIndex: 7, Flags: onlink},
+			expected: true,
+		},
+		{
+			name:     "different interface",
+			desired:  netlink.Route{Dst: destination, MultiPath: []*netlink.NexthopInfo{{Gw: gateway1, LinkIndex: 7, Flags: onlink}}},
+			observed: netlink.Route{Dst: destination, Type: unix.RTN_UNICAST, Gw: gateway1, LinkIndex: 8, Flags: onlink},
+			expected: false,
+		},
+		{
+			name:     "missing onlink flag",
+			desired:  netlink.Route{Dst: destination, MultiPath: []*netlink.NexthopInfo{{Gw: gateway1, LinkIndex: 7, Flags: onlink}, {Gw: gateway2}}},
+			observed: netlink.Route{Dst: destination, Type: unix.RTN_UNICAST, MultiPath: []*netlink.NexthopInfo{{Gw: gateway1, LinkIndex: 7}, {Gw: gateway2, LinkIndex: 2}}},
+			expected: false,
+		},
+		{
+			name:     "different preferred source",
+			desired:  netlink.Route{Dst: destination, MultiPath: []*netlink.NexthopInfo{{Gw: gateway2}}, Src: net.ParseIP("192.168.1.10")},
+			observed: netlink.Route{Dst: destination, Type: unix.RTN_UNICAST, Gw: gateway2, LinkIndex: 2},
+			expected: false,
+		},
+		{
+			name:     "different weights",
+			desired:  netlink.Route{Dst: destination, MultiPath: []*netlink.NexthopInfo{{Gw: gateway1, Hops: 1}, {Gw: gateway2}}},
+			observed: netlink.Route{Dst: destination, Type: unix.RTN_UNICAST, MultiPath: []*netlink.NexthopInfo{{Gw: gateway1}, {Gw: gateway2}}},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, routesEqual(tt.desired, tt.observed))
+		})
+	}
+}
@@ -5,11 +5,15 @@ import (
 	"fmt"
 	"log/slog"
 	"net"
+	"slices"
 	"sort"
+	"strings"
+	"syscall"
 
 	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/iputil"
 	"github.com/vishvananda/netlink"
 	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
 )
 
 func init() {
@@ -17,11 +21,147 @@ func init() {
 	nl.EnableErrorMessageReporting = true
 }
 
+// Maximum ECMP nexthop weight supported by the kernel
+const MaxWeight = 256
+
+// Nexthop is an active gateway that routes are sent via
+type Nexthop struct {
+	Gateway net.IP
+	// Relative share of the traffic sent via this gateway, between 1 and MaxWeight. Zero is treated as 1.
+	Weight int
+	// Interface that the gateway is reached through. Empty lets the kernel resolve it from the gateway address.
+	Interface string
+	// Whether the gateway is used even though no route on the interface covers it, such as for tunnels without
+	// addresses in the gateway network. Requires Interface.
+	OnLink bool
+	// Source address hint for locally generated traffic routed via the gateway. The kernel only supports one per
+	// route, so it is only used when all nexthops of a route that set it agree.
+	PreferredSource net.IP
+}
+
+// Route is a destination that is routed via weighted ECMP across a set of nexthops
+type Route struct {
+	Destination *net.IPNet
+	Nexthops    []Nexthop
+	// Name of the set of gateways that the route is sent via. When nexthop groups are used, routes of the same
+	// address family and pool share one group, so they must have the same nexthops. Routes without a pool get their
+	// own group.
+	Pool string
+}
+
+// Selector matches traffic that is routed via the gateway table. Both the source and the firewall mark must match
+// when both are set.
+type Selector struct {
+	Source *net.IPNet // Source network of the traffic. Nil matches all sources.
+	Mark   uint32     // Firewall mark of the traffic, compared after applying Mask
+	Mask   uint32     // Zero does not match on the firewall mark
+}
+
+func (s Selector) String() string {
+	var parts []string
+	if s.Source != nil {
+		parts = append(parts, "from "+s.Source.String())
+	}
+	if s.Mask != 0 {
+		parts = append(parts, fmt.Sprintf("fwmark %#x/%#x", s.Mark, s.Mask))
+	}
+	if len(parts) == 0 {
+		return "all"
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// matchesFamily returns whether the selector applies to the rule list of the address family
+func (s Selector) matchesFamily(family int) bool {
+	return s.Source == nil || iputil.Family(s.Source.IP) == family
+}
+
+// rule creates a rule in the address family that matches the selector
+func (s Selector) rule(family int) *netlink.Rule {
+	rule := netlink.NewRule()
+	rule.Family = family
+	rule.Src = s.Source
+	if s.Mask != 0 {
+		mask := s.Mask
+		rule.Mark = s.Mark
+		rule.Mask = &mask
+	}
+
+	return rule
+}
+
+// NoGatewayAction controls what happens to traffic to a destination that has no active gateways
+type NoGatewayAction int
+
+const (
+	NoGatewayFallthrough     NoGatewayAction = iota // The route is removed, so traffic falls through to the rest of the system routing tables
+	NoGatewayBlackhole                              // Traffic is silently dropped
+	NoGatewayUnreachable                            // Traffic is rejected with an ICMP unreachable error
+	NoGatewayProhibit                               // Traffic is rejected with an ICMP administratively prohibited error
+	NoGatewayFallbackGateway                        // Traffic is routed via a static fallback gateway
+)
+
+func (a NoGatewayAction) String() string {
+	switch a {
+	case NoGatewayBlackhole:
+		return "blackhole"
+	case NoGatewayUnreachable:
+		return "unreachable"
+	case NoGatewayProhibit:
+		return "prohibit"
+	case NoGatewayFallbackGateway:
+		return "gateway"
+	default:
+		return "fallthrough"
+	}
+}
+
+// NoGatewayPolicy configures the route that is installed in the gateway table for destinations without any active
+// gateways
+type NoGatewayPolicy struct {
+	Action NoGatewayAction
+	// Static gateways used by NoGatewayFallbackGateway, at most one per address family. Destinations in a family
+	// without a fallback gateway fall through.
+	FallbackGateways []net.IP
+}
+
+// route returns the gateway table route to the destination for the policy, or nil if the route should be removed
+func (p NoGatewayPolicy) route(destination *net.IPNet, tableID int) *netlink.Route {
+	route := &netlink.Route{
+		Dst:   destination,
+		Table: tableID,
+	}
+
+	switch p.Action {
+	case NoGatewayBlackhole:
+		route.Type = unix.RTN_BLACKHOLE
+	case NoGatewayUnreachable:
+		route.Type = unix.RTN_UNREACHABLE
+	case NoGatewayProhibit:
+		route.Type = unix.RTN_PROHIBIT
+	case NoGatewayFallbackGateway:
+		family := iputil.Family(destination.IP)
+		index := slices.IndexFunc(p.FallbackGateways, func(gateway net.IP) bool {
+			return iputil.Family(gateway) == family
+		})
+		if index == -1 {
+			return nil
+		}
+		route.Gw = p.FallbackGateways[index]
+	default:
+		return nil
+	}
+
+	return route
+}
+
 // Manager defines the interface for route management operations
 type Manager interface {
-	// UpdateRoutes updates the specified routes to use ECMP with the provided active gateways.
+	// UpdateRoutes updates the specified routes to use weighted ECMP with their nexthops. Routes without nexthops
+	// are handled according to the no gateway policy of the manager.
 	// Only returns an error if a fatal error occurs during route manipulation.
-	UpdateRoutes(routes []*net.IPNet, activeGateways []net.IP) error
+	UpdateRoutes(routes []Route) error
 }
 
 // CloseableManager extends Manager with a Close method for cleanup
@@ -30,6 +170,22 @@ type CloseableManager interface {
 	Close() error
 }
 
+// ReconcilingManager extends Manager with the ability to repair changes that others made to the managed rules and
+// routes
+type ReconcilingManager interface {
+	Manager
+	// Reconcile compares the managed rules and routes in the kernel with the desired state, and repairs any
+	// differences. Returns the differences that were found.
+	Reconcile() ([]Drift, error)
+}
+
+// ExclusionManager extends Manager with the ability to change the excluded networks after creation
+type ExclusionManager interface {
+	Manager
+	// UpdateExclusions replaces the networks that are excluded from route management.
+	UpdateExclusions(netsToExclude []*net.IPNet) error
+}
+
 // NetlinkManager is the netlink-based implementation of the Manager interface
 type NetlinkManager struct {
 	handle iputil.NetlinkHandle
@@ -39,17 +195,123 @@ type NetlinkManager struct {
 
 	firstExcludeRulePreference     int
 	fallthroughTableRulePreference int
-	gatewayTableRulePreference     int
+	gatewayTableRulePreference     int // Preference of the first gateway table rule. There is one rule per selector.
 
 	excludeNets []*net.IPNet
+
+	// Traffic that skips the gateway table, in addition to traffic to the excluded networks
+	bypassSelectors []Selector
+
+	// Traffic that is routed via the gateway table. All traffic is routed via the gateway table when empty.
+	selectors []Selector
+
+	// Address families that rules are managed for. Defaults to IPv4 only when empty.
+	families []int
+
+	// Route installed for destinations without any active gateways
+	noGatewayPolicy NoGatewayPolicy
+
+	// Routes that were configured by the last UpdateRoutes call. Used to remove routes that are no longer configured.
+	appliedRoutes []*net.IPNet
+
+	// Routes that are currently installed in the gateway table, keyed by destination. Used to skip unchanged routes
+	// and detect drift.
+	installedRoutes map[string]*netlink.Route
+	// Route writes of the last UpdateRoutes call
+	lastUpdateStats UpdateStats
+
+	// Whether routes use kernel nexthop groups instead of listing their nexthops
+	nexthopGroups bool
+	// Number of buckets of resilient nexthop groups. Zero uses plain groups.
+	resilientBuckets uint16
+	// Handle that nexthop objects are managed with. Set when nexthop groups are used.
+	nexthopHandle iputil.NexthopHandle
+	// IDs of the nexthop objects of gateways and groups, keyed by nexthopKey
+	nexthopIDs map[string]uint32
+	// Nexthop objects that are currently installed, keyed by ID. Used to skip unchanged objects and detect drift.
+	installedNexthops map[uint32]*iputil.NexthopObject
+	// Routes that are currently installed in the gateway table and use a nexthop group, keyed by destination
+	installedNexthopRoutes map[string]*iputil.NexthopRoute
+}
+
+var _ ExclusionManager = (*NetlinkManager)(nil)
+var _ CloseableManager = (*NetlinkManager)(nil)
+var _ ReconcilingManager = (*NetlinkManager)(nil)
+
+// Option configures optional NetlinkManager behavior
+type Option func(*NetlinkManager)
+
+// WithFamilies sets the address families (netlink.FAMILY_V4 and/or netlink.FAMILY_V6) that
+// routing rules are managed for. If not set, only IPv4 rules are managed.
+func WithFamilies(families ...int) Option {
+	return func(m *NetlinkManager) {
+		m.families = families
+	}
+}
+
+// WithSelectors limits the traffic that is routed via the gateway table to traffic matching any of the selectors,
+// such as traffic from specific client subnets. If not set, all traffic is routed via the gateway table.
+func WithSelectors(selectors ...Selector) Option {
+	return func(m *NetlinkManager) {
+		m.selectors = selectors
+	}
 }
 
-var _ Manager = (*NetlinkManager)(nil)
+// WithBypassSelectors skips the gateway table for traffic matching any of the selectors, such as traffic with a
+// firewall mark. These are checked after the excluded networks, and before the selectors of the gateway table.
+func WithBypassSelectors(selectors ...Selector) Option {
+	return func(m *NetlinkManager) {
+		m.bypassSelectors = selectors
+	}
+}
+
+// WithNoGatewayPolicy sets the route that is installed for destinations without any active gateways, such as a
+// blackhole route for a VPN kill switch. If not set, these routes are removed and traffic falls through to the rest
+// of the system routing tables.
+func WithNoGatewayPolicy(policy NoGatewayPolicy) Option {
+	return func(m *NetlinkManager) {
+		m.noGatewayPolicy = policy
+	}
+}
+
+// WithHandle sets the handle that rules and routes are managed with, such as a recording handle for dry runs. If not
+// set, the kernel is modified directly.
+func WithHandle(handle iputil.NetlinkHandle) Option {
+	return func(m *NetlinkManager) {
+		m.handle = handle
+	}
+}
+
+// WithNexthopGroups routes destinations via kernel nexthop groups instead of multipath routes. Gateway changes then
+// update the group that routes use at once. Resilient hashing is used when resilientBuckets is not zero, so that
+// flows via the remaining gateways are not moved when a gateway is removed. Requires a handle that implements
+// iputil.NexthopHandle, and Linux 5.3 or later (5.13 for resilient hashing).
+func WithNexthopGroups(resilientBuckets uint16) Option {
+	return func(m *NetlinkManager) {
+		m.nexthopGroups = true
+		m.resilientBuckets = resilientBuckets
+	}
+}
 
 // NewNetlinkManager creates a new netlink route manager
-func NewNetlinkManager(netsToExclude []*net.IPNet, firstTableID, firstRulePreference int) (*NetlinkManager, error) {
-	manager := &NetlinkManager{
-		handle: iputil.NewRealNetlinkHandle(),
+func NewNetlinkManager(netsToExclude []*net.IPNet, firstTableID, firstRulePreference int, opts ...Option) (*NetlinkManager, error) {
+	manager := &NetlinkManager{}
+
+	for _, opt := range opts {
+		opt(manager)
+	}
+
+	if manager.handle == nil {
+		manager.handle = iputil.NewRealNetlinkHandle()
+	}
+
+	if manager.nexthopGroups {
+		nexthopHandle, ok := manager.handle.(iputil.NexthopHandle)
+		if !ok {
+			manager.handle.Close()
+			return nil, fmt.Errorf("handle does not support nexthop groups")
+		}
+		manager.nexthopHandle = nexthopHandle
 	}
 
 	if err := manager.excludeNetworks(netsToExclude, firstTableID, firstRulePreference); err != nil {
@@ -57,6 +319,17 @@ func NewNetlinkManager(netsToExclude []*net.IPNet, firstTableID, firstRulePrefer
 		return nil, fmt.Errorf("failed to exclude networks: %w", err)
 	}
 
+	// Objects left behind by a previous run would conflict with the IDs that are assigned by this run
+	if manager.nexthopGroups {
+		if err := manager.removeNexthops(); err != nil {
+			if cleanupErr := manager.removeRules(); cleanupErr != nil {
+				slog.Error("Failed to clean up rules after nexthop removal failure", "error", cleanupErr)
+			}
+			manager.handle.Close()
+			return nil, fmt.Errorf("failed to remove existing nexthops: %w", err)
+		}
+	}
+
 	return manager, nil
 }
 
@@ -69,14 +342,25 @@ func NewNetlinkManager(netsToExclude []*net.IPNet, firstTableID, firstRulePrefer
 // startRule+0: from netToExclude1 jump fallthrough table rule
 // ...
 // startRule+M-1: from netToExcludeM jump to the fallthrough table rule at startRule+N
-// startRule+N-1: from all lookup gatewayTableID
+// startRule+M: from bypassSelector1 jump to the fallthrough table rule at startRule+N
+// ...
+// startRule+M+B-1: from bypassSelectorB jump to the fallthrough table rule at startRule+N
+// startRule+M+B: from selector1 lookup gatewayTableID
+// ...
+// startRule+N-1: from selectorS lookup gatewayTableID
 // startRule+N: from all lookup fallthroughTableID
 // ...
 // 32766: from all lookup main
 // 32767: from all lookup default
 //
-// where M is the number of networks to exclude, and N is M+2. This makes the total number of required rules M + 2
-// (for the jump to the fallthrough table and the jump to gateway table).
+// where M is the number of networks to exclude, B is the number of bypass selectors (such as firewall marks), S is
+// the number of selectors, and N is M+B+S. This makes the total number of required rules M + B + S + 1. When no
+// selectors are configured, a single "from all" gateway table rule is used, so S is 1. Traffic that does not match
+// any selector continues to the fallthrough table rule, and from there to the rest of the system routing tables.
+//
+// IPv4 and IPv6 rules are stored in separate lists by the kernel. When both families are managed, the same rule
+// preferences are used in both lists. Each network exclude rule and source selector rule is only added to the list
+// of its own family (leaving a gap in the other list), while the other rules are added to every managed family.
 //
 // The gateway table will contain a single rule: the ECMP default route via the active gateways. This means
 // that this table will never return, as all packets that hit it will be routed via one of the gateways.
@@ -87,7 +371,8 @@ func NewNetlinkManager(netsToExclude []*net.IPNet, firstTableID, firstRulePrefer
 //
 // It is important that the rules are added in the following order to prevent disruption of existing traffic:
 // 1. Add the jump to the fallthrough table rule
-// 2. Add the network exclude rules, which jump to the fallthrough table jump rule (traffic has not been impacted yet)
+// 2. Add the network exclude and bypass rules, which jump to the fallthrough table jump rule (traffic has not been
+//    impacted yet)
 // 3. Add the jump to the gateway table rule (this is where traffic starts being routed via the gateways)
 //
 // When removing the rules, they should be removed in reverse order to prevent disruption.
@@ -103,11 +388,9 @@ func (m *NetlinkManager) excludeNetworks(netsToExclude []*net.IPNet, firstTableI
 	// subsets, and merging adjacent networks
 	netsToExclude = iputil.ReduceNetworks(netsToExclude)
 
-	// Validate that there are enough rule priorities available
-	requiredRuleCount := len(netsToExclude) + 2             // 2 for the table rules, rest for the exclude jumps
-	maxFirstRulePreference := 32766 - requiredRuleCount + 1 // +1 because the firstRuleID is inclusive
-	if firstRulePreference < 1 || firstRulePreference > maxFirstRulePreference {
-		return fmt.Errorf("invalid first rule preference: %d (must be between 1 and %d)", firstRulePreference, maxFirstRulePreference)
+	selectorCount := len(m.bypassSelectors) + len(m.gatewaySelectors())
+	if err := validateFirstRulePreference(firstRulePreference, len(netsToExclude), selectorCount); err != nil {
+		return err
 	}
 
 	// Update the manager state with the provided parameters
@@ -117,8 +400,8 @@ func (m *NetlinkManager) excludeNetworks(netsToExclude []*net.IPNet, firstTableI
 	m.fallthroughTableID = firstTableID + 1
 
 	m.firstExcludeRulePreference = firstRulePreference
-	m.fallthroughTableRulePreference = firstRulePreference + len(netsToExclude) + 1 // Last rule is the fallthrough table rule
-	m.gatewayTableRulePreference = m.fallthroughTableRulePreference - 1             // Second last rule is the gateway table rule
+	m.fallthroughTableRulePreference = firstRulePreference + len(netsToExclude) + selectorCount // Last rule is the fallthrough table rule
+	m.gatewayTableRulePreference = m.fallthroughTableRulePreference - len(m.gatewaySelectors()) // Gateway table rules are right before it
 
 	// Add the rules to the system
 	if err := m.addRules(); err != nil {
@@ -130,7 +413,48 @@ func (m *NetlinkManager) excludeNetworks(netsToExclude []*net.IPNet, firstTableI
 		return fmt.Errorf("failed to add rules: %w", err)
 	}
 
-	slog.Info("Configured route manager", "gateway_table", m.gatewayTableID, "fallthrough_table", m.fallthroughTableID, "first_rule_preference", m.firstExcludeRulePreference, "excluded_networks", netsToExclude)
+	slog.Info("Configured route manager", "gateway_table", m.gatewayTableID, "fallthrough_table", m.fallthroughTableID, "first_rule_preference", m.firstExcludeRulePreference, "excluded_networks", netsToExclude, "selectors", m.gatewaySelectors())
+	return nil
+}
+
+// validateFirstRulePreference checks that there are enough rule priorities available for the given number of
+// (already reduced) networks to exclude and selectors
+func validateFirstRulePreference(firstRulePreference, excludeNetCount, selectorCount int) error {
+	requiredRuleCount := excludeNetCount + selectorCount + 1 // 1 for the fallthrough table rule
+	maxFirstRulePreference := 32766 - requiredRuleCount + 1  // +1 because the firstRuleID is inclusive
+	if firstRulePreference < 1 || firstRulePreference > maxFirstRulePreference {
+		return fmt.Errorf("invalid first rule preference: %d (must be between 1 and %d)", firstRulePreference, maxFirstRulePreference)
+	}
+
+	return nil
+}
+
+// UpdateExclusions replaces the networks that are excluded from route management. The rules are only rebuilt if
+// the reduced set of networks changed. Routes in the gateway table are not touched. While the rules are being
+// rebuilt, traffic briefly falls through to the rest of the system routing tables.
+func (m *NetlinkManager) UpdateExclusions(netsToExclude []*net.IPNet) error {
+	reducedNets := iputil.ReduceNetworks(netsToExclude)
+	if slices.EqualFunc(reducedNets, m.excludeNets, func(a, b *net.IPNet) bool {
+		return a.String() == b.String()
+	}) {
+		slog.Debug("Excluded networks unchanged, skipping rule update")
+		return nil
+	}
+
+	if err := validateFirstRulePreference(m.firstExcludeRulePreference, len(reducedNets), len(m.bypassSelectors)+len(m.gatewaySelectors())); err != nil {
+		return err
+	}
+
+	// The rule preferences depend on the number of excluded networks, so the existing rules must be removed
+	// using the current layout before the new layout is applied
+	if err := m.removeRules(); err != nil {
+		return fmt.Errorf("failed to remove existing rules: %w", err)
+	}
+
+	if err := m.excludeNetworks(reducedNets, m.gatewayTableID, m.firstExcludeRulePreference); err != nil {
+		return fmt.Errorf("failed to exclude networks: %w", err)
+	}
+
 	return nil
 }
 
@@ -141,44 +465,96 @@ func (m *NetlinkManager) addRules() error {
 		return fmt.Errorf("failed to remove existing rules: %w", err)
 	}
 
-	// First add the fallthrough table rule
+	for _, family := range m.ipFamilies() {
+		for _, rule := range m.desiredRules(family) {
+			if err := m.handle.RuleAdd(rule); err != nil {
+				return fmt.Errorf("failed to add %s rule with preference %d: %w", familyName(family), rule.Priority, err)
+			}
+			slog.Debug("Added rule", "family", familyName(family), "rule", rule.String())
+		}
+	}
+
+	return nil
+}
+
+// desiredRules returns the rules of the address family, in the order that they must be added to prevent disruption
+// of existing traffic
+func (m *NetlinkManager) desiredRules(family int) []*netlink.Rule {
+	// First the fallthrough table rule
 	fallthroughRule := netlink.NewRule()
+	fallthroughRule.Family = family
 	fallthroughRule.Table = m.fallthroughTableID
 	fallthroughRule.Priority = m.fallthroughTableRulePreference
+	rules := []*netlink.Rule{fallthroughRule}
 
-	if err := m.handle.RuleAdd(fallthroughRule); err != nil {
-		return fmt.Errorf("failed to add fallthrough table rule: %w", err)
-	}
-	slog.Debug("Added fallthrough table rule", "table", m.fallthroughTableID, "preference", fallthroughRule.Priority)
-
-	// Then add the exclude rules
+	// Then the exclude rules
 	for i, excludeNet := range m.excludeNets {
+		if iputil.Family(excludeNet.IP) != family {
+			continue
+		}
+
 		excludeRule := netlink.NewRule()
+		excludeRule.Family = family
 		excludeRule.Dst = excludeNet
 		excludeRule.Goto = m.fallthroughTableRulePreference // Jump to fallthrough table rule, skippping over the gateway table rule
 		excludeRule.Priority = m.firstExcludeRulePreference + i
+		rules = append(rules, excludeRule)
+	}
 
-		if err := m.handle.RuleAdd(excludeRule); err != nil {
-			return fmt.Errorf("failed to add exclude rule for %s: %w", excludeNet.String(), err)
+	// Then the bypass rules
+	for i, selector := range m.bypassSelectors {
+		if !selector.matchesFamily(family) {
+			continue
 		}
-		slog.Debug("Added exclude rule", "network", excludeNet.String(), "table", excludeRule.Table, "preference", excludeRule.Priority)
+
+		bypassRule := selector.rule(family)
+		bypassRule.Goto = m.fallthroughTableRulePreference
+		bypassRule.Priority = m.firstBypassRulePreference() + i
+		rules = append(rules, bypassRule)
 	}
 
-	// Finally add the gateway table rule
-	gatewayRule := netlink.NewRule()
-	gatewayRule.Table = m.gatewayTableID
-	gatewayRule.Priority = m.gatewayTableRulePreference
+	// Finally the gateway table rules
+	for i, selector := range m.gatewaySelectors() {
+		if !selector.matchesFamily(family) {
+			continue
+		}
 
-	if err := m.handle.RuleAdd(gatewayRule); err != nil {
-		return fmt.Errorf("failed to add gateway table rule: %w", err)
+		gatewayRule := selector.rule(family)
+		gatewayRule.Table = m.gatewayTableID
+		gatewayRule.Priority = m.gatewayTableRulePreference + i
+		rules = append(rules, gatewayRule)
 	}
-	slog.Debug("Added gateway table rule", "table", m.gatewayTableID, "preference", gatewayRule.Priority)
 
-	return nil
+	return rules
+}
+
+// firstBypassRulePreference returns the preference of the first bypass rule, which follows the exclude rules
+func (m *NetlinkManager) firstBypassRulePreference() int {
+	return m.firstExcludeRulePreference + len(m.excludeNets)
+}
+
+// gatewaySelectors returns the selectors of the gateway table rules. Without any configured selectors, all traffic
+// is matched by a single rule.
+func (m *NetlinkManager) gatewaySelectors() []Selector {
+	if len(m.selectors) == 0 {
+		return []Selector{{}}
+	}
+
+	return m.selectors
 }
 
 func (m *NetlinkManager) removeRules() error {
-	rules, err := m.handle.RuleList(netlink.FAMILY_V4)
+	for _, family := range m.ipFamilies() {
+		if err := m.removeFamilyRules(family); err != nil {
+			return fmt.Errorf("failed to remove %s rules: %w", familyName(family), err)
+		}
+	}
+
+	return nil
+}
+
+func (m *NetlinkManager) removeFamilyRules(family int) error {
+	rules, err := m.handle.RuleList(family)
 	if err != nil {
 		return fmt.Errorf("failed to list rules: %w", err)
 	}
@@ -190,18 +566,46 @@ func (m *NetlinkManager) removeRules() error {
 	}
 
 	// Remove rules in reverse order
-	// First remove the gateway table rule
-	if gatewayTableRule, ok := ruleMap[m.gatewayTableRulePreference]; ok {
-		if err := m.handle.RuleDel(&gatewayTableRule); err != nil {
-			return fmt.Errorf("failed to delete gateway table rule: %w", err)
+	// First remove the gateway table rules
+	for i, selector := range m.gatewaySelectors() {
+		if !selector.matchesFamily(family) {
+			continue
+		}
+
+		rulePreference := m.gatewayTableRulePreference + i
+		if gatewayTableRule, ok := ruleMap[rulePreference]; ok {
+			if err := m.handle.RuleDel(&gatewayTableRule); err != nil {
+				return fmt.Errorf("failed to delete gateway table rule with preference %d for %s: %w", rulePreference, selector.String(), err)
+			}
+			slog.Debug("Removed gateway table rule", "selector", selector.String(), "preference", rulePreference)
+		} else {
+			slog.Debug("Gateway table rule not found, skipping removal", "selector", selector.String(), "preference", rulePreference)
+		}
+	}
+
+	// Then remove the bypass rules
+	for i, selector := range m.bypassSelectors {
+		if !selector.matchesFamily(family) {
+			continue
+		}
+
+		rulePreference := m.firstBypassRulePreference() + i
+		if bypassRule, ok := ruleMap[rulePreference]; ok {
+			if err := m.handle.RuleDel(&bypassRule); err != nil {
+				return fmt.Errorf("failed to delete bypass rule with preference %d for %s: %w", rulePreference, selector.String(), err)
+			}
+			slog.Debug("Removed bypass rule", "selector", selector.String(), "preference", rulePreference)
+		} else {
+			slog.Debug("Bypass rule not found, skipping removal", "selector", selector.String(), "preference", rulePreference)
 		}
-		slog.Debug("Removed gateway table rule", "preference", m.gatewayTableRulePreference)
-	} else {
-		slog.Debug("Gateway table rule not found, skipping removal", "preference", m.gatewayTableRulePreference)
 	}
 
 	// Then remove the exclude rules
 	for i, excludeNet := range m.excludeNets {
+		if iputil.Family(excludeNet.IP) != family {
+			continue
+		}
+
 		rulePreference := m.firstExcludeRulePreference + i
 		if excludeRule, ok := ruleMap[rulePreference]; ok {
 			if err := m.handle.RuleDel(&excludeRule); err != nil {
@@ -227,6 +631,16 @@ func (m *NetlinkManager) removeRules() error {
 }
 
 func (m *NetlinkManager) Close() error {
+	// The kernel removes the routes that use a nexthop group along with it. These routes cannot be removed by their
+	// gateways like other routes, so the groups are removed first.
+	var removeNexthopsErr error
+	if m.nexthopGroups {
+		removeNexthopsErr = m.removeNexthops()
+		if removeNexthopsErr != nil {
+			removeNexthopsErr = fmt.Errorf("failed to remove nexthops during close: %w", removeNexthopsErr)
+		}
+	}
+
 	removeRoutesErr := m.removeRoutes()
 	if removeRoutesErr != nil {
 		removeRoutesErr = fmt.Errorf("failed to remove routes during close: %w", removeRoutesErr)
@@ -238,44 +652,170 @@ func (m *NetlinkManager) Close() error {
 	}
 
 	m.handle.Close()
-	return errors.Join(removeRoutesErr, removeRulesErr)
+	return errors.Join(removeNexthopsErr, removeRoutesErr, removeRulesErr)
 }
 
-// UpdateRoutes updates the specified routes to use ECMP with the provided active gateways.
+// UpdateRoutes updates the specified routes to use weighted ECMP with their nexthops. Routes without nexthops
+// are handled according to the no gateway policy, and are removed from the gateway table by default.
 // Only returns an error if a fatal error occurs during route manipulation.
-func (m *NetlinkManager) UpdateRoutes(routes []*net.IPNet, activeGateways []net.IP) error {
+// Routes are only ever routed via gateways of the same address family.
+func (m *NetlinkManager) UpdateRoutes(routes []Route) error {
 	if len(routes) == 0 {
 		return fmt.Errorf("no routes specified")
 	}
 
-	if len(activeGateways) == 0 {
-		// Remove existing routes if no gateways are active
-		if err := m.removeRoutes(); err != nil {
-			return fmt.Errorf("failed to remove routes: %w", err)
+	destinations := make([]*net.IPNet, 0, len(routes))
+	for _, route := range routes {
+		destinations = append(destinations, route.Destination)
+	}
+
+	// Remove any routes that were previously configured, but are no longer requested
+	if err := m.removeStaleRoutes(destinations); err != nil {
+		return fmt.Errorf("failed to remove stale routes: %w", err)
+	}
+	m.appliedRoutes = destinations
+
+	update := newRouteUpdate()
+	defer func() { m.lastUpdateStats = update.stats }()
+
+	for _, route := range routes {
+		family := iputil.Family(route.Destination.IP)
+
+		// Sort gateways for consistent ordering
+		nexthops := filterNexthopsByFamily(route.Nexthops, family)
+		sort.Slice(nexthops, func(i, j int) bool {
+			return nexthops[i].Gateway.String() < nexthops[j].Gateway.String()
+		})
+
+		if len(nexthops) == 0 {
+			if err := m.applyNoGatewayPolicy(route.Destination, update); err != nil {
+				return fmt.Errorf("failed to apply no gateway policy to route to %s: %w", route.Destination.String(), err)
+			}
+			continue
+		}
+
+		if m.nexthopGroups {
+			if err := m.replaceRouteGroup(route, nexthops, update); err != nil {
+				return fmt.Errorf("failed to update route to %s: %w", route.Destination.String(), err)
+			}
+			continue
+		}
+
+		if err := m.replaceRouteECMP(route.Destination, nexthops, update); err != nil {
+			return fmt.Errorf("failed to update route to %s: %w", route.Destination.String(), err)
+		}
+	}
+
+	if m.nexthopGroups {
+		// Nexthops are only removed once no route uses them anymore
+		if err := m.removeUnusedNexthops(update.usedNexthops); err != nil {
+			return fmt.Errorf("failed to remove unused nexthops: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// applyNoGatewayPolicy replaces the route to a destination without any active gateways with the route of the no
+// gateway policy, or removes the route if the policy lets traffic fall through
+func (m *NetlinkManager) applyNoGatewayPolicy(destination *net.IPNet, update *routeUpdate) error {
+	family := iputil.Family(destination.IP)
+
+	route := m.noGatewayPolicy.route(destination, m.gatewayTableID)
+	if route == nil {
+		if err := m.deleteRoute(destination); err != nil {
+			return fmt.Errorf("failed to remove route: %w", err)
 		}
 
-		slog.Debug("No active gateways, routes removed")
+		slog.Debug("No active gateways, route removed", "destination", destination.String(), "family", familyName(family))
 		return nil
 	}
 
-	// Sort gateways for consistent ordering
-	sort.Slice(activeGateways, func(i, j int) bool {
-		return activeGateways[i].String() < activeGateways[j].String()
-	})
+	if err := m.replaceRoute(route, update); err != nil {
+		return fmt.Errorf("failed to replace/add %s route: %w", m.noGatewayPolicy.Action, err)
+	}
 
-	// Update each route
-	for _, route := range routes {
-		if err := m.replaceRouteECMP(route, activeGateways); err != nil {
-			return fmt.Errorf("failed to update route to %s: %w", route.String(), err)
+	slog.Debug("No active gateways, installed no gateway route", "destination", destination.String(), "family", familyName(family), "action", m.noGatewayPolicy.Action.String(), "gateway", route.Gw)
+	return nil
+}
+
+// removeStaleRoutes deletes routes from the gateway table that were applied by a previous UpdateRoutes call, but
+// are not in the provided destinations
+func (m *NetlinkManager) removeStaleRoutes(destinations []*net.IPNet) error {
+	for _, appliedRoute := range m.appliedRoutes {
+		if slices.ContainsFunc(destinations, func(destination *net.IPNet) bool {
+			return destination.String() == appliedRoute.String()
+		}) {
+			continue
 		}
+
+		if err := m.deleteRoute(appliedRoute); err != nil {
+			return fmt.Errorf("failed to delete route to %s: %w", appliedRoute.String(), err)
+		}
+
+		slog.Debug("Removed stale route", "destination", appliedRoute.String())
+	}
+
+	return nil
+}
+
+// deleteRoute deletes the route to the destination from the gateway table, if it exists
+func (m *NetlinkManager) deleteRoute(destination *net.IPNet) error {
+	route := &netlink.Route{
+		Dst:   destination,
+		Table: m.gatewayTableID,
+	}
+
+	// The route may already be gone if there were no active gateways for it
+	if err := m.handle.RouteDel(route); err != nil && !errors.Is(err, syscall.ESRCH) {
+		return err
 	}
 
+	delete(m.installedRoutes, destination.String())
+	delete(m.installedNexthopRoutes, destination.String())
+	return nil
+}
+
+// replaceRoute adds or replaces a route in the gateway table, and records it as installed. Routes that are unchanged
+// since the previous update are skipped.
+func (m *NetlinkManager) replaceRoute(route *netlink.Route, update *routeUpdate) error {
+	if m.routeUnchanged(route, update) {
+		update.stats.Skipped++
+		slog.Debug("Route unchanged, skipping replacement", "route", route.String())
+		return nil
+	}
+
+	// This is an upsert operation, so if the route does not exist, it will be created
+	if err := m.handle.RouteReplace(route); err != nil {
+		return err
+	}
+	update.stats.Applied++
+
+	if m.installedRoutes == nil {
+		m.installedRoutes = make(map[string]*netlink.Route)
+	}
+	m.installedRoutes[route.Dst.String()] = route
+	delete(m.installedNexthopRoutes, route.Dst.String())
 	return nil
 }
 
 func (m *NetlinkManager) removeRoutes() error {
+	m.installedRoutes = nil
+	m.installedNexthopRoutes = nil
+
+	var errs []error
+	for _, family := range m.ipFamilies() {
+		if err := m.removeFamilyRoutes(family); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove %s routes: %w", familyName(family), err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (m *NetlinkManager) removeFamilyRoutes(family int) error {
 	var cleanupErr error
-	err := m.handle.RouteListFilteredIter(netlink.FAMILY_V4, &netlink.Route{Table: m.gatewayTableID}, netlink.RT_FILTER_TABLE, func(route netlink.Route) bool {
+	err := m.handle.RouteListFilteredIter(family, &netlink.Route{Table: m.gatewayTableID}, netlink.RT_FILTER_TABLE, func(route netlink.Route) bool {
 		if err := m.handle.RouteDel(&route); err != nil {
 			cleanupErr = fmt.Errorf("failed to delete route to %s via %s: %v", route.Dst, route.Gw, err)
 			return false
@@ -292,36 +832,124 @@ func (m *NetlinkManager) removeRoutes() error {
 	return errors.Join(err, cleanupErr)
 }
 
-func (m *NetlinkManager) replaceRouteECMP(routeNet *net.IPNet, gateways []net.IP) error {
-	if len(gateways) == 0 {
+func (m *NetlinkManager) replaceRouteECMP(routeNet *net.IPNet, nexthops []Nexthop, update *routeUpdate) error {
+	if len(nexthops) == 0 {
 		return nil
 	}
 
-	// Create multipath route for ECMP
-	nexthops := make([]*netlink.NexthopInfo, 0, len(gateways))
-	for _, gateway := range gateways {
-		nexthops = append(nexthops, &netlink.NexthopInfo{
-			Gw: gateway,
-		})
+	// Create multipath route for ECMP. The kernel weight of a nexthop is its hop count plus one.
+	nexthopInfos := make([]*netlink.NexthopInfo, 0, len(nexthops))
+	gatewayStrings := make([]string, 0, len(nexthops))
+	usedNexthops := make([]Nexthop, 0, len(nexthops))
+	for _, nexthop := range nexthops {
+		nexthopInfo := &netlink.NexthopInfo{
+			Gw:   nexthop.Gateway,
+			Hops: min(max(nexthop.Weight, 1), MaxWeight) - 1,
+		}
+		gatewayString := fmt.Sprintf("%s (weight %d)", nexthop.Gateway, max(nexthop.Weight, 1))
+
+		if nexthop.Interface != "" {
+			linkIndex, err := m.interfaceIndex(nexthop)
+			if err != nil {
+				return err
+			}
+			if linkIndex == 0 {
+				continue
+			}
+
+			nexthopInfo.LinkIndex = linkIndex
+			gatewayString = fmt.Sprintf("%s dev %s (weight %d)", nexthop.Gateway, nexthop.Interface, max(nexthop.Weight, 1))
+		}
+
+		if nexthop.OnLink {
+			nexthopInfo.Flags |= int(netlink.FLAG_ONLINK)
+		}
+
+		nexthopInfos = append(nexthopInfos, nexthopInfo)
+		gatewayStrings = append(gatewayStrings, gatewayString)
+		usedNexthops = append(usedNexthops, nexthop)
+	}
+
+	if len(nexthopInfos) == 0 {
+		return m.applyNoGatewayPolicy(routeNet, update)
 	}
 
 	route := &netlink.Route{
 		Dst:       routeNet,
-		MultiPath: nexthops,
+		MultiPath: nexthopInfos,
+		Src:       preferredSource(routeNet, usedNexthops),
 		Table:     m.gatewayTableID,
 	}
 
-	// Try to replace existing route. This is an upsert operation, so if the route
-	// does not exist, it will be created.
-	if err := m.handle.RouteReplace(route); err != nil {
+	if err := m.replaceRoute(route, update); err != nil {
 		return fmt.Errorf("failed to replace/add ECMP route: %w", err)
 	}
 
-	gatewayStrings := make([]string, 0, len(gateways))
-	for _, gw := range gateways {
-		gatewayStrings = append(gatewayStrings, gw.String())
-	}
 	slog.Debug("Updated ECMP route", "destination", routeNet.String(), "gateways", gatewayStrings)
 
 	return nil
 }
+
+// interfaceIndex returns the index of the interface of the nexthop, or zero if the interface is missing. Interfaces
+// are looked up on every update, because tunnel interfaces get a new index when recreated. Gateways are skipped while
+// their interface is missing, such as when a tunnel is being recreated.
+func (m *NetlinkManager) interfaceIndex(nexthop Nexthop) (int, error) {
+	link, err := m.handle.LinkByName(nexthop.Interface)
+	var notFoundErr netlink.LinkNotFoundError
+	if errors.As(err, &notFoundErr) {
+		slog.Warn("Interface of gateway not found, not routing via it", "gateway", nexthop.Gateway, "interface", nexthop.Interface)
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to find interface %s of gateway %s: %w", nexthop.Interface, nexthop.Gateway, err)
+	}
+
+	return link.Attrs().Index, nil
+}
+
+// ipFamilies returns the address families that rules are managed for
+func (m *NetlinkManager) ipFamilies() []int {
+	if len(m.families) == 0 {
+		return []int{netlink.FAMILY_V4}
+	}
+
+	return m.families
+}
+
+// preferredSource returns the preferred source address of the nexthops, or nil if none set one or they disagree
+func preferredSource(routeNet *net.IPNet, nexthops []Nexthop) net.IP {
+	var source net.IP
+	for _, nexthop := range nexthops {
+		if nexthop.PreferredSource == nil {
+			continue
+		}
+
+		if source != nil && !source.Equal(nexthop.PreferredSource) {
+			slog.Debug("Gateways of route have different preferred source addresses, not setting one",
+				"destination", routeNet.String(), "sources", []string{source.String(), nexthop.PreferredSource.String()})
+			return nil
+		}
+		source = nexthop.PreferredSource
+	}
+
+	return source
+}
+
+func filterNexthopsByFamily(nexthops []Nexthop, family int) []Nexthop {
+	filtered := make([]Nexthop, 0, len(nexthops))
+	for _, nexthop := range nexthops {
+		if iputil.Family(nexthop.Gateway) == family {
+			filtered = append(filtered, nexthop)
+		}
+	}
+
+	return filtered
+}
+
+func familyName(family int) string {
+	if family == netlink.FAMILY_V6 {
+		return "IPv6"
+	}
+
+	return "IPv4"
+}
@@ -6,6 +6,7 @@ import (
 	"os/exec"
 	"slices"
 	"strings"
+	"syscall"
 	"testing"
 
 	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/iputil"
@@ -13,6 +14,7 @@ import (
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
 )
 
 // mockNetlinkHandle is a mock implementation of the netlinkHandle interface
@@ -46,6 +48,12 @@ func (m *mockNetlinkHandle) RouteDel(route *netlink.Route) error {
 	return args.Error(0)
 }
 
+func (m *mockNetlinkHandle) LinkByName(name string) (netlink.Link, error) {
+	args := m.Called(name)
+	link, _ := args.Get(0).(netlink.Link)
+	return link, args.Error(1)
+}
+
 func (m *mockNetlinkHandle) RuleList(family int) ([]netlink.Rule, error) {
 	args := m.Called(family)
 	return args.Get(0).([]netlink.Rule), args.Error(1)
@@ -65,6 +73,33 @@ func (m *mockNetlinkHandle) Close() {
 	m.Called()
 }
 
+func (m *mockNetlinkHandle) NexthopList() ([]iputil.NexthopObject, error) {
+	args := m.Called()
+	nexthops, _ := args.Get(0).([]iputil.NexthopObject)
+	return nexthops, args.Error(1)
+}
+
+func (m *mockNetlinkHandle) NexthopReplace(nexthop *iputil.NexthopObject) error {
+	args := m.Called(nexthop)
+	return args.Error(0)
+}
+
+func (m *mockNetlinkHandle) NexthopDel(id uint32) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *mockNetlinkHandle) NexthopRouteList(family, table int) ([]iputil.NexthopRoute, error) {
+	args := m.Called(family, table)
+	routes, _ := args.Get(0).([]iputil.NexthopRoute)
+	return routes, args.Error(1)
+}
+
+func (m *mockNetlinkHandle) NexthopRouteReplace(route *iputil.NexthopRoute) error {
+	args := m.Called(route)
+	return args.Error(0)
+}
+
 // createTestNetlinkManager creates a NetlinkManager with a mocked handle for testing
 func createTestNetlinkManager(mockHandle *mockNetlinkHandle) *NetlinkManager {
 	return &NetlinkManager{
@@ -169,6 +204,7 @@ func TestMockNetlinkHandle_InterfaceCompliance(t *testing.T) {
 
 	// This should compile if mockNetlinkHandle properly implements netlinkHandle
 	var _ iputil.NetlinkHandle = mockHandle
+	var _ iputil.NexthopHandle = mockHandle
 
 	assert.NotNil(t, mockHandle)
 }
@@ -442,7 +478,7 @@ func TestNetlinkManager_UpdateRoutes_NoRoutes(t *testing.T) {
 	mockHandle := &mockNetlinkHandle{}
 	manager := createTestNetlinkManager(mockHandle)
 
-	err := manager.UpdateRoutes([]*net.IPNet{}, []net.IP{})
+	err := manager.UpdateRoutes([]Route{})
 
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "no routes specified")
@@ -458,10 +494,10 @@ func TestNetlinkManager_UpdateRoutes_NoGateways(t *testing.T) {
 		Mask: net.CIDRMask(16, 32),
 	}
 
-	// Mock the removeRoutes call
-	mockHandle.On("RouteListFilteredIter", netlink.FAMILY_V4, &netlink.Route{Table: 100}, uint64(netlink.RT_FILTER_TABLE), mock.AnythingOfType("func(netlink.Route) bool")).Return(nil, []netlink.Route{})
+	// The route should be removed, as there are no gateways for it
+	mockHandle.On("RouteDel", &netlink.Route{Dst: route, Table: 100}).Return(syscall.ESRCH)
 
-	err := manager.UpdateRoutes([]*net.IPNet{route}, []net.IP{})
+	err := manager.UpdateRoutes([]Route{{Destination: route}})
 
 	require.NoError(t, err)
 	mockHandle.AssertExpectations(t)
@@ -487,7 +523,7 @@ func TestNetlinkManager_UpdateRoutes_SingleRoute(t *testing.T) {
 
 	mockHandle.On("RouteReplace", expectedRoute).Return(nil)
 
-	err := manager.UpdateRoutes([]*net.IPNet{route}, []net.IP{gateway})
+	err := manager.UpdateRoutes([]Route{{Destination: route, Nexthops: []Nexthop{{Gateway: gateway}}}})
 
 	require.NoError(t, err)
 	mockHandle.AssertExpectations(t)
@@ -526,8 +562,515 @@ func TestNetlinkManager_UpdateRoutes_MultipleRoutes(t *testing.T) {
 	mockHandle.On("RouteReplace", expectedRoute1).Return(nil)
 	mockHandle.On("RouteReplace", expectedRoute2).Return(nil)
 
-	err := manager.UpdateRoutes([]*net.IPNet{route1, route2}, []net.IP{gateway})
+	nexthops := []Nexthop{{Gateway: gateway}}
+	err := manager.UpdateRoutes([]Route{
+		{Destination: route1, Nexthops: nexthops},
+		{Destination: route2, Nexthops: nexthops},
+	})
+
+	require.NoError(t, err)
+	mockHandle.AssertExpectations(t)
+}
+
+func TestNetlinkManager_UpdateRoutes_DualStack(t *testing.T) {
+	mockHandle := &mockNetlinkHandle{}
+	manager := createTestNetlinkManager(mockHandle)
+	manager.families = []int{netlink.FAMILY_V4, netlink.FAMILY_V6}
+
+	route4 := &net.IPNet{
+		IP:   net.IPv4zero,
+		Mask: net.CIDRMask(0, 32),
+	}
+	route6 := &net.IPNet{
+		IP:   net.IPv6zero,
+		Mask: net.CIDRMask(0, 128),
+	}
+	gateway4 := net.ParseIP("192.168.1.1")
+	gateway6 := net.ParseIP("2001:db8::1")
+
+	expectedRoute4 := &netlink.Route{
+		Dst: route4,
+		MultiPath: []*netlink.NexthopInfo{
+			{Gw: gateway4},
+		},
+		Table: 100, // gateway table
+	}
+
+	expectedRoute6 := &netlink.Route{
+		Dst: route6,
+		MultiPath: []*netlink.NexthopInfo{
+			{Gw: gateway6},
+		},
+		Table: 100, // gateway table
+	}
+
+	// Each route should only be routed via gateways of its own family
+	mockHandle.On("RouteReplace", expectedRoute4).Return(nil)
+	mockHandle.On("RouteReplace", expectedRoute6).Return(nil)
+
+	nexthops := []Nexthop{{Gateway: gateway6}, {Gateway: gateway4}}
+	err := manager.UpdateRoutes([]Route{
+		{Destination: route4, Nexthops: nexthops},
+		{Destination: route6, Nexthops: nexthops},
+	})
+
+	require.NoError(t, err)
+	mockHandle.AssertExpectations(t)
+}
+
+func TestNetlinkManager_UpdateRoutes_NoGatewaysForFamily(t *testing.T) {
+	mockHandle := &mockNetlinkHandle{}
+	manager := createTestNetlinkManager(mockHandle)
+	manager.families = []int{netlink.FAMILY_V4, netlink.FAMILY_V6}
+
+	route4 := &net.IPNet{
+		IP:   net.IPv4zero,
+		Mask: net.CIDRMask(0, 32),
+	}
+	route6 := &net.IPNet{
+		IP:   net.IPv6zero,
+		Mask: net.CIDRMask(0, 128),
+	}
+	gateway4 := net.ParseIP("192.168.1.1")
+
+	expectedRoute4 := &netlink.Route{
+		Dst: route4,
+		MultiPath: []*netlink.NexthopInfo{
+			{Gw: gateway4},
+		},
+		Table: 100, // gateway table
+	}
+
+	// The IPv4 route should be updated, while the IPv6 route should be removed
+	mockHandle.On("RouteReplace", expectedRoute4).Return(nil)
+	mockHandle.On("RouteDel", &netlink.Route{Dst: route6, Table: 100}).Return(nil)
+
+	nexthops := []Nexthop{{Gateway: gateway4}}
+	err := manager.UpdateRoutes([]Route{
+		{Destination: route4, Nexthops: nexthops},
+		{Destination: route6, Nexthops: nexthops},
+	})
+
+	require.NoError(t, err)
+	mockHandle.AssertExpectations(t)
+}
+
+func TestNetlinkManager_UpdateRoutes_NoGatewayPolicy(t *testing.T) {
+	route4 := &net.IPNet{
+		IP:   net.IPv4zero,
+		Mask: net.CIDRMask(0, 32),
+	}
+	route6 := &net.IPNet{
+		IP:   net.IPv6zero,
+		Mask: net.CIDRMask(0, 128),
+	}
+	fallback4 := net.ParseIP("192.168.1.254")
+
+	tests := []struct {
+		name           string
+		policy         NoGatewayPolicy
+		expectedRoute4 *netlink.Route // Nil when the route should be removed
+		expectedRoute6 *netlink.Route
+	}{
+		{
+			name:   "fallthrough",
+			policy: NoGatewayPolicy{Action: NoGatewayFallthrough},
+		},
+		{
+			name:           "blackhole",
+			policy:         NoGatewayPolicy{Action: NoGatewayBlackhole},
+			expectedRoute4: &netlink.Route{Dst: route4, Table: 100, Type: unix.RTN_BLACKHOLE},
+			expectedRoute6: &netlink.Route{Dst: route6, Table: 100, Type: unix.RTN_BLACKHOLE},
+		},
+		{
+			name:           "unreachable",
+			policy:         NoGatewayPolicy{Action: NoGatewayUnreachable},
+			expectedRoute4: &netlink.Route{Dst: route4, Table: 100, Type: unix.RTN_UNREACHABLE},
+			expectedRoute6: &netlink.Route{Dst: route6, Table: 100, Type: unix.RTN_UNREACHABLE},
+		},
+		{
+			name:           "prohibit",
+			policy:         NoGatewayPolicy{Action: NoGatewayProhibit},
+			expectedRoute4: &netlink.Route{Dst: route4, Table: 100, Type: unix.RTN_PROHIBIT},
+			expectedRoute6: &netlink.Route{Dst: route6, Table: 100, Type: unix.RTN_PROHIBIT},
+		},
+		{
+			name:           "fallback gateway without one for every family",
+			policy:         NoGatewayPolicy{Action: NoGatewayFallbackGateway, FallbackGateways: []net.IP{fallback4}},
+			expectedRoute4: &netlink.Route{Dst: route4, Table: 100, Gw: fallback4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockHandle := &mockNetlinkHandle{}
+			manager := createTestNetlinkManager(mockHandle)
+			manager.families = []int{netlink.FAMILY_V4, netlink.FAMILY_V6}
+			manager.noGatewayPolicy = tt.policy
+
+			for destination, expectedRoute := range map[*net.IPNet]*netlink.Route{route4: tt.expectedRoute4, route6: tt.expectedRoute6} {
+				if expectedRoute == nil {
+					mockHandle.On("RouteDel", &netlink.Route{Dst: destination, Table: 100}).Return(syscall.ESRCH)
+				} else {
+					mockHandle.On("RouteReplace", expectedRoute).Return(nil)
+				}
+			}
+
+			err := manager.UpdateRoutes([]Route{{Destination: route4}, {Destination: route6}})
+
+			require.NoError(t, err)
+			mockHandle.AssertExpectations(t)
+		})
+	}
+}
+
+func TestNetlinkManager_UpdateRoutes_NoGatewayPolicyError(t *testing.T) {
+	mockHandle := &mockNetlinkHandle{}
+	manager := createTestNetlinkManager(mockHandle)
+	manager.noGatewayPolicy = NoGatewayPolicy{Action: NoGatewayBlackhole}
+
+	route := &net.IPNet{
+		IP:   net.IPv4zero,
+		Mask: net.CIDRMask(0, 32),
+	}
+
+	mockHandle.On("RouteReplace", &netlink.Route{Dst: route, Table: 100, Type: unix.RTN_BLACKHOLE}).Return(syscall.EPERM)
+
+	err := manager.UpdateRoutes([]Route{{Destination: route}})
+
+	require.ErrorIs(t, err, syscall.EPERM)
+	assert.Contains(t, err.Error(), "blackhole")
+	mockHandle.AssertExpectations(t)
+}
+
+func TestNetlinkManager_UpdateRoutes_Weights(t *testing.T) {
+	mockHandle := &mockNetlinkHandle{}
+	manager := createTestNetlinkManager(mockHandle)
+
+	route := &net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)}
+	gateway1 := net.ParseIP("192.168.1.1")
+	gateway2 := net.ParseIP("192.168.1.2")
+	gateway3 := net.ParseIP("192.168.1.3")
+
+	// Weights are converted to hop counts, and limited to the range supported by the kernel
+	mockHandle.On("RouteReplace", &netlink.Route{
+		Dst: route,
+		MultiPath: []*netlink.NexthopInfo{
+			{Gw: gateway1, Hops: 0},
+			{Gw: gateway2, Hops: 4},
+			{Gw: gateway3, Hops: 255},
+		},
+		Table: 100,
+	}).Return(nil)
+
+	err := manager.UpdateRoutes([]Route{{Destination: route, Nexthops: []Nexthop{
+		{Gateway: gateway3, Weight: 1000},
+		{Gateway: gateway1},
+		{Gateway: gateway2, Weight: 5},
+	}}})
+
+	require.NoError(t, err)
+	mockHandle.AssertExpectations(t)
+}
+
+func TestNetlinkManager_UpdateRoutes_Interfaces(t *testing.T) {
+	mockHandle := &mockNetlinkHandle{}
+	manager := createTestNetlinkManager(mockHandle)
+
+	route := &net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)}
+	tunnelGateway := net.ParseIP("10.200.0.1")
+	lanGateway := net.ParseIP("192.168.1.1")
+	source := net.ParseIP("192.168.1.10")
+
+	mockHandle.On("LinkByName", "wg0").Return(&netlink.Wireguard{LinkAttrs: netlink.LinkAttrs{Name: "wg0", Index: 7}}, nil)
+	mockHandle.On("RouteReplace", &netlink.Route{
+		Dst: route,
+		MultiPath: []*netlink.NexthopInfo{
+			{Gw: tunnelGateway, LinkIndex: 7, Flags: int(netlink.FLAG_ONLINK)},
+			{Gw: lanGateway},
+		},
+		Src:   source,
+		Table: 100,
+	}).Return(nil)
+
+	err := manager.UpdateRoutes([]Route{{Destination: route, Nexthops: []Nexthop{
+		{Gateway: tunnelGateway, Interface: "wg0", OnLink: true, PreferredSource: source},
+		{Gateway: lanGateway},
+	}}})
+
+	require.NoError(t, err)
+	mockHandle.AssertExpectations(t)
+}
+
+func TestNetlinkManager_UpdateRoutes_InterfaceNotFound(t *testing.T) {
+	mockHandle := &mockNetlinkHandle{}
+	manager := createTestNetlinkManager(mockHandle)
+
+	route := &net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)}
+	mockHandle.On("LinkByName", "wg0").Return(nil, netlink.LinkNotFoundError{})
+
+	// Without any usable gateways, the route falls through
+	mockHandle.On("RouteDel", &netlink.Route{Dst: route, Table: 100}).Return(nil).Once()
+
+	err := manager.UpdateRoutes([]Route{{Destination: route, Nexthops: []Nexthop{
+		{Gateway: net.ParseIP("10.200.0.1"), Interface: "wg0"},
+	}}})
+
+	require.NoError(t, err)
+	mockHandle.AssertExpectations(t)
+	mockHandle.AssertNotCalled(t, "RouteReplace", mock.Anything)
+}
+
+func TestNetlinkManager_UpdateRoutes_InterfaceLookupError(t *testing.T) {
+	mockHandle := &mockNetlinkHandle{}
+	manager := createTestNetlinkManager(mockHandle)
+
+	route := &net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)}
+	mockHandle.On("LinkByName", "wg0").Return(nil, errors.New("netlink error"))
+
+	err := manager.UpdateRoutes([]Route{{Destination: route, Nexthops: []Nexthop{
+		{Gateway: net.ParseIP("10.200.0.1"), Interface: "wg0"},
+	}}})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to find interface wg0")
+	mockHandle.AssertNotCalled(t, "RouteReplace", mock.Anything)
+}
+
+func TestPreferredSource(t *testing.T) {
+	route := &net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)}
+	source1 := net.ParseIP("192.168.1.10")
+	source2 := net.ParseIP("192.168.2.10")
+
+	assert.Nil(t, preferredSource(route, []Nexthop{{}, {}}))
+	assert.Equal(t, source1, preferredSource(route, []Nexthop{{}, {PreferredSource: source1}, {PreferredSource: source1}}))
+	assert.Nil(t, preferredSource(route, []Nexthop{{PreferredSource: source1}, {PreferredSource: source2}}))
+}
+
+func TestNetlinkManager_UpdateRoutes_PerRouteNexthops(t *testing.T) {
+	mockHandle := &mockNetlinkHandle{}
+	manager := createTestNetlinkManager(mockHandle)
+
+	defaultRoute := &net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)}
+	streamingRoute := &net.IPNet{IP: net.ParseIP("198.51.100.0").To4(), Mask: net.CIDRMask(24, 32)}
+	gateway1 := net.ParseIP("192.168.1.1")
+	gateway2 := net.ParseIP("192.168.1.2")
+
+	// Each route is only routed via its own nexthops
+	mockHandle.On("RouteReplace", &netlink.Route{
+		Dst:       defaultRoute,
+		MultiPath: []*netlink.NexthopInfo{{Gw: gateway1}, {Gw: gateway2}},
+		Table:     100,
+	}).Return(nil)
+	mockHandle.On("RouteReplace", &netlink.Route{
+		Dst:       streamingRoute,
+		MultiPath: []*netlink.NexthopInfo{{Gw: gateway2}},
+		Table:     100,
+	}).Return(nil)
+
+	err := manager.UpdateRoutes([]Route{
+		{Destination: defaultRoute, Nexthops: []Nexthop{{Gateway: gateway2}, {Gateway: gateway1}}},
+		{Destination: streamingRoute, Nexthops: []Nexthop{{Gateway: gateway2}}},
+	})
+
+	require.NoError(t, err)
+	mockHandle.AssertExpectations(t)
+}
+
+func TestNetlinkManager_excludeNetworks_DualStack(t *testing.T) {
+	mockHandle := &mockNetlinkHandle{}
+	manager := &NetlinkManager{
+		handle:   mockHandle,
+		families: []int{netlink.FAMILY_V4, netlink.FAMILY_V6},
+	}
+
+	excludeNets := []*net.IPNet{
+		{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(8, 32)},
+		{IP: net.ParseIP("fc00::"), Mask: net.CIDRMask(7, 128)},
+	}
+
+	mockHandle.On("RuleList", netlink.FAMILY_V4).Return([]netlink.Rule{}, nil)
+	mockHandle.On("RuleList", netlink.FAMILY_V6).Return([]netlink.Rule{}, nil)
+
+	// Table rules for each family
+	for _, family := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		mockHandle.On("RuleAdd", mock.MatchedBy(func(rule *netlink.Rule) bool {
+			return rule.Family == family && rule.Table == 101 && rule.Priority == 1003
+		})).Return(nil).Once()
+		mockHandle.On("RuleAdd", mock.MatchedBy(func(rule *netlink.Rule) bool {
+			return rule.Family == family && rule.Table == 100 && rule.Priority == 1002
+		})).Return(nil).Once()
+	}
+
+	// One exclude rule per network, in the network's family
+	mockHandle.On("RuleAdd", mock.MatchedBy(func(rule *netlink.Rule) bool {
+		return rule.Dst != nil && rule.Dst.String() == "10.0.0.0/8" && rule.Priority == 1000 && rule.Goto == 1003
+	})).Return(nil).Once()
+	mockHandle.On("RuleAdd", mock.MatchedBy(func(rule *netlink.Rule) bool {
+		return rule.Dst != nil && rule.Dst.String() == "fc00::/7" && rule.Priority == 1001 && rule.Goto == 1003
+	})).Return(nil).Once()
+
+	err := manager.excludeNetworks(excludeNets, 100, 1000)
 
 	require.NoError(t, err)
 	mockHandle.AssertExpectations(t)
 }
+
+func TestNetlinkManager_excludeNetworks_Selectors(t *testing.T) {
+	mockHandle := &mockNetlinkHandle{}
+	manager := &NetlinkManager{
+		handle:          mockHandle,
+		families:        []int{netlink.FAMILY_V4, netlink.FAMILY_V6},
+		bypassSelectors: []Selector{{Mark: 0x10000, Mask: 0x10000}},
+		selectors: []Selector{
+			{Source: &net.IPNet{IP: net.ParseIP("192.168.10.0"), Mask: net.CIDRMask(24, 32)}},
+			{Mark: 0x10, Mask: 0xff},
+		},
+	}
+
+	excludeNets := []*net.IPNet{
+		{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(8, 32)},
+	}
+
+	mockHandle.On("RuleList", netlink.FAMILY_V4).Return([]netlink.Rule{}, nil)
+	mockHandle.On("RuleList", netlink.FAMILY_V6).Return([]netlink.Rule{}, nil)
+
+	// The exclude and bypass rules jump over the gateway table rules
+	mockHandle.On("RuleAdd", mock.MatchedBy(func(rule *netlink.Rule) bool {
+		return rule.Dst != nil && rule.Dst.String() == "10.0.0.0/8" && rule.Priority == 1000 && rule.Goto == 1004
+	})).Return(nil).Once()
+
+	// The source rule is only added to its own family, while the fwmark and fallthrough rules are added to both
+	mockHandle.On("RuleAdd", mock.MatchedBy(func(rule *netlink.Rule) bool {
+		return rule.Family == netlink.FAMILY_V4 && rule.Table == 100 && rule.Priority == 1002 &&
+			rule.Src != nil && rule.Src.String() == "192.168.10.0/24" && rule.Mask == nil
+	})).Return(nil).Once()
+	for _, family := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		mockHandle.On("RuleAdd", mock.MatchedBy(func(rule *netlink.Rule) bool {
+			return rule.Family == family && rule.Goto == 1004 && rule.Priority == 1001 &&
+				rule.Mark == 0x10000 && rule.Mask != nil && *rule.Mask == 0x10000
+		})).Return(nil).Once()
+		mockHandle.On("RuleAdd", mock.MatchedBy(func(rule *netlink.Rule) bool {
+			return rule.Family == family && rule.Table == 100 && rule.Priority == 1003 &&
+				rule.Src == nil && rule.Mark == 0x10 && rule.Mask != nil && *rule.Mask == 0xff
+		})).Return(nil).Once()
+		mockHandle.On("RuleAdd", mock.MatchedBy(func(rule *netlink.Rule) bool {
+			return rule.Family == family && rule.Table == 101 && rule.Priority == 1004
+		})).Return(nil).Once()
+	}
+
+	err := manager.excludeNetworks(excludeNets, 100, 1000)
+
+	require.NoError(t, err)
+	require.Equal(t, 1001, manager.firstBypassRulePreference())
+	require.Equal(t, 1002, manager.gatewayTableRulePreference)
+	require.Equal(t, 1004, manager.fallthroughTableRulePreference)
+	mockHandle.AssertExpectations(t)
+}
+
+func TestNetlinkManager_UpdateRoutes_RemovesStaleRoutes(t *testing.T) {
+	mockHandle := &mockNetlinkHandle{}
+	manager := createTestNetlinkManager(mockHandle)
+
+	oldRoute := &net.IPNet{IP: net.ParseIP("10.0.0.0").To4(), Mask: net.CIDRMask(8, 32)}
+	keptRoute := &net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)}
+	manager.appliedRoutes = []*net.IPNet{oldRoute, keptRoute}
+
+	gateway := net.ParseIP("192.168.1.1")
+
+	mockHandle.On("RouteDel", &netlink.Route{Dst: oldRoute, Table: 100}).Return(nil).Once()
+	mockHandle.On("RouteReplace", &netlink.Route{
+		Dst:       keptRoute,
+		MultiPath: []*netlink.NexthopInfo{{Gw: gateway}},
+		Table:     100,
+	}).Return(nil)
+
+	err := manager.UpdateRoutes([]Route{{Destination: keptRoute, Nexthops: []Nexthop{{Gateway: gateway}}}})
+
+	require.NoError(t, err)
+	require.Equal(t, []*net.IPNet{keptRoute}, manager.appliedRoutes)
+	mockHandle.AssertExpectations(t)
+}
+
+func TestNetlinkManager_UpdateRoutes_StaleRouteAlreadyRemoved(t *testing.T) {
+	mockHandle := &mockNetlinkHandle{}
+	manager := createTestNetlinkManager(mockHandle)
+
+	oldRoute := &net.IPNet{IP: net.ParseIP("10.0.0.0").To4(), Mask: net.CIDRMask(8, 32)}
+	newRoute := &net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)}
+	manager.appliedRoutes = []*net.IPNet{oldRoute}
+
+	gateway := net.ParseIP("192.168.1.1")
+
+	mockHandle.On("RouteDel", &netlink.Route{Dst: oldRoute, Table: 100}).Return(syscall.ESRCH).Once()
+	mockHandle.On("RouteReplace", mock.AnythingOfType("*netlink.Route")).Return(nil)
+
+	err := manager.UpdateRoutes([]Route{{Destination: newRoute, Nexthops: []Nexthop{{Gateway: gateway}}}})
+
+	require.NoError(t, err)
+	mockHandle.AssertExpectations(t)
+}
+
+func TestNetlinkManager_UpdateExclusions(t *testing.T) {
+	tests := []struct {
+		name          string
+		currentNets   []*net.IPNet
+		newNets       []*net.IPNet
+		expectRebuild bool
+	}{
+		{
+			name:        "unchanged networks",
+			currentNets: []*net.IPNet{{IP: net.ParseIP("10.0.0.0").To4(), Mask: net.CIDRMask(8, 32)}},
+			newNets:     []*net.IPNet{{IP: net.ParseIP("10.0.0.0").To4(), Mask: net.CIDRMask(8, 32)}},
+		},
+		{
+			name:        "unchanged after reduction",
+			currentNets: []*net.IPNet{{IP: net.ParseIP("10.0.0.0").To4(), Mask: net.CIDRMask(8, 32)}},
+			newNets: []*net.IPNet{
+				{IP: net.ParseIP("10.0.0.0").To4(), Mask: net.CIDRMask(8, 32)},
+				{IP: net.ParseIP("10.1.0.0").To4(), Mask: net.CIDRMask(16, 32)},
+			},
+		},
+		{
+			name:        "added network",
+			currentNets: []*net.IPNet{{IP: net.ParseIP("10.0.0.0").To4(), Mask: net.CIDRMask(8, 32)}},
+			newNets: []*net.IPNet{
+				{IP: net.ParseIP("10.0.0.0").To4(), Mask: net.CIDRMask(8, 32)},
+				{IP: net.ParseIP("192.168.0.0").To4(), Mask: net.CIDRMask(16, 32)},
+			},
+			expectRebuild: true,
+		},
+		{
+			name:          "removed all networks",
+			currentNets:   []*net.IPNet{{IP: net.ParseIP("10.0.0.0").To4(), Mask: net.CIDRMask(8, 32)}},
+			newNets:       nil,
+			expectRebuild: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockHandle := &mockNetlinkHandle{}
+			manager := createTestNetlinkManager(mockHandle)
+			manager.excludeNets = tt.currentNets
+			manager.fallthroughTableRulePreference = 1000 + len(tt.currentNets) + 1
+			manager.gatewayTableRulePreference = manager.fallthroughTableRulePreference - 1
+
+			if tt.expectRebuild {
+				mockHandle.On("RuleList", netlink.FAMILY_V4).Return([]netlink.Rule{}, nil)
+				mockHandle.On("RuleAdd", mock.AnythingOfType("*netlink.Rule")).Return(nil).Times(len(tt.newNets) + 2)
+			}
+
+			err := manager.UpdateExclusions(tt.newNets)
+
+			require.NoError(t, err)
+			mockHandle.AssertExpectations(t)
+
+			if tt.expectRebuild {
+				require.Len(t, manager.excludeNets, len(tt.newNets))
+				require.Equal(t, 1000+len(tt.newNets)+1, manager.fallthroughTableRulePreference)
+				require.Equal(t, 100, manager.gatewayTableID)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package routes
+
+import (
+	"log/slog"
+
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/iputil"
+	"github.com/vishvananda/netlink"
+)
+
+// UpdateStats counts the route writes of an UpdateRoutes call. Routes that the kernel already has are not written
+// again, because every write is reported to route change listeners, and makes the kernel flush cached routes.
+type UpdateStats struct {
+	Applied int // Routes that were added or replaced
+	Skipped int // Routes that were unchanged since the previous update, and still match the kernel
+}
+
+// UpdateStatsManager extends Manager with statistics about the route writes of the last update
+type UpdateStatsManager interface {
+	Manager
+	// LastUpdateStats returns the route writes of the last UpdateRoutes call, including calls that failed
+	LastUpdateStats() UpdateStats
+}
+
+var _ UpdateStatsManager = (*NetlinkManager)(nil)
+
+// LastUpdateStats returns the route writes of the last UpdateRoutes call
+func (m *NetlinkManager) LastUpdateStats() UpdateStats {
+	return m.lastUpdateStats
+}
+
+// routeUpdate is the state of a single UpdateRoutes call
+type routeUpdate struct {
+	stats UpdateStats
+
+	// Routes of the gateway table by address family and destination. Listed on first use.
+	kernelRoutes map[int]map[string]netlink.Route
+	// Routes of the gateway table that use nexthop objects by address family and destination. Listed on first use.
+	kernelNexthopRoutes map[int]map[string]iputil.NexthopRoute
+
+	// Nexthop objects that are used by the updated routes
+	usedNexthops map[uint32]struct{}
+	// Routes of the main table without a gateway by address family, which gateways without an interface are reached
+	// through. Listed on first use.
+	connectedRoutes map[int][]netlink.Route
+}
+
+func newRouteUpdate() *routeUpdate {
+	return &routeUpdate{
+		kernelRoutes:        make(map[int]map[string]netlink.Route),
+		kernelNexthopRoutes: make(map[int]map[string]iputil.NexthopRoute),
+		usedNexthops:        make(map[uint32]struct{}),
+		connectedRoutes:     make(map[int][]netlink.Route),
+	}
+}
+
+// routeUnchanged returns whether the route was installed by a previous update, and the kernel still has it. Only
+// the gateway table is listed, once per address family and update, which is much cheaper than writing every route.
+func (m *NetlinkManager) routeUnchanged(route *netlink.Route, update *routeUpdate) bool {
+	installedRoute, ok := m.installedRoutes[route.Dst.String()]
+	if !ok || !routesEqual(*route, *installedRoute) {
+		return false
+	}
+
+	family := iputil.Family(route.Dst.IP)
+	kernelRoutes, ok := update.kernelRoutes[family]
+	if !ok {
+		kernelRoutes = make(map[string]netlink.Route)
+		err := m.handle.RouteListFilteredIter(family, &netlink.Route{Table: m.gatewayTableID}, netlink.RT_FILTER_TABLE, func(route netlink.Route) bool {
+			kernelRoutes[route.Dst.String()] = route
+			return true
+		})
+		if err != nil {
+			// The routes are written instead, which is always safe
+			slog.Debug("Failed to list routes, not skipping unchanged routes", "family", familyName(family), "error", err)
+			return false
+		}
+		update.kernelRoutes[family] = kernelRoutes
+	}
+
+	kernelRoute, ok := kernelRoutes[route.Dst.String()]
+	return ok && routesEqual(*route, kernelRoute)
+}
+
+// nexthopRouteUnchanged returns whether the route that uses a nexthop group was installed by a previous update, and
+// the kernel still has it
+func (m *NetlinkManager) nexthopRouteUnchanged(route *iputil.NexthopRoute, update *routeUpdate) bool {
+	installedRoute, ok := m.installedNexthopRoutes[route.Dst.String()]
+	if !ok || !nexthopRoutesEqual(*route, *installedRoute) {
+		return false
+	}
+
+	family := iputil.Family(route.Dst.IP)
+	kernelRoutes, ok := update.kernelNexthopRoutes[family]
+	if !ok {
+		routes, err := m.nexthopHandle.NexthopRouteList(family, m.gatewayTableID)
+		if err != nil {
+			slog.Debug("Failed to list routes, not skipping unchanged routes", "family", familyName(family), "error", err)
+			return false
+		}
+
+		kernelRoutes = make(map[string]iputil.NexthopRoute, len(routes))
+		for _, route := range routes {
+			kernelRoutes[route.Dst.String()] = route
+		}
+		update.kernelNexthopRoutes[family] = kernelRoutes
+	}
+
+	kernelRoute, ok := kernelRoutes[route.Dst.String()]
+	return ok && nexthopRoutesEqual(*route, kernelRoute)
+}
+
+// nexthopRoutesEqual returns whether both routes send traffic via the same nexthop group
+func nexthopRoutesEqual(desired, observed iputil.NexthopRoute) bool {
+	return desired.NexthopID == observed.NexthopID && desired.Src.Equal(observed.Src)
+}
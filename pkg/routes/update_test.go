@@ -0,0 +1,135 @@
+package routes
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/solidDoWant/infra-mk3/tooling/gateway-route-manager/pkg/iputil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+)
+
+var skippedRouteGateway = net.ParseIP("192.168.1.1")
+
+// skippedRoute returns the route that the manager installs for a default route via skippedRouteGateway
+func skippedRoute() *netlink.Route {
+	return &netlink.Route{
+		Dst:       defaultDestination,
+		MultiPath: []*netlink.NexthopInfo{{Gw: skippedRouteGateway}},
+		Table:     100,
+	}
+}
+
+// installSkippedRoute installs a default route via skippedRouteGateway
+func installSkippedRoute(t *testing.T, mockHandle *mockNetlinkHandle, manager *NetlinkManager) {
+	t.Helper()
+
+	call := mockHandle.On("RouteReplace", skippedRoute()).Return(nil).Once()
+	require.NoError(t, manager.UpdateRoutes([]Route{{Destination: defaultDestination, Nexthops: []Nexthop{{Gateway: skippedRouteGateway}}}}))
+	mockHandle.AssertExpectations(t)
+	call.Unset()
+
+	assert.Equal(t, UpdateStats{Applied: 1}, manager.LastUpdateStats())
+}
+
+func TestNetlinkManager_UpdateRoutes_SkipsUnchangedRoutes(t *testing.T) {
+	mockHandle := &mockNetlinkHandle{}
+	manager := createTestNetlinkManager(mockHandle)
+
+	installSkippedRoute(t, mockHandle, manager)
+
+	// The kernel lists single nexthop routes without multipath attributes
+	kernelRoutes := []netlink.Route{{Dst: defaultDestination, Gw: skippedRouteGateway, LinkIndex: 2, Table: 100}}
+	mockHandle.On("RouteListFilteredIter", netlink.FAMILY_V4, &netlink.Route{Table: 100}, uint64(netlink.RT_FILTER_TABLE), mock.Anything).Return(nil, kernelRoutes).Once()
+
+	err := manager.UpdateRoutes([]Route{{Destination: defaultDestination, Nexthops: []Nexthop{{Gateway: skippedRouteGateway}}}})
+
+	require.NoError(t, err)
+	mockHandle.AssertExpectations(t)
+	assert.Equal(t, UpdateStats{Skipped: 1}, manager.LastUpdateStats())
+}
+
+func TestNetlinkManager_UpdateRoutes_WritesDriftedRoutes(t *testing.T) {
+	tests := []struct {
+		name         string
+		kernelRoutes []netlink.Route
+		listErr      error
+	}{
+		{
+			name: "route removed by someone else",
+		},
+		{
+			name:         "route modified by someone else",
+			kernelRoutes: []netlink.Route{{Dst: defaultDestination, Gw: net.ParseIP("192.168.1.254"), Table: 100}},
+		},
+		{
+			name:    "routes cannot be listed",
+			listErr: errors.New("netlink error"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockHandle := &mockNetlinkHandle{}
+			manager := createTestNetlinkManager(mockHandle)
+
+			installSkippedRoute(t, mockHandle, manager)
+
+			mockHandle.On("RouteListFilteredIter", netlink.FAMILY_V4, &netlink.Route{Table: 100}, uint64(netlink.RT_FILTER_TABLE), mock.Anything).Return(tt.listErr, tt.kernelRoutes).Once()
+			mockHandle.On("RouteReplace", skippedRoute()).Return(nil).Once()
+
+			err := manager.UpdateRoutes([]Route{{Destination: defaultDestination, Nexthops: []Nexthop{{Gateway: skippedRouteGateway}}}})
+
+			require.NoError(t, err)
+			mockHandle.AssertExpectations(t)
+			assert.Equal(t, UpdateStats{Applied: 1}, manager.LastUpdateStats())
+		})
+	}
+}
+
+func TestNetlinkManager_UpdateRoutes_WritesChangedRoutes(t *testing.T) {
+	mockHandle := &mockNetlinkHandle{}
+	manager := createTestNetlinkManager(mockHandle)
+
+	installSkippedRoute(t, mockHandle, manager)
+
+	// Routes that differ from the installed route are written without listing the kernel routes
+	newGateway := net.ParseIP("192.168.1.254")
+	mockHandle.On("RouteReplace", &netlink.Route{
+		Dst:       defaultDestination,
+		MultiPath: []*netlink.NexthopInfo{{Gw: newGateway}},
+		Table:     100,
+	}).Return(nil).Once()
+
+	err := manager.UpdateRoutes([]Route{{Destination: defaultDestination, Nexthops: []Nexthop{{Gateway: newGateway}}}})
+
+	require.NoError(t, err)
+	mockHandle.AssertExpectations(t)
+	assert.Equal(t, UpdateStats{Applied: 1}, manager.LastUpdateStats())
+}
+
+// TestNetlinkManager_UpdateRoutes_DryRun tests that routes recorded in dry run mode are compared against the recorded
+// state, so that they are not planned again on every update
+func TestNetlinkManager_UpdateRoutes_DryRun(t *testing.T) {
+	mockHandle := &mockNetlinkHandle{}
+	recorder := iputil.NewRecordingNetlinkHandle(mockHandle)
+	manager := createTestNetlinkManager(mockHandle)
+	manager.handle = recorder
+
+	// The kernel does not have the route, because it was only recorded
+	mockHandle.On("RouteListFilteredIter", netlink.FAMILY_V4, &netlink.Route{Table: 100}, uint64(netlink.RT_FILTER_TABLE), mock.Anything).Return(nil, nil)
+
+	desiredRoutes := []Route{{Destination: defaultDestination, Nexthops: []Nexthop{{Gateway: skippedRouteGateway}}}}
+	require.NoError(t, manager.UpdateRoutes(desiredRoutes))
+	assert.Equal(t, UpdateStats{Applied: 1}, manager.LastUpdateStats())
+
+	require.NoError(t, manager.UpdateRoutes(desiredRoutes))
+	assert.Equal(t, UpdateStats{Skipped: 1}, manager.LastUpdateStats())
+
+	operations := recorder.Operations()
+	require.Len(t, operations, 1)
+	assert.Equal(t, skippedRoute().String(), operations[0].Object)
+}